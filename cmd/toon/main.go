@@ -0,0 +1,306 @@
+// Command toon usa el conversor desde la línea de comandos, sin el servidor
+// HTTP:
+//
+//	toon convert [flags] [fichero...]   convierte JSON a TOON
+//	toon fix [fichero...]               corrige el JSON, como /api/fix-json
+//	toon count [flags] [fichero...]     compara los tokens del JSON y del TOON
+//
+// Sin ficheros (o con "-") lee la entrada estándar. Los resultados van a la
+// salida estándar y los avisos y errores a la de errores, así que se puede
+// encadenar: toon fix < datos.json | toon convert -delimiter tab.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"toon-converter/tokens"
+	"toon-converter/toon"
+)
+
+// Códigos de salida: exitError si falla una entrada, exitUsage si los
+// argumentos no son válidos.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+const usage = `Uso:
+  toon convert [flags] [fichero...]   convierte JSON a TOON
+  toon fix [fichero...]               corrige el JSON
+  toon count [flags] [fichero...]     compara los tokens del JSON y del TOON
+
+Sin ficheros lee la entrada estándar. "toon <comando> -h" muestra los flags.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// input es un documento de entrada: un fichero o la entrada estándar ("-").
+type input struct {
+	name string
+	data string
+}
+
+// run ejecuta el comando de args y devuelve el código de salida.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "convert":
+		return runConvert(args[1:], stdin, stdout, stderr)
+	case "fix":
+		return runFix(args[1:], stdin, stdout, stderr)
+	case "count":
+		return runCount(args[1:], stdin, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "toon: comando desconocido %q\n\n%s", args[0], usage)
+	return exitUsage
+}
+
+// encoderFlags registra en fs los flags del encoder y devuelve una función
+// que, una vez leídos, comprueba las opciones y las devuelve junto con el
+// decodificador de JSON que les corresponde: con -key-sort none se conserva
+// el orden de las claves. El encoder de cada documento lo crea newEncoder.
+func encoderFlags(fs *flag.FlagSet) func() (toon.TOONOptions, jsonParser, error) {
+	delimiter := fs.String("delimiter", ",", `delimitador de arrays: ",", "|", "tab" o "auto" (el que dé menos tokens)`)
+	indent := fs.Int("indent", 2, "espacios por nivel de indentación")
+	lengthMarker := fs.Bool("length-marker", false, `escribe la longitud de los arrays como [#N]`)
+	keySort := fs.String("key-sort", "asc", `orden de las claves: "asc", "asc-ci", "natural" o "none" (el de la entrada)`)
+
+	return func() (toon.TOONOptions, jsonParser, error) {
+		if *delimiter == "tab" {
+			*delimiter = "\t"
+		}
+		opts := toon.TOONOptions{
+			Delimiter:    *delimiter,
+			Indent:       *indent,
+			LengthMarker: *lengthMarker,
+			KeySort:      *keySort,
+		}
+		// Con auto se comprueba el resto de opciones con cualquier delimitador
+		check := opts
+		if check.Delimiter == "auto" {
+			check.Delimiter = ","
+		}
+		_, err := toon.NewTOONEncoderWithOptions(check)
+		parse := parseJSON
+		if *keySort == "none" {
+			parse = parseOrderedJSON
+		}
+		return opts, parse, err
+	}
+}
+
+// newEncoder crea el encoder de un documento con opts, ya comprobadas por
+// encoderFlags. Con -delimiter auto usa el delimitador que da menos tokens
+// para data según countTokens.
+func newEncoder(opts toon.TOONOptions, data interface{}, countTokens func(string) int) *toon.TOONEncoder {
+	if opts.Delimiter == "auto" {
+		opts.Delimiter, _ = toon.BestDelimiter(data, opts, countTokens)
+	}
+	encoder, _ := toon.NewTOONEncoderWithOptions(opts)
+	return encoder
+}
+
+// parseFlags lee los flags de un comando. Devuelve false y el código de
+// salida si no hay que seguir (-h o flags inválidos).
+func parseFlags(fs *flag.FlagSet, args []string, stderr io.Writer) (int, bool) {
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+func runConvert(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("toon convert", flag.ContinueOnError)
+	encoderOptions := encoderFlags(fs)
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	opts, parse, err := encoderOptions()
+	if err != nil {
+		fmt.Fprintf(stderr, "toon convert: %v\n", err)
+		return exitUsage
+	}
+
+	inputs, err := readInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "toon convert: %v\n", err)
+		return exitError
+	}
+
+	code := exitOK
+	for i, in := range inputs {
+		data, err := parse(in)
+		if err != nil {
+			fmt.Fprintf(stderr, "toon convert: %v\n", err)
+			code = exitError
+			continue
+		}
+		encoder := newEncoder(opts, data, func(text string) int { return tokens.Count(text, tokens.DefaultEncoding) })
+		encoded, err := encoder.Encode(data)
+		if err != nil {
+			fmt.Fprintf(stderr, "toon convert: %s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		// Con varios ficheros cada documento va precedido de su nombre
+		if len(inputs) > 1 {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			fmt.Fprintf(stdout, "# %s\n", in.name)
+		}
+		fmt.Fprintln(stdout, encoded)
+	}
+	return code
+}
+
+func runFix(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("toon fix", flag.ContinueOnError)
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+
+	inputs, err := readInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "toon fix: %v\n", err)
+		return exitError
+	}
+
+	code := exitOK
+	for _, in := range inputs {
+		fixed, changes := toon.FixJSON(in.data)
+		if !json.Valid([]byte(fixed)) {
+			fmt.Fprintf(stderr, "toon fix: %s: no se pudo corregir el JSON\n", in.name)
+			code = exitError
+			continue
+		}
+		for _, change := range changes {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, change)
+		}
+		fmt.Fprintln(stdout, fixed)
+	}
+	return code
+}
+
+func runCount(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("toon count", flag.ContinueOnError)
+	encoderOptions := encoderFlags(fs)
+	model := fs.String("model", "", "modelo de OpenAI cuyo tokenizer se usa (o200k_base por defecto)")
+	if code, ok := parseFlags(fs, args, stderr); !ok {
+		return code
+	}
+	opts, parse, err := encoderOptions()
+	if err != nil {
+		fmt.Fprintf(stderr, "toon count: %v\n", err)
+		return exitUsage
+	}
+	encoding, err := tokens.EncodingForModel(*model)
+	if err != nil {
+		fmt.Fprintf(stderr, "toon count: %v\n", err)
+		return exitUsage
+	}
+
+	inputs, err := readInputs(fs.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "toon count: %v\n", err)
+		return exitError
+	}
+
+	code := exitOK
+	for _, in := range inputs {
+		data, err := parse(in)
+		if err != nil {
+			fmt.Fprintf(stderr, "toon count: %v\n", err)
+			code = exitError
+			continue
+		}
+		count := func(text string) int { return tokens.Count(text, encoding) }
+		jsonTokens := count(in.data)
+		encoded, err := newEncoder(opts, data, count).Encode(data)
+		if err != nil {
+			fmt.Fprintf(stderr, "toon count: %s: %v\n", in.name, err)
+			code = exitError
+			continue
+		}
+		toonTokens := count(encoded)
+
+		saved := 0.0
+		if jsonTokens > 0 {
+			saved = math.Round(float64(jsonTokens-toonTokens)/float64(jsonTokens)*10000) / 100
+		}
+		fmt.Fprintf(stdout, "%s\tjson=%d\ttoon=%d\tsaved=%d (%.2f%%)\n", in.name, jsonTokens, toonTokens, jsonTokens-toonTokens, saved)
+	}
+	return code
+}
+
+// readInputs lee los ficheros de names, o la entrada estándar si no hay
+// ninguno. "-" también es la entrada estándar.
+func readInputs(names []string, stdin io.Reader) ([]input, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	inputs := make([]input, 0, len(names))
+	for _, name := range names {
+		var data []byte
+		var err error
+		if name == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input{name: name, data: string(data)})
+	}
+	return inputs, nil
+}
+
+// jsonParser decodifica el JSON de una entrada.
+type jsonParser func(in input) (interface{}, error)
+
+// parseJSON decodifica el JSON de una entrada, con los números como
+// json.Number para no redondear los enteros grandes. Si no es válido sugiere
+// pasarlo antes por "toon fix".
+func parseJSON(in input) (interface{}, error) {
+	data, err := toon.DecodeJSON(in.data, false)
+	if err != nil {
+		return nil, invalidJSON(in, err)
+	}
+	return data, nil
+}
+
+// parseOrderedJSON es parseJSON conservando el orden de las claves.
+func parseOrderedJSON(in input) (interface{}, error) {
+	data, err := toon.DecodeJSON(in.data, true)
+	if err != nil {
+		return nil, invalidJSON(in, err)
+	}
+	return data, nil
+}
+
+// invalidJSON es el error de una entrada que no es JSON válido.
+func invalidJSON(in input, err error) error {
+	return fmt.Errorf("%s: JSON inválido: %v (prueba con toon fix)", in.name, err)
+}
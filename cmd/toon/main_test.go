@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runWith(args []string, stdin string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestConvert(t *testing.T) {
+	input := `{"users": [{"id": 1, "name": "Alice"}, {"id": 2, "name": "Bob"}]}`
+
+	code, out, _ := runWith([]string{"convert"}, input)
+	if expected := "users[2]{id,name}:\n    1,Alice\n    2,Bob\n"; code != exitOK || out != expected {
+		t.Errorf("Expected:\n%s\nGot (%d):\n%s", expected, code, out)
+	}
+
+	code, out, _ = runWith([]string{"convert", "-delimiter", "tab", "-indent", "4", "-length-marker"}, input)
+	if expected := "users[#2 ]{id name}:\n        1\tAlice\n        2\tBob\n"; code != exitOK || out != expected {
+		t.Errorf("Expected:\n%q\nGot (%d):\n%q", expected, code, out)
+	}
+
+	code, out, _ = runWith([]string{"convert", "-key-sort", "none"}, `{"z": 9007199254740993, "a": {"y": 2, "b": 3}}`)
+	if expected := "z: 9007199254740993\na:\n  y: 2\n  b: 3\n"; code != exitOK || out != expected {
+		t.Errorf("Expected:\n%s\nGot (%d):\n%s", expected, code, out)
+	}
+
+	if code, _, stderr := runWith([]string{"convert"}, `{"a": 1,}`); code != exitError || !strings.Contains(stderr, "toon fix") {
+		t.Errorf("Expected an error suggesting toon fix, got %d %q", code, stderr)
+	}
+	if code, _, _ := runWith([]string{"convert", "-delimiter", ";"}, input); code != exitUsage {
+		t.Errorf("Expected usage error for an invalid delimiter, got %d", code)
+	}
+
+	// Con auto, valores con comas no obligan a entrecomillar
+	code, out, _ = runWith([]string{"convert", "-delimiter", "auto"}, `{"users": [{"id": 1, "name": "Smith, John"}, {"id": 2, "name": "Doe, Jane"}]}`)
+	if code != exitOK || strings.Contains(out, `"`) {
+		t.Errorf("Expected an unquoted table with delimiter auto, got (%d):\n%s", code, out)
+	}
+}
+
+func TestConvert_Files(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	os.WriteFile(a, []byte(`{"x": 1}`), 0o644)
+	os.WriteFile(b, []byte(`[1, 2]`), 0o644)
+
+	code, out, _ := runWith([]string{"convert", a, b}, "")
+	if expected := "# " + a + "\nx: 1\n\n# " + b + "\n[2]: 1,2\n"; code != exitOK || out != expected {
+		t.Errorf("Expected:\n%s\nGot (%d):\n%s", expected, code, out)
+	}
+
+	if code, _, _ := runWith([]string{"convert", filepath.Join(dir, "missing.json")}, ""); code != exitError {
+		t.Errorf("Expected error for a missing file, got %d", code)
+	}
+}
+
+func TestFix(t *testing.T) {
+	code, out, stderr := runWith([]string{"fix"}, `{"a": 1, "b": [1, 2,],}`)
+	if code != exitOK || out != "{\"a\": 1, \"b\": [1, 2]}\n" {
+		t.Errorf("Unexpected output (%d): %q", code, out)
+	}
+	if !strings.Contains(stderr, "-: Eliminada coma") {
+		t.Errorf("Expected the changes on stderr, got %q", stderr)
+	}
+
+	if code, _, _ := runWith([]string{"fix"}, `{"a": }`); code != exitError {
+		t.Errorf("Expected error for unfixable JSON, got %d", code)
+	}
+}
+
+func TestCount(t *testing.T) {
+	input := `[{"id": 1, "name": "Alice"}, {"id": 2, "name": "Bob"}]`
+
+	code, out, _ := runWith([]string{"count", "-model", "gpt-4"}, input)
+	if code != exitOK || !strings.HasPrefix(out, "-\tjson=") || !strings.Contains(out, "\ttoon=") {
+		t.Errorf("Unexpected output (%d): %q", code, out)
+	}
+
+	if code, _, _ := runWith([]string{"count", "-model", "llama-3"}, input); code != exitUsage {
+		t.Errorf("Expected usage error for an unknown model, got %d", code)
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	if code, _, stderr := runWith(nil, ""); code != exitUsage || !strings.Contains(stderr, "Uso:") {
+		t.Errorf("Expected usage, got %d %q", code, stderr)
+	}
+	if code, _, _ := runWith([]string{"encode"}, ""); code != exitUsage {
+		t.Errorf("Expected usage error for an unknown command, got %d", code)
+	}
+	if code, _, _ := runWith([]string{"convert", "-h"}, ""); code != exitOK {
+		t.Errorf("Expected -h to exit 0, got %d", code)
+	}
+}
@@ -2,10 +2,15 @@ module toon-converter
 
 go 1.24.1
 
-require golang.org/x/time v0.14.0
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/pkoukk/tiktoken-go v0.1.8
+	golang.org/x/time v0.14.0
+	google.golang.org/protobuf v1.36.11
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/dlclark/regexp2 v1.10.0 // indirect
 	github.com/google/uuid v1.3.0 // indirect
-	github.com/pkoukk/tiktoken-go v0.1.8 // indirect
 )
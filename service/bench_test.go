@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+func BenchmarkEncode_SimpleObject(b *testing.B) {
+	input := map[string]interface{}{
+		"id":     float64(123),
+		"name":   "Alice",
+		"email":  "alice@example.com",
+		"active": true,
+		"score":  98.5,
+	}
+
+	encoder := toon.NewTOONEncoder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encoder.Encode(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode_WideTabular(b *testing.B) {
+	rows := make([]interface{}, 1000)
+	for i := range rows {
+		row := make(map[string]interface{}, 12)
+		for c := 0; c < 10; c++ {
+			row[fmt.Sprintf("field%02d", c)] = fmt.Sprintf("value %d-%d", i, c)
+		}
+		row["id"] = float64(i)
+		row["note"] = "needs, quoting: yes"
+		rows[i] = row
+	}
+	input := map[string]interface{}{"rows": rows}
+
+	encoder := toon.NewTOONEncoder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encoder.Encode(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncode_DeeplyNested(b *testing.B) {
+	var input interface{} = map[string]interface{}{"leaf": "value", "n": float64(1)}
+	for depth := 0; depth < 50; depth++ {
+		input = map[string]interface{}{
+			"level": fmt.Sprintf("level %d", depth),
+			"tags":  []interface{}{"a", "b", "c"},
+			"child": input,
+		}
+	}
+
+	encoder := toon.NewTOONEncoder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encoder.Encode(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"toon-converter/toon"
+)
+
+// convertAPI convierte a TOON el cuerpo de la petición, que es directamente
+// el JSON a convertir y no un string dentro de {"json": "..."}: el cliente no
+// tiene que escapar el documento ni el servidor decodificarlo dos veces. Los
+// números se leen con UseNumber, así que los enteros grandes no pierden
+// precisión. Las opciones van en la query (ver convertOptions). No se corrige
+// JSON inválido.
+//
+// Con from y to en la query convierte también YAML a TOON y TOON a YAML (ver
+// convertFormats). El ahorro compara siempre el lado TOON con el otro
+// formato, que va en el campo "json" de tokenSavings.
+func convertAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		YAML          string        `json:"yaml,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	from, to, err := convertFormats(r.URL.Query())
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeInvalidOptions})
+		return
+	}
+
+	body, ok := readRawBody(w, r, strings.ToUpper(from))
+	if !ok {
+		return
+	}
+
+	opts, err := convertOptions(r.URL.Query())
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
+	}
+	encoder, err := toon.NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		if to == "yaml" {
+			value, _, err := toon.NewTOONDecoder().DecodeWithOptions(string(body), toon.DecodeOptions{Strict: true, UseNumber: true})
+			if err != nil {
+				return response{Error: fmt.Sprintf("TOON inválido: %v", err), Code: codeInvalidTOON}
+			}
+			yaml, err := toon.EncodeYAML(value, opts.Indent)
+			if err != nil {
+				return response{Error: err.Error(), Code: codeInternal}
+			}
+			return response{YAML: yaml, TokenSavings: calculateTokenSavings(yaml, string(body)), FormatVersion: FormatVersion}
+		}
+
+		var data interface{}
+		var err error
+		if from == "yaml" {
+			if data, err = toon.DecodeYAML(string(body)); err != nil {
+				return response{Error: fmt.Sprintf("YAML inválido: %v", err), Code: codeInvalidYAML}
+			}
+		} else {
+			dec := json.NewDecoder(bytes.NewReader(body))
+			dec.UseNumber()
+
+			// Con preserveKeyOrder o keySort "none" se conserva el orden de las
+			// claves, como en /api/json-to-toon
+			if opts.PreserveKeyOrder || opts.KeySort == "none" {
+				data, err = toon.DecodeOrderedValue(dec)
+			} else {
+				err = dec.Decode(&data)
+			}
+			if err == nil {
+				if _, extra := dec.Token(); extra != io.EOF {
+					err = fmt.Errorf("contenido inesperado después del valor JSON")
+				}
+			}
+			if err != nil {
+				return response{Error: fmt.Sprintf("JSON inválido: %v", err), Code: codeInvalidJSON}
+			}
+		}
+
+		if _, err := encoder.CheckLimits(data); err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+
+		toon, err := encoder.Encode(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+		return response{Toon: toon, TokenSavings: calculateTokenSavings(string(body), toon), FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readRawBody lee el cuerpo de una petición cuyo documento va sin envolver,
+// aplicando los mismos límites que decodeRequest y checkInputLimit. Si falla
+// ya ha escrito la respuesta de error.
+func readRawBody(w http.ResponseWriter, r *http.Request, label string) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Cuerpo de la petición demasiado grande (máximo 1MB)")
+			return nil, false
+		}
+		writeAPIError(w, http.StatusBadRequest, codeInvalidBody, "Error leyendo el body")
+		return nil, false
+	}
+	if !checkInputLimit(w, label, string(body)) {
+		return nil, false
+	}
+	return body, true
+}
+
+// convertFormats lee from y to de la query de /api/convert: "json" (por
+// defecto) o "yaml" a "toon" (por defecto), o "toon" a "yaml".
+func convertFormats(query url.Values) (from, to string, err error) {
+	from, to = query.Get("from"), query.Get("to")
+	if from == "" {
+		from = "json"
+	}
+	if to == "" {
+		to = "toon"
+	}
+	switch {
+	case to == "toon" && (from == "json" || from == "yaml"):
+	case to == "yaml" && from == "toon":
+	default:
+		return from, to, fmt.Errorf("conversión no soportada: de %q a %q (se admite json o yaml a toon, y toon a yaml)", from, to)
+	}
+	return from, to, nil
+}
+
+// convertOptions lee las opciones de /api/convert de la query: delimiter
+// (",", "|" o "tab"), indent, lengthMarker, keySort y preserveKeyOrder. Lo que
+// no se indica toma el valor por defecto del servidor.
+func convertOptions(query url.Values) (toon.TOONOptions, error) {
+	opts := toon.TOONOptions{
+		Delimiter: query.Get("delimiter"),
+		KeySort:   query.Get("keySort"),
+	}
+	if opts.Delimiter == "tab" {
+		opts.Delimiter = "\t"
+	}
+	if indent := query.Get("indent"); indent != "" {
+		n, err := strconv.Atoi(indent)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("indent inválido: %q (debe ser un entero positivo)", indent)
+		}
+		opts.Indent = n
+	}
+	if preserve := query.Get("preserveKeyOrder"); preserve != "" {
+		b, err := strconv.ParseBool(preserve)
+		if err != nil {
+			return opts, fmt.Errorf("preserveKeyOrder inválido: %q (debe ser true o false)", preserve)
+		}
+		opts.PreserveKeyOrder = b
+	}
+
+	var lengthMarker *bool
+	if marker := query.Get("lengthMarker"); marker != "" {
+		b, err := strconv.ParseBool(marker)
+		if err != nil {
+			return opts, fmt.Errorf("lengthMarker inválido: %q (debe ser true o false)", marker)
+		}
+		lengthMarker = &b
+	}
+	applyDefaultOptions(&opts, lengthMarker)
+	return opts, nil
+}
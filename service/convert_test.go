@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+func TestTOONEncoder_JSONNumber(t *testing.T) {
+	tests := []struct {
+		input    json.Number
+		expected string
+	}{
+		{"9007199254740993", "9007199254740993"},
+		{"-12345678901234567890", "-12345678901234567890"},
+		{"-0", "0"},
+		{"1.50", "1.5"},
+		{"1e3", "1000"},
+	}
+
+	encoder := toon.NewTOONEncoder()
+	for _, tt := range tests {
+		if result := mustEncode(t, encoder, tt.input); result != tt.expected {
+			t.Errorf("Encode(%s): expected %q, got %q", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestConvertAPI(t *testing.T) {
+	// El body es el propio JSON; los enteros grandes no pasan por float64
+	_, resp := postJSON(t, convertAPI, "/api/convert", `{"users": [{"id": 9007199254740993, "name": "Alice"}]}`)
+	if resp["toon"] != "users[1]{id,name}:\n    9007199254740993,Alice" || resp["formatVersion"] != FormatVersion {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	_, resp = postJSON(t, convertAPI, "/api/convert?delimiter=tab&indent=4&lengthMarker=true&keySort=none", `{"b": [1, 2], "a": 1}`)
+	if resp["toon"] != "b[#2 ]: 1\t2\na: 1" {
+		t.Errorf("Expected the query options to apply, got %q", resp["toon"])
+	}
+
+	tests := []struct {
+		query string
+		body  string
+		code  errorCode
+	}{
+		{"", `{"a": `, codeInvalidJSON},
+		{"", `{"a": 1} {"b": 2}`, codeInvalidJSON},
+		{"?delimiter=%3B", `{}`, codeInvalidDelimiter},
+		{"?indent=-1", `{}`, codeInvalidOptions},
+		{"?lengthMarker=maybe", `{}`, codeInvalidOptions},
+		{"?from=toon", `a: 1`, codeInvalidOptions},
+		{"?to=xml", `{}`, codeInvalidOptions},
+		{"?from=yaml", "a: [1", codeInvalidYAML},
+		{"?from=toon&to=yaml", "items[3]: 1,2", codeInvalidTOON},
+	}
+	for _, tt := range tests {
+		if _, resp := postJSON(t, convertAPI, "/api/convert"+tt.query, tt.body); resp["code"] != string(tt.code) || resp["error"] == nil {
+			t.Errorf("%s %s: expected code %s, got %v", tt.query, tt.body, tt.code, resp)
+		}
+	}
+
+	if status, resp := postJSON(t, convertAPI, "/api/convert", strings.Repeat(" ", maxPayloadSize+1)); status != http.StatusRequestEntityTooLarge || resp["code"] != string(codePayloadTooLarge) {
+		t.Errorf("Expected 413 for a large body, got %d %v", status, resp)
+	}
+}
+
+func TestConvertAPI_YAML(t *testing.T) {
+	toonDoc := "id: 9007199254740993\nname: \"123\"\nusers[2]{active,name}:\n    true,Alice\n    null,Bob\nzip: \"08001\""
+	expected := "id: 9007199254740993\n" +
+		"name: \"123\"\n" +
+		"users:\n" +
+		"    - active: true\n" +
+		"      name: Alice\n" +
+		"    - active: null\n" +
+		"      name: Bob\n" +
+		"zip: \"08001\"\n"
+	_, resp := postJSON(t, convertAPI, "/api/convert?from=toon&to=yaml&indent=4", toonDoc)
+	if resp["yaml"] != expected || resp["toon"] != nil || resp["tokenSavings"] == nil {
+		t.Errorf("Expected YAML:\n%s\ngot: %v", expected, resp)
+	}
+
+	// Y de vuelta: el YAML generado vuelve al mismo TOON
+	_, resp = postJSON(t, convertAPI, "/api/convert?from=yaml&indent=2", expected)
+	if resp["toon"] != toonDoc {
+		t.Errorf("Expected the YAML to convert back to:\n%s\ngot: %v", toonDoc, resp)
+	}
+}
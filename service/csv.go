@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"toon-converter/toon"
+)
+
+func csvToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		CSV          string `json:"csv"`
+		Separator    string `json:"separator,omitempty"` // separador del CSV: "," (por defecto), ";", "|" o "\t" para TSV
+		Name         string `json:"name,omitempty"`      // clave del array; vacío = array en la raíz
+		Delimiter    string `json:"delimiter,omitempty"`
+		LengthMarker bool   `json:"lengthMarker,omitempty"`
+		Indent       int    `json:"indent,omitempty"`
+	}
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "CSV", req.CSV) {
+		return
+	}
+
+	comma, err := csvSeparator(req.Separator)
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeInvalidOptions})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		opts := toon.TOONOptions{
+			Delimiter:    req.Delimiter,
+			LengthMarker: req.LengthMarker,
+			Indent:       req.Indent,
+			RootKey:      req.Name,
+		}
+		if _, err := toon.NewTOONEncoderWithOptions(opts); err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+		toon, err := toon.EncodeCSV(req.CSV, comma, opts)
+		if err != nil {
+			return response{Error: fmt.Sprintf("CSV inválido: %v", err), Code: codeInvalidCSV}
+		}
+
+		return response{Toon: toon, TokenSavings: calculateTokenSavings(req.CSV, toon), FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// toonToCSVAPI extrae como CSV los arrays tabulares de un documento TOON o
+// JSON (ver TOONEncoder.ExtractCSVTables), uno por tabla, para abrirlos en una
+// hoja de cálculo. Con JSON las columnas siguen el orden del documento; el
+// decoder TOON no lo conserva y las ordena.
+func toonToCSVAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		Toon      string `json:"toon,omitempty"`
+		JSON      string `json:"json,omitempty"`
+		Separator string `json:"separator,omitempty"` // separador del CSV: "," (por defecto), ";", "|" o "\t"
+	}
+	type response struct {
+		Tables []toon.CSVTable `json:"tables,omitempty"`
+		Error  string          `json:"error,omitempty"`
+		Code   errorCode       `json:"code,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if (req.Toon == "") == (req.JSON == "") {
+		writeAPIError(w, http.StatusBadRequest, codeInvalidBody, "Se necesita toon o json, no ambos")
+		return
+	}
+	if !checkInputLimit(w, "Documento", req.Toon+req.JSON) {
+		return
+	}
+
+	comma, err := csvSeparator(req.Separator)
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeInvalidOptions})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		var data interface{}
+		var err error
+		if req.Toon != "" {
+			if data, err = toon.NewTOONDecoder().Decode(req.Toon); err != nil {
+				return response{Error: fmt.Sprintf("TOON inválido: %v", err), Code: codeInvalidTOON}
+			}
+		} else if data, err = toon.DecodeJSON(req.JSON, true); err != nil {
+			return response{Error: fmt.Sprintf("JSON inválido: %v", err), Code: codeInvalidJSON}
+		}
+
+		encoder, _ := toon.NewTOONEncoderWithOptions(toon.TOONOptions{KeySort: "none"})
+		tables, err := encoder.ExtractCSVTables(data, comma)
+		if err != nil {
+			return response{Error: err.Error(), Code: codeInternal}
+		}
+		return response{Tables: tables}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// csvSeparator valida el separador de un CSV; "" es la coma.
+func csvSeparator(separator string) (rune, error) {
+	switch separator {
+	case "":
+		return ',', nil
+	case ",", ";", "|", "\t":
+		r, _ := utf8.DecodeRuneInString(separator)
+		return r, nil
+	}
+	return 0, errors.New(`invalid separator: must be ",", ";", "|" or "\t"`)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCSVToToonAPI(t *testing.T) {
+	_, resp := postJSON(t, csvToToonAPI, "/api/csv-to-toon", map[string]interface{}{"csv": "sku\tqty\nA1\t2\nB2\t1", "separator": "\t", "name": "items"})
+	if resp["toon"] != "items[2]{sku,qty}:\n    A1,2\n    B2,1" || resp["tokenSavings"] == nil {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	if _, resp := postJSON(t, csvToToonAPI, "/api/csv-to-toon", map[string]interface{}{"csv": "a,b\n1"}); resp["code"] != string(codeInvalidCSV) {
+		t.Errorf("Expected code INVALID_CSV, got %v", resp)
+	}
+	if status, resp := postJSON(t, csvToToonAPI, "/api/csv-to-toon", map[string]interface{}{"csv": "a\n1", "separator": ":"}); status != http.StatusOK || resp["code"] != string(codeInvalidOptions) {
+		t.Errorf("Expected 200 INVALID_OPTIONS, got %d %v", status, resp)
+	}
+	if _, resp := postJSON(t, csvToToonAPI, "/api/csv-to-toon", map[string]interface{}{"csv": "a\n1", "delimiter": ";"}); resp["code"] != string(codeInvalidDelimiter) {
+		t.Errorf("Expected code INVALID_DELIMITER, got %v", resp)
+	}
+}
+
+func TestToonToCSVAPI(t *testing.T) {
+	_, resp := postJSON(t, toonToCSVAPI, "/api/toon-to-csv", `{"toon": "team: core\nusers[2]{name,id}:\n  Ana,1\n  Luis,2", "separator": ";"}`)
+	tables, _ := resp["tables"].([]interface{})
+	if len(tables) != 1 {
+		t.Fatalf("Expected one table, got %v", resp)
+	}
+	if table := tables[0].(map[string]interface{}); table["path"] != "users" || table["rows"] != 2.0 || table["csv"] != "id;name\n1;Ana\n2;Luis\n" {
+		t.Errorf("Unexpected table: %v", table)
+	}
+
+	// Con JSON las columnas siguen el orden del documento
+	_, resp = postJSON(t, toonToCSVAPI, "/api/toon-to-csv", `{"json": "[{\"name\": \"Ana\", \"id\": 1}]"}`)
+	if tables, _ := resp["tables"].([]interface{}); len(tables) != 1 || tables[0].(map[string]interface{})["csv"] != "name,id\nAna,1\n" {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	tests := []struct {
+		body   string
+		status int
+		code   errorCode
+	}{
+		{`{}`, http.StatusBadRequest, codeInvalidBody},
+		{`{"toon": "a: 1", "json": "{}"}`, http.StatusBadRequest, codeInvalidBody},
+		{`{"json": "{}", "separator": ":"}`, http.StatusOK, codeInvalidOptions},
+		{`{"json": "{"}`, http.StatusOK, codeInvalidJSON},
+		{`{"toon": "items[3]: 1,2"}`, http.StatusOK, codeInvalidTOON},
+	}
+	for _, tt := range tests {
+		if status, resp := postJSON(t, toonToCSVAPI, "/api/toon-to-csv", tt.body); status != tt.status || resp["code"] != string(tt.code) {
+			t.Errorf("%s: expected %d %s, got %d %v", tt.body, tt.status, tt.code, status, resp)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postJSON envía body a handler en un POST a target y devuelve el status y la
+// respuesta JSON decodificada. Un body string se envía tal cual; cualquier
+// otro valor se codifica como JSON.
+func postJSON(t *testing.T, handler http.HandlerFunc, target string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	payload, ok := body.(string)
+	if !ok {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Cannot encode request body: %v", err)
+		}
+		payload = string(data)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(payload)))
+	var resp map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec.Code, resp
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"toon-converter/toon"
+)
+
+// maxJSONLPayloadSize limita el body de /api/jsonl-to-toon. Es mayor que
+// maxPayloadSize porque la entrada se lee línea a línea sin guardarla.
+const maxJSONLPayloadSize = 32 << 20 // 32MB
+
+// jsonlToToonAPI convierte un documento JSON Lines (un objeto por línea) en
+// un único array tabular. El cuerpo es el documento tal cual y las opciones
+// van en la query, como en /api/convert. Todos los registros deben tener los
+// mismos campos y solo valores primitivos; si no, el error cita la línea.
+// Las líneas en blanco se ignoran. El body se procesa a medida que llega
+// (ver TOONEncoder.EncodeNDJSON), así que admite logs de varios MB.
+func jsonlToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Records       int           `json:"records,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	opts, err := convertOptions(r.URL.Query())
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
+	}
+	encoder, err := toon.NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(ctx context.Context) response {
+		body := &lineTokenReader{ctx: ctx, r: http.MaxBytesReader(w, r.Body, maxJSONLPayloadSize)}
+		var out strings.Builder
+		records, err := encoder.EncodeNDJSON(body, &out)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			var recordErr *toon.RecordError
+			switch {
+			case errors.As(err, &maxBytesErr):
+				return response{Error: "Cuerpo de la petición demasiado grande (máximo 32MB)", Code: codePayloadTooLarge}
+			case errors.As(err, &recordErr) && recordErr.Schema:
+				return response{Error: err.Error(), Code: codeSchemaMismatch}
+			case errors.As(err, &recordErr):
+				return response{Error: err.Error(), Code: codeInvalidJSON}
+			default:
+				return response{Error: "Error leyendo el body", Code: codeInvalidBody}
+			}
+		}
+
+		toon := out.String()
+		return response{Toon: toon, Records: records, TokenSavings: tokenSavings(body.tokens, countTokens(toon)), FormatVersion: FormatVersion}
+	})
+
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	if resp.Code == codePayloadTooLarge {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// lineTokenReader cuenta los tokens de lo que se lee de r línea a línea,
+// para calcular el ahorro sin guardar la entrada, y deja de leer cuando ctx
+// termina.
+type lineTokenReader struct {
+	ctx     context.Context
+	r       io.Reader
+	partial []byte // línea incompleta del último Read
+	tokens  int
+}
+
+func (l *lineTokenReader) Read(p []byte) (int, error) {
+	if err := l.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := l.r.Read(p)
+	l.partial = append(l.partial, p[:n]...)
+	if i := bytes.LastIndexByte(l.partial, '\n'); i >= 0 {
+		l.tokens += countTokens(string(l.partial[:i+1]))
+		l.partial = append(l.partial[:0], l.partial[i+1:]...)
+	}
+	if err == io.EOF && len(l.partial) > 0 {
+		l.tokens += countTokens(string(l.partial))
+		l.partial = nil
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONLToToonAPI(t *testing.T) {
+	body := "{\"id\": 1, \"name\": \"Alice\", \"active\": true}\r\n\n{\"name\": \"Bob\", \"id\": 9007199254740993, \"active\": null}\n"
+	_, resp := postJSON(t, jsonlToToonAPI, "/api/jsonl-to-toon", body)
+	if resp["toon"] != "[2]{active,id,name}:\n  true,1,Alice\n  null,9007199254740993,Bob" || resp["records"] != 2.0 {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	// Con keySort=none las columnas siguen el orden de la primera línea
+	if _, resp := postJSON(t, jsonlToToonAPI, "/api/jsonl-to-toon?keySort=none&delimiter=%7C", body); !strings.HasPrefix(resp["toon"].(string), "[2|]{id|name|active}:") {
+		t.Errorf("Expected the first record's key order, got %q", resp["toon"])
+	}
+
+	tests := []struct {
+		body    string
+		code    errorCode
+		message string
+	}{
+		{"{\"id\": 1}\n{\"id\": ", codeInvalidJSON, "línea 2:"},
+		{"{\"id\": 1}\n\n{\"id\": 2} {\"id\": 3}", codeInvalidJSON, "línea 3:"},
+		{"{\"id\": 1, \"a\": 1}\n{\"id\": 2, \"b\": 1}", codeSchemaMismatch, "línea 2: los campos no coinciden con los de la línea 1 (faltan: a; sobran: b)"},
+		{"{\"id\": 1}\n{\"id\": 2, \"tags\": []}", codeSchemaMismatch, "línea 2:"},
+		{"{\"id\": 1, \"tags\": [1]}", codeSchemaMismatch, `el campo "tags" no es un valor primitivo`},
+		{"[1, 2]", codeSchemaMismatch, "línea 1: se esperaba un objeto JSON"},
+		{"{}", codeSchemaMismatch, "línea 1:"},
+	}
+	for _, tt := range tests {
+		_, resp := postJSON(t, jsonlToToonAPI, "/api/jsonl-to-toon", tt.body)
+		if resp["code"] != string(tt.code) || !strings.Contains(resp["error"].(string), tt.message) {
+			t.Errorf("%q: expected %s with %q, got %v", tt.body, tt.code, tt.message, resp)
+		}
+	}
+}
+
+// El body se lee línea a línea, así que admite documentos de más de 1MB
+func TestJSONLToToonAPI_LargeBody(t *testing.T) {
+	line := "{\"id\": 1, \"msg\": \"" + strings.Repeat("x", 100) + "\"}\n"
+	n := maxPayloadSize/len(line) + 100
+	rec := httptest.NewRecorder()
+	jsonlToToonAPI(rec, httptest.NewRequest(http.MethodPost, "/api/jsonl-to-toon", strings.NewReader(strings.Repeat(line, n))))
+
+	var resp map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp["records"] != float64(n) || resp["tokenSavings"] == nil {
+		t.Errorf("Expected %d records, got status %d: %v", n, rec.Code, resp["error"])
+	}
+}
@@ -1,24 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
-	tiktoken "github.com/pkoukk/tiktoken-go"
 	"golang.org/x/time/rate"
+	"toon-converter/tokens"
+	"toon-converter/toon"
 )
 
 type TokenSavings struct {
@@ -28,6 +35,13 @@ type TokenSavings struct {
 	Percentage float64 `json:"percentage"`
 }
 
+// Límite de peticiones por IP en /api/*: visitorRate por segundo, con ráfagas
+// de hasta visitorBurst
+const (
+	visitorRate  = 5
+	visitorBurst = 10
+)
+
 type visitor struct {
 	limiter  *rate.Limiter
 	lastSeen time.Time
@@ -38,26 +52,13 @@ var (
 	mu       sync.RWMutex
 )
 
-var (
-	tokenizer     *tiktoken.Tiktoken
-	tokenizerOnce sync.Once
-	tokenizerErr  error
-)
-
-func initTokenizer() {
-	tokenizerOnce.Do(func() {
-		// Usar o200k_base (GPT-4o, GPT-5)
-		tokenizer, tokenizerErr = tiktoken.GetEncoding("o200k_base")
-	})
-}
-
 func getVisitor(ip string) *rate.Limiter {
 	mu.Lock()
 	defer mu.Unlock()
 
 	v, exists := visitors[ip]
 	if !exists {
-		limiter := rate.NewLimiter(5, 10) // 5 req/seg, burst 10
+		limiter := rate.NewLimiter(visitorRate, visitorBurst)
 		visitors[ip] = &visitor{limiter: limiter, lastSeen: time.Now()}
 		return limiter
 	}
@@ -79,39 +80,188 @@ func cleanupVisitors() {
 	}
 }
 
-func getIP(r *http.Request) string {
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip != "" {
-		// Tomar el primer valor si hay múltiples
-		if idx := strings.Index(ip, ","); idx > 0 {
-			ip = strings.TrimSpace(ip[:idx])
+// trustedProxies son los rangos de los proxies cuyo X-Forwarded-For se cree,
+// leídos de TRUSTED_PROXIES al arrancar (ver loadTrustedProxies).
+var trustedProxies []netip.Prefix
+
+// loadTrustedProxies lee TRUSTED_PROXIES: rangos CIDR o IPs sueltas separados
+// por comas ("10.0.0.0/8,192.168.1.10"). Vacío, no se confía en ningún proxy.
+func loadTrustedProxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
 		}
-		return ip
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES inválido: %q (debe ser una IP o un rango CIDR)", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
 	}
-	ip = r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx > 0 {
-		ip = ip[:idx]
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// getIP devuelve la IP del cliente para el rate limit. X-Forwarded-For solo
+// se tiene en cuenta si la conexión viene de un proxy de confianza, y se lee
+// de derecha a izquierda saltando los proxies de confianza: la primera IP que
+// no lo es la añadió el último proxy nuestro y es la del cliente. Lo que
+// haya a su izquierda lo escribió el propio cliente y puede ser falso.
+func getIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !isTrustedProxy(addr) {
+		return remote
+	}
+
+	client := addr
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Entrada mal formada: nos quedamos con el último salto fiable
+			break
+		}
+		client = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
 	}
-	return ip
+	return client.Unmap().String()
 }
 
 func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ip := getIP(r)
 		limiter := getVisitor(ip)
-		if !limiter.Allow() {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		now := time.Now()
+		allowed := limiter.AllowN(now, 1)
+		setRateLimitHeaders(w, limiter, now, allowed)
+		if !allowed {
+			writeAPIError(w, http.StatusTooManyRequests, codeRateLimited, "Límite de peticiones excedido")
 			return
 		}
 		next(w, r)
 	}
 }
 
+// setRateLimitHeaders informa al cliente del estado de su limiter:
+// X-RateLimit-Limit es la ráfaga máxima, X-RateLimit-Remaining las peticiones
+// que puede hacer ya y X-RateLimit-Reset los segundos hasta recuperarlas
+// todas. Si la petición se rechazó, Retry-After indica cuándo habrá una.
+func setRateLimitHeaders(w http.ResponseWriter, limiter *rate.Limiter, now time.Time, allowed bool) {
+	tokens := limiter.TokensAt(now)
+	perSecond := float64(limiter.Limit())
+	burst := limiter.Burst()
+
+	remaining := int(math.Floor(tokens))
+	if remaining < 0 {
+		remaining = 0
+	}
+	reset := int(math.Ceil((float64(burst) - tokens) / perSecond))
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(reset))
+	if !allowed {
+		retryAfter := int(math.Ceil((1 - tokens) / perSecond))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+}
+
+// conversionSlots limita las conversiones simultáneas: su capacidad es el
+// máximo, compartido por todos los endpoints que usan runConversion. main la
+// ajusta a MAX_CONCURRENT_CONVERSIONS.
+var conversionSlots = make(chan struct{}, defaultMaxConcurrentConversions)
+
+// conversionTimeout limita el tiempo de cada conversión.
+var conversionTimeout = 5 * time.Second
+
+// errServerBusy indica que todos los huecos de conversionSlots estaban
+// ocupados.
+var errServerBusy = errors.New("servidor ocupado")
+
+// acquireConversionSlot ocupa un hueco de conversionSlots sin esperar y
+// devuelve la función que lo libera, o errServerBusy si no queda ninguno.
+func acquireConversionSlot() (func(), error) {
+	select {
+	case conversionSlots <- struct{}{}:
+		return func() { <-conversionSlots }, nil
+	default:
+		return nil, errServerBusy
+	}
+}
+
+// runConversion ocupa un hueco de conversionSlots y ejecuta convert en una
+// goroutine con un contexto que vence a los conversionTimeout. Devuelve su
+// resultado, errServerBusy sin ejecutarla si no queda ningún hueco, o el
+// error del contexto si se acaba el tiempo antes; convert debe dejar de
+// trabajar cuando su contexto termine. El hueco se libera al volver, también
+// por tiempo excedido.
+func runConversion[T any](ctx context.Context, convert func(ctx context.Context) T) (T, error) {
+	var zero T
+	release, err := acquireConversionSlot()
+	if err != nil {
+		return zero, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, conversionTimeout)
+	defer cancel()
+
+	resultChan := make(chan T, 1)
+	go func() {
+		resultChan <- convert(ctx)
+	}()
+
+	select {
+	case result := <-resultChan:
+		// Un resultado que llega con el tiempo ya agotado puede estar a medias
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+		return result, nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// writeConversionError responde al error de runConversion: 503 con
+// Retry-After si no había hueco libre y TIMEOUT si se acabó el tiempo.
+func writeConversionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errServerBusy) {
+		w.Header().Set("Retry-After", "5")
+		writeAPIError(w, http.StatusServiceUnavailable, codeServerBusy, "Servidor ocupado, inténtalo de nuevo en unos segundos")
+		return
+	}
+	json.NewEncoder(w).Encode(apiError{Error: "Tiempo de procesamiento excedido", Code: codeTimeout})
+}
+
 func securityMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 		w.Header().Set("Access-Control-Allow-Credentials", "false")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
@@ -146,17 +296,170 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// serverConfig agrupa lo que cambia entre despliegues.
+type serverConfig struct {
+	Addr      string
+	StaticDir string
+	Dev       bool // sin caché para los archivos estáticos
+}
+
+// loadConfig lee la configuración del entorno: ADDR (dirección completa,
+// p. ej. "127.0.0.1:9000") o PORT, STATIC_DIR y DEV ("1" para desarrollo).
+// Sin variables se usan ":8080", "static" y modo producción.
+func loadConfig() serverConfig {
+	cfg := serverConfig{Addr: ":8080", StaticDir: "static"}
+	if addr := os.Getenv("ADDR"); addr != "" {
+		cfg.Addr = addr
+	} else if port := os.Getenv("PORT"); port != "" {
+		cfg.Addr = ":" + port
+	}
+	if dir := os.Getenv("STATIC_DIR"); dir != "" {
+		cfg.StaticDir = dir
+	}
+	cfg.Dev = os.Getenv("DEV") == "1"
+	return cfg
+}
+
+// fingerprintPattern reconoce los archivos con hash en el nombre
+// ("app.3f2a9c1d.js"), que no cambian nunca sin cambiar de nombre.
+var fingerprintPattern = regexp.MustCompile(`\.[0-9a-f]{8,}\.[A-Za-z0-9]+$`)
+
+// staticCacheMiddleware pone Cache-Control a los archivos estáticos. En
+// desarrollo nada se guarda, para ver cada cambio al recargar; en producción
+// los archivos con hash se cachean un año y el resto se revalida en cada
+// uso con Last-Modified.
+func staticCacheMiddleware(dev bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case dev:
+			w.Header().Set("Cache-Control", "no-store")
+		case fingerprintPattern.MatchString(r.URL.Path):
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		default:
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// defaultOptions es la base de las opciones de /api/json-to-toon, leída del
+// entorno al arrancar (ver loadDefaultOptions).
+var defaultOptions toon.TOONOptions
+
+// loadDefaultOptions lee el estilo por defecto del encoder: DEFAULT_DELIMITER
+// (",", "|" o "tab"), DEFAULT_INDENT y DEFAULT_LENGTH_MARKER, y lo valida con
+// NewTOONEncoderWithOptions.
+func loadDefaultOptions() (toon.TOONOptions, error) {
+	var opts toon.TOONOptions
+
+	opts.Delimiter = os.Getenv("DEFAULT_DELIMITER")
+	if opts.Delimiter == "tab" {
+		opts.Delimiter = "\t"
+	}
+	if indent := os.Getenv("DEFAULT_INDENT"); indent != "" {
+		n, err := strconv.Atoi(indent)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("DEFAULT_INDENT inválido: %q (debe ser un entero positivo)", indent)
+		}
+		opts.Indent = n
+	}
+	if marker := os.Getenv("DEFAULT_LENGTH_MARKER"); marker != "" {
+		b, err := strconv.ParseBool(marker)
+		if err != nil {
+			return opts, fmt.Errorf("DEFAULT_LENGTH_MARKER inválido: %q (debe ser true o false)", marker)
+		}
+		opts.LengthMarker = b
+	}
+
+	if _, err := toon.NewTOONEncoderWithOptions(opts); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// defaultMaxConcurrentConversions es el máximo de conversiones simultáneas
+// sin MAX_CONCURRENT_CONVERSIONS.
+const defaultMaxConcurrentConversions = 10
+
+// loadMaxConcurrentConversions lee MAX_CONCURRENT_CONVERSIONS, el número de
+// peticiones de conversión que pueden ejecutarse a la vez, sumando todos los
+// endpoints.
+func loadMaxConcurrentConversions() (int, error) {
+	value := os.Getenv("MAX_CONCURRENT_CONVERSIONS")
+	if value == "" {
+		return defaultMaxConcurrentConversions, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("MAX_CONCURRENT_CONVERSIONS inválido: %q (debe ser un entero positivo)", value)
+	}
+	return n, nil
+}
+
+// applyDefaultOptions completa el delimitador, la indentación y el marcador
+// de longitud de opts con defaultOptions cuando la petición no los indica
+// (lengthMarker nil).
+func applyDefaultOptions(opts *toon.TOONOptions, lengthMarker *bool) {
+	if opts.Delimiter == "" {
+		opts.Delimiter = defaultOptions.Delimiter
+	}
+	if opts.Indent <= 0 {
+		opts.Indent = defaultOptions.Indent
+	}
+	opts.LengthMarker = defaultOptions.LengthMarker
+	if lengthMarker != nil {
+		opts.LengthMarker = *lengthMarker
+	}
+}
+
 func main() {
 	go cleanupVisitors()
 
+	cfg := loadConfig()
+	if info, err := os.Stat(cfg.StaticDir); err != nil || !info.IsDir() {
+		log.Printf("Advertencia: el directorio estático %q no existe, la interfaz web no estará disponible", cfg.StaticDir)
+	}
+
+	opts, err := loadDefaultOptions()
+	if err != nil {
+		log.Fatalf("Opciones por defecto del encoder inválidas: %v", err)
+	}
+	defaultOptions = opts
+
+	maxConversions, err := loadMaxConcurrentConversions()
+	if err != nil {
+		log.Fatalf("Configuración inválida: %v", err)
+	}
+	if trustedProxies, err = loadTrustedProxies(); err != nil {
+		log.Fatalf("Configuración inválida: %v", err)
+	}
+
 	mux := http.NewServeMux()
-	mux.Handle("/", http.FileServer(http.Dir("static")))
+	mux.Handle("/", staticCacheMiddleware(cfg.Dev, http.FileServer(http.Dir(cfg.StaticDir))))
 	mux.HandleFunc("/api/count-tokens", rateLimitMiddleware(countTokensAPI))
+	mux.HandleFunc("/api/batch-count-tokens", rateLimitMiddleware(batchCountTokensAPI))
 	mux.HandleFunc("/api/fix-json", rateLimitMiddleware(fixJSONAPI))
+	conversionSlots = make(chan struct{}, maxConversions)
 	mux.HandleFunc("/api/json-to-toon", rateLimitMiddleware(jsonToToonAPI))
+	mux.HandleFunc("/api/convert", rateLimitMiddleware(convertAPI))
+	mux.HandleFunc("/api/jsonl-to-toon", rateLimitMiddleware(jsonlToToonAPI))
+	mux.HandleFunc("/api/json-to-toon/stream", rateLimitMiddleware(jsonToToonStreamAPI))
+	mux.HandleFunc("/api/xml-to-toon", rateLimitMiddleware(xmlToToonAPI))
+	mux.HandleFunc("/api/toml-to-toon", rateLimitMiddleware(tomlToToonAPI))
+	mux.HandleFunc("/api/yaml-to-toon", rateLimitMiddleware(yamlToToonAPI))
+	mux.HandleFunc("/api/csv-to-toon", rateLimitMiddleware(csvToToonAPI))
+	mux.HandleFunc("/api/msgpack-to-toon", rateLimitMiddleware(msgpackToToonAPI))
+	mux.HandleFunc("/api/proto-to-toon", rateLimitMiddleware(protoToToonAPI))
+	mux.HandleFunc("/api/transcode-toon", rateLimitMiddleware(transcodeToonAPI))
+	mux.HandleFunc("/api/toon-to-json", rateLimitMiddleware(toonToJSONAPI))
+	mux.HandleFunc("/api/toon-to-csv", rateLimitMiddleware(toonToCSVAPI))
+	mux.HandleFunc("/api/keys-stats", rateLimitMiddleware(keysStatsAPI))
+	mux.HandleFunc("/api/explain-quoting", rateLimitMiddleware(explainQuotingAPI))
+	mux.HandleFunc("/api/format-version", formatVersionAPI)
+	mux.HandleFunc("/api/selftest", rateLimitMiddleware(selfTestAPI))
 
 	server := &http.Server{
-		Addr:           ":8080",
+		Addr:           cfg.Addr,
 		Handler:        recoveryMiddleware(loggingMiddleware(securityMiddleware(mux))),
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
@@ -164,7 +467,10 @@ func main() {
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	log.Println("Servidor iniciado en :8080")
+	if cfg.Dev {
+		log.Printf("Modo desarrollo: archivos estáticos sin caché")
+	}
+	log.Printf("Servidor iniciado en %s", cfg.Addr)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -190,861 +496,785 @@ func main() {
 
 const maxPayloadSize = 1 << 20 // 1MB
 
-func jsonToToonAPI(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-
-	type request struct {
-		JSON         string `json:"json"`
-		Delimiter    string `json:"delimiter,omitempty"`    // ",", "\t", "|"
-		LengthMarker bool   `json:"lengthMarker,omitempty"` // true/false
-		Indent       int    `json:"indent,omitempty"`       // espacios de indentación
-	}
-	type response struct {
-		Toon         string        `json:"toon,omitempty"`
-		Error        string        `json:"error,omitempty"`
-		Fixed        bool          `json:"fixed,omitempty"`
-		Original     string        `json:"original,omitempty"`
-		TokenSavings *TokenSavings `json:"tokenSavings,omitempty"`
-	}
+// maxInputChars limita el texto de entrada de los endpoints. Se cuentan
+// caracteres (runas) y no bytes, para no penalizar CJK o emojis.
+const maxInputChars = 500000
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSize)
+func exceedsInputLimit(s string) bool {
+	return utf8.RuneCountInString(s) > maxInputChars
+}
 
-	var req request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		if err.Error() == "http: request body too large" {
-			json.NewEncoder(w).Encode(response{Error: "Cuerpo de la petición demasiado grande (máximo 1MB)"})
-			return
-		}
-		json.NewEncoder(w).Encode(response{Error: "Error de decodificación del body"})
-		return
-	}
+// errorCode identifica el tipo de error para los clientes; acompaña al
+// mensaje de "error" en el campo "code" de todas las respuestas.
+type errorCode string
+
+const (
+	codeInvalidBody        errorCode = "INVALID_BODY"      // body que no es JSON o no encaja con la petición
+	codePayloadTooLarge    errorCode = "PAYLOAD_TOO_LARGE" // body o texto de entrada por encima del límite
+	codeInvalidJSON        errorCode = "INVALID_JSON"
+	codeInvalidTOON        errorCode = "INVALID_TOON"
+	codeInvalidXML         errorCode = "INVALID_XML"
+	codeInvalidTOML        errorCode = "INVALID_TOML"
+	codeInvalidYAML        errorCode = "INVALID_YAML"
+	codeInvalidCSV         errorCode = "INVALID_CSV"
+	codeInvalidMessagePack errorCode = "INVALID_MSGPACK"
+	codeInvalidProtobuf    errorCode = "INVALID_PROTOBUF"
+	codeDuplicateKeys      errorCode = "DUPLICATE_KEYS" // solo con strict
+	codeInvalidDelimiter   errorCode = "INVALID_DELIMITER"
+	codeInvalidOptions     errorCode = "INVALID_OPTIONS"    // el resto de opciones inválidas
+	codeArrayTooLarge      errorCode = "ARRAY_TOO_LARGE"    // array por encima de maxArrayElements
+	codeMaxDepthExceeded   errorCode = "MAX_DEPTH_EXCEEDED" // más niveles de anidamiento que maxDepth
+	codeSchemaMismatch     errorCode = "SCHEMA_MISMATCH"    // registros JSONL con campos distintos
+	codeUnsupportedVersion errorCode = "UNSUPPORTED_FORMAT_VERSION"
+	codeTimeout            errorCode = "TIMEOUT"
+	codeRateLimited        errorCode = "RATE_LIMITED"
+	codeServerBusy         errorCode = "SERVER_BUSY"
+	codeInternal           errorCode = "INTERNAL_ERROR"
+	codeJSONFixed          errorCode = "JSON_FIXED"   // no es un fallo: la conversión se hizo tras corregir el JSON
+	codeJSONLenient        errorCode = "JSON_LENIENT" // no es un fallo: el JSON se leyó como JSON5/JSONC
+)
 
-	if len(req.JSON) > 500000 {
-		json.NewEncoder(w).Encode(response{Error: "JSON demasiado grande (máximo 500,000 caracteres)"})
-		return
+// optionsErrorCode devuelve el código de un error de
+// NewTOONEncoderWithOptions o NewTOONDecoderWithOptions.
+func optionsErrorCode(err error) errorCode {
+	if errors.Is(err, toon.ErrInvalidDelimiter) {
+		return codeInvalidDelimiter
 	}
+	return codeInvalidOptions
+}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
-	type result struct {
-		toon         string
-		tokenSavings *TokenSavings
-		fixed        bool
-		err          error
+// limitsErrorCode devuelve el código de un error de CheckLimits.
+func limitsErrorCode(err error) errorCode {
+	if errors.Is(err, toon.ErrMaxDepth) {
+		return codeMaxDepthExceeded
 	}
+	return codeArrayTooLarge
+}
 
-	resultChan := make(chan result, 1)
-
-	go func() {
-		var data interface{}
-		err := json.Unmarshal([]byte(req.JSON), &data)
-
-		wasFixed := false
-		if err != nil {
-			fixed := tryFixJSON(req.JSON)
-			if err := json.Unmarshal([]byte(fixed), &data); err != nil {
-				resultChan <- result{err: fmt.Errorf("JSON inválido: %v", err)}
-				return
-			}
-			wasFixed = true
-		}
-
-		// Crear encoder con opciones
-		opts := TOONOptions{
-			Delimiter:    req.Delimiter,
-			LengthMarker: req.LengthMarker,
-			Indent:       req.Indent,
-		}
-		encoder, err := NewTOONEncoderWithOptions(opts)
-		if err != nil {
-			resultChan <- result{err: err}
-			return
-		}
-		toon := encoder.Encode(data)
-
-		// Calcular tokens
-		jsonTokens := countTokens(req.JSON)
-		toonTokens := countTokens(toon)
-
-		var tokenSavings *TokenSavings
-		if jsonTokens > 0 && toonTokens > 0 {
-			saved := jsonTokens - toonTokens
-			percentage := float64(saved) / float64(jsonTokens) * 100
-			tokenSavings = &TokenSavings{
-				JSON:       jsonTokens,
-				TOON:       toonTokens,
-				Saved:      saved,
-				Percentage: math.Round(percentage*100) / 100,
-			}
-		}
-
-		resultChan <- result{toon: toon, tokenSavings: tokenSavings, fixed: wasFixed}
-	}()
+// apiError es el cuerpo de las respuestas de error de todos los endpoints.
+type apiError struct {
+	Error string    `json:"error"`
+	Code  errorCode `json:"code"`
+}
 
-	select {
-	case res := <-resultChan:
-		if res.err != nil {
-			json.NewEncoder(w).Encode(response{
-				Error:    res.err.Error(),
-				Original: req.JSON,
-			})
-			return
-		}
+// writeAPIError responde con status y {"error": message, "code": code}.
+func writeAPIError(w http.ResponseWriter, status int, code errorCode, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: message, Code: code})
+}
 
-		resp := response{
-			Toon:         res.toon,
-			TokenSavings: res.tokenSavings,
-		}
+// decodeRequest lee el body JSON de r en dst, limitado a maxPayloadSize. Si
+// falla responde 413 (body demasiado grande) o 400 (body inválido) y
+// devuelve false; el handler solo tiene que retornar.
+func decodeRequest(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSize)
 
-		if res.fixed {
-			resp.Fixed = true
-			resp.Error = "JSON corregido automáticamente"
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Cuerpo de la petición demasiado grande (máximo 1MB)")
+			return false
 		}
-
-		json.NewEncoder(w).Encode(resp)
-	case <-ctx.Done():
-		json.NewEncoder(w).Encode(response{Error: "Tiempo de procesamiento excedido"})
+		writeAPIError(w, http.StatusBadRequest, codeInvalidBody, "Error de decodificación del body")
+		return false
 	}
+	return true
 }
 
-// Intenta corregir errores comunes de formato JSON
-func tryFixJSON(input string) string {
-	s := strings.TrimSpace(input)
-
-	// 1. Eliminar comas duplicadas
-	re := regexp.MustCompile(`,\s*,+`)
-	s = re.ReplaceAllString(s, ",")
+// checkInputLimit responde 413 si input supera maxInputChars; label nombra
+// la entrada en el mensaje ("JSON", "XML"...).
+func checkInputLimit(w http.ResponseWriter, label, input string) bool {
+	if exceedsInputLimit(input) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("%s demasiado grande (máximo 500,000 caracteres)", label))
+		return false
+	}
+	return true
+}
 
-	// 2. Eliminar comas antes de llaves/corchetes de cierre
-	s = regexp.MustCompile(`,\s*}`).ReplaceAllString(s, "}")
-	s = regexp.MustCompile(`,\s*]`).ReplaceAllString(s, "]")
+// encodeOptions son las opciones del encoder que acepta /api/json-to-toon.
+// Los endpoints que convierten otros formatos a TOON las comparten
+// incrustándolas en su petición.
+type encodeOptions struct {
+	Delimiter           string            `json:"delimiter,omitempty"`           // ",", "\t", "|" o "auto"
+	LengthMarker        *bool             `json:"lengthMarker,omitempty"`        // true/false; nil = valor por defecto
+	Indent              int               `json:"indent,omitempty"`              // espacios de indentación
+	PreserveKeyOrder    bool              `json:"preserveKeyOrder,omitempty"`    // columnas tabulares en orden original
+	KeySort             string            `json:"keySort,omitempty"`             // "asc", "asc-ci", "natural", "none"
+	ListIndex           string            `json:"listIndex,omitempty"`           // "0" o "1": numerar elementos de lista
+	ListIndexStyle      string            `json:"listIndexStyle,omitempty"`      // "-" o ")"
+	TrueLiteral         string            `json:"trueLiteral,omitempty"`         // en vez de true
+	FalseLiteral        string            `json:"falseLiteral,omitempty"`        // en vez de false
+	NullLiteral         string            `json:"nullLiteral,omitempty"`         // en vez de null
+	EmptyNull           bool              `json:"emptyNull,omitempty"`           // null como valor vacío
+	SparseTabular       bool              `json:"sparseTabular,omitempty"`       // tabular aunque falten campos
+	InlineObjects       int               `json:"inlineObjects,omitempty"`       // objetos pequeños de listas en una línea
+	FieldTypes          map[string]string `json:"fieldTypes,omitempty"`          // "number" o "string" por columna tabular
+	MaxStringLength     int               `json:"maxStringLength,omitempty"`     // recortar los strings largos con "…"
+	MaxStringLengths    map[string]int    `json:"maxStringLengths,omitempty"`    // el mismo límite por campo
+	BinaryPlaceholders  bool              `json:"binaryPlaceholders,omitempty"`  // "<binary 42KB>" en vez de base64 largo
+	MinBinaryLength     int               `json:"minBinaryLength,omitempty"`     // longitud mínima, 256 por defecto
+	AlignColumns        bool              `json:"alignColumns,omitempty"`        // alinear columnas tabulares con espacios
+	Flatten             bool              `json:"flatten,omitempty"`             // claves con la ruta completa ("a.b.0")
+	FlattenSeparator    string            `json:"flattenSeparator,omitempty"`    // separador de Flatten, "." por defecto
+	KeyFolding          bool              `json:"keyFolding,omitempty"`          // cadenas de objetos de una clave como "a.b.c"
+	AbbreviateKeys      bool              `json:"abbreviateKeys,omitempty"`      // alias cortos para las claves largas repetidas
+	Annotate            bool              `json:"annotate,omitempty"`            // comentario sobre cada array tabular
+	Compact             bool              `json:"compact,omitempty"`             // headers de array mínimos
+	TypedHeaders        bool              `json:"typedHeaders,omitempty"`        // tipo de cada columna en el header tabular
+	CompactBooleans     bool              `json:"compactBooleans,omitempty"`     // 1/0 en filas tabulares y arrays
+	JSNumberCompat      bool              `json:"jsNumberCompat,omitempty"`      // números como Number.toString de JS
+	DecimalPlaces       int               `json:"decimalPlaces,omitempty"`       // decimales fijos, 0 = exactos
+	FloatPrecision      int               `json:"floatPrecision,omitempty"`      // decimales como máximo, sin ceros finales
+	DateMode            string            `json:"dateMode,omitempty"`            // "keep", "epoch" o "date-only"
+	EmptyContainerStyle string            `json:"emptyContainerStyle,omitempty"` // "header" o "literal" ([] y {})
+	ASCIIOnly           bool              `json:"asciiOnly,omitempty"`           // no ASCII como \uXXXX
+	SpecVersion         string            `json:"specVersion,omitempty"`         // "legacy" o "1.0" (especificación de referencia)
+	NumericStrings      bool              `json:"numericStrings,omitempty"`      // strings numéricos sin comillas
+	NumericFields       []string          `json:"numericFields,omitempty"`       // ídem, solo en estas claves
+	Include             []string          `json:"include,omitempty"`             // rutas que se conservan ("users.*.email")
+	Exclude             []string          `json:"exclude,omitempty"`             // rutas que se quitan
+	DropKeys            []string          `json:"dropKeys,omitempty"`            // claves que se quitan en cualquier nivel
+	RedactKeys          []string          `json:"redactKeys,omitempty"`          // claves cuyo valor pasa a "***"
+	OmitNull            bool              `json:"omitNull,omitempty"`            // quitar los campos null
+	OmitEmpty           bool              `json:"omitEmpty,omitempty"`           // quitar también "", [] y {}
+	MaxArrayElements    int               `json:"maxArrayElements,omitempty"`    // 0 = sin límite
+	MaxDepth            int               `json:"maxDepth,omitempty"`            // 0 = toon.DefaultMaxDepth
+	TruncateArrays      bool              `json:"truncateArrays,omitempty"`      // recortar en vez de fallar
+	SampleStrategy      string            `json:"sampleStrategy,omitempty"`      // "head", "head+tail" o "random"
+	RootKey             string            `json:"rootKey,omitempty"`             // clave raíz que envuelve la salida
+	ListEndMarker       bool              `json:"listEndMarker,omitempty"`       // cerrar listas con "[/N]"
+}
 
-	// 3. Agregar comas faltantes entre propiedades (caso: "a":1"b":2)
-	s = regexp.MustCompile(`("\s*:\s*[^,}\]]+)\s*"`).ReplaceAllString(s, `$1,"`)
+// toonOptions pasa las opciones de la petición a toon.TOONOptions, con los
+// valores por defecto del servidor.
+func (o encodeOptions) toonOptions() toon.TOONOptions {
+	opts := toon.TOONOptions{
+		Delimiter:           o.Delimiter,
+		Indent:              o.Indent,
+		PreserveKeyOrder:    o.PreserveKeyOrder,
+		KeySort:             o.KeySort,
+		ListIndex:           o.ListIndex,
+		ListIndexStyle:      o.ListIndexStyle,
+		TrueLiteral:         o.TrueLiteral,
+		FalseLiteral:        o.FalseLiteral,
+		NullLiteral:         o.NullLiteral,
+		EmptyNull:           o.EmptyNull,
+		SparseTabular:       o.SparseTabular,
+		InlineObjects:       o.InlineObjects,
+		FieldTypes:          o.FieldTypes,
+		MaxStringLength:     o.MaxStringLength,
+		MaxStringLengths:    o.MaxStringLengths,
+		BinaryPlaceholders:  o.BinaryPlaceholders,
+		MinBinaryLength:     o.MinBinaryLength,
+		AlignColumns:        o.AlignColumns,
+		Flatten:             o.Flatten,
+		FlattenSeparator:    o.FlattenSeparator,
+		KeyFolding:          o.KeyFolding,
+		AbbreviateKeys:      o.AbbreviateKeys,
+		Annotate:            o.Annotate,
+		Compact:             o.Compact,
+		TypedHeaders:        o.TypedHeaders,
+		CompactBooleans:     o.CompactBooleans,
+		JSNumberCompat:      o.JSNumberCompat,
+		DecimalPlaces:       o.DecimalPlaces,
+		FloatPrecision:      o.FloatPrecision,
+		DateMode:            o.DateMode,
+		EmptyContainerStyle: o.EmptyContainerStyle,
+		ASCIIOnly:           o.ASCIIOnly,
+		SpecVersion:         o.SpecVersion,
+		NumericStrings:      o.NumericStrings,
+		NumericFields:       o.NumericFields,
+		Include:             o.Include,
+		Exclude:             o.Exclude,
+		DropKeys:            o.DropKeys,
+		RedactKeys:          o.RedactKeys,
+		OmitNull:            o.OmitNull,
+		OmitEmpty:           o.OmitEmpty,
+		MaxArrayElements:    o.MaxArrayElements,
+		MaxDepth:            o.MaxDepth,
+		TruncateArrays:      o.TruncateArrays,
+		SampleStrategy:      o.SampleStrategy,
+		RootKey:             o.RootKey,
+		ListEndMarker:       o.ListEndMarker,
+	}
+	applyDefaultOptions(&opts, o.LengthMarker)
+	return opts
+}
 
-	// 4. Corregir llaves desbalanceadas
-	openBraces := strings.Count(s, "{")
-	closeBraces := strings.Count(s, "}")
-	if openBraces > closeBraces {
-		s += strings.Repeat("}", openBraces-closeBraces)
-	} else if closeBraces > openBraces {
-		s = strings.Repeat("{", closeBraces-openBraces) + s
+// newConversionEncoder crea el encoder de opts. Con delimiter "auto" antes
+// elige el delimitador que da menos tokens para data, lo guarda en opts y lo
+// devuelve.
+func newConversionEncoder(data interface{}, opts *toon.TOONOptions) (*toon.TOONEncoder, string, error) {
+	var chosenDelimiter string
+	if opts.Delimiter == "auto" {
+		var err error
+		if chosenDelimiter, err = toon.BestDelimiter(data, *opts, countTokens); err != nil {
+			return nil, "", err
+		}
+		opts.Delimiter = chosenDelimiter
 	}
-
-	// 5. Corregir corchetes desbalanceados
-	openBrackets := strings.Count(s, "[")
-	closeBrackets := strings.Count(s, "]")
-	if openBrackets > closeBrackets {
-		s += strings.Repeat("]", openBrackets-closeBrackets)
-	} else if closeBrackets > openBrackets {
-		s = strings.Repeat("[", closeBrackets-openBrackets) + s
+	encoder, err := toon.NewTOONEncoderWithOptions(*opts)
+	if err != nil {
+		return nil, "", err
 	}
-
-	// 6. Intentar agregar comillas faltantes a claves (muy básico)
-	// Ejemplo: {name: "value"} -> {"name": "value"}
-	re = regexp.MustCompile(`([{,]\s*)([a-zA-Z_][a-zA-Z0-9_]*)\s*:`)
-	s = re.ReplaceAllString(s, `$1"$2":`)
-
-	return s
+	return encoder, chosenDelimiter, nil
 }
 
-func fixJSONAPI(w http.ResponseWriter, r *http.Request) {
+func jsonToToonAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	type request struct {
 		JSON string `json:"json"`
+		encodeOptions
+		Strict      bool `json:"strict,omitempty"`      // no intentar corregir JSON inválido
+		SavingsOnly bool `json:"savingsOnly,omitempty"` // devolver solo el ahorro, sin el TOON
+		InputHash   bool `json:"inputHash,omitempty"`   // incluir el SHA-256 del JSON normalizado
+		MaxTokens   int  `json:"maxTokens,omitempty"`   // dividir el array raíz en fragmentos
+		TextStats   bool `json:"textStats,omitempty"`   // incluir palabras y caracteres de entrada y salida
 	}
 	type response struct {
-		Fixed    string   `json:"fixed,omitempty"`
-		Error    string   `json:"error,omitempty"`
-		Original string   `json:"original,omitempty"`
-		Changes  []string `json:"changes,omitempty"`
+		Toon           string               `json:"toon,omitempty"`
+		Error          string               `json:"error,omitempty"`
+		Code           errorCode            `json:"code,omitempty"`
+		Fixed          bool                 `json:"fixed,omitempty"`
+		Changes        []string             `json:"changes,omitempty"`
+		Lenient        bool                 `json:"lenient,omitempty"` // leído como JSON5/JSONC, sin corregir
+		Syntax         []string             `json:"syntax,omitempty"`  // extensiones de JSON5 encontradas
+		Warnings       []string             `json:"warnings,omitempty"`
+		Original       string               `json:"original,omitempty"`
+		Truncated      bool                 `json:"truncated,omitempty"`
+		TimedOut       bool                 `json:"timedOut,omitempty"` // toon es solo lo escrito antes del límite de tiempo
+		Lines          int                  `json:"lines,omitempty"`
+		Bytes          int                  `json:"bytes,omitempty"`
+		Hash           string               `json:"hash,omitempty"`
+		InputHash      string               `json:"inputHash,omitempty"`
+		Chunks         []toon.TOONChunk     `json:"chunks,omitempty"`
+		TokenSavings   *TokenSavings        `json:"tokenSavings,omitempty"`
+		Recommendation string               `json:"recommendation,omitempty"` // si el ahorro es nulo o escaso
+		Delimiter      string               `json:"delimiter,omitempty"`      // el elegido con delimiter "auto"
+		TextStats      *ConversionTextStats `json:"textStats,omitempty"`
+		FormatVersion  string               `json:"formatVersion,omitempty"`
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSize)
-
 	var req request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		if err.Error() == "http: request body too large" {
-			json.NewEncoder(w).Encode(response{Error: "Cuerpo de la petición demasiado grande (máximo 1MB)"})
-			return
-		}
-		json.NewEncoder(w).Encode(response{Error: "Error de decodificación del body"})
+	if !decodeRequest(w, r, &req) {
 		return
 	}
-
-	if len(req.JSON) > 500000 {
-		json.NewEncoder(w).Encode(response{Error: "JSON demasiado grande (máximo 500,000 caracteres)"})
+	if !checkInputLimit(w, "JSON", req.JSON) {
 		return
 	}
 
-	original := strings.TrimSpace(req.JSON)
-	fixed, changes := fixJSON(original)
+	type result struct {
+		toon           string
+		tokenSavings   *TokenSavings
+		fixed          bool
+		changes        []string
+		lenient        bool
+		syntax         []string
+		warnings       []string
+		truncated      bool
+		inputHash      string
+		chunks         []toon.TOONChunk
+		recommendation string
+		delimiter      string
+		textStats      *ConversionTextStats
+		err            error
+		code           errorCode
+	}
+
+	partial := &partialWriter{}
+
+	res, err := runConversion(r.Context(), func(ctx context.Context) result {
+		partial.ctx = ctx
+
+		// Con preserveKeyOrder o keySort "none" se decodifica conservando el
+		// orden de las claves. Los números se leen como json.Number para no
+		// perder precisión en los enteros grandes
+		ordered := req.PreserveKeyOrder || req.KeySort == "none"
+		parse := func(input string) (interface{}, error) {
+			return toon.DecodeJSON(input, ordered)
+		}
 
-	// Verificar que el JSON corregido sea válido
-	var test interface{}
-	if err := json.Unmarshal([]byte(fixed), &test); err != nil {
-		json.NewEncoder(w).Encode(response{
-			Error:    fmt.Sprintf("No se pudo corregir el JSON: %v", err),
-			Original: original,
-		})
-		return
-	}
+		data, err := parse(req.JSON)
 
-	json.NewEncoder(w).Encode(response{
-		Fixed:   fixed,
-		Changes: changes,
-	})
-}
+		if err != nil && req.Strict {
+			return result{err: fmt.Errorf("JSON inválido: %v", err), code: codeInvalidJSON}
+		}
 
-func fixJSON(input string) (string, []string) {
-	s := strings.TrimSpace(input)
-	var changes []string
+		// JSON5 y JSONC (comentarios, comas finales...) se leen con su
+		// gramática; FixJSON queda para lo que tampoco es JSON5
+		wasFixed, lenient := false, false
+		var changes, syntax []string
+		parsed := req.JSON
+		if err != nil {
+			if value, features, err5 := toon.DecodeJSON5(req.JSON, ordered); err5 == nil {
+				data, syntax, lenient = value, features, true
+				canonical, _ := json.Marshal(data)
+				parsed = string(canonical)
+			} else {
+				parsed, changes = toon.FixJSON(req.JSON)
+				if data, err = parse(parsed); err != nil {
+					return result{err: fmt.Errorf("JSON inválido: %v", err), code: codeInvalidJSON}
+				}
+				wasFixed = true
+			}
+		}
 
-	// 1. Eliminar comentarios (// y /* */)
-	original := s
-	re := regexp.MustCompile(`(?s)/\*.*?\*/|//.*?$`)
-	s = re.ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, fmt.Sprintf("Eliminado comentario: %s", strings.TrimSpace(match)))
-		return ""
-	})
-	if s != original {
-		s = strings.TrimSpace(s)
-	}
+		// json.Unmarshal conserva el último valor de una clave repetida, y
+		// DecodeJSON5 también. En JSON5 se buscan en el texto original: el
+		// JSON canónico ya no las tiene
+		var warnings []string
+		var duplicates []string
+		if lenient {
+			duplicates, _ = toon.FindDuplicateKeysJSON5(req.JSON)
+		} else {
+			duplicates, _ = toon.FindDuplicateKeys(parsed)
+		}
+		if len(duplicates) > 0 && req.Strict {
+			return result{err: fmt.Errorf("claves duplicadas: %s", strings.Join(duplicates, ", ")), code: codeDuplicateKeys}
+		}
+		for _, path := range duplicates {
+			warnings = append(warnings, fmt.Sprintf("Clave duplicada: %s (se conserva el último valor)", path))
+		}
 
-	// 2. Eliminar comas duplicadas
-	original = s
-	re = regexp.MustCompile(`,\s*,+`)
-	s = re.ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, fmt.Sprintf("Eliminada coma duplicada: %s", match))
-		return ","
-	})
+		// Crear encoder con opciones; delimiter "auto" elige el que dé menos
+		// tokens con el resto
+		opts := req.toonOptions()
+		encoder, chosenDelimiter, err := newConversionEncoder(data, &opts)
+		if err != nil {
+			return result{err: err, code: optionsErrorCode(err)}
+		}
+		truncated, err := encoder.CheckLimits(data)
+		if err != nil {
+			return result{err: err, code: limitsErrorCode(err)}
+		}
+		// Si se acaba el tiempo EncodeTo se corta y el handler responde con
+		// lo escrito hasta entonces
+		if err := encoder.EncodeTo(partial, data, nil); err != nil {
+			return result{}
+		}
 
-	// 3. Eliminar comas antes de llaves/corchetes de cierre
-	original = s
-	s = regexp.MustCompile(`,\s*}`).ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, "Eliminada coma antes de }")
-		return "}"
-	})
-	s = regexp.MustCompile(`,\s*]`).ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, "Eliminada coma antes de ]")
-		return "]"
-	})
+		// maxTokens: además del TOON completo, fragmentos dentro del presupuesto
+		var chunks []toon.TOONChunk
+		if req.MaxTokens > 0 {
+			var chunkWarnings []string
+			chunks, chunkWarnings, err = encoder.EncodeChunks(data, req.MaxTokens, countTokens)
+			if err != nil {
+				return result{err: err, code: codeInvalidOptions}
+			}
+			warnings = append(warnings, chunkWarnings...)
+		}
+		if ctx.Err() != nil {
+			return result{}
+		}
+		toon := partial.String()
 
-	// 4. Agregar comas faltantes entre propiedades
-	original = s
-	re = regexp.MustCompile(`("\s*:\s*[^,}\]]+)\s*("[{\[])`)
-	s = re.ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, "Agregada coma faltante entre propiedades")
-		return "$1,$2"
-	})
+		tokenSavings := calculateTokenSavings(req.JSON, toon)
+		recommendation := recommendConversion(req.JSON, data, opts, tokenSavings)
 
-	// 5. Balancear llaves y corchetes
-	openBraces := strings.Count(s, "{")
-	closeBraces := strings.Count(s, "}")
-	if openBraces > closeBraces {
-		s += strings.Repeat("}", openBraces-closeBraces)
-		changes = append(changes, fmt.Sprintf("Agregadas %d llaves de cierre", openBraces-closeBraces))
-	} else if closeBraces > openBraces {
-		s = strings.Repeat("{", closeBraces-openBraces) + s
-		changes = append(changes, fmt.Sprintf("Agregadas %d llaves de apertura", closeBraces-openBraces))
-	}
-
-	openBrackets := strings.Count(s, "[")
-	closeBrackets := strings.Count(s, "]")
-	if openBrackets > closeBrackets {
-		s += strings.Repeat("]", openBrackets-closeBrackets)
-		changes = append(changes, fmt.Sprintf("Agregados %d corchetes de cierre", openBrackets-closeBrackets))
-	} else if closeBrackets > openBrackets {
-		s = strings.Repeat("[", closeBrackets-openBrackets) + s
-		changes = append(changes, fmt.Sprintf("Agregados %d corchetes de apertura", closeBrackets-openBrackets))
-	}
-
-	// 6. Agregar comillas a claves sin comillas
-	original = s
-	re = regexp.MustCompile(`([{,]\s*)([a-zA-Z_][a-zA-Z0-9_]*)\s*:`)
-	s = re.ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, "Agregadas comillas a clave sin comillas")
-		return "$1\"$2\":"
-	})
+		// Entrada normalizada: el JSON (ya corregido) sin espacios
+		var inputHash string
+		if req.InputHash {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, []byte(parsed)); err == nil {
+				inputHash = sha256Hex(compact.String())
+			}
+		}
 
-	// 7. Corregir comillas simples a dobles en claves
-	original = s
-	re = regexp.MustCompile(`'([^']*)'(\s*:)`)
-	s = re.ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, "Convertidas comillas simples a dobles en clave")
-		return "\"$1\"$2"
-	})
+		var stats *ConversionTextStats
+		if req.TextStats {
+			stats = &ConversionTextStats{JSON: textStats(req.JSON), TOON: textStats(toon)}
+		}
 
-	// 8. Corregir valores true/false/null sin comillas
-	original = s
-	re = regexp.MustCompile(`([{,]\s*"[^"]*"\s*:\s*)(true|false|null)([},])`)
-	s = re.ReplaceAllStringFunc(s, func(match string) string {
-		changes = append(changes, "Corregido valor primitivo sin comillas")
-		return "$1\"$2\"$3"
+		return result{toon: toon, tokenSavings: tokenSavings, fixed: wasFixed, changes: changes, lenient: lenient, syntax: syntax, warnings: warnings, truncated: truncated, inputHash: inputHash, chunks: chunks, recommendation: recommendation, delimiter: chosenDelimiter, textStats: stats}
 	})
 
-	return s, changes
-}
-
-type TOONOptions struct {
-	Indent       int
-	Delimiter    string // ",", "\t", "|"
-	LengthMarker bool   // true para usar '#'
-}
-
-type TOONEncoder struct {
-	indent       string
-	delimiter    string
-	lengthMarker string // "#" or ""
-}
-
-func NewTOONEncoder() *TOONEncoder {
-	return &TOONEncoder{
-		indent:       "  ", // 2 espacios
-		delimiter:    ",",
-		lengthMarker: "",
-	}
-}
-
-func NewTOONEncoderWithOptions(opts TOONOptions) (*TOONEncoder, error) {
-	indent := "  "
-	if opts.Indent > 0 {
-		indent = strings.Repeat(" ", opts.Indent)
+	if errors.Is(err, errServerBusy) {
+		writeConversionError(w, err)
+		return
 	}
-
-	delimiter := ","
-	if opts.Delimiter != "" {
-		if opts.Delimiter != "," && opts.Delimiter != "\t" && opts.Delimiter != "|" {
-			return nil, fmt.Errorf("invalid delimiter: %q (must be ',', '\\t', or '|')", opts.Delimiter)
+	if err != nil {
+		// Devolver lo ya codificado: un prefijo que termina en una clave,
+		// fila o elemento completos
+		resp := response{Error: "Tiempo de procesamiento excedido", Code: codeTimeout}
+		if toon := partial.String(); toon != "" {
+			resp.Truncated = true
+			resp.TimedOut = true
+			resp.FormatVersion = FormatVersion
+			resp.Lines = countLines(toon)
+			resp.Bytes = len(toon)
+			if !req.SavingsOnly {
+				resp.Toon = toon
+			}
 		}
-		delimiter = opts.Delimiter
-	}
-
-	lengthMarker := ""
-	if opts.LengthMarker {
-		lengthMarker = "#"
-	}
-
-	return &TOONEncoder{
-		indent:       indent,
-		delimiter:    delimiter,
-		lengthMarker: lengthMarker,
-	}, nil
-}
-
-func (e *TOONEncoder) Encode(value interface{}) string {
-	return e.encodeValue(value, 0)
-}
-
-const maxDepth = 100
-
-func (e *TOONEncoder) encodeValue(value interface{}, depth int) string {
-	if depth > maxDepth {
-		return `"[MAX_DEPTH_EXCEEDED]"`
-	}
-
-	if value == nil {
-		return "null"
+		json.NewEncoder(w).Encode(resp)
+		return
 	}
 
-	switch v := value.(type) {
-	case bool:
-		return strconv.FormatBool(v)
-	case float64:
-		return e.encodeNumber(v)
-	case string:
-		return e.encodeString(v)
-	case map[string]interface{}:
-		return e.encodeObject(v, depth)
-	case []interface{}:
-		return e.encodeArray(v, depth)
-	default:
-		return fmt.Sprintf("%v", v)
+	if res.err != nil {
+		json.NewEncoder(w).Encode(response{
+			Error:    res.err.Error(),
+			Code:     res.code,
+			Original: req.JSON,
+		})
+		return
 	}
-}
 
-func (e *TOONEncoder) encodeNumber(n float64) string {
-	if n == 0 {
-		return "0"
+	// El hash del TOON sirve de ETag: si el cliente ya tiene esta salida
+	// se responde 304 sin cuerpo. Con fragmentos la salida son ellos.
+	output := res.toon
+	if res.chunks != nil {
+		parts := make([]string, len(res.chunks))
+		for i, chunk := range res.chunks {
+			parts[i] = chunk.Toon
+		}
+		output = strings.Join(parts, "\n\x00\n")
 	}
-
-	if math.IsNaN(n) || math.IsInf(n, 0) {
-		return "null"
+	hash := sha256Hex(output)
+	etag := `"` + hash + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	// Manejar números muy grandes sin notación científica
-	if math.Abs(n) >= 1e15 {
-		return fmt.Sprintf("%.0f", n)
+	resp := response{
+		Warnings:       res.warnings,
+		Truncated:      res.truncated,
+		Lines:          countLines(res.toon),
+		Bytes:          len(res.toon),
+		Hash:           hash,
+		InputHash:      res.inputHash,
+		TokenSavings:   res.tokenSavings,
+		Recommendation: res.recommendation,
+		Delimiter:      res.delimiter,
+		TextStats:      res.textStats,
+		FormatVersion:  FormatVersion,
+	}
+
+	// savingsOnly: el TOON se genera igual para medirlo, pero no se envía.
+	// Con fragmentos se envían solo ellos.
+	if !req.SavingsOnly {
+		if res.chunks != nil {
+			resp.Chunks = res.chunks
+		} else {
+			resp.Toon = res.toon
+		}
 	}
 
-	if n >= 1e6 || (n > 0 && n <= 1e-6) {
-		return fmt.Sprintf("%.0f", n)
+	if res.fixed {
+		resp.Fixed = true
+		resp.Changes = res.changes
+		resp.Error = "JSON corregido automáticamente"
+		resp.Code = codeJSONFixed
 	}
-
-	if n == float64(int64(n)) {
-		return fmt.Sprintf("%d", int64(n))
+	if res.lenient {
+		resp.Lenient = true
+		resp.Syntax = res.syntax
+		resp.Error = "JSON leído como JSON5"
+		resp.Code = codeJSONLenient
 	}
 
-	return strconv.FormatFloat(n, 'f', -1, 64)
+	json.NewEncoder(w).Encode(resp)
 }
 
-func (e *TOONEncoder) encodeString(s string) string {
-	needsQuotes := false
+// partialWriter acumula la salida de EncodeTo y permite leerla desde otra
+// goroutine mientras se escribe. Cuando ctx termina rechaza las escrituras,
+// lo que corta EncodeTo en la siguiente parte.
+type partialWriter struct {
+	ctx context.Context
+	mu  sync.Mutex
+	buf strings.Builder
+}
 
-	if s == "" {
-		return `""`
+func (pw *partialWriter) Write(p []byte) (int, error) {
+	if err := pw.ctx.Err(); err != nil {
+		return 0, err
 	}
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.buf.Write(p)
+}
 
-	if strings.TrimSpace(s) != s {
-		needsQuotes = true
-	}
+func (pw *partialWriter) String() string {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.buf.String()
+}
 
-	// CRÍTICO: Quote si contiene el delimitador ACTIVO
-	if strings.Contains(s, e.delimiter) {
-		needsQuotes = true
-	}
+// minUsefulSavings es el ahorro (en %) por debajo del cual se recomienda
+// revisar si compensa convertir.
+const minUsefulSavings = 5.0
 
-	// Quote si contiene :, comillas, backslash, o control chars
-	if strings.ContainsAny(s, `:"'\`) ||
-		strings.Contains(s, "\n") ||
-		strings.Contains(s, "\t") ||
-		strings.Contains(s, "\r") {
-		needsQuotes = true
+// recommendConversion devuelve un consejo cuando TOON ahorra menos de
+// minUsefulSavings: prueba los otros delimitadores y, si alguno ahorra lo
+// suficiente, lo sugiere; si no, recomienda mantener JSON. Devuelve "" si el
+// ahorro ya es suficiente o no se pudo medir.
+func recommendConversion(source string, data interface{}, opts toon.TOONOptions, savings *TokenSavings) string {
+	if savings == nil || savings.Percentage >= minUsefulSavings {
+		return ""
 	}
 
-	lower := strings.ToLower(s)
-	if lower == "true" || lower == "false" || lower == "null" {
-		needsQuotes = true
-	}
-	if _, err := strconv.ParseFloat(s, 64); err == nil {
-		needsQuotes = true
+	current := opts.Delimiter
+	if current == "" {
+		current = ","
 	}
 
-	if strings.HasPrefix(s, "- ") {
-		needsQuotes = true
+	var best *TokenSavings
+	var bestDelimiter string
+	for _, delimiter := range []string{",", "\t", "|"} {
+		if delimiter == current {
+			continue
+		}
+		alt := opts
+		alt.Delimiter = delimiter
+		encoder, err := toon.NewTOONEncoderWithOptions(alt)
+		if err != nil {
+			continue
+		}
+		encoded, err := encoder.Encode(data)
+		if err != nil {
+			continue
+		}
+		altSavings := calculateTokenSavings(source, encoded)
+		if altSavings != nil && altSavings.Percentage >= minUsefulSavings &&
+			(best == nil || altSavings.Saved > best.Saved) {
+			best, bestDelimiter = altSavings, delimiter
+		}
 	}
 
-	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
-		needsQuotes = true
+	if best != nil {
+		return fmt.Sprintf("Con delimiter %q TOON ahorra %d tokens (%.2f%%); con la configuración actual el ahorro es %.2f%%", bestDelimiter, best.Saved, best.Percentage, savings.Percentage)
 	}
-
-	if needsQuotes {
-		escaped := strings.ReplaceAll(s, `\`, `\\`)
-		escaped = strings.ReplaceAll(escaped, `"`, `\"`)
-		escaped = strings.ReplaceAll(escaped, "\n", `\n`)
-		escaped = strings.ReplaceAll(escaped, "\t", `\t`)
-		escaped = strings.ReplaceAll(escaped, "\r", `\r`)
-		return `"` + escaped + `"`
+	if savings.Saved <= 0 {
+		return "Mantén JSON: TOON no reduce tokens para esta entrada con ningún delimitador"
 	}
-
-	return s
+	return fmt.Sprintf("El ahorro es pequeño (%.2f%%); puede que no compense convertir esta entrada", savings.Percentage)
 }
 
-func (e *TOONEncoder) encodeObject(obj map[string]interface{}, depth int) string {
-	if len(obj) == 0 {
-		return ""
-	}
-
-	// Ordenar claves para salida determinística
-	keys := make([]string, 0, len(obj))
-	for k := range obj {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
-	var lines []string
-	indentation := strings.Repeat(e.indent, depth)
-
-	for _, key := range keys {
-		value := obj[key]
-		encodedKey := e.encodeKey(key)
-
-		// Determinar formato según tipo de valor
-		switch v := value.(type) {
-		case map[string]interface{}:
-			if len(v) == 0 {
-				lines = append(lines, indentation+encodedKey+":")
-			} else {
-				lines = append(lines, indentation+encodedKey+":")
-				nested := e.encodeObject(v, depth+1)
-				lines = append(lines, nested)
-			}
-
-		case []interface{}:
-			arrayStr := e.encodeArray(v, depth+1)
-			if strings.Contains(arrayStr, "\n") {
-				// Array multilínea
-				lines = append(lines, indentation+encodedKey+arrayStr)
-			} else {
-				// Array inline
-				lines = append(lines, indentation+encodedKey+arrayStr)
-			}
+// sha256Hex devuelve el SHA-256 de s en hexadecimal.
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
 
-		default:
-			// Valor primitivo
-			encoded := e.encodeValue(value, depth)
-			lines = append(lines, indentation+encodedKey+": "+encoded)
+// etagMatches indica si la cabecera If-None-Match incluye etag (o es "*").
+// Las etiquetas débiles (W/"...") se comparan por su valor.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
 		}
 	}
-
-	return strings.Join(lines, "\n")
+	return false
 }
 
-func (e *TOONEncoder) encodeKeyWithDelimiter(key string, inArray bool) string {
-	// Claves necesitan comillas si:
-	// - Contienen espacios, comas, colons, comillas
-	// - Contienen brackets/braces
-	// - Comienzan con guión
-	// - Son solo números
-	// - Están vacías
+func fixJSONAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	if key == "" {
-		return `""`
+	type request struct {
+		JSON   string `json:"json"`
+		Format string `json:"format,omitempty"` // "none", "minify", "pretty"
 	}
-
-	needsQuotes := false
-
-	if inArray {
-		// En arrays, quote si contiene el delimitador activo
-		if strings.Contains(key, e.delimiter) {
-			needsQuotes = true
-		}
-		if strings.ContainsAny(key, ` :"'[]{}`) {
-			needsQuotes = true
-		}
-	} else {
-		if strings.ContainsAny(key, ` ,:"'[]{}`) {
-			needsQuotes = true
-		}
+	type response struct {
+		Fixed    string    `json:"fixed,omitempty"`
+		Error    string    `json:"error,omitempty"`
+		Code     errorCode `json:"code,omitempty"`
+		Original string    `json:"original,omitempty"`
+		Changes  []string  `json:"changes,omitempty"`
 	}
 
-	if strings.HasPrefix(key, "-") {
-		needsQuotes = true
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
 	}
-
-	if _, err := strconv.ParseFloat(key, 64); err == nil {
-		needsQuotes = true
+	if !checkInputLimit(w, "JSON", req.JSON) {
+		return
 	}
 
-	if needsQuotes {
-		if inArray {
-			escaped := strings.ReplaceAll(key, `\`, `\\`)
-			escaped = strings.ReplaceAll(escaped, `"`, `\"`)
-			return `"` + escaped + `"`
-		} else {
-			escaped := strings.ReplaceAll(key, `"`, `\"`)
-			return `"` + escaped + `"`
-		}
+	original := strings.TrimSpace(req.JSON)
+	fixed, changes := toon.FixJSON(original)
+
+	// Verificar que el JSON corregido sea válido
+	var test interface{}
+	if err := json.Unmarshal([]byte(fixed), &test); err != nil {
+		json.NewEncoder(w).Encode(response{
+			Error:    fmt.Sprintf("No se pudo corregir el JSON: %v", err),
+			Code:     codeInvalidJSON,
+			Original: original,
+		})
+		return
 	}
 
-	return key
-}
+	formatted, err := formatJSON(fixed, req.Format)
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeInvalidOptions})
+		return
+	}
 
-func (e *TOONEncoder) encodeKey(key string) string {
-	return e.encodeKeyWithDelimiter(key, false)
+	json.NewEncoder(w).Encode(response{
+		Fixed:   formatted,
+		Changes: changes,
+	})
 }
 
-// Nueva función para encodear claves en arrays tabulares
-func (e *TOONEncoder) encodeKeyForArray(key string) string {
-	return e.encodeKeyWithDelimiter(key, true)
+// formatJSON minifica o indenta JSON ya validado. Usa json.Compact/json.Indent
+// en vez de volver a serializar para no reordenar claves ni reescribir números.
+func formatJSON(s, format string) (string, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "", "none":
+		return s, nil
+	case "minify":
+		if err := json.Compact(&buf, []byte(s)); err != nil {
+			return "", err
+		}
+	case "pretty":
+		if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("formato inválido: %q (debe ser 'none', 'minify' o 'pretty')", format)
+	}
+	return buf.String(), nil
 }
 
-func (e *TOONEncoder) encodeArray(arr []interface{}, depth int) string {
-	length := len(arr)
+func explainQuotingAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	if length == 0 {
-		return "[0]:"
+	type request struct {
+		Text      string `json:"text"`
+		Delimiter string `json:"delimiter,omitempty"` // ",", "\t", "|"
 	}
-
-	// Verificar si es array tabular (todos objetos con mismas claves primitivas)
-	if isTabular, fields := e.isTabularArray(arr); isTabular {
-		return e.encodeTabularArray(arr, fields, depth)
+	type explanation struct {
+		Encoded     string `json:"encoded"`
+		Quoted      bool   `json:"quoted"`
+		Reason      string `json:"reason,omitempty"`
+		Description string `json:"description"`
 	}
-
-	// Verificar si todos son primitivos
-	if e.allPrimitive(arr) {
-		return e.encodePrimitiveArray(arr, length)
+	type response struct {
+		Value *explanation `json:"value,omitempty"` // como valor (también celdas de arrays)
+		Key   *explanation `json:"key,omitempty"`   // como clave de objeto
+		Field *explanation `json:"field,omitempty"` // como columna de cabecera tabular
+		Error string       `json:"error,omitempty"`
+		Code  errorCode    `json:"code,omitempty"`
 	}
 
-	// Formato lista (fallback)
-	return e.encodeListArray(arr, depth, length)
-}
-
-func (e *TOONEncoder) isTabularArray(arr []interface{}) (bool, []string) {
-	if len(arr) == 0 {
-		return false, nil
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
 	}
-
-	// Primer elemento debe ser objeto
-	firstObj, ok := arr[0].(map[string]interface{})
-	if !ok {
-		return false, nil
+	if !checkInputLimit(w, "Texto", req.Text) {
+		return
 	}
 
-	// Obtener claves del primer objeto (ordenadas)
-	fields := make([]string, 0, len(firstObj))
-	for k := range firstObj {
-		fields = append(fields, k)
+	encoder, err := toon.NewTOONEncoderWithOptions(toon.TOONOptions{Delimiter: req.Delimiter})
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
 	}
-	sort.Strings(fields)
-
-	// Verificar todos los elementos
-	for _, item := range arr {
-		obj, ok := item.(map[string]interface{})
-		if !ok {
-			return false, nil
-		}
-
-		// Misma cantidad de campos
-		if len(obj) != len(fields) {
-			return false, nil
-		}
-
-		// Mismos campos y todos primitivos
-		for _, field := range fields {
-			val, exists := obj[field]
-			if !exists {
-				return false, nil
-			}
 
-			// Verificar que sea primitivo
-			switch val.(type) {
-			case map[string]interface{}, []interface{}:
-				return false, nil
-			}
+	explain := func(encoded string, reason toon.QuoteReason) *explanation {
+		return &explanation{
+			Encoded:     encoded,
+			Quoted:      reason != toon.QuoteNone,
+			Reason:      string(reason),
+			Description: reason.Description(),
 		}
 	}
 
-	return true, fields
+	json.NewEncoder(w).Encode(response{
+		Value: explain(encoder.ExplainString(req.Text)),
+		Key:   explain(encoder.ExplainKey(req.Text, false)),
+		Field: explain(encoder.ExplainKey(req.Text, true)),
+	})
 }
 
-func (e *TOONEncoder) encodeTabularArray(arr []interface{}, fields []string, depth int) string {
-	length := len(arr)
-	indentation := strings.Repeat(e.indent, depth)
-
-	// Determinar delimitador para header
-	var headerDelimiter string
-	var lengthDelimiter string
-
-	switch e.delimiter {
-	case "\t":
-		headerDelimiter = " "
-		lengthDelimiter = " "
-	case "|":
-		headerDelimiter = "|"
-		lengthDelimiter = "|"
-	default: // comma
-		headerDelimiter = ","
-		lengthDelimiter = ""
-	}
-
-	// Encodear claves para el header
-	encodedFields := make([]string, len(fields))
-	for i, field := range fields {
-		encodedFields[i] = e.encodeKeyForArray(field)
-	}
-	fieldList := strings.Join(encodedFields, headerDelimiter)
-
-	header := fmt.Sprintf("[%s%d%s]{%s}:",
-		e.lengthMarker,
-		length,
-		lengthDelimiter,
-		fieldList)
-
-	// Filas - usar fields originales
-	var rows []string
-	for _, item := range arr {
-		obj := item.(map[string]interface{})
-		var values []string
-
-		for _, field := range fields { // Usar fields, no encodedFields
-			val := obj[field]
-			encoded := e.encodeValue(val, depth)
-			if s, ok := val.(string); ok {
-				encoded = e.encodeString(s)
-			}
-			values = append(values, encoded)
-		}
-
-		row := indentation + e.indent + strings.Join(values, e.delimiter)
-		rows = append(rows, row)
+// countLines cuenta las líneas de la salida TOON (0 si está vacía).
+func countLines(s string) int {
+	if s == "" {
+		return 0
 	}
-
-	return header + "\n" + strings.Join(rows, "\n")
+	return strings.Count(s, "\n") + 1
 }
 
-func (e *TOONEncoder) allPrimitive(arr []interface{}) bool {
-	for _, item := range arr {
-		switch item.(type) {
-		case map[string]interface{}, []interface{}:
-			return false
-		}
-	}
-	return true
+// calculateTokenSavings compara los tokens de la entrada original con los del
+// TOON generado. Devuelve nil si alguno de los dos no tiene tokens.
+func calculateTokenSavings(source, toon string) *TokenSavings {
+	return tokenSavings(countTokens(source), countTokens(toon))
 }
 
-func (e *TOONEncoder) encodePrimitiveArray(arr []interface{}, length int) string {
-	var values []string
-	for _, item := range arr {
-		encoded := e.encodeValue(item, 0)
-		if s, ok := item.(string); ok {
-			encoded = e.encodeString(s)
-		}
-		values = append(values, encoded)
-	}
-
-	// Delimiter marker para header
-	var delimiterMarker string
-	switch e.delimiter {
-	case "\t":
-		delimiterMarker = " "
-	case "|":
-		delimiterMarker = "|"
+// tokenSavings es calculateTokenSavings con los tokens ya contados.
+func tokenSavings(sourceTokens, toonTokens int) *TokenSavings {
+	if sourceTokens == 0 || toonTokens == 0 {
+		return nil
 	}
 
-	return fmt.Sprintf("[%s%d%s]: %s",
-		e.lengthMarker,
-		length,
-		delimiterMarker,
-		strings.Join(values, e.delimiter))
-}
-
-func (e *TOONEncoder) encodeListArray(arr []interface{}, depth int, length int) string {
-	indentation := strings.Repeat(e.indent, depth)
-
-	var lines []string
-	lines = append(lines, fmt.Sprintf("[%s%d]:", e.lengthMarker, length))
-
-	for _, item := range arr {
-		switch v := item.(type) {
-		case map[string]interface{}:
-			// Objeto en lista
-			if len(v) == 0 {
-				lines = append(lines, indentation+e.indent+"- ")
-			} else {
-				// Primera propiedad en línea del guión
-				keys := make([]string, 0, len(v))
-				for k := range v {
-					keys = append(keys, k)
-				}
-				sort.Strings(keys)
-
-				firstKey := keys[0]
-				firstVal := e.encodeValue(v[firstKey], depth+1)
-				lines = append(lines, indentation+e.indent+"- "+e.encodeKey(firstKey)+": "+firstVal)
-
-				// Resto de propiedades indentadas
-				for _, key := range keys[1:] {
-					val := e.encodeValue(v[key], depth+1)
-					lines = append(lines, indentation+e.indent+e.indent+e.encodeKey(key)+": "+val)
-				}
-			}
-
-		case []interface{}:
-			// Array en lista
-			arrayStr := e.encodeArray(v, depth+1)
-			if strings.Contains(arrayStr, "\n") {
-				// Array multilínea - indentar cada línea
-				arrayLines := strings.Split(arrayStr, "\n")
-				for i, line := range arrayLines {
-					if i == 0 {
-						lines = append(lines, indentation+e.indent+"- "+line)
-					} else {
-						lines = append(lines, indentation+e.indent+"  "+line)
-					}
-				}
-			} else {
-				// Array inline
-				lines = append(lines, indentation+e.indent+"- "+arrayStr)
-			}
-
-		default:
-			// Primitivo en lista
-			encoded := e.encodeValue(item, depth)
-			lines = append(lines, indentation+e.indent+"- "+encoded)
-		}
+	saved := sourceTokens - toonTokens
+	percentage := float64(saved) / float64(sourceTokens) * 100
+	return &TokenSavings{
+		JSON:       sourceTokens,
+		TOON:       toonTokens,
+		Saved:      saved,
+		Percentage: math.Round(percentage*100) / 100,
 	}
-
-	return strings.Join(lines, "\n")
 }
 
 func countTokensAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	type request struct {
-		Text string `json:"text"`
-	}
-	type response struct {
-		Tokens               int `json:"tokens"`
-		Words                int `json:"words"`
-		Characters           int `json:"characters"`
-		CharactersWithSpaces int `json:"charactersWithSpaces"`
+		Text  string `json:"text"`
+		Model string `json:"model,omitempty"` // elige el tokenizer; o200k_base por defecto
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxPayloadSize)
-
 	var req request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		if err.Error() == "http: request body too large" {
-			json.NewEncoder(w).Encode(response{})
-			return
-		}
-		json.NewEncoder(w).Encode(response{})
+	if !decodeRequest(w, r, &req) {
 		return
 	}
-
-	if len(req.Text) > 500000 {
-		json.NewEncoder(w).Encode(response{})
+	if !checkInputLimit(w, "Texto", req.Text) {
 		return
 	}
-
-	words := strings.Fields(req.Text)
-	resp := response{
-		Tokens:               countTokens(req.Text),
-		Words:                len(words),
-		Characters:           len(strings.ReplaceAll(req.Text, " ", "")),
-		CharactersWithSpaces: len(req.Text),
+	encoding, err := tokens.EncodingForModel(req.Model)
+	if err != nil {
+		json.NewEncoder(w).Encode(apiError{Error: err.Error(), Code: codeInvalidOptions})
+		return
 	}
 
-	json.NewEncoder(w).Encode(resp)
+	json.NewEncoder(w).Encode(textStatsFor(req.Text, encoding))
 }
 
-func countTokens(text string) int {
-	initTokenizer()
-
-	if tokenizerErr != nil {
-		// Fallback a estimación si falla
-		return countTokensEstimate(text)
-	}
-
-	tokens := tokenizer.Encode(text, nil, nil)
-	return len(tokens)
+// TextStats resume el tamaño de un texto: tokens, palabras y caracteres con
+// y sin espacios.
+type TextStats struct {
+	Tokens               int `json:"tokens"`
+	Words                int `json:"words"`
+	Characters           int `json:"characters"`
+	CharactersWithSpaces int `json:"charactersWithSpaces"`
 }
 
-// Mantener función de estimación como fallback
-func countTokensEstimate(text string) int {
-	text = strings.TrimSpace(text)
-	if text == "" {
-		return 0
-	}
+// ConversionTextStats compara la entrada y la salida de una conversión.
+type ConversionTextStats struct {
+	JSON TextStats `json:"json"`
+	TOON TextStats `json:"toon"`
+}
 
-	re := regexp.MustCompile(`\w+|[^\w\s]`)
-	basicTokens := re.FindAllString(text, -1)
+func textStats(text string) TextStats {
+	return textStatsFor(text, tokens.DefaultEncoding)
+}
 
-	totalTokens := 0
-	for _, token := range basicTokens {
-		if len(token) > 8 && regexp.MustCompile(`^[a-zA-Z]+$`).MatchString(token) {
-			if len(token) > 12 {
-				totalTokens += 3
-			} else {
-				totalTokens += 2
-			}
-		} else {
-			totalTokens += 1
-		}
+// textStatsFor es textStats contando los tokens con otra codificación.
+func textStatsFor(text, encoding string) TextStats {
+	return TextStats{
+		Tokens:               tokens.Count(text, encoding),
+		Words:                len(strings.Fields(text)),
+		Characters:           len(strings.ReplaceAll(text, " ", "")),
+		CharactersWithSpaces: len(text),
 	}
+}
 
-	return totalTokens
+func countTokens(text string) int {
+	return tokens.Count(text, tokens.DefaultEncoding)
 }
@@ -1,143 +1,887 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"toon-converter/toon"
 )
 
-func TestTOONEncoder_SimpleObject(t *testing.T) {
-	input := map[string]interface{}{
-		"id":   float64(123),
-		"name": "Alice",
+// mustEncode codifica value con e y falla el test si Encode devuelve un error.
+func mustEncode(t *testing.T, e *toon.TOONEncoder, value interface{}) string {
+	t.Helper()
+	encoded, err := e.Encode(value)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
 	}
+	return encoded
+}
 
-	encoder := NewTOONEncoder()
-	result := encoder.Encode(input)
+func TestJSONToToonAPI_Truncated(t *testing.T) {
+	body := `{"json": "[1,2,3,4,5]", "maxArrayElements": 3, "truncateArrays": true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	rec := httptest.NewRecorder()
 
-	expected := "id: 123\nname: Alice"
-	if result != expected {
-		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon      string `json:"toon"`
+		Truncated bool   `json:"truncated"`
+		Error     string `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Truncated {
+		t.Errorf("Expected truncated=true, got %+v", resp)
+	}
+	if resp.Toon != "[3]: 1,2,3\n  ... (+2)" {
+		t.Errorf("Unexpected TOON: %q", resp.Toon)
 	}
 }
 
-func TestTOONEncoder_TabularArray(t *testing.T) {
-	input := map[string]interface{}{
-		"users": []interface{}{
-			map[string]interface{}{"id": float64(1), "name": "Alice"},
-			map[string]interface{}{"id": float64(2), "name": "Bob"},
-		},
+func TestJSONToToonAPI_Strict(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantLenient bool
+	}{
+		{"lenient default", `{"json": "{\"a\": 1,}"}`, true},
+		{"strict", `{"json": "{\"a\": 1,}", "strict": true}`, false},
 	}
 
-	encoder := NewTOONEncoder()
-	result := encoder.Encode(input)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			jsonToToonAPI(rec, req)
+
+			var resp struct {
+				Toon    string `json:"toon"`
+				Lenient bool   `json:"lenient"`
+				Error   string `json:"error"`
+			}
+			json.NewDecoder(rec.Body).Decode(&resp)
 
-	expected := "users[2]{id,name}:\n    1,Alice\n    2,Bob"
-	if result != expected {
-		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+			if resp.Lenient != tt.wantLenient {
+				t.Errorf("Expected lenient=%v, got %+v", tt.wantLenient, resp)
+			}
+			if !tt.wantLenient && (resp.Toon != "" || !strings.HasPrefix(resp.Error, "JSON inválido")) {
+				t.Errorf("Expected parse error in strict mode, got %+v", resp)
+			}
+		})
 	}
 }
 
-func TestTOONEncoder_TabDelimiter(t *testing.T) {
-	input := map[string]interface{}{
-		"items": []interface{}{
-			map[string]interface{}{"id": float64(1), "name": "Widget"},
-			map[string]interface{}{"id": float64(2), "name": "Gadget"},
-		},
+func TestJSONToToonAPI_JSON5(t *testing.T) {
+	// Los comentarios y las comillas simples se leen como JSON5, sin tocar
+	// el contenido de los strings
+	body := `{"json": "{\n  // usuario\n  name: 'Ana // admin',\n  mask: 0xFF,\n}", "keySort": "none"}`
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body)))
+
+	var resp struct {
+		Toon    string    `json:"toon"`
+		Fixed   bool      `json:"fixed"`
+		Lenient bool      `json:"lenient"`
+		Syntax  []string  `json:"syntax"`
+		Code    errorCode `json:"code"`
 	}
+	json.NewDecoder(rec.Body).Decode(&resp)
 
-	opts := TOONOptions{
-		Delimiter: "\t",
+	if !resp.Lenient || resp.Fixed || resp.Code != codeJSONLenient || resp.Toon != "name: Ana // admin\nmask: 255" {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	expected := []string{"comentarios", "claves sin comillas", "strings con comillas simples", "números hexadecimales", "comas finales"}
+	if strings.Join(resp.Syntax, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected syntax %v, got %v", expected, resp.Syntax)
+	}
+}
+
+func TestJSONToToonAPI_LargeIntegers(t *testing.T) {
+	// Los enteros de más de 53 bits no pasan por float64, tampoco tras
+	// corregir el JSON ni conservando el orden de las claves
+	for _, body := range []string{
+		`{"json": "{\"id\": 9007199254740993, \"price\": 1.50}"}`,
+		`{"json": "{\"id\": 9007199254740993, \"price\": 1.50,}"}`,
+		`{"json": "{\"id\": 9007199254740993, \"price\": 1.50}", "keySort": "none"}`,
+	} {
+		rec := httptest.NewRecorder()
+		jsonToToonAPI(rec, httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body)))
+
+		var resp struct {
+			Toon string `json:"toon"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if expected := "id: 9007199254740993\nprice: 1.5"; resp.Toon != expected {
+			t.Errorf("%s: expected %q, got %q", body, expected, resp.Toon)
+		}
 	}
-	encoder, _ := NewTOONEncoderWithOptions(opts)
-	result := encoder.Encode(input)
+}
 
-	expected := "items[2 ]{id name}:\n    1\tWidget\n    2\tGadget"
-	if result != expected {
-		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+func TestJSONToToonAPI_AutoDelimiter(t *testing.T) {
+	body := `{"json": "[{\"id\": 1, \"name\": \"Smith, John\"}, {\"id\": 2, \"name\": \"Doe, Jane\"}]", "delimiter": "auto"}`
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body)))
+
+	var resp struct {
+		Toon      string `json:"toon"`
+		Delimiter string `json:"delimiter"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Delimiter == "" || resp.Delimiter == "," {
+		t.Fatalf("Expected a delimiter other than comma, got %q", resp.Delimiter)
+	}
+	encoder, _ := toon.NewTOONEncoderWithOptions(toon.TOONOptions{Delimiter: resp.Delimiter})
+	data, _ := toon.DecodeJSON(`[{"id": 1, "name": "Smith, John"}, {"id": 2, "name": "Doe, Jane"}]`, false)
+	if expected := mustEncode(t, encoder, data); resp.Toon != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, resp.Toon)
 	}
 }
 
-func TestTOONEncoder_LengthMarker(t *testing.T) {
-	input := map[string]interface{}{
-		"tags": []interface{}{"foo", "bar", "baz"},
+func TestJSONToToonAPI_FixChanges(t *testing.T) {
+	body := `{"json": "{\"name\": \"Ana\" \"ok\": true,}"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon    string   `json:"toon"`
+		Fixed   bool     `json:"fixed"`
+		Changes []string `json:"changes"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if !resp.Fixed || resp.Toon != "name: Ana\nok: true" {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+
+	expected := []string{"Eliminada coma antes de }", "Agregada coma faltante entre propiedades"}
+	if strings.Join(resp.Changes, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected changes %v, got %v", expected, resp.Changes)
 	}
+}
 
-	opts := TOONOptions{
-		LengthMarker: true,
+func TestJSONToToonAPI_LinesAndBytes(t *testing.T) {
+	body := `{"json": "{\"city\": \"São Paulo\", \"tags\": [\"a\", \"b\"]}"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon  string `json:"toon"`
+		Lines int    `json:"lines"`
+		Bytes int    `json:"bytes"`
 	}
-	encoder, _ := NewTOONEncoderWithOptions(opts)
-	result := encoder.Encode(input)
+	json.NewDecoder(rec.Body).Decode(&resp)
 
-	expected := "tags[#3]: foo,bar,baz"
-	if result != expected {
-		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	// "city: São Paulo\ntags[2]: a,b" — la ã ocupa 2 bytes
+	if resp.Lines != 2 || resp.Bytes != 29 {
+		t.Errorf("Expected 2 lines and 29 bytes, got %d lines and %d bytes (%q)", resp.Lines, resp.Bytes, resp.Toon)
 	}
 }
 
-func TestTOONEncoder_StringQuoting(t *testing.T) {
+func TestFixJSONAPI_Format(t *testing.T) {
 	tests := []struct {
-		name     string
-		input    string
+		format   string
 		expected string
 	}{
-		{"empty", "", `""`},
-		{"normal", "hello", "hello"},
-		{"with comma", "hello,world", `"hello,world"`},
-		{"with colon", "key:value", `"key:value"`},
-		{"looks like bool", "true", `"true"`},
-		{"looks like number", "123", `"123"`},
-		{"with leading space", " padded", `" padded"`},
-		{"with dash prefix", "- item", `"- item"`},
+		{"", "{\"b\": 1,  \"a\": [1, 2]}"},
+		{"none", "{\"b\": 1,  \"a\": [1, 2]}"},
+		{"minify", `{"b":1,"a":[1,2]}`},
+		{"pretty", "{\n  \"b\": 1,\n  \"a\": [\n    1,\n    2\n  ]\n}"},
 	}
 
-	encoder := NewTOONEncoder()
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := encoder.encodeString(tt.input)
-			if result != tt.expected {
-				t.Errorf("Expected %s, got %s", tt.expected, result)
+		t.Run(tt.format, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"json": `{"b": 1,  "a": [1, 2], }`, "format": tt.format})
+			req := httptest.NewRequest(http.MethodPost, "/api/fix-json", strings.NewReader(string(body)))
+			rec := httptest.NewRecorder()
+			fixJSONAPI(rec, req)
+
+			var resp struct {
+				Fixed string `json:"fixed"`
+				Error string `json:"error"`
+			}
+			json.NewDecoder(rec.Body).Decode(&resp)
+
+			if resp.Fixed != tt.expected {
+				t.Errorf("Expected %q, got %q (error: %s)", tt.expected, resp.Fixed, resp.Error)
 			}
 		})
 	}
 }
 
-func TestTOONEncoder_NestedArrays(t *testing.T) {
-	input := map[string]interface{}{
-		"matrix": []interface{}{
-			[]interface{}{float64(1), float64(2)},
-			[]interface{}{float64(3), float64(4)},
-		},
+func TestJSONToToonAPI_DuplicateKeys(t *testing.T) {
+	body := `{"json": "{\"a\": 1, \"a\": 2}"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon     string   `json:"toon"`
+		Warnings []string `json:"warnings"`
+		Error    string   `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Toon != "a: 2" || len(resp.Warnings) != 1 {
+		t.Errorf("Expected last-wins output with one warning, got %+v", resp)
+	}
+
+	body = `{"json": "{\"a\": 1, \"a\": 2}", "strict": true}`
+	req = httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	rec = httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	resp.Toon, resp.Error = "", ""
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Toon != "" || !strings.Contains(resp.Error, "claves duplicadas: a") {
+		t.Errorf("Expected duplicate key error in strict mode, got %+v", resp)
+	}
+
+	// En JSON5 se buscan en el texto original, no en el JSON canónico
+	body = `{"json": "{a: 1, 'a': 2,}"}`
+	rec = httptest.NewRecorder()
+	jsonToToonAPI(rec, httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body)))
+
+	resp.Toon, resp.Warnings = "", nil
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Toon != "a: 2" || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "Clave duplicada: a") {
+		t.Errorf("Expected a duplicate key warning for JSON5 input, got %+v", resp)
+	}
+}
+
+func TestJSONToToonAPI_SavingsOnly(t *testing.T) {
+	convert := func(body string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		jsonToToonAPI(rec, req)
+
+		var resp map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	input := `"[{\"id\": 1, \"name\": \"Alice\"}, {\"id\": 2, \"name\": \"Bob\"}]"`
+	full := convert(`{"json": ` + input + `}`)
+	dry := convert(`{"json": ` + input + `, "savingsOnly": true}`)
+
+	if _, ok := dry["toon"]; ok {
+		t.Errorf("Expected no toon field, got %v", dry)
+	}
+	if dry["tokenSavings"] == nil || !reflect.DeepEqual(dry["tokenSavings"], full["tokenSavings"]) {
+		t.Errorf("Expected same savings as full conversion, got %v vs %v", dry["tokenSavings"], full["tokenSavings"])
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("ADDR", "")
+	t.Setenv("PORT", "")
+	t.Setenv("STATIC_DIR", "")
+	t.Setenv("DEV", "")
+	if cfg := loadConfig(); cfg.Addr != ":8080" || cfg.StaticDir != "static" || cfg.Dev {
+		t.Errorf("Unexpected defaults: %+v", cfg)
 	}
 
-	encoder := NewTOONEncoder()
-	result := encoder.Encode(input)
+	t.Setenv("PORT", "9000")
+	t.Setenv("STATIC_DIR", "/srv/ui")
+	t.Setenv("DEV", "1")
+	if cfg := loadConfig(); cfg.Addr != ":9000" || cfg.StaticDir != "/srv/ui" || !cfg.Dev {
+		t.Errorf("Unexpected config: %+v", cfg)
+	}
+
+	// ADDR tiene prioridad sobre PORT
+	t.Setenv("ADDR", "127.0.0.1:7000")
+	if cfg := loadConfig(); cfg.Addr != "127.0.0.1:7000" {
+		t.Errorf("Expected ADDR to take precedence, got %q", cfg.Addr)
+	}
+}
+
+func TestStaticCacheMiddleware(t *testing.T) {
+	files := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		dev      bool
+		path     string
+		expected string
+	}{
+		{true, "/app.js", "no-store"},
+		{true, "/app.3f2a9c1d.js", "no-store"},
+		{false, "/", "no-cache"},
+		{false, "/app.js", "no-cache"},
+		{false, "/app.3f2a9c1d.js", "public, max-age=31536000, immutable"},
+		{false, "/favicon_io/favicon-32x32.png", "no-cache"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		staticCacheMiddleware(tt.dev, files).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := rec.Header().Get("Cache-Control"); got != tt.expected {
+			t.Errorf("dev=%v %s: expected %q, got %q", tt.dev, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestExplainQuotingAPI(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"text": "a|b", "delimiter": "|"})
+	req := httptest.NewRequest(http.MethodPost, "/api/explain-quoting", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	explainQuotingAPI(rec, req)
+
+	type explanation struct {
+		Encoded string `json:"encoded"`
+		Quoted  bool   `json:"quoted"`
+		Reason  string `json:"reason"`
+	}
+	var resp struct {
+		Value explanation `json:"value"`
+		Key   explanation `json:"key"`
+		Field explanation `json:"field"`
+		Error string      `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Error != "" {
+		t.Fatalf("Unexpected error: %s", resp.Error)
+	}
+	if !resp.Value.Quoted || resp.Value.Reason != "contains-delimiter" || resp.Value.Encoded != `"a|b"` {
+		t.Errorf("Unexpected value explanation: %+v", resp.Value)
+	}
+	if resp.Key.Quoted || resp.Key.Encoded != "a|b" {
+		t.Errorf("Expected object key to stay unquoted, got %+v", resp.Key)
+	}
+	if !resp.Field.Quoted || resp.Field.Reason != "contains-delimiter" {
+		t.Errorf("Unexpected field explanation: %+v", resp.Field)
+	}
+}
+
+func TestJSONToToonAPI_ETag(t *testing.T) {
+	body := `{"json": "{\"b\": 1,\n \"a\": [1, 2]}", "inputHash": true}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon      string `json:"toon"`
+		Hash      string `json:"hash"`
+		InputHash string `json:"inputHash"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Hash != sha256Hex(resp.Toon) {
+		t.Errorf("Expected hash of the TOON output, got %q", resp.Hash)
+	}
+	if resp.InputHash != sha256Hex(`{"b":1,"a":[1,2]}`) {
+		t.Errorf("Expected hash of the compacted input, got %q", resp.InputHash)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag != `"`+resp.Hash+`"` {
+		t.Fatalf("Expected ETag with the output hash, got %q", etag)
+	}
+
+	// Misma petición con If-None-Match: 304 sin cuerpo
+	req = httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	rec = httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
 
-	expected := "matrix[2]:\n    - [2]: 1,2\n    - [2]: 3,4"
-	if result != expected {
-		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected empty 304, got %d with %q", rec.Code, rec.Body.String())
+	}
+
+	// Otra salida: la ETag anterior ya no coincide
+	req = httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(`{"json": "{\"b\": 2}"}`))
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a different output, got %d", rec.Code)
 	}
 }
 
-func TestTOONEncoder_ComplexNested(t *testing.T) {
-	jsonStr := `{
-		"users": [
-			{"id": 1, "name": "Alice", "active": true},
-			{"id": 2, "name": "Bob", "active": false}
-		],
-		"metadata": {
-			"total": 2,
-			"page": 1
+func TestInputLimitCountsCharacters(t *testing.T) {
+	// 300.000 caracteres CJK ocupan 900.000 bytes: dentro del límite de
+	// caracteres aunque superen 500.000 bytes
+	cjk := strings.Repeat("漢", 300000)
+	if exceedsInputLimit(cjk) {
+		t.Error("Expected 300,000 CJK characters to be within the limit")
+	}
+	if !exceedsInputLimit(strings.Repeat("a", maxInputChars+1)) {
+		t.Error("Expected limit+1 characters to exceed the limit")
+	}
+	if exceedsInputLimit(strings.Repeat("é", maxInputChars)) {
+		t.Error("Expected exactly the limit to be accepted")
+	}
+
+	body, _ := json.Marshal(map[string]string{"json": `{"text": "` + strings.Repeat("漢", 299990) + `"}`})
+	for name, handler := range map[string]http.HandlerFunc{
+		"json-to-toon": jsonToToonAPI,
+		"fix-json":     fixJSONAPI,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/"+name, strings.NewReader(string(body)))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		var resp struct {
+			Error string `json:"error"`
 		}
-	}`
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp.Error != "" {
+			t.Errorf("%s: unexpected error for a CJK payload under the limit: %s", name, resp.Error)
+		}
+	}
+}
 
+func TestRecommendConversion(t *testing.T) {
 	var data interface{}
-	json.Unmarshal([]byte(jsonStr), &data)
+	json.Unmarshal([]byte(`{"a": 1}`), &data)
 
-	encoder := NewTOONEncoder()
-	result := encoder.Encode(data)
+	if got := recommendConversion(`{"a": 1}`, data, toon.TOONOptions{}, &TokenSavings{JSON: 100, TOON: 50, Saved: 50, Percentage: 50}); got != "" {
+		t.Errorf("Expected no recommendation with good savings, got %q", got)
+	}
+	if got := recommendConversion(`{"a": 1}`, data, toon.TOONOptions{}, nil); got != "" {
+		t.Errorf("Expected no recommendation without savings data, got %q", got)
+	}
+
+	// "a: 1" ahorra frente a '{"a": 1}' con cualquier delimitador: con un
+	// ahorro actual negativo se sugiere otro delimitador
+	got := recommendConversion(`{"a": 1}`, data, toon.TOONOptions{}, &TokenSavings{JSON: 10, TOON: 12, Saved: -2, Percentage: -20})
+	if !strings.Contains(got, "delimiter") {
+		t.Errorf("Expected an alternate delimiter suggestion, got %q", got)
+	}
+
+	// Un string que necesita comillas no ahorra con ningún delimitador
+	got = recommendConversion(`"a: b"`, "a: b", toon.TOONOptions{}, &TokenSavings{JSON: 5, TOON: 5, Saved: 0, Percentage: 0})
+	if !strings.HasPrefix(got, "Mantén JSON") {
+		t.Errorf("Expected a recommendation to keep JSON, got %q", got)
+	}
+}
 
-	expected := "metadata:\n  page: 1\n  total: 2\nusers[2]{active,id,name}:\n    true,1,Alice\n    false,2,Bob"
-	if result != expected {
-		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+func TestAPIRequestErrors(t *testing.T) {
+	handlers := map[string]http.HandlerFunc{
+		"/api/count-tokens":        countTokensAPI,
+		"/api/fix-json":            fixJSONAPI,
+		"/api/json-to-toon":        jsonToToonAPI,
+		"/api/xml-to-toon":         xmlToToonAPI,
+		"/api/transcode-toon":      transcodeToonAPI,
+		"/api/toon-to-json":        toonToJSONAPI,
+		"/api/keys-stats":          keysStatsAPI,
+		"/api/explain-quoting":     explainQuotingAPI,
+		"/api/json-to-toon/stream": jsonToToonStreamAPI,
+	}
+	longInput := strings.Repeat("a", maxInputChars+1)
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   errorCode
+	}{
+		{"invalid body", `{"json": `, http.StatusBadRequest, codeInvalidBody},
+		{"body too large", strings.Repeat(" ", maxPayloadSize+1), http.StatusRequestEntityTooLarge, codePayloadTooLarge},
+		{"input too long", `{"text": "` + longInput + `", "json": "` + longInput + `", "xml": "` + longInput + `", "toon": "` + longInput + `"}`, http.StatusRequestEntityTooLarge, codePayloadTooLarge},
+	}
+
+	for path, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(path+"/"+tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(tt.body))
+				req.Header.Set("Accept", "text/event-stream")
+				rec := httptest.NewRecorder()
+				handler(rec, req)
+
+				if rec.Code != tt.status {
+					t.Errorf("Expected status %d, got %d", tt.status, rec.Code)
+				}
+				if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+					t.Errorf("Expected a JSON error, got Content-Type %q", ct)
+				}
+				var resp map[string]interface{}
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("Error body is not JSON: %v", err)
+				}
+				if msg, _ := resp["error"].(string); msg == "" || resp["code"] != string(tt.code) || len(resp) != 2 {
+					t.Errorf("Expected only a non-empty error and code %s, got %v", tt.code, resp)
+				}
+			})
+		}
+	}
+}
+
+func TestLoadDefaultOptions(t *testing.T) {
+	t.Setenv("DEFAULT_DELIMITER", "tab")
+	t.Setenv("DEFAULT_INDENT", "4")
+	t.Setenv("DEFAULT_LENGTH_MARKER", "true")
+	opts, err := loadDefaultOptions()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if opts.Delimiter != "\t" || opts.Indent != 4 || !opts.LengthMarker {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	for name, value := range map[string]string{
+		"DEFAULT_DELIMITER":     ";",
+		"DEFAULT_INDENT":        "two",
+		"DEFAULT_LENGTH_MARKER": "maybe",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := loadDefaultOptions(); err == nil {
+				t.Errorf("Expected error for %s=%q", name, value)
+			}
+		})
+	}
+}
+
+func TestJSONToToonAPI_DefaultOptions(t *testing.T) {
+	saved := defaultOptions
+	defer func() { defaultOptions = saved }()
+	defaultOptions = toon.TOONOptions{Delimiter: "|", LengthMarker: true}
+
+	convert := func(body string) string {
+		req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		jsonToToonAPI(rec, req)
+
+		var resp struct {
+			Toon string `json:"toon"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.Toon
+	}
+
+	if toon := convert(`{"json": "{\"tags\": [\"a\", \"b\"]}"}`); toon != "tags[#2|]: a|b" {
+		t.Errorf("Expected the default style, got %q", toon)
+	}
+	// Los campos de la petición sustituyen a los valores por defecto
+	if toon := convert(`{"json": "{\"tags\": [\"a\", \"b\"]}", "delimiter": ",", "lengthMarker": false}`); toon != "tags[2]: a,b" {
+		t.Errorf("Expected request fields to override the defaults, got %q", toon)
+	}
+}
+
+func TestPartialWriter_StopsEncodeTo(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}]`), &data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	partial := &partialWriter{ctx: ctx}
+	err := toon.NewTOONEncoder().EncodeTo(partial, data, func(done, total int) {
+		if done == 2 {
+			cancel()
+		}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected EncodeTo to stop with context.Canceled, got %v", err)
+	}
+	if partial.String() != "[4]{id}:\n  1\n  2" {
+		t.Errorf("Expected the rows written before cancelling, got:\n%s", partial.String())
+	}
+}
+
+func TestJSONToToonAPI_TimeoutReturnsPartial(t *testing.T) {
+	saved := conversionTimeout
+	defer func() { conversionTimeout = saved }()
+	conversionTimeout = time.Nanosecond
+
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(`{"json": "[1, 2, 3]"}`))
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon      string `json:"toon"`
+		Truncated bool   `json:"truncated"`
+		TimedOut  bool   `json:"timedOut"`
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	// Con un límite tan corto no da tiempo a codificar nada
+	if resp.Error != "Tiempo de procesamiento excedido" || resp.Code != "TIMEOUT" || resp.Toon != "" || resp.TimedOut {
+		t.Errorf("Expected a timeout without partial output, got %+v", resp)
+	}
+}
+
+func TestJSONToToonAPI_TextStats(t *testing.T) {
+	convert := func(body string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		jsonToToonAPI(rec, req)
+
+		var resp map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	if resp := convert(`{"json": "{\"a\": 1}"}`); resp["textStats"] != nil {
+		t.Errorf("Expected no textStats unless requested, got %v", resp["textStats"])
+	}
+
+	resp := convert(`{"json": "{\"name\": \"Ana Pérez\", \"age\": 30}", "textStats": true}`)
+	raw, _ := json.Marshal(resp["textStats"])
+	var stats ConversionTextStats
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		t.Fatalf("Unexpected textStats: %s", raw)
+	}
+	if stats.JSON != textStats(`{"name": "Ana Pérez", "age": 30}`) {
+		t.Errorf("Unexpected JSON stats: %+v", stats.JSON)
+	}
+	if stats.TOON != textStats("age: 30\nname: Ana Pérez") {
+		t.Errorf("Unexpected TOON stats: %+v", stats.TOON)
+	}
+	if stats.TOON.Words != 5 || stats.JSON.Words != 5 {
+		t.Errorf("Unexpected word counts: json=%d toon=%d", stats.JSON.Words, stats.TOON.Words)
+	}
+}
+
+func TestJSONToToonAPI_MaxTokens(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"json":      `[{"id": 1}, {"id": 2}, {"id": 3}]`,
+		"maxTokens": 1000,
+		"rootKey":   "items",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	jsonToToonAPI(rec, req)
+
+	var resp struct {
+		Toon   string           `json:"toon"`
+		Chunks []toon.TOONChunk `json:"chunks"`
+		Error  string           `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Error != "" {
+		t.Fatalf("Unexpected error: %s", resp.Error)
+	}
+	if resp.Toon != "" || len(resp.Chunks) != 1 {
+		t.Fatalf("Expected only chunks in the response, got %+v", resp)
+	}
+	if resp.Chunks[0].Toon != "items[3]{id}:\n    1\n    2\n    3" {
+		t.Errorf("Unexpected chunk:\n%s", resp.Chunks[0].Toon)
+	}
+}
+
+func TestRunConversion_ConcurrencyLimit(t *testing.T) {
+	saved := conversionSlots
+	defer func() { conversionSlots = saved }()
+	conversionSlots = make(chan struct{}, 1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := runConversion(context.Background(), func(context.Context) bool {
+			started <- struct{}{}
+			<-release
+			return true
+		})
+		done <- err
+	}()
+	<-started
+
+	// Con el único hueco ocupado la conversión se rechaza sin esperar
+	if _, err := runConversion(context.Background(), func(context.Context) bool { return true }); !errors.Is(err, errServerBusy) {
+		t.Errorf("Expected errServerBusy, got %v", err)
+	}
+
+	// Cualquier endpoint que convierta comparte los huecos
+	rec := httptest.NewRecorder()
+	xmlToToonAPI(rec, httptest.NewRequest(http.MethodPost, "/api/xml-to-toon", strings.NewReader(`{"xml": "<a>1</a>"}`)))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"SERVER_BUSY"`) {
+		t.Errorf("Expected code SERVER_BUSY, got %s", rec.Body.String())
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Expected the first conversion to finish, got %v", err)
+	}
+
+	// Al terminar se libera el hueco
+	if ok, err := runConversion(context.Background(), func(context.Context) bool { return true }); err != nil || !ok {
+		t.Errorf("Expected the slot to be released, got %v %v", ok, err)
+	}
+}
+
+func TestRunConversion_Timeout(t *testing.T) {
+	saved := conversionTimeout
+	defer func() { conversionTimeout = saved }()
+	conversionTimeout = time.Nanosecond
+
+	_, err := runConversion(context.Background(), func(ctx context.Context) bool {
+		<-ctx.Done()
+		return true
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	writeConversionError(rec, err)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"code":"TIMEOUT"`) {
+		t.Errorf("Expected 200 with code TIMEOUT, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	handler := rateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	rec := request()
+	if rec.Header().Get("X-RateLimit-Limit") != "10" || rec.Header().Get("X-RateLimit-Remaining") != "9" {
+		t.Errorf("Unexpected rate limit headers: %v", rec.Header())
+	}
+	if rec.Header().Get("Retry-After") != "" {
+		t.Errorf("Expected no Retry-After on an allowed request")
+	}
+
+	// Se agota la ráfaga: la siguiente es 429 con Retry-After
+	for i := 0; i < visitorBurst-1; i++ {
+		request()
+	}
+	rec = request()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("X-RateLimit-Remaining") != "0" || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Unexpected headers on 429: %v", rec.Header())
+	}
+	if rec.Header().Get("X-RateLimit-Reset") != "2" {
+		t.Errorf("Expected the bucket to refill in 2s, got %q", rec.Header().Get("X-RateLimit-Reset"))
+	}
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	if prefixes, err := loadTrustedProxies(); err != nil || len(prefixes) != 0 {
+		t.Errorf("Expected no trusted proxies, got %v %v", prefixes, err)
+	}
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.10,fd00::/8")
+	prefixes, err := loadTrustedProxies()
+	if err != nil || len(prefixes) != 3 || prefixes[1].String() != "192.168.1.10/32" {
+		t.Errorf("Unexpected prefixes: %v %v", prefixes, err)
+	}
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+	if _, err := loadTrustedProxies(); err == nil {
+		t.Error("Expected error for an invalid CIDR")
+	}
+}
+
+func TestGetIP(t *testing.T) {
+	saved := trustedProxies
+	defer func() { trustedProxies = saved }()
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"no header", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"spoofed from untrusted peer", "203.0.113.7:1234", []string{"1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:1234", []string{"198.51.100.9"}, "198.51.100.9"},
+		// El cliente antepone una IP falsa; cuenta la que añadió el proxy
+		{"spoofed behind trusted proxy", "10.0.0.1:1234", []string{"1.2.3.4, 198.51.100.9"}, "198.51.100.9"},
+		{"chained trusted proxies", "10.0.0.1:1234", []string{"198.51.100.9, 10.0.0.2", "10.0.0.3"}, "198.51.100.9"},
+		{"only trusted hops", "10.0.0.1:1234", []string{"10.0.0.2"}, "10.0.0.2"},
+		{"malformed hop", "10.0.0.1:1234", []string{"198.51.100.9, garbage"}, "10.0.0.1"},
+		{"trusted proxy without header", "10.0.0.1:1234", nil, "10.0.0.1"},
+		{"ipv6 peer", "[2001:db8::1]:1234", []string{"1.2.3.4"}, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/json-to-toon", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if ip := getIP(req); ip != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, ip)
+		}
+	}
+}
+
+func TestLoadMaxConcurrentConversions(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_CONVERSIONS", "")
+	if n, err := loadMaxConcurrentConversions(); err != nil || n != defaultMaxConcurrentConversions {
+		t.Errorf("Expected the default, got %d %v", n, err)
+	}
+	t.Setenv("MAX_CONCURRENT_CONVERSIONS", "3")
+	if n, err := loadMaxConcurrentConversions(); err != nil || n != 3 {
+		t.Errorf("Expected 3, got %d %v", n, err)
+	}
+	t.Setenv("MAX_CONCURRENT_CONVERSIONS", "0")
+	if _, err := loadMaxConcurrentConversions(); err == nil {
+		t.Error("Expected error for a non-positive limit")
+	}
+}
+
+func TestAPIErrorCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    map[string]interface{}
+		code    errorCode
+	}{
+		{"invalid json", jsonToToonAPI, map[string]interface{}{"json": "{not json", "strict": true}, codeInvalidJSON},
+		{"unfixable json", jsonToToonAPI, map[string]interface{}{"json": "{{{"}, codeInvalidJSON},
+		{"duplicate keys", jsonToToonAPI, map[string]interface{}{"json": `{"a": 1, "a": 2}`, "strict": true}, codeDuplicateKeys},
+		{"invalid delimiter", jsonToToonAPI, map[string]interface{}{"json": "[1]", "delimiter": ";"}, codeInvalidDelimiter},
+		{"invalid keySort", jsonToToonAPI, map[string]interface{}{"json": "[1]", "keySort": "desc"}, codeInvalidOptions},
+		{"invalid include path", jsonToToonAPI, map[string]interface{}{"json": "{}", "include": []string{"a..b"}}, codeInvalidOptions},
+		{"array too large", jsonToToonAPI, map[string]interface{}{"json": "[1, 2, 3]", "maxArrayElements": 2}, codeArrayTooLarge},
+		{"fixed json", jsonToToonAPI, map[string]interface{}{"json": `{"a": 1 "b": 2}`}, codeJSONFixed},
+		{"json5", jsonToToonAPI, map[string]interface{}{"json": "{'a': 1}"}, codeJSONLenient},
+		{"fix-json unfixable", fixJSONAPI, map[string]interface{}{"json": "{{{"}, codeInvalidJSON},
+		{"fix-json format", fixJSONAPI, map[string]interface{}{"json": "[1]", "format": "tiny"}, codeInvalidOptions},
+		{"invalid xml", xmlToToonAPI, map[string]interface{}{"xml": "<a>"}, codeInvalidXML},
+		{"xml delimiter", xmlToToonAPI, map[string]interface{}{"xml": "<a/>", "delimiter": ";"}, codeInvalidDelimiter},
+		{"invalid toon", transcodeToonAPI, map[string]interface{}{"toon": "[2]: 1"}, codeInvalidTOON},
+		{"transcode delimiter", transcodeToonAPI, map[string]interface{}{"toon": "a: 1", "delimiter": ";"}, codeInvalidDelimiter},
+		{"toon-to-json strict", toonToJSONAPI, map[string]interface{}{"toon": "[2]: 1", "strict": true}, codeInvalidTOON},
+		{"toon-to-json format", toonToJSONAPI, map[string]interface{}{"toon": "a: 1", "format": "tiny"}, codeInvalidOptions},
+		{"max depth", jsonToToonAPI, map[string]interface{}{"json": `{"a": [[1]]}`, "maxDepth": 2}, codeMaxDepthExceeded},
+		{"keys-stats json", keysStatsAPI, map[string]interface{}{"json": "{"}, codeInvalidJSON},
+		{"explain delimiter", explainQuotingAPI, map[string]interface{}{"text": "a", "delimiter": ";"}, codeInvalidDelimiter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			rec := httptest.NewRecorder()
+			tt.handler(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))))
+
+			var resp struct {
+				Error string    `json:"error"`
+				Code  errorCode `json:"code"`
+			}
+			json.NewDecoder(rec.Body).Decode(&resp)
+			if resp.Error == "" || resp.Code != tt.code {
+				t.Errorf("Expected code %s with a message, got %q %q", tt.code, resp.Code, resp.Error)
+			}
+		})
 	}
 }
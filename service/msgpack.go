@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"toon-converter/toon"
+)
+
+// msgpackToToonAPI convierte un payload MessagePack, en base64 dentro del
+// JSON de la petición. Como el payload es binario, el ahorro se calcula
+// frente al JSON equivalente.
+func msgpackToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		MessagePack  []byte `json:"msgpack"` // base64
+		Delimiter    string `json:"delimiter,omitempty"`
+		LengthMarker bool   `json:"lengthMarker,omitempty"`
+		Indent       int    `json:"indent,omitempty"`
+	}
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		data, err := toon.DecodeMessagePack(req.MessagePack)
+		if err != nil {
+			return response{Error: fmt.Sprintf("MessagePack inválido: %v", err), Code: codeInvalidMessagePack}
+		}
+
+		encoder, err := toon.NewTOONEncoderWithOptions(toon.TOONOptions{
+			Delimiter:    req.Delimiter,
+			LengthMarker: req.LengthMarker,
+			Indent:       req.Indent,
+		})
+		if err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+		toon, err := encoder.Encode(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+
+		source, _ := json.Marshal(data)
+		return response{Toon: toon, TokenSavings: calculateTokenSavings(string(source), toon), FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMsgpackToToonAPI(t *testing.T) {
+	// {"id": 1, "temp": 21.5}
+	_, resp := postJSON(t, msgpackToToonAPI, "/api/msgpack-to-toon", `{"msgpack": "gqJpZAGkdGVtcMtANYAAAAAAAA==", "delimiter": "|"}`)
+	if resp["toon"] != "id: 1\ntemp: 21.5" || resp["tokenSavings"] == nil {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   errorCode
+	}{
+		{"truncated payload", `{"msgpack": "kwEC"}`, http.StatusOK, codeInvalidMessagePack},
+		{"empty payload", `{}`, http.StatusOK, codeInvalidMessagePack},
+		{"invalid delimiter", `{"msgpack": "AQ==", "delimiter": ";"}`, http.StatusOK, codeInvalidDelimiter},
+		{"not base64", `{"msgpack": "***"}`, http.StatusBadRequest, codeInvalidBody},
+	}
+	for _, tt := range tests {
+		status, resp := postJSON(t, msgpackToToonAPI, "/api/msgpack-to-toon", tt.body)
+		if status != tt.status || resp["code"] != string(tt.code) {
+			t.Errorf("%s: expected %d %s, got %d %v", tt.name, tt.status, tt.code, status, resp)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"toon-converter/toon"
+)
+
+// DecodeProto decodifica message, un mensaje protobuf binario del tipo
+// messageType ("paquete.Mensaje"), con los descriptores de descriptorSet (un
+// FileDescriptorSet serializado, como el que genera
+// `protoc --include_imports --descriptor_set_out`), y lo convierte en la
+// misma estructura genérica que produce json.Unmarshal:
+//
+//   - Los mensajes son objetos con los campos en el orden del .proto y los
+//     nombres del .proto (no los lowerCamelCase de protojson). Los campos
+//     sin valor se omiten, como en protojson.
+//   - Los enteros pasan a json.Number, también los de 64 bits (protojson los
+//     escribe entre comillas); NaN e Inf quedan como null.
+//   - Los enums se escriben por su nombre, o por su número si el descriptor
+//     no lo conoce; los bytes, en base64.
+//   - Los maps son objetos con las claves ordenadas.
+//   - Los tipos conocidos de google.protobuf (Timestamp, Duration, Struct,
+//     Any, los wrappers...) usan su forma JSON: "2024-05-01T10:30:00Z", "1.5s".
+//
+// Los campos desconocidos se ignoran.
+func DecodeProto(descriptorSet, message []byte, messageType string) (interface{}, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("FileDescriptorSet inválido: %v", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("FileDescriptorSet inválido: %v", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(messageType, ".")))
+	if err != nil {
+		return nil, fmt.Errorf("tipo de mensaje %q no encontrado en el FileDescriptorSet", messageType)
+	}
+	md, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%q no es un tipo de mensaje", messageType)
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(message, msg); err != nil {
+		return nil, fmt.Errorf("mensaje inválido: %v", err)
+	}
+	d := protoDecoder{json: protojson.MarshalOptions{UseProtoNames: true, Resolver: dynamicpb.NewTypes(files)}}
+	return d.message(msg)
+}
+
+// protoDecoder convierte mensajes dinámicos en valores genéricos; json escribe
+// los tipos conocidos.
+type protoDecoder struct {
+	json protojson.MarshalOptions
+}
+
+func (d protoDecoder) message(m protoreflect.Message) (interface{}, error) {
+	md := m.Descriptor()
+	if md.ParentFile().Package() == "google.protobuf" {
+		data, err := d.json.Marshal(m.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return toon.DecodeJSON(string(data), true)
+	}
+
+	obj := &toon.OrderedMap{Values: make(map[string]interface{})}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		value, err := d.field(fd, m.Get(fd))
+		if err != nil {
+			return nil, err
+		}
+		name := string(fd.Name())
+		obj.Keys = append(obj.Keys, name)
+		obj.Values[name] = value
+	}
+	return obj, nil
+}
+
+func (d protoDecoder) field(fd protoreflect.FieldDescriptor, v protoreflect.Value) (interface{}, error) {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		arr := make([]interface{}, list.Len())
+		for i := range arr {
+			item, err := d.singular(fd, list.Get(i))
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = item
+		}
+		return arr, nil
+	case fd.IsMap():
+		var keys []string
+		values := make(map[string]interface{})
+		var err error
+		v.Map().Range(func(k protoreflect.MapKey, item protoreflect.Value) bool {
+			var value interface{}
+			if value, err = d.singular(fd.MapValue(), item); err != nil {
+				return false
+			}
+			keys = append(keys, k.String())
+			values[k.String()] = value
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(keys)
+		return &toon.OrderedMap{Keys: keys, Values: values}, nil
+	}
+	return d.singular(fd, v)
+}
+
+// singular convierte un valor que no es una lista ni un map.
+func (d protoDecoder) singular(fd protoreflect.FieldDescriptor, v protoreflect.Value) (interface{}, error) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return d.message(v.Message())
+	case protoreflect.EnumKind:
+		if value := fd.Enum().Values().ByNumber(v.Enum()); value != nil {
+			return string(value.Name()), nil
+		}
+		return json.Number(strconv.Itoa(int(v.Enum()))), nil
+	case protoreflect.BoolKind:
+		return v.Bool(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return json.Number(strconv.FormatInt(v.Int(), 10)), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return json.Number(strconv.FormatUint(v.Uint(), 10)), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, nil
+		}
+		if fd.Kind() == protoreflect.FloatKind {
+			// Sin las cifras espurias de float32 (0.1, no 0.10000000149011612)
+			f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+		}
+		return f, nil
+	case protoreflect.StringKind:
+		return v.String(), nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes()), nil
+	}
+	return v.Interface(), nil
+}
+
+func protoToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		DescriptorSet []byte `json:"descriptorSet"` // FileDescriptorSet serializado, en base64
+		Message       []byte `json:"message"`       // mensaje binario, en base64
+		MessageType   string `json:"messageType"`   // nombre completo, p. ej. "shop.v1.Order"
+		Delimiter     string `json:"delimiter,omitempty"`
+		LengthMarker  bool   `json:"lengthMarker,omitempty"`
+		Indent        int    `json:"indent,omitempty"`
+	}
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		data, err := DecodeProto(req.DescriptorSet, req.Message, req.MessageType)
+		if err != nil {
+			return response{Error: fmt.Sprintf("Protobuf inválido: %v", err), Code: codeInvalidProtobuf}
+		}
+
+		encoder, err := toon.NewTOONEncoderWithOptions(toon.TOONOptions{
+			Delimiter:    req.Delimiter,
+			LengthMarker: req.LengthMarker,
+			Indent:       req.Indent,
+			KeySort:      "none",
+		})
+		if err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+		toon, err := encoder.Encode(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+
+		source, _ := json.Marshal(data)
+		return response{Toon: toon, TokenSavings: calculateTokenSavings(string(source), toon), FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"toon-converter/toon"
+)
+
+// orderProto describe shop.v1.Order con los campos fuera de orden alfabético:
+//
+//	message Order {
+//	  uint64 id = 1;
+//	  Status status = 2;
+//	  repeated Item items = 3;
+//	  google.protobuf.Timestamp created = 4;
+//	  map<string, int32> tags = 5;
+//	  bytes checksum = 6;
+//	}
+func orderProto(t *testing.T) (*descriptorpb.FileDescriptorSet, protoreflect.MessageDescriptor) {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("shop.proto"),
+		Package:    proto.String("shop.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATUS_UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("STATUS_PAID"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Item"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+					field("price", 2, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, "", false),
+				},
+			},
+			{
+				Name: proto.String("Order"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT64, "", false),
+					field("status", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".shop.v1.Status", false),
+					field("items", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".shop.v1.Item", true),
+					field("created", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp", false),
+					field("tags", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".shop.v1.Order.TagsEntry", true),
+					field("checksum", 6, descriptorpb.FieldDescriptorProto_TYPE_BYTES, "", false),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name:    proto.String("TagsEntry"),
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+						field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, "", false),
+					},
+				}},
+			},
+		},
+	}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+		file,
+	}}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatalf("protodesc.NewFiles: %v", err)
+	}
+	desc, err := files.FindDescriptorByName("shop.v1.Order")
+	if err != nil {
+		t.Fatalf("FindDescriptorByName: %v", err)
+	}
+	return set, desc.(protoreflect.MessageDescriptor)
+}
+
+func orderMessage(t *testing.T) ([]byte, []byte) {
+	set, md := orderProto(t)
+	order := dynamicpb.NewMessage(md)
+	fields := md.Fields()
+	order.Set(fields.ByName("id"), protoreflect.ValueOfUint64(18446744073709551615))
+	order.Set(fields.ByName("status"), protoreflect.ValueOfEnum(1))
+
+	items := order.Mutable(fields.ByName("items")).List()
+	for _, sku := range []string{"A1", "B2"} {
+		item := items.NewElement().Message()
+		item.Set(item.Descriptor().Fields().ByName("sku"), protoreflect.ValueOfString(sku))
+		item.Set(item.Descriptor().Fields().ByName("price"), protoreflect.ValueOfFloat32(0.1))
+		items.Append(protoreflect.ValueOfMessage(item))
+	}
+
+	created := order.Mutable(fields.ByName("created")).Message()
+	created.Set(created.Descriptor().Fields().ByName("seconds"), protoreflect.ValueOfInt64(1714559400))
+
+	tags := order.Mutable(fields.ByName("tags")).Map()
+	tags.Set(protoreflect.ValueOfString("vip").MapKey(), protoreflect.ValueOfInt32(1))
+	tags.Set(protoreflect.ValueOfString("gift").MapKey(), protoreflect.ValueOfInt32(0))
+	order.Set(fields.ByName("checksum"), protoreflect.ValueOfBytes([]byte("hi")))
+
+	descriptorSet, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("Marshal descriptor set: %v", err)
+	}
+	message, err := proto.Marshal(order)
+	if err != nil {
+		t.Fatalf("Marshal message: %v", err)
+	}
+	return descriptorSet, message
+}
+
+func TestDecodeProto(t *testing.T) {
+	descriptorSet, message := orderMessage(t)
+	data, err := DecodeProto(descriptorSet, message, "shop.v1.Order")
+	if err != nil {
+		t.Fatalf("DecodeProto error: %v", err)
+	}
+
+	encoder, _ := toon.NewTOONEncoderWithOptions(toon.TOONOptions{KeySort: "none"})
+	expected := "id: 18446744073709551615\n" +
+		"status: STATUS_PAID\n" +
+		"items[2]{sku,price}:\n" +
+		"    A1,0.1\n" +
+		"    B2,0.1\n" +
+		"created: \"2024-05-01T10:30:00Z\"\n" +
+		"tags:\n" +
+		"  gift: 0\n" +
+		"  vip: 1\n" +
+		"checksum: aGk="
+	if got := mustEncode(t, encoder, data); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	tests := []struct {
+		name          string
+		descriptorSet []byte
+		message       []byte
+		messageType   string
+		errMsg        string
+	}{
+		{"unknown type", descriptorSet, message, "shop.v1.Missing", "no encontrado"},
+		{"enum type", descriptorSet, message, "shop.v1.Status", "no es un tipo de mensaje"},
+		{"bad descriptor set", []byte{0xff}, message, "shop.v1.Order", "FileDescriptorSet inválido"},
+		{"truncated message", descriptorSet, message[:len(message)-1], "shop.v1.Order", "mensaje inválido"},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeProto(tt.descriptorSet, tt.message, tt.messageType); err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("%s: expected an error with %q, got %v", tt.name, tt.errMsg, err)
+		}
+	}
+}
+
+func TestProtoToToonAPI(t *testing.T) {
+	descriptorSet, message := orderMessage(t)
+	_, resp := postJSON(t, protoToToonAPI, "/api/proto-to-toon", map[string]interface{}{
+		"descriptorSet": base64.StdEncoding.EncodeToString(descriptorSet),
+		"message":       base64.StdEncoding.EncodeToString(message),
+		"messageType":   "shop.v1.Order",
+		"delimiter":     "|",
+	})
+	if toonOut, _ := resp["toon"].(string); !strings.HasPrefix(toonOut, "id: 18446744073709551615\nstatus: STATUS_PAID\nitems[2|]{sku|price}:") || resp["tokenSavings"] == nil {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+
+	_, resp = postJSON(t, protoToToonAPI, "/api/proto-to-toon", map[string]interface{}{"descriptorSet": base64.StdEncoding.EncodeToString(descriptorSet), "messageType": "Order"})
+	if resp["code"] != string(codeInvalidProtobuf) {
+		t.Errorf("Expected %s for an unqualified type name, got %v", codeInvalidProtobuf, resp)
+	}
+}
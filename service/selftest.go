@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"toon-converter/toon"
+)
+
+// selfTestAPI ejecuta los fixtures de regresión que van compilados en el
+// binario y responde con el resultado de cada uno, para comprobar el build
+// desplegado. No aparece en la interfaz.
+func selfTestAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type response struct {
+		FormatVersion string                   `json:"formatVersion"`
+		Passed        int                      `json:"passed"`
+		Failed        int                      `json:"failed"`
+		Skipped       int                      `json:"skipped"`
+		Results       []toon.ConformanceResult `json:"results"`
+	}
+
+	results, err := toon.RunConformance()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, codeInternal, "No se pudieron leer los fixtures: "+err.Error())
+		return
+	}
+
+	resp := response{FormatVersion: FormatVersion, Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case "pass":
+			resp.Passed++
+		case "fail":
+			resp.Failed++
+		default:
+			resp.Skipped++
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelfTestAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	selfTestAPI(rec, httptest.NewRequest(http.MethodGet, "/api/selftest", nil))
+
+	var resp struct {
+		Passed  int `json:"passed"`
+		Failed  int `json:"failed"`
+		Results []struct {
+			File   string `json:"file"`
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Response is not JSON: %v", err)
+	}
+	if resp.Passed == 0 || resp.Failed != 0 || len(resp.Results) != resp.Passed {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
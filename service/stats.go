@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"toon-converter/toon"
+)
+
+// maxStatsArrays limita los arrays detallados en /api/keys-stats; el resto
+// solo se cuenta.
+const maxStatsArrays = 200
+
+// StructureStats resume la forma de un documento JSON antes de convertirlo.
+type StructureStats struct {
+	Objects    int          `json:"objects"`
+	Arrays     int          `json:"arrays"`
+	MaxDepth   int          `json:"maxDepth"`
+	TotalKeys  int          `json:"totalKeys"`
+	UniqueKeys int          `json:"uniqueKeys"`
+	Details    []ArrayStats `json:"details,omitempty"`
+	// DetailsTruncated indica que había más de maxStatsArrays arrays
+	DetailsTruncated bool `json:"detailsTruncated,omitempty"`
+}
+
+// ArrayStats describe un array y cómo lo codificaría el encoder.
+type ArrayStats struct {
+	Path         string        `json:"path"`
+	Length       int           `json:"length"`
+	Format       string        `json:"format"` // "empty", "tabular", "matrix", "primitive", "list"
+	Fields       []string      `json:"fields,omitempty"`
+	TokenSavings *TokenSavings `json:"tokenSavings,omitempty"`
+}
+
+// analyzeStructure recorre value contando objetos, arrays, claves y
+// profundidad, y para cada array indica el formato que elegiría e (con
+// ArrayFormat) y el ahorro de tokens del array por separado. Las rutas
+// siguen el formato de toon.FindDuplicateKeys ("users[1].tags"); "$" es la
+// raíz.
+func analyzeStructure(value interface{}, e *toon.TOONEncoder) StructureStats {
+	var stats StructureStats
+	uniqueKeys := make(map[string]bool)
+
+	var walk func(value interface{}, path string, depth int)
+	walk = func(value interface{}, path string, depth int) {
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			stats.Objects++
+			stats.TotalKeys += len(v)
+			for _, key := range e.ObjectKeys(v) {
+				uniqueKeys[key] = true
+				keyPath := key
+				if path != "$" {
+					keyPath = path + "." + key
+				}
+				walk(v[key], keyPath, depth+1)
+			}
+
+		case []interface{}:
+			stats.Arrays++
+			if len(stats.Details) < maxStatsArrays {
+				stats.Details = append(stats.Details, arrayStats(e, v, path))
+			} else {
+				stats.DetailsTruncated = true
+			}
+			for i, item := range v {
+				prefix := path
+				if path == "$" {
+					prefix = ""
+				}
+				walk(item, fmt.Sprintf("%s[%d]", prefix, i), depth+1)
+			}
+		}
+	}
+
+	walk(value, "$", 0)
+	stats.UniqueKeys = len(uniqueKeys)
+	return stats
+}
+
+func arrayStats(e *toon.TOONEncoder, arr []interface{}, path string) ArrayStats {
+	stats := ArrayStats{Path: path, Length: len(arr)}
+	stats.Format, stats.Fields = e.ArrayFormat(arr)
+	if stats.Format == "empty" {
+		return stats
+	}
+
+	encoded, err := e.Encode(arr)
+	if err != nil {
+		return stats
+	}
+	source, _ := json.Marshal(arr)
+	stats.TokenSavings = calculateTokenSavings(string(source), encoded)
+	return stats
+}
+
+func keysStatsAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		JSON          string `json:"json"`
+		Delimiter     string `json:"delimiter,omitempty"`
+		SparseTabular bool   `json:"sparseTabular,omitempty"`
+	}
+	type response struct {
+		*StructureStats
+		Error string    `json:"error,omitempty"`
+		Code  errorCode `json:"code,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "JSON", req.JSON) {
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		data, err := toon.DecodeJSON(req.JSON, false)
+		if err != nil {
+			return response{Error: fmt.Sprintf("JSON inválido: %v", err), Code: codeInvalidJSON}
+		}
+
+		encoder, err := toon.NewTOONEncoderWithOptions(toon.TOONOptions{
+			Delimiter:     req.Delimiter,
+			SparseTabular: req.SparseTabular,
+		})
+		if err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+
+		stats := analyzeStructure(data, encoder)
+		return response{StructureStats: &stats}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+func TestAnalyzeStructure(t *testing.T) {
+	jsonStr := `{
+		"users": [
+			{"id": 1, "name": "Alice", "tags": ["a", "b"]},
+			{"id": 2, "name": "Bob", "tags": []}
+		],
+		"grid": [[1, 2], [3, 4]],
+		"meta": {"page": 1, "rows": [{"x": 1}, {"x": 2}]}
+	}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	stats := analyzeStructure(data, toon.NewTOONEncoder())
+
+	if stats.Objects != 6 || stats.Arrays != 7 || stats.MaxDepth != 4 {
+		t.Errorf("Unexpected counts: objects=%d arrays=%d maxDepth=%d", stats.Objects, stats.Arrays, stats.MaxDepth)
+	}
+	if stats.TotalKeys != 13 || stats.UniqueKeys != 9 {
+		t.Errorf("Unexpected key counts: total=%d unique=%d", stats.TotalKeys, stats.UniqueKeys)
+	}
+
+	formats := make(map[string]string)
+	for _, array := range stats.Details {
+		formats[array.Path] = array.Format
+	}
+	expected := map[string]string{
+		"grid":          "matrix",
+		"meta.rows":     "tabular",
+		"users":         "list",
+		"users[0].tags": "primitive",
+		"users[1].tags": "empty",
+		"grid[0]":       "primitive",
+	}
+	delete(formats, "grid[1]")
+	if !reflect.DeepEqual(formats, expected) {
+		t.Errorf("Expected formats %v, got %v", expected, formats)
+	}
+}
+
+func TestKeysStatsAPI(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"json":          `[{"id": 1, "name": "Alice"}, {"id": 2}]`,
+		"sparseTabular": true,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/keys-stats", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	keysStatsAPI(rec, req)
+
+	var resp struct {
+		Objects int          `json:"objects"`
+		Details []ArrayStats `json:"details"`
+		Error   string       `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Error != "" {
+		t.Fatalf("Unexpected error: %s", resp.Error)
+	}
+	if resp.Objects != 2 || len(resp.Details) != 1 {
+		t.Fatalf("Unexpected stats: %+v", resp)
+	}
+	root := resp.Details[0]
+	if root.Path != "$" || root.Format != "tabular" || !reflect.DeepEqual(root.Fields, []string{"id", "name"}) {
+		t.Errorf("Unexpected root array stats: %+v", root)
+	}
+}
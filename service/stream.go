@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"toon-converter/toon"
+)
+
+// jsonToToonStreamAPI convierte JSON a TOON enviando el progreso como
+// Server-Sent Events:
+//
+//	event: progress  {"done": 3, "total": 10, "percentage": 30}
+//	event: result    {"toon": "...", "tokenSavings": {...}}
+//	event: error     {"error": "...", "code": "INVALID_JSON"}
+//
+// El progreso cuenta las claves del objeto raíz, o las filas/elementos del
+// array raíz, y solo se envía cuando cambia el porcentaje. Si el cliente no
+// pide text/event-stream o la conexión no admite flush, responde igual que
+// /api/json-to-toon.
+func jsonToToonStreamAPI(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		jsonToToonAPI(w, r)
+		return
+	}
+
+	type request struct {
+		JSON         string `json:"json"`
+		Delimiter    string `json:"delimiter,omitempty"`
+		LengthMarker *bool  `json:"lengthMarker,omitempty"`
+		Indent       int    `json:"indent,omitempty"`
+	}
+	type progressEvent struct {
+		Done       int `json:"done"`
+		Total      int `json:"total"`
+		Percentage int `json:"percentage"`
+	}
+	type resultEvent struct {
+		Toon          string        `json:"toon"`
+		Fixed         bool          `json:"fixed,omitempty"`
+		Changes       []string      `json:"changes,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion"`
+	}
+	type errorEvent struct {
+		Error string    `json:"error"`
+		Code  errorCode `json:"code"`
+	}
+
+	// Los errores de la petición se responden antes de abrir el stream, con
+	// su código HTTP
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "JSON", req.JSON) {
+		return
+	}
+
+	// Ocupa un hueco de conversionSlots como runConversion, pero sin ella:
+	// el progreso se envía mientras la conversión sigue en marcha
+	release, err := acquireConversionSlot()
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	defer release()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(event string, data interface{}) {
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), conversionTimeout)
+	defer cancel()
+
+	progressChan := make(chan progressEvent, 16)
+	resultChan := make(chan interface{}, 1)
+
+	go func() {
+		defer close(progressChan)
+
+		wasFixed := false
+		var changes []string
+		data, err := toon.DecodeJSON(req.JSON, false)
+		if err != nil {
+			var fixed string
+			fixed, changes = toon.FixJSON(req.JSON)
+			wasFixed = true
+			if data, err = toon.DecodeJSON(fixed, false); err != nil {
+				resultChan <- errorEvent{Error: fmt.Sprintf("JSON inválido: %v", err), Code: codeInvalidJSON}
+				return
+			}
+		}
+
+		opts := toon.TOONOptions{Delimiter: req.Delimiter, Indent: req.Indent}
+		applyDefaultOptions(&opts, req.LengthMarker)
+		encoder, err := toon.NewTOONEncoderWithOptions(opts)
+		if err != nil {
+			resultChan <- errorEvent{Error: err.Error(), Code: optionsErrorCode(err)}
+			return
+		}
+		if _, err := encoder.CheckLimits(data); err != nil {
+			resultChan <- errorEvent{Error: err.Error(), Code: limitsErrorCode(err)}
+			return
+		}
+
+		var toon strings.Builder
+		last := -1
+		encoder.EncodeTo(&toon, data, func(done, total int) {
+			percentage := done * 100 / total
+			if percentage == last {
+				return
+			}
+			last = percentage
+			// Si el cliente va lento se descartan eventos intermedios
+			select {
+			case progressChan <- progressEvent{Done: done, Total: total, Percentage: percentage}:
+			case <-ctx.Done():
+			default:
+			}
+		})
+
+		resultChan <- resultEvent{
+			Toon:          toon.String(),
+			Fixed:         wasFixed,
+			Changes:       changes,
+			TokenSavings:  calculateTokenSavings(req.JSON, toon.String()),
+			FormatVersion: FormatVersion,
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-progressChan:
+			if !ok {
+				// El encoder terminó: solo queda el resultado
+				progressChan = nil
+				continue
+			}
+			send("progress", event)
+		case res := <-resultChan:
+			// Vaciar el progreso pendiente antes del resultado
+			if progressChan != nil {
+				for event := range progressChan {
+					send("progress", event)
+				}
+			}
+			if errEvent, ok := res.(errorEvent); ok {
+				send("error", errEvent)
+			} else {
+				send("result", res)
+			}
+			return
+		case <-ctx.Done():
+			send("error", errorEvent{Error: "Tiempo de procesamiento excedido", Code: codeTimeout})
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONToToonStreamAPI(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"json": `[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}]`})
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon/stream", strings.NewReader(string(body)))
+	req.Header.Set("Accept", "text/event-stream")
+	rec := httptest.NewRecorder()
+	jsonToToonStreamAPI(rec, req)
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected event stream, got %q", ct)
+	}
+
+	var events []string
+	var result struct {
+		Toon string `json:"toon"`
+	}
+	for _, block := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+		lines := strings.SplitN(block, "\n", 2)
+		event := strings.TrimPrefix(lines[0], "event: ")
+		events = append(events, event)
+		if event == "result" {
+			json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &result)
+		}
+	}
+
+	if len(events) < 2 || events[0] != "progress" || events[len(events)-1] != "result" {
+		t.Fatalf("Expected progress events followed by result, got %v", events)
+	}
+	if result.Toon != "[4]{id}:\n  1\n  2\n  3\n  4" {
+		t.Errorf("Unexpected TOON:\n%s", result.Toon)
+	}
+}
+
+func TestJSONToToonStreamAPI_FallbackWithoutSSE(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"json": `{"a": 1}`})
+	req := httptest.NewRequest(http.MethodPost, "/api/json-to-toon/stream", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	jsonToToonStreamAPI(rec, req)
+
+	var resp struct {
+		Toon string `json:"toon"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected a plain JSON response: %v", err)
+	}
+	if resp.Toon != "a: 1" {
+		t.Errorf("Expected 'a: 1', got %q", resp.Toon)
+	}
+}
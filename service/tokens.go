@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sync"
+	"unicode/utf8"
+
+	"toon-converter/tokens"
+)
+
+// maxBatchTexts limita los textos de /api/batch-count-tokens. Entre todos no
+// pueden pasar de maxInputChars caracteres.
+const maxBatchTexts = 10000
+
+// batchCountTokensAPI cuenta los tokens, palabras y caracteres de muchos
+// textos en una petición. Los resultados van en el mismo orden que los
+// textos y se calculan en paralelo con un número fijo de workers.
+func batchCountTokensAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		Texts []string `json:"texts"`
+		Model string   `json:"model,omitempty"` // elige el tokenizer; o200k_base por defecto
+	}
+	type response struct {
+		Results     []TextStats `json:"results,omitempty"`
+		TotalTokens int         `json:"totalTokens,omitempty"`
+		Encoding    string      `json:"encoding,omitempty"`
+		Error       string      `json:"error,omitempty"`
+		Code        errorCode   `json:"code,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if len(req.Texts) > maxBatchTexts {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Demasiados textos (máximo %d)", maxBatchTexts))
+		return
+	}
+	total := 0
+	for _, text := range req.Texts {
+		total += utf8.RuneCountInString(text)
+	}
+	if total > maxInputChars {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "Textos demasiado grandes (máximo 500,000 caracteres en total)")
+		return
+	}
+
+	encoding, err := tokens.EncodingForModel(req.Model)
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeInvalidOptions})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(ctx context.Context) response {
+		results := countTextsParallel(ctx, req.Texts, encoding)
+		resp := response{Results: results, Encoding: encoding}
+		for _, stats := range results {
+			resp.TotalTokens += stats.Tokens
+		}
+		return resp
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// countTextsParallel calcula textStatsFor de cada texto con hasta GOMAXPROCS
+// workers; el resultado i es el del texto i. Si ctx termina, los workers
+// dejan los textos pendientes sin contar.
+func countTextsParallel(ctx context.Context, texts []string, encoding string) []TextStats {
+	results := make([]TextStats, len(texts))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(texts) {
+		workers = len(texts)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = textStatsFor(texts[i], encoding)
+			}
+		}()
+	}
+
+feed:
+	for i := range texts {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
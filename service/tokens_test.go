@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBatchCountTokensAPI(t *testing.T) {
+	// Textos de longitudes muy distintas: cada resultado en su posición
+	texts := []string{"", "hola", strings.Repeat("palabra ", 2000), `{"id": 1}`, "a b c"}
+	for i := 0; i < 50; i++ {
+		texts = append(texts, strings.Repeat("x", i*37))
+	}
+
+	_, resp := postJSON(t, batchCountTokensAPI, "/api/batch-count-tokens", map[string]interface{}{"texts": texts, "model": "gpt-4"})
+	results, _ := resp["results"].([]interface{})
+	if len(results) != len(texts) || resp["encoding"] != "cl100k_base" {
+		t.Fatalf("Unexpected response: %v", resp["encoding"])
+	}
+	total := 0
+	for i, result := range results {
+		expected := textStatsFor(texts[i], "cl100k_base")
+		stats := result.(map[string]interface{})
+		if int(stats["tokens"].(float64)) != expected.Tokens || int(stats["charactersWithSpaces"].(float64)) != expected.CharactersWithSpaces {
+			t.Errorf("Result %d does not match text %d: %v", i, i, stats)
+		}
+		total += expected.Tokens
+	}
+	if int(resp["totalTokens"].(float64)) != total {
+		t.Errorf("Expected totalTokens %d, got %v", total, resp["totalTokens"])
+	}
+
+	if _, resp := postJSON(t, batchCountTokensAPI, "/api/batch-count-tokens", map[string]interface{}{"texts": []string{"a"}, "model": "llama-3"}); resp["code"] != string(codeInvalidOptions) {
+		t.Errorf("Expected INVALID_OPTIONS for an unknown model, got %v", resp)
+	}
+	if status, _ := postJSON(t, batchCountTokensAPI, "/api/batch-count-tokens", map[string]interface{}{"texts": make([]string, maxBatchTexts+1)}); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for too many texts, got %d", status)
+	}
+	if status, _ := postJSON(t, batchCountTokensAPI, "/api/batch-count-tokens", map[string]interface{}{"texts": []string{strings.Repeat("a", maxInputChars/2), strings.Repeat("b", maxInputChars/2+1)}}); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for too many characters, got %d", status)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"toon-converter/toon"
+)
+
+// DecodeTOML convierte un documento TOML en la misma estructura genérica que
+// produce json.Unmarshal, para pasarla al encoder TOON:
+//
+//   - Las tablas son objetos y los arrays de tablas ([[items]]) arrays de
+//     objetos, que se codifican como tabulares si son uniformes.
+//   - Los enteros pasan a json.Number, así que los int64 grandes no pierden
+//     precisión; los float inf y nan no existen en JSON y quedan como null.
+//   - Las fechas y horas pasan a string en formato RFC 3339 ("1979-05-27T07:32:00Z";
+//     las locales sin zona: "1979-05-27T07:32:00", "1979-05-27", "07:32:00"),
+//     que el encoder siempre pone entre comillas.
+//
+// El orden de las claves no se conserva.
+func DecodeTOML(input string) (interface{}, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(input, &doc); err != nil {
+		return nil, err
+	}
+	return tomlValue(doc), nil
+}
+
+// tomlValue pasa un valor decodificado por toml a los tipos de JSON.
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[key] = tomlValue(item)
+		}
+		return obj
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = tomlValue(item)
+		}
+		return arr
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = tomlValue(item)
+		}
+		return arr
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case time.Time:
+		return formatTOMLTime(v)
+	}
+	return value
+}
+
+// formatTOMLTime escribe una fecha u hora TOML como en el documento. Las
+// locales llevan una zona con nombre propio (ver toml.Decode).
+func formatTOMLTime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func tomlToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		TOML         string `json:"toml"`
+		Delimiter    string `json:"delimiter,omitempty"`
+		LengthMarker bool   `json:"lengthMarker,omitempty"`
+		Indent       int    `json:"indent,omitempty"`
+	}
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "TOML", req.TOML) {
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		data, err := DecodeTOML(req.TOML)
+		if err != nil {
+			return response{Error: fmt.Sprintf("TOML inválido: %v", err), Code: codeInvalidTOML}
+		}
+
+		encoder, err := toon.NewTOONEncoderWithOptions(toon.TOONOptions{
+			Delimiter:    req.Delimiter,
+			LengthMarker: req.LengthMarker,
+			Indent:       req.Indent,
+		})
+		if err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+		toon, err := encoder.Encode(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+
+		return response{Toon: toon, TokenSavings: calculateTokenSavings(req.TOML, toon), FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+const serversTOML = `title = "Inventario"
+max_id = 9007199254740993
+ratio = 0.5
+updated = 1979-05-27T07:32:00Z
+backup = 07:30:00
+missing = nan
+
+[owner]
+name = "Tom"
+since = 1979-05-27
+
+[[servers]]
+name = "alpha"
+ip = "10.0.0.1"
+port = 8001
+enabled = true
+
+[[servers]]
+name = "beta"
+ip = "10.0.0.2"
+port = 8002
+enabled = false
+`
+
+func TestDecodeTOML_ArrayOfTables(t *testing.T) {
+	data, err := DecodeTOML(serversTOML)
+	if err != nil {
+		t.Fatalf("DecodeTOML error: %v", err)
+	}
+
+	result := mustEncode(t, toon.NewTOONEncoder(), data)
+
+	expected := "backup: \"07:30:00\"\n" +
+		"max_id: 9007199254740993\n" +
+		"missing: null\n" +
+		"owner:\n" +
+		"  name: Tom\n" +
+		"  since: \"1979-05-27\"\n" +
+		"ratio: 0.5\n" +
+		"servers[2]{enabled,ip,name,port}:\n" +
+		"    true,10.0.0.1,alpha,8001\n" +
+		"    false,10.0.0.2,beta,8002\n" +
+		"title: Inventario\n" +
+		"updated: \"1979-05-27T07:32:00Z\""
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestDecodeTOML_Invalid(t *testing.T) {
+	for _, input := range []string{"a = ", "[a]\nb = 1\n[a]\nb = 2", "a = 1\na = 2"} {
+		if _, err := DecodeTOML(input); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestTOMLToToonAPI(t *testing.T) {
+	_, resp := postJSON(t, tomlToToonAPI, "/api/toml-to-toon", map[string]interface{}{"toml": serversTOML, "delimiter": "|"})
+	if toon, _ := resp["toon"].(string); !strings.Contains(toon, "servers[2|]{enabled|ip|name|port}:") {
+		t.Errorf("Expected pipe tabular header, got %v", resp)
+	}
+
+	if _, resp := postJSON(t, tomlToToonAPI, "/api/toml-to-toon", map[string]interface{}{"toml": "a = "}); resp["code"] != string(codeInvalidTOML) {
+		t.Errorf("Expected code INVALID_TOML, got %v", resp)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"toon-converter/toon"
+)
+
+// toonToJSONAPI convierte TOON de vuelta a JSON. Con "strict" falla en la
+// primera inconsistencia del texto; sin él la corrige y la devuelve en
+// "warnings" (ver DecodeOptions).
+func toonToJSONAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		Toon             string `json:"toon"`
+		Strict           bool   `json:"strict,omitempty"`
+		Format           string `json:"format,omitempty"`           // "none"/"minify" (por defecto) o "pretty"
+		Indent           int    `json:"indent,omitempty"`           // espacios de indentación, 0 = compacto
+		Flatten          bool   `json:"flatten,omitempty"`          // deshacer las claves aplanadas
+		FlattenSeparator string `json:"flattenSeparator,omitempty"` // "." por defecto
+		KeyFolding       bool   `json:"keyFolding,omitempty"`       // desplegar las rutas "a.b.c" sin comillas
+		AbbreviateKeys   bool   `json:"abbreviateKeys,omitempty"`   // restaurar las claves de la leyenda "# keys:"
+		CompactBooleans  bool   `json:"compactBooleans,omitempty"`  // 1/0 en columnas bool como booleanos
+		FormatVersion    string `json:"formatVersion,omitempty"`    // versión de toon, la actual por defecto
+		UseNumber        bool   `json:"useNumber,omitempty"`        // copiar los números tal cual, sin pasar por float64
+	}
+	type response struct {
+		JSON     string    `json:"json,omitempty"`
+		Warnings []string  `json:"warnings,omitempty"`
+		Error    string    `json:"error,omitempty"`
+		Code     errorCode `json:"code,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "TOON", req.Toon) {
+		return
+	}
+	if err := checkFormatVersion(req.FormatVersion); err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeUnsupportedVersion})
+		return
+	}
+	if err := checkJSONIndent(req.Indent, req.Format); err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: codeInvalidOptions})
+		return
+	}
+
+	decoder, err := toon.NewTOONDecoderWithOptions(toon.TOONOptions{
+		Flatten:          req.Flatten,
+		FlattenSeparator: req.FlattenSeparator,
+		KeyFolding:       req.KeyFolding,
+		AbbreviateKeys:   req.AbbreviateKeys,
+		CompactBooleans:  req.CompactBooleans,
+	})
+	if err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		value, warnings, err := decoder.DecodeWithOptions(req.Toon, toon.DecodeOptions{Strict: req.Strict, UseNumber: req.UseNumber})
+		if err != nil {
+			return response{Error: fmt.Sprintf("TOON inválido: %v", err), Code: codeInvalidTOON}
+		}
+
+		// Con indent se indenta al generar; si no, format decide
+		if req.Indent > 0 {
+			data, err := json.MarshalIndent(value, "", strings.Repeat(" ", req.Indent))
+			if err != nil {
+				return response{Error: fmt.Sprintf("Error al generar JSON: %v", err), Code: codeInternal}
+			}
+			return response{JSON: string(data), Warnings: warnings}
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return response{Error: fmt.Sprintf("Error al generar JSON: %v", err), Code: codeInternal}
+		}
+		formatted, err := formatJSON(string(data), req.Format)
+		if err != nil {
+			return response{Error: err.Error(), Code: codeInvalidOptions}
+		}
+		return response{JSON: formatted, Warnings: warnings}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// maxJSONIndent limita indent en /api/toon-to-json
+const maxJSONIndent = 8
+
+// checkJSONIndent valida indent de /api/toon-to-json: entre 0 (compacto) y
+// maxJSONIndent espacios. Un indent mayor que 0 sustituye a format, que
+// solo puede faltar o ser "pretty".
+func checkJSONIndent(indent int, format string) error {
+	if indent < 0 || indent > maxJSONIndent {
+		return fmt.Errorf("indent inválido: %d (debe estar entre 0 y %d)", indent, maxJSONIndent)
+	}
+	if indent > 0 && format != "" && format != "pretty" {
+		return fmt.Errorf("indent no se puede usar con format %q", format)
+	}
+	return nil
+}
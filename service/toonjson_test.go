@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+func TestTOONDecoder_DecodeWithOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  interface{}
+		warnings  int
+		strictErr string
+	}{
+		{
+			name:      "length mismatch",
+			input:     "tags[3]: a,b",
+			expected:  map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			warnings:  1,
+			strictErr: "línea 1: longitud declarada 3",
+		},
+		{
+			name:  "missing and extra cells",
+			input: "[2]{id,name}:\n  1\n  2,Bob,extra",
+			expected: []interface{}{
+				map[string]interface{}{"id": 1.0, "name": nil},
+				map[string]interface{}{"id": 2.0, "name": "Bob"},
+			},
+			warnings:  2,
+			strictErr: "línea 2: se esperaban 2 celdas, hay 1",
+		},
+		{
+			name:      "unknown escape",
+			input:     `path: "C:\dir"`,
+			expected:  map[string]interface{}{"path": "C:dir"},
+			warnings:  1,
+			strictErr: `línea 1: secuencia de escape desconocida: \d`,
+		},
+		{
+			name:      "list end marker",
+			input:     "items[2]:\n  - 1\n  - 2\n  [/3]",
+			expected:  map[string]interface{}{"items": []interface{}{1.0, 2.0}},
+			warnings:  1,
+			strictErr: "línea 4: el cierre indica 3",
+		},
+		{
+			name:     "consistent document",
+			input:    "users[1]{id,name}:\n  1  ,  Alice  ",
+			expected: map[string]interface{}{"users": []interface{}{map[string]interface{}{"id": 1.0, "name": "Alice"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, warnings, err := toon.NewTOONDecoder().DecodeWithOptions(tt.input, toon.DecodeOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error in lenient mode: %v", err)
+			}
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, value)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("Expected %d warnings, got %v", tt.warnings, warnings)
+			}
+
+			_, _, err = toon.NewTOONDecoder().DecodeWithOptions(tt.input, toon.DecodeOptions{Strict: true})
+			if tt.strictErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error in strict mode: %v", err)
+				}
+			} else if err == nil || !strings.HasPrefix(err.Error(), tt.strictErr) {
+				t.Errorf("Expected strict error starting with %q, got %v", tt.strictErr, err)
+			}
+		})
+	}
+}
+
+func TestToonToJSONAPI(t *testing.T) {
+	call := func(body map[string]interface{}) (string, []string, string) {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/toon-to-json", strings.NewReader(string(data)))
+		rec := httptest.NewRecorder()
+		toonToJSONAPI(rec, req)
+
+		var resp struct {
+			JSON     string   `json:"json"`
+			Warnings []string `json:"warnings"`
+			Error    string   `json:"error"`
+		}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.JSON, resp.Warnings, resp.Error
+	}
+
+	out, warnings, errMsg := call(map[string]interface{}{"toon": "items[3]{id,name}:\n  1,Widget\n  2"})
+	if errMsg != "" {
+		t.Fatalf("Unexpected error: %s", errMsg)
+	}
+	if out != `{"items":[{"id":1,"name":"Widget"},{"id":2,"name":null}]}` || len(warnings) != 2 {
+		t.Errorf("Unexpected lenient result: %s %v", out, warnings)
+	}
+
+	_, _, errMsg = call(map[string]interface{}{"toon": "items[3]{id,name}:\n  1,Widget\n  2", "strict": true})
+	if !strings.Contains(errMsg, "línea 3") {
+		t.Errorf("Expected a strict error with the line number, got %q", errMsg)
+	}
+
+	// useNumber: los números se copian tal cual en vez de pasar por float64
+	big := "ids[2]: 9007199254740993,1.50"
+	if out, _, _ := call(map[string]interface{}{"toon": big}); out != `{"ids":[9007199254740992,1.5]}` {
+		t.Errorf("Expected float64 rounding without useNumber, got %s", out)
+	}
+	if out, _, _ := call(map[string]interface{}{"toon": big, "useNumber": true}); out != `{"ids":[9007199254740993,1.50]}` {
+		t.Errorf("Expected exact numbers with useNumber, got %s", out)
+	}
+
+	// keyFolding despliega las rutas sin comillas
+	if out, _, _ := call(map[string]interface{}{"toon": "a.b.c: 1\n\"x.y\": 2", "keyFolding": true}); out != `{"a":{"b":{"c":1}},"x.y":2}` {
+		t.Errorf("Expected expanded paths with keyFolding, got %s", out)
+	}
+
+	// abbreviateKeys restaura las claves de la leyenda
+	if out, _, _ := call(map[string]interface{}{"toon": "# keys: k1=customer_name\nrows[2]{k1}:\n  Ana\n  Luis", "abbreviateKeys": true}); out != `{"rows":[{"customer_name":"Ana"},{"customer_name":"Luis"}]}` {
+		t.Errorf("Expected restored keys with abbreviateKeys, got %s", out)
+	}
+
+	// indent: espacios de la salida con MarshalIndent; 0 es compacto
+	tests := []struct {
+		indent   int
+		expected string
+	}{
+		{0, `{"a":[1,2],"b":{"c":true}}`},
+		{2, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {\n    \"c\": true\n  }\n}"},
+		{4, "{\n    \"a\": [\n        1,\n        2\n    ],\n    \"b\": {\n        \"c\": true\n    }\n}"},
+	}
+	for _, tt := range tests {
+		out, _, errMsg := call(map[string]interface{}{"toon": "a[2]: 1,2\nb:\n  c: true", "indent": tt.indent})
+		if errMsg != "" || out != tt.expected {
+			t.Errorf("indent %d: expected %q, got %q (%s)", tt.indent, tt.expected, out, errMsg)
+		}
+	}
+
+	for _, body := range []map[string]interface{}{
+		{"toon": "a: 1", "indent": -1},
+		{"toon": "a: 1", "indent": maxJSONIndent + 1},
+		{"toon": "a: 1", "indent": 2, "format": "minify"},
+	} {
+		if _, _, errMsg := call(body); errMsg == "" {
+			t.Errorf("Expected an error for %v", body)
+		}
+	}
+}
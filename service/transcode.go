@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"toon-converter/toon"
+)
+
+// TranscodeTOON decodifica input y lo vuelve a codificar con opts (otro
+// delimitador, indentación, marcador de longitud...). El delimitador de
+// entrada se deduce de cada header; de opts el decoder solo usa los
+// literales (TrueLiteral, EmptyNull...), así que input debe usar los mismos
+// que la salida. Las claves de objetos se reordenan según KeySort, porque el
+// decoder no conserva el orden original.
+func TranscodeTOON(input string, opts toon.TOONOptions) (string, error) {
+	// La indentación de input se deduce: la de opts es la de la salida
+	decodeOpts := opts
+	decodeOpts.Indent = 0
+	decoder, err := toon.NewTOONDecoderWithOptions(decodeOpts)
+	if err != nil {
+		return "", err
+	}
+	encoder, err := toon.NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := decoder.Decode(input)
+	if err != nil {
+		return "", err
+	}
+	return encoder.Encode(value)
+}
+
+func transcodeToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		Toon         string `json:"toon"`
+		Delimiter    string `json:"delimiter,omitempty"`
+		LengthMarker bool   `json:"lengthMarker,omitempty"`
+		Indent       int    `json:"indent,omitempty"`
+	}
+	type response struct {
+		Toon  string    `json:"toon,omitempty"`
+		Error string    `json:"error,omitempty"`
+		Code  errorCode `json:"code,omitempty"`
+		// FormatVersion es la versión de la salida; input puede ser de
+		// cualquier versión conocida
+		FormatVersion string `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "TOON", req.Toon) {
+		return
+	}
+
+	opts := toon.TOONOptions{
+		Delimiter:    req.Delimiter,
+		LengthMarker: req.LengthMarker,
+		Indent:       req.Indent,
+	}
+	if _, err := toon.NewTOONEncoderWithOptions(opts); err != nil {
+		json.NewEncoder(w).Encode(response{Error: err.Error(), Code: optionsErrorCode(err)})
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		toon, err := TranscodeTOON(req.Toon, opts)
+		if err != nil {
+			return response{Error: fmt.Sprintf("TOON inválido: %v", err), Code: codeInvalidTOON}
+		}
+		return response{Toon: toon, FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+func TestTranscodeTOON_AllDelimiterPairs(t *testing.T) {
+	jsonStr := `{
+		"users": [
+			{"id": 1, "name": "Smith, Alice", "tags": "a|b", "active": true},
+			{"id": 2, "name": "Bob", "tags": "tab\there", "active": false}
+		],
+		"scores": [1.5, 2, -3],
+		"labels": ["x y", "a,b", "p|q", ""],
+		"grid": [[1, 2], [3, 4]],
+		"items": [{"id": 1, "meta": {"x": 1}}, "plain"]
+	}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	delimiters := []string{",", "\t", "|"}
+	for _, from := range delimiters {
+		for _, to := range delimiters {
+			source, _ := toon.NewTOONEncoderWithOptions(toon.TOONOptions{Delimiter: from})
+			target, _ := toon.NewTOONEncoderWithOptions(toon.TOONOptions{Delimiter: to})
+
+			transcoded, err := TranscodeTOON(mustEncode(t, source, data), toon.TOONOptions{Delimiter: to})
+			if err != nil {
+				t.Fatalf("%q -> %q: %v", from, to, err)
+			}
+			if expected := mustEncode(t, target, data); transcoded != expected {
+				t.Errorf("%q -> %q mismatch\nExpected:\n%s\nGot:\n%s", from, to, expected, transcoded)
+			}
+
+			decoded, err := toon.NewTOONDecoder().Decode(transcoded)
+			if err != nil || !reflect.DeepEqual(decoded, data) {
+				t.Errorf("%q -> %q does not round-trip: %v", from, to, err)
+			}
+		}
+	}
+}
+
+func TestTranscodeToonAPI(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"toon": "items[2]{id,name}:\n  1,Widget\n  2,Gadget", "delimiter": "|"})
+	req := httptest.NewRequest(http.MethodPost, "/api/transcode-toon", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	transcodeToonAPI(rec, req)
+
+	var resp struct {
+		Toon  string `json:"toon"`
+		Error string `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Error != "" {
+		t.Fatalf("Unexpected error: %s", resp.Error)
+	}
+	if expected := "items[2|]{id|name}:\n    1|Widget\n    2|Gadget"; resp.Toon != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, resp.Toon)
+	}
+
+	body, _ = json.Marshal(map[string]string{"toon": "items[3]: 1,2"})
+	req = httptest.NewRequest(http.MethodPost, "/api/transcode-toon", strings.NewReader(string(body)))
+	rec = httptest.NewRecorder()
+	transcodeToonAPI(rec, req)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if !strings.HasPrefix(resp.Error, "TOON inválido") {
+		t.Errorf("Expected an invalid TOON error, got %q", resp.Error)
+	}
+}
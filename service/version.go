@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// FormatVersion es la variante del formato TOON que genera el encoder. Se
+// incluye en las respuestas de conversión ("formatVersion") para que los
+// clientes sepan qué pueden encontrarse en la salida.
+const FormatVersion = "1.2"
+
+// formatVersionInfo describe lo que añade una versión del formato respecto a
+// la anterior.
+type formatVersionInfo struct {
+	Version  string   `json:"version"`
+	Features []string `json:"features"`
+}
+
+// formatVersions son las versiones conocidas, de la más antigua a la actual.
+// Cada una es un superconjunto de la anterior, así que el decoder lee todas.
+var formatVersions = []formatVersionInfo{
+	{"1.0", []string{"objetos", "arrays tabulares, de primitivos y en lista", "marcador de longitud '#'"}},
+	{"1.1", []string{"cierre de listas '[/N]'", "marcador de recorte '... (+N)'"}},
+	{"1.2", []string{"líneas de comentario '# ...'", "headers compactos"}},
+}
+
+// checkFormatVersion devuelve un error si version no es una versión conocida
+// del formato; "" significa la actual.
+func checkFormatVersion(version string) error {
+	if version == "" {
+		return nil
+	}
+	for _, known := range formatVersions {
+		if known.Version == version {
+			return nil
+		}
+	}
+	return fmt.Errorf("versión de formato no soportada: %q (la actual es %s)", version, FormatVersion)
+}
+
+// formatVersionAPI responde con la versión del formato que genera el
+// servidor y las que acepta el decoder.
+func formatVersionAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type response struct {
+		FormatVersion string              `json:"formatVersion"`
+		Versions      []formatVersionInfo `json:"versions"`
+	}
+
+	json.NewEncoder(w).Encode(response{FormatVersion: FormatVersion, Versions: formatVersions})
+}
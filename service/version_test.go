@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormatVersionAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	formatVersionAPI(rec, httptest.NewRequest(http.MethodGet, "/api/format-version", nil))
+
+	var resp struct {
+		FormatVersion string              `json:"formatVersion"`
+		Versions      []formatVersionInfo `json:"versions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Response is not JSON: %v", err)
+	}
+	if resp.FormatVersion != FormatVersion || len(resp.Versions) == 0 {
+		t.Fatalf("Unexpected response: %+v", resp)
+	}
+	if last := resp.Versions[len(resp.Versions)-1]; last.Version != FormatVersion {
+		t.Errorf("Expected the current version last, got %s", last.Version)
+	}
+}
+
+func TestCheckFormatVersion(t *testing.T) {
+	for _, version := range []string{"", "1.0", "1.1", FormatVersion} {
+		if err := checkFormatVersion(version); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", version, err)
+		}
+	}
+	for _, version := range []string{"0.9", "2.0", "1.2.0"} {
+		if err := checkFormatVersion(version); err == nil {
+			t.Errorf("Expected %q to be rejected", version)
+		}
+	}
+}
+
+func TestFormatVersionInResponses(t *testing.T) {
+	tests := []struct {
+		path    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"/api/json-to-toon", jsonToToonAPI, `{"json": "{\"a\": 1}"}`},
+		{"/api/xml-to-toon", xmlToToonAPI, `{"xml": "<a>1</a>"}`},
+		{"/api/transcode-toon", transcodeToonAPI, `{"toon": "a: 1"}`},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+		var resp map[string]interface{}
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp["formatVersion"] != FormatVersion {
+			t.Errorf("%s: expected formatVersion %s, got %v", tt.path, FormatVersion, resp)
+		}
+	}
+}
+
+func TestToonToJSONAPI_FormatVersion(t *testing.T) {
+	// Un documento 1.0 se lee igual que uno actual
+	if _, resp := postJSON(t, toonToJSONAPI, "/api/toon-to-json", `{"toon": "tags[#2]: a,b", "formatVersion": "1.0"}`); resp["json"] != `{"tags":["a","b"]}` {
+		t.Errorf("Expected a 1.0 document to decode, got %v", resp)
+	}
+	if _, resp := postJSON(t, toonToJSONAPI, "/api/toon-to-json", `{"toon": "a: 1", "formatVersion": "9.9"}`); resp["code"] != string(codeUnsupportedVersion) {
+		t.Errorf("Expected an unsupported version error, got %v", resp)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecodeXML convierte un documento XML en la misma estructura genérica que
+// produce json.Unmarshal, para pasarla al encoder TOON:
+//
+//   - El documento es un objeto con una sola clave: el nombre del elemento raíz.
+//   - Un elemento sin atributos ni hijos es su texto (string, sin espacios
+//     alrededor; "" si está vacío).
+//   - Si no, es un objeto: los atributos van con prefijo "@" ("@id"), los hijos
+//     por su nombre local y el texto no vacío bajo "#text".
+//   - Los hijos repetidos con el mismo nombre se agrupan en un array, que se
+//     codifica como tabular si sus elementos son uniformes.
+//
+// Los valores se conservan como strings y los prefijos de namespace se
+// descartan (se usa el nombre local).
+func DecodeXML(input string) (interface{}, error) {
+	dec := xml.NewDecoder(strings.NewReader(input))
+
+	var root map[string]interface{}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root != nil {
+			return nil, fmt.Errorf("el documento XML tiene más de un elemento raíz")
+		}
+		value, err := decodeXMLElement(dec, start)
+		if err != nil {
+			return nil, err
+		}
+		root = map[string]interface{}{start.Name.Local: value}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("documento XML sin elemento raíz")
+	}
+	return root, nil
+}
+
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	obj := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		// Las declaraciones de namespace no son datos
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		obj["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			// Los hijos nunca son arrays, así que un array aquí es un grupo
+			// de hermanos repetidos
+			switch existing := obj[name].(type) {
+			case nil:
+				obj[name] = child
+			case []interface{}:
+				obj[name] = append(existing, child)
+			default:
+				obj[name] = []interface{}{existing, child}
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(obj) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				obj["#text"] = content
+			}
+			return obj, nil
+		}
+	}
+}
+
+func xmlToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		XML string `json:"xml"`
+		encodeOptions
+	}
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		Truncated     bool          `json:"truncated,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		Delimiter     string        `json:"delimiter,omitempty"` // el elegido con delimiter "auto"
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "XML", req.XML) {
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		data, err := DecodeXML(req.XML)
+		if err != nil {
+			return response{Error: fmt.Sprintf("XML inválido: %v", err), Code: codeInvalidXML}
+		}
+
+		opts := req.toonOptions()
+		encoder, chosenDelimiter, err := newConversionEncoder(data, &opts)
+		if err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+		truncated, err := encoder.CheckLimits(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+		toon, err := encoder.Encode(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+
+		return response{Toon: toon, Truncated: truncated, TokenSavings: calculateTokenSavings(req.XML, toon), Delimiter: chosenDelimiter, FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+const catalogXML = `<?xml version="1.0"?>
+<catalog xmlns="urn:example" version="2">
+  <!-- libros disponibles -->
+  <book id="b1">
+    <title>Dune</title>
+    <price>9.99</price>
+  </book>
+  <book id="b2">
+    <title>Emma</title>
+    <price>5.50</price>
+  </book>
+  <owner>
+    <name lang="es">Librería <![CDATA[Central]]></name>
+    <empty/>
+  </owner>
+</catalog>`
+
+func TestDecodeXML_NestedRepeated(t *testing.T) {
+	data, err := DecodeXML(catalogXML)
+	if err != nil {
+		t.Fatalf("DecodeXML error: %v", err)
+	}
+
+	result := mustEncode(t, toon.NewTOONEncoder(), data)
+
+	expected := "catalog:\n" +
+		"  @version: \"2\"\n" +
+		"  book[2]{@id,price,title}:\n" +
+		"      b1,\"9.99\",Dune\n" +
+		"      b2,\"5.50\",Emma\n" +
+		"  owner:\n" +
+		"    empty: \"\"\n" +
+		"    name:\n" +
+		"      #text: Librería Central\n" +
+		"      @lang: es"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestDecodeXML_Invalid(t *testing.T) {
+	for _, input := range []string{"", "<a><b></a>", "<a/><b/>"} {
+		if _, err := DecodeXML(input); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}
+
+func TestXMLToToonAPI(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{"xml": catalogXML, "delimiter": "|"})
+	req := httptest.NewRequest(http.MethodPost, "/api/xml-to-toon", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	xmlToToonAPI(rec, req)
+
+	var resp struct {
+		Toon  string `json:"toon"`
+		Error string `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Error != "" {
+		t.Fatalf("Unexpected error: %s", resp.Error)
+	}
+	if !strings.Contains(resp.Toon, "book[2|]{@id|price|title}:") {
+		t.Errorf("Expected pipe tabular header, got:\n%s", resp.Toon)
+	}
+}
+
+func TestXMLToToonAPI_EncodeOptions(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{"xml": catalogXML, "maxArrayElements": 1, "truncateArrays": true, "lengthMarker": true})
+	req := httptest.NewRequest(http.MethodPost, "/api/xml-to-toon", strings.NewReader(string(body)))
+	rec := httptest.NewRecorder()
+	xmlToToonAPI(rec, req)
+
+	var resp struct {
+		Toon      string `json:"toon"`
+		Truncated bool   `json:"truncated"`
+		Error     string `json:"error"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	if resp.Error != "" {
+		t.Fatalf("Unexpected error: %s", resp.Error)
+	}
+	if !resp.Truncated || !strings.Contains(resp.Toon, "book[#1]{@id,price,title}:") {
+		t.Errorf("Expected the book array cut to one row, got truncated=%v:\n%s", resp.Truncated, resp.Toon)
+	}
+
+	// Las opciones inválidas responden 200 con su código, como en las demás rutas
+	if status, resp := postJSON(t, xmlToToonAPI, "/api/xml-to-toon", `{"xml": "<a>1</a>", "keySort": "sideways"}`); status != http.StatusOK || resp["code"] != string(codeInvalidOptions) {
+		t.Errorf("Expected 200 with INVALID_OPTIONS, got %d %v", status, resp)
+	}
+}
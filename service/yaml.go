@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"toon-converter/toon"
+)
+
+func yamlToToonAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type request struct {
+		YAML string `json:"yaml"`
+		encodeOptions
+	}
+	type response struct {
+		Toon          string        `json:"toon,omitempty"`
+		Error         string        `json:"error,omitempty"`
+		Code          errorCode     `json:"code,omitempty"`
+		Truncated     bool          `json:"truncated,omitempty"`
+		TokenSavings  *TokenSavings `json:"tokenSavings,omitempty"`
+		Delimiter     string        `json:"delimiter,omitempty"` // el elegido con delimiter "auto"
+		FormatVersion string        `json:"formatVersion,omitempty"`
+	}
+
+	var req request
+	if !decodeRequest(w, r, &req) {
+		return
+	}
+	if !checkInputLimit(w, "YAML", req.YAML) {
+		return
+	}
+
+	resp, err := runConversion(r.Context(), func(context.Context) response {
+		data, err := toon.DecodeYAML(req.YAML)
+		if err != nil {
+			return response{Error: fmt.Sprintf("YAML inválido: %v", err), Code: codeInvalidYAML}
+		}
+
+		opts := req.toonOptions()
+		encoder, chosenDelimiter, err := newConversionEncoder(data, &opts)
+		if err != nil {
+			return response{Error: err.Error(), Code: optionsErrorCode(err)}
+		}
+		truncated, err := encoder.CheckLimits(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+		toon, err := encoder.Encode(data)
+		if err != nil {
+			return response{Error: err.Error(), Code: limitsErrorCode(err)}
+		}
+
+		return response{Toon: toon, Truncated: truncated, TokenSavings: calculateTokenSavings(req.YAML, toon), Delimiter: chosenDelimiter, FormatVersion: FormatVersion}
+	})
+	if err != nil {
+		writeConversionError(w, err)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
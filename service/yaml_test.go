@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYAMLToToonAPI(t *testing.T) {
+	servers := "servers:\n  - name: alpha\n    port: 8001\n  - name: beta\n    port: 8002\n"
+	_, resp := postJSON(t, yamlToToonAPI, "/api/yaml-to-toon", map[string]interface{}{"yaml": servers, "delimiter": "|"})
+	if toon, _ := resp["toon"].(string); !strings.Contains(toon, "servers[2|]{name|port}:") || resp["tokenSavings"] == nil {
+		t.Errorf("Expected pipe tabular header, got %v", resp)
+	}
+
+	// Las opciones de /api/json-to-toon también valen aquí
+	_, resp = postJSON(t, yamlToToonAPI, "/api/yaml-to-toon", map[string]interface{}{"yaml": servers, "rootKey": "config", "exclude": []string{"servers.*.port"}, "lengthMarker": true})
+	if toon, _ := resp["toon"].(string); toon != "config:\n  servers[#2]{name}:\n      alpha\n      beta" {
+		t.Errorf("Expected the json-to-toon options to apply, got %v", resp)
+	}
+
+	_, resp = postJSON(t, yamlToToonAPI, "/api/yaml-to-toon", map[string]interface{}{"yaml": servers, "maxArrayElements": 1})
+	if resp["code"] != string(codeArrayTooLarge) {
+		t.Errorf("Expected code ARRAY_TOO_LARGE, got %v", resp)
+	}
+	_, resp = postJSON(t, yamlToToonAPI, "/api/yaml-to-toon", map[string]interface{}{"yaml": servers, "maxArrayElements": 1, "truncateArrays": true})
+	if resp["truncated"] != true {
+		t.Errorf("Expected a truncated response, got %v", resp)
+	}
+	_, resp = postJSON(t, yamlToToonAPI, "/api/yaml-to-toon", map[string]interface{}{"yaml": "a:\n  b:\n    c: 1\n", "maxDepth": 2})
+	if resp["code"] != string(codeMaxDepthExceeded) {
+		t.Errorf("Expected code MAX_DEPTH_EXCEEDED, got %v", resp)
+	}
+
+	if _, resp := postJSON(t, yamlToToonAPI, "/api/yaml-to-toon", map[string]interface{}{"yaml": "a: [1, 2"}); resp["code"] != string(codeInvalidYAML) {
+		t.Errorf("Expected code INVALID_YAML, got %v", resp)
+	}
+}
@@ -22,7 +22,9 @@ async function performToolRequest(endpoint, payload, resultElement, buttonElemen
     });
 
     if (!res.ok) {
-      throw new Error(`Server error: ${res.status}`);
+      // Error envelope shared by all endpoints: {"error": "..."}
+      const body = await res.json().catch(() => null);
+      throw new Error(body && body.error ? body.error : `Server error: ${res.status}`);
     }
 
     const contentType = res.headers.get('content-type');
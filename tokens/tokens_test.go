@@ -0,0 +1,92 @@
+package tokens
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"toon-converter/toon"
+)
+
+func TestEncodingForModel(t *testing.T) {
+	tests := []struct {
+		model    string
+		expected string
+	}{
+		{"", "o200k_base"},
+		{"gpt-4o", "o200k_base"},
+		{"gpt-4o-2024-05-13", "o200k_base"},
+		{"gpt-4.1-mini", "o200k_base"},
+		{"gpt-5-mini", "o200k_base"},
+		{"o3-mini", "o200k_base"},
+		{"gpt-4", "cl100k_base"},
+		{"gpt-4-32k", "cl100k_base"},
+		{"gpt-3.5-turbo-0125", "cl100k_base"},
+		{"text-embedding-3-small", "cl100k_base"},
+		{"text-davinci-003", "p50k_base"},
+		{"davinci", "r50k_base"},
+	}
+	for _, tt := range tests {
+		if encoding, err := EncodingForModel(tt.model); err != nil || encoding != tt.expected {
+			t.Errorf("EncodingForModel(%q) = %q, %v; expected %q", tt.model, encoding, err, tt.expected)
+		}
+	}
+
+	if _, err := EncodingForModel("llama-3"); err == nil {
+		t.Error("Expected error for an unknown model")
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{"hello world", 2},
+		{`{"name": "John"}`, 6},     // {" name ": " John "}
+		{"12345678", 3},             // 123 456 78
+		{"internationalization", 4}, // palabra larga
+		{"users[2]{id,name}:\n  1,Alice\n  2,Bob", 16},
+		{"東京タワー", 5},
+	}
+
+	for _, tt := range tests {
+		if got := Estimate(tt.input); got != tt.expected {
+			t.Errorf("Estimate(%q) = %d, expected %d", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestEstimate_MatchesTokenizer compara la estimación con o200k_base en
+// muestras de JSON, TOON y texto. Necesita poder cargar el tokenizer
+// (descarga el vocabulario la primera vez); si no, se salta.
+func TestEstimate_MatchesTokenizer(t *testing.T) {
+	tokenizer, err := getTokenizer(DefaultEncoding)
+	if err != nil {
+		t.Skipf("tokenizer no disponible: %v", err)
+	}
+
+	users := `[{"id": 1, "name": "Alice", "email": "alice@example.com", "active": true}, {"id": 2, "name": "Bob", "email": "bob@example.com", "active": false}]`
+	var data interface{}
+	json.Unmarshal([]byte(users), &data)
+
+	encoded, err := toon.NewTOONEncoder().Encode(data)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	samples := []string{
+		users,
+		encoded,
+		`{"order": {"id": "A-1042", "items": [{"sku": "X1", "qty": 3, "price": 9.99}], "total": 29.97, "notes": null}}`,
+		"The quick brown fox jumps over the lazy dog while the configuration is being internationalized.",
+	}
+	for _, sample := range samples {
+		actual := len(tokenizer.Encode(sample, nil, nil))
+		estimate := Estimate(sample)
+		if diff := math.Abs(float64(estimate-actual)) / float64(actual); diff > 0.25 {
+			t.Errorf("Estimate %d is %.0f%% off the real count %d for:\n%s", estimate, diff*100, actual, sample)
+		}
+	}
+}
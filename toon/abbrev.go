@@ -0,0 +1,154 @@
+package toon
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keyLegendPrefix empieza el comentario con la leyenda de AbbreviateKeys:
+// "# keys: k1=transaction_identifier, k2=customer_name".
+const keyLegendPrefix = "# keys: "
+
+// keyAlias es una clave abreviada y el alias que la sustituye.
+type keyAlias struct {
+	alias string
+	key   string
+}
+
+// keyAliases elige los alias de AbbreviateKeys para value: cada clave que
+// aparece en al menos dos objetos y es más larga que su alias recibe "k1",
+// "k2"... por orden alfabético. Se saltan los alias que ya son claves de
+// value, para que la leyenda no sea ambigua.
+func keyAliases(value interface{}) []keyAlias {
+	counts := make(map[string]int)
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, item := range v {
+				counts[key]++
+				walk(item)
+			}
+		case *OrderedMap:
+			for key, item := range v.Values {
+				counts[key]++
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(value)
+
+	keys := make([]string, 0, len(counts))
+	for key, count := range counts {
+		if count >= 2 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var aliases []keyAlias
+	next := 1
+	for _, key := range keys {
+		alias := "k" + strconv.Itoa(next)
+		for counts[alias] > 0 {
+			next++
+			alias = "k" + strconv.Itoa(next)
+		}
+		if len(key) <= len(alias) {
+			continue
+		}
+		aliases = append(aliases, keyAlias{alias: alias, key: key})
+		next++
+	}
+	return aliases
+}
+
+// renameKeys devuelve una copia de value con las claves de names cambiadas
+// por su valor, en cualquier nivel. Los *OrderedMap conservan su orden.
+func renameKeys(value interface{}, names map[string]string) interface{} {
+	rename := func(key string) string {
+		if name, ok := names[key]; ok {
+			return name
+		}
+		return key
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			renamed[rename(key)] = renameKeys(item, names)
+		}
+		return renamed
+	case *OrderedMap:
+		renamed := &OrderedMap{Keys: make([]string, len(v.Keys)), Values: make(map[string]interface{}, len(v.Values)), fixedOrder: v.fixedOrder}
+		for i, key := range v.Keys {
+			renamed.Keys[i] = rename(key)
+		}
+		for key, item := range v.Values {
+			renamed.Values[rename(key)] = renameKeys(item, names)
+		}
+		return renamed
+	case []interface{}:
+		renamed := make([]interface{}, len(v))
+		for i, item := range v {
+			renamed[i] = renameKeys(item, names)
+		}
+		return renamed
+	}
+	return value
+}
+
+// applyKeyAliases aplica AbbreviateKeys a value y devuelve el resultado con
+// la línea de leyenda, o value y "" si ninguna clave merece un alias.
+func (e *TOONEncoder) applyKeyAliases(value interface{}) (interface{}, string) {
+	aliases := keyAliases(value)
+	if len(aliases) == 0 {
+		return value, ""
+	}
+
+	names := make(map[string]string, len(aliases))
+	entries := make([]string, len(aliases))
+	for i, a := range aliases {
+		names[a.key] = a.alias
+		entries[i] = a.alias + "=" + e.encodeKey(a.key)
+	}
+	return renameKeys(value, names), keyLegendPrefix + strings.Join(entries, ", ")
+}
+
+// parseKeyLegend busca la leyenda de AbbreviateKeys en las primeras líneas
+// de input (antes de cualquier contenido) y devuelve cada alias con su clave,
+// o nil si no la hay.
+func parseKeyLegend(input string) map[string]string {
+	for _, raw := range strings.Split(input, "\n") {
+		text := strings.TrimSpace(raw)
+		if text == "" {
+			continue
+		}
+		if !strings.HasPrefix(text, keyLegendPrefix) {
+			if isCommentLine(text) {
+				continue
+			}
+			return nil
+		}
+
+		names := make(map[string]string)
+		for _, entry := range splitDelimited(strings.TrimPrefix(text, keyLegendPrefix), ",") {
+			alias, key, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || alias == "" {
+				continue
+			}
+			if strings.HasPrefix(key, `"`) && closingQuote(key) == len(key)-1 {
+				key = unescapeTOON(key[1 : len(key)-1])
+			}
+			names[alias] = key
+		}
+		return names
+	}
+	return nil
+}
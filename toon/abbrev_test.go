@@ -0,0 +1,94 @@
+package toon
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTOONEncoder_AbbreviateKeys(t *testing.T) {
+	input := `{
+		"transactions": [
+			{"transaction_identifier": "t1", "amount": 10, "details": {"customer_name": "Ana"}},
+			{"transaction_identifier": "t2", "amount": 20, "details": {"customer_name": "Luis"}}
+		],
+		"k1": "ocupado",
+		"id": 7
+	}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	opts := TOONOptions{AbbreviateKeys: true}
+	encoder, err := NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := mustEncode(t, encoder, data)
+
+	// "k1" ya es una clave, así que el primer alias es "k2"; "id" y
+	// "transactions" aparecen una sola vez
+	expected := "# keys: k2=amount, k3=customer_name, k4=details, k5=transaction_identifier\n" +
+		"id: 7\n" +
+		"k1: ocupado\n" +
+		"transactions[2]:\n" +
+		"    - k2: 10\n" +
+		"      k4:\n" +
+		"        k3: Ana\n" +
+		"      k5: t1\n" +
+		"    - k2: 20\n" +
+		"      k4:\n" +
+		"        k3: Luis\n" +
+		"      k5: t2"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	var buf bytes.Buffer
+	if err := encoder.EncodeTo(&buf, data, nil); err != nil || buf.String() != expected {
+		t.Errorf("EncodeTo differs from Encode (%v):\n%s", err, buf.String())
+	}
+
+	decoder, _ := NewTOONDecoderWithOptions(opts)
+	decoded, err := decoder.Decode(result)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Round trip mismatch:\n%v\n%v", decoded, data)
+	}
+
+	// Sin la opción el decoder deja los alias
+	if plain, _ := NewTOONDecoder().Decode(result); plain.(map[string]interface{})["k1"] != "ocupado" || plain.(map[string]interface{})["transactions"].([]interface{})[0].(map[string]interface{})["k2"] == nil {
+		t.Errorf("Expected aliases without AbbreviateKeys, got %v", plain)
+	}
+}
+
+func TestTOONEncoder_AbbreviateKeys_NoLegend(t *testing.T) {
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{AbbreviateKeys: true})
+
+	// Claves únicas o tan cortas como su alias: no hay leyenda
+	for input, expected := range map[string]string{
+		`{"name": "Ana", "age": 30}`:     "age: 30\nname: Ana",
+		`[{"id": 1, "x": 2}, {"id": 3}]`: "[2]:\n  - id: 1\n    x: 2\n  - id: 3",
+	} {
+		var data interface{}
+		json.Unmarshal([]byte(input), &data)
+		if result := mustEncode(t, encoder, data); result != expected {
+			t.Errorf("%s: expected:\n%s\nGot:\n%s", input, expected, result)
+		}
+	}
+}
+
+func TestParseKeyLegend(t *testing.T) {
+	names := parseKeyLegend("# 2 rows\n# keys: k1=\"first name\", k2=\"a,b\", k3=id_number\n[2]: 1,2")
+	expected := map[string]string{"k1": "first name", "k2": "a,b", "k3": "id_number"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	// La leyenda solo cuenta antes del contenido
+	if names := parseKeyLegend("a: 1\n# keys: k1=b"); names != nil {
+		t.Errorf("Expected no legend after content, got %v", names)
+	}
+}
@@ -0,0 +1,69 @@
+package toon
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultMinBinaryLength es la longitud a partir de la cual
+// BinaryPlaceholders trata un string base64 como binario si
+// TOONOptions.MinBinaryLength es 0.
+const DefaultMinBinaryLength = 256
+
+// base64Pattern reconoce base64 estándar o URL-safe, con o sin relleno.
+var base64Pattern = regexp.MustCompile(`^[A-Za-z0-9+/_-]+={0,2}$`)
+
+// dataURIPattern reconoce una data URI en base64 y captura su tipo MIME.
+var dataURIPattern = regexp.MustCompile(`^data:([\w.+-]+/[\w.+-]+)?(?:;[\w.+-]+=[\w.+-]+)*;base64,`)
+
+// minBinaryLength devuelve la longitud mínima de BinaryPlaceholders, o 0 si
+// está desactivado.
+func minBinaryLength(opts TOONOptions) int {
+	switch {
+	case !opts.BinaryPlaceholders:
+		return 0
+	case opts.MinBinaryLength > 0:
+		return opts.MinBinaryLength
+	}
+	return DefaultMinBinaryLength
+}
+
+// binaryPlaceholder devuelve el sustituto de BinaryPlaceholders para s
+// ("<binary 42KB>", o "<image/png 3KB>" en una data URI), o false si s no
+// parece un binario en base64 de al menos minLength caracteres.
+func binaryPlaceholder(s string, minLength int) (string, bool) {
+	if len(s) < minLength {
+		return "", false
+	}
+
+	kind := "binary"
+	payload := s
+	if m := dataURIPattern.FindStringSubmatch(s); m != nil {
+		if m[1] != "" {
+			kind = m[1]
+		}
+		payload = s[len(m[0]):]
+	}
+	if !base64Pattern.MatchString(payload) {
+		return "", false
+	}
+	// Las palabras largas sin dígitos ni símbolos no son base64 real
+	if !strings.ContainsAny(payload, "0123456789+/_-") {
+		return "", false
+	}
+
+	size := len(strings.TrimRight(payload, "=")) * 3 / 4
+	return fmt.Sprintf("<%s %s>", kind, formatByteSize(size)), true
+}
+
+// formatByteSize escribe un tamaño en bytes como "512B", "42KB" o "1.5MB".
+func formatByteSize(size int) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%dB", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%dKB", (size+512)/1024)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(size)/(1024*1024)), ".0") + "MB"
+}
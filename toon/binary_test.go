@@ -0,0 +1,56 @@
+package toon
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestTOONEncoder_BinaryPlaceholders(t *testing.T) {
+	raw := make([]byte, 43008)
+	for i := range raw {
+		raw[i] = byte(i * 7)
+	}
+	image := base64.StdEncoding.EncodeToString(raw)
+	data := map[string]interface{}{
+		"photo":  "data:image/png;base64," + image,
+		"file":   image,
+		"rows":   []interface{}{map[string]interface{}{"blob": base64.URLEncoding.EncodeToString(raw[:300])}},
+		"word":   strings.Repeat("a", 400),
+		"text":   strings.Repeat("hola ", 100) + "adiós",
+		"hash":   "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"number": "12345",
+	}
+
+	encoder, err := NewTOONEncoderWithOptions(TOONOptions{BinaryPlaceholders: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := mustEncode(t, encoder, data)
+
+	// Palabras sin dígitos, texto con espacios y strings cortos no cambian
+	for _, expected := range []string{
+		"file: <binary 42KB>\n",
+		"photo: <image/png 42KB>\n",
+		"rows[1]{blob}:\n    <binary 300B>\n",
+		"hash: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08\n",
+		"word: " + strings.Repeat("a", 400),
+	} {
+		if !strings.Contains(result, expected) {
+			t.Errorf("Expected %q in:\n%.300s", expected, result)
+		}
+	}
+	if !strings.Contains(result, "text: hola hola") {
+		t.Errorf("Expected the text unchanged")
+	}
+
+	// MinBinaryLength sube el umbral
+	strict, _ := NewTOONEncoderWithOptions(TOONOptions{BinaryPlaceholders: true, MinBinaryLength: 1000})
+	if result := mustEncode(t, strict, data); !strings.Contains(result, "<binary 42KB>") || strings.Contains(result, "<binary 300B>") {
+		t.Errorf("Expected only the long blobs replaced")
+	}
+
+	if size := formatByteSize(1536 * 1024); size != "1.5MB" {
+		t.Errorf("Expected 1.5MB, got %s", size)
+	}
+}
@@ -0,0 +1,108 @@
+package toon
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TOONChunk es un fragmento de la salida de EncodeChunks: un documento TOON
+// completo (con su propio header) con los elementos [Start, Start+Elements)
+// del array raíz.
+type TOONChunk struct {
+	Toon     string `json:"toon"`
+	Tokens   int    `json:"tokens"`
+	Start    int    `json:"start"`
+	Elements int    `json:"elements"`
+}
+
+// EncodeChunks divide un array raíz en documentos TOON de como mucho
+// maxTokens tokens cada uno. Cada fragmento se codifica por separado, así que
+// repite el header (campos tabulares, RootKey) y se entiende solo.
+//
+// Los elementos se acumulan sumando los tokens de su línea (fila tabular o
+// elemento de lista) a los del header; al cerrar un fragmento se cuenta de
+// nuevo el texto real y, si aun así se pasa, se devuelven elementos al
+// siguiente. Un elemento que por sí solo supera el presupuesto va en su propio
+// fragmento y se avisa en los warnings. countTokens cuenta los tokens de un
+// texto con el tokenizer del modelo de destino.
+func (e *TOONEncoder) EncodeChunks(value interface{}, maxTokens int, countTokens func(string) int) ([]TOONChunk, []string, error) {
+	arr, ok := value.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("la división en fragmentos requiere un array en la raíz")
+	}
+	if maxTokens <= 0 {
+		return nil, nil, fmt.Errorf("maxTokens debe ser mayor que 0")
+	}
+	if e.flattenSeparator != "" {
+		return nil, nil, fmt.Errorf("la división en fragmentos no admite flatten")
+	}
+	if _, err := e.walkLimits(arr, false); err != nil {
+		return nil, nil, err
+	}
+	arr = e.sampleArray(arr).items
+	if len(arr) == 0 {
+		toon, err := e.Encode(arr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []TOONChunk{{Toon: toon, Tokens: countTokens(toon)}}, nil, nil
+	}
+
+	// Coste estimado de cada elemento: su línea en el formato del array
+	isTabular, fields := e.isTabularArray(arr)
+	isList := !isTabular && !e.allPrimitive(arr)
+	if _, isMatrix := e.matrixColumns(arr); isMatrix {
+		isList = false
+	}
+	costs := make([]int, len(arr))
+	for i, item := range arr {
+		var line string
+		switch {
+		case isTabular:
+			line = e.tabularRow(item, fields, 0, nil)
+		case isList:
+			line = strings.Join(e.listItemLines(item, i, 0), "\n")
+		default:
+			line = e.encodeValue(item, 0)
+		}
+		costs[i] = countTokens(line) + 1 // + separador
+	}
+	first, err := e.Encode(arr[:1])
+	if err != nil {
+		return nil, nil, err
+	}
+	headerTokens := countTokens(strings.SplitN(first, "\n", 2)[0])
+
+	var chunks []TOONChunk
+	var warnings []string
+	for start := 0; start < len(arr); {
+		end := start + 1
+		tokens := headerTokens + costs[start]
+		for end < len(arr) && tokens+costs[end] <= maxTokens {
+			tokens += costs[end]
+			end++
+		}
+
+		// Ajustar con el recuento real del fragmento
+		toon, err := e.Encode(arr[start:end])
+		if err != nil {
+			return nil, nil, err
+		}
+		actual := countTokens(toon)
+		for actual > maxTokens && end-start > 1 {
+			end--
+			if toon, err = e.Encode(arr[start:end]); err != nil {
+				return nil, nil, err
+			}
+			actual = countTokens(toon)
+		}
+		if actual > maxTokens {
+			warnings = append(warnings, fmt.Sprintf("El elemento %d ocupa %d tokens, más que maxTokens (%d); va solo en su fragmento", start, actual, maxTokens))
+		}
+
+		chunks = append(chunks, TOONChunk{Toon: toon, Tokens: actual, Start: start, Elements: end - start})
+		start = end
+	}
+
+	return chunks, warnings, nil
+}
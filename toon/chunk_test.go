@@ -0,0 +1,81 @@
+package toon
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countWords hace de tokenizer en los tests: una palabra, un token.
+func countWords(s string) int {
+	return len(strings.Fields(s))
+}
+
+func TestTOONEncoder_EncodeChunks(t *testing.T) {
+	rows := make([]interface{}, 40)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": float64(i), "name": fmt.Sprintf("user number %d", i)}
+	}
+
+	encoder := NewTOONEncoder()
+	maxTokens := 60
+	chunks, warnings, err := encoder.EncodeChunks(rows, maxTokens, countWords)
+	if err != nil {
+		t.Fatalf("EncodeChunks error: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected several chunks, got %d", len(chunks))
+	}
+
+	next := 0
+	for _, chunk := range chunks {
+		if chunk.Tokens > maxTokens || chunk.Tokens != countWords(chunk.Toon) {
+			t.Errorf("Chunk over budget or miscounted: %d tokens\n%s", chunk.Tokens, chunk.Toon)
+		}
+		if chunk.Start != next {
+			t.Errorf("Expected chunk to start at %d, got %d", next, chunk.Start)
+		}
+		if !strings.HasPrefix(chunk.Toon, fmt.Sprintf("[%d]{id,name}:\n", chunk.Elements)) {
+			t.Errorf("Expected each chunk to repeat the tabular header, got:\n%s", chunk.Toon)
+		}
+
+		decoded, err := NewTOONDecoder().Decode(chunk.Toon)
+		if err != nil {
+			t.Fatalf("Decode error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, rows[chunk.Start:chunk.Start+chunk.Elements]) {
+			t.Errorf("Chunk starting at %d does not decode to its rows", chunk.Start)
+		}
+		next += chunk.Elements
+	}
+	if next != len(rows) {
+		t.Errorf("Chunks cover %d of %d rows", next, len(rows))
+	}
+}
+
+func TestTOONEncoder_EncodeChunksOversizedRow(t *testing.T) {
+	rows := []interface{}{
+		map[string]interface{}{"text": "short"},
+		map[string]interface{}{"text": strings.Repeat("very long text ", 50)},
+		map[string]interface{}{"text": "short"},
+	}
+
+	chunks, warnings, err := NewTOONEncoder().EncodeChunks(rows, 20, countWords)
+	if err != nil {
+		t.Fatalf("EncodeChunks error: %v", err)
+	}
+	if len(chunks) != 3 || chunks[1].Start != 1 || chunks[1].Elements != 1 {
+		t.Fatalf("Expected the long row alone in its chunk, got %+v", chunks)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "elemento 1") {
+		t.Errorf("Expected a warning for the oversized row, got %v", warnings)
+	}
+
+	if _, _, err := NewTOONEncoder().EncodeChunks(map[string]interface{}{"a": 1.0}, 20, countWords); err == nil {
+		t.Error("Expected error when the root is not an array")
+	}
+}
@@ -0,0 +1,228 @@
+package toon
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+)
+
+// regressionFixtures son los casos de regresión propios que acompañan al
+// paquete, en regression/encode y regression/decode. Están escritos a mano
+// para este repositorio; no son la suite de la especificación.
+//
+//go:embed regression
+var regressionFixtures embed.FS
+
+// ConformanceFile es un fichero de fixtures: un grupo de casos de una
+// categoría ("encode" o "decode").
+type ConformanceFile struct {
+	Version     string            `json:"version"`
+	Category    string            `json:"category"`
+	Description string            `json:"description"`
+	Tests       []ConformanceTest `json:"tests"`
+}
+
+// ConformanceTest es un caso: en "encode", Input es JSON y Expected el TOON
+// esperado; en "decode", Input es TOON (un string JSON) y Expected el JSON.
+// Con ShouldError el caso pasa si la conversión falla.
+type ConformanceTest struct {
+	Name        string                 `json:"name"`
+	Input       json.RawMessage        `json:"input"`
+	Expected    json.RawMessage        `json:"expected"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+	ShouldError bool                   `json:"shouldError,omitempty"`
+	SpecSection string                 `json:"specSection,omitempty"`
+}
+
+// ConformanceResult es el resultado de un caso. Status es "pass", "fail" o
+// "skip" (el caso usa una opción que no tiene equivalente aquí); Reason
+// explica los dos últimos.
+type ConformanceResult struct {
+	File     string `json:"file"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Expected string `json:"expected,omitempty"`
+	Got      string `json:"got,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// RunConformance ejecuta los fixtures de regresión que acompañan al paquete.
+func RunConformance() ([]ConformanceResult, error) {
+	sub, err := fs.Sub(regressionFixtures, "regression")
+	if err != nil {
+		return nil, err
+	}
+	return RunConformanceFS(sub)
+}
+
+// RunConformanceFS ejecuta todos los ficheros .json de fsys, en cualquier
+// subdirectorio y en orden alfabético. El encoder usa SpecVersion "1.0" y
+// conserva el orden de las claves.
+func RunConformanceFS(fsys fs.FS) ([]ConformanceResult, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && path.Ext(name) == ".json" {
+			files = append(files, name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var results []ConformanceResult
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var file ConformanceFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, test := range file.Tests {
+			result := runConformanceTest(file.Category, test)
+			result.File = name
+			result.Name = test.Name
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// runConformanceTest ejecuta un caso de la categoría category.
+func runConformanceTest(category string, test ConformanceTest) ConformanceResult {
+	switch category {
+	case "encode":
+		return runEncodeTest(test)
+	case "decode":
+		return runDecodeTest(test)
+	}
+	return ConformanceResult{Status: "skip", Reason: fmt.Sprintf("categoría desconocida: %q", category)}
+}
+
+// conformanceEncodeOptions traduce las opciones de un caso de "encode". Las
+// que no tienen equivalente se devuelven como motivo para saltarlo.
+func conformanceEncodeOptions(options map[string]interface{}) (TOONOptions, string) {
+	opts := TOONOptions{SpecVersion: "1.0", KeySort: "none", PreserveKeyOrder: true, Indent: 2}
+	for name, value := range options {
+		switch v := value.(type) {
+		case string:
+			switch {
+			case name == "delimiter":
+				opts.Delimiter = v
+				continue
+			case name == "lengthMarker" && (v == "#" || v == ""):
+				opts.LengthMarker = v == "#"
+				continue
+			case name == "keyFolding" && v == "off":
+				continue
+			}
+		case float64:
+			if name == "indent" {
+				opts.Indent = int(v)
+				continue
+			}
+		}
+		return opts, fmt.Sprintf("opción no soportada: %s=%v", name, value)
+	}
+	return opts, ""
+}
+
+func runEncodeTest(test ConformanceTest) ConformanceResult {
+	opts, skip := conformanceEncodeOptions(test.Options)
+	if skip != "" {
+		return ConformanceResult{Status: "skip", Reason: skip}
+	}
+	var expected string
+	if !test.ShouldError {
+		if err := json.Unmarshal(test.Expected, &expected); err != nil {
+			return ConformanceResult{Status: "fail", Reason: "expected no es un string: " + err.Error()}
+		}
+	}
+
+	got, err := encodeConformanceInput(test.Input, opts)
+	switch {
+	case test.ShouldError && err != nil:
+		return ConformanceResult{Status: "pass"}
+	case test.ShouldError:
+		return ConformanceResult{Status: "fail", Got: got, Reason: "se esperaba un error"}
+	case err != nil:
+		return ConformanceResult{Status: "fail", Expected: expected, Reason: err.Error()}
+	case got != expected:
+		return ConformanceResult{Status: "fail", Expected: expected, Got: got}
+	}
+	return ConformanceResult{Status: "pass"}
+}
+
+func encodeConformanceInput(input json.RawMessage, opts TOONOptions) (string, error) {
+	encoder, err := NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	value, err := DecodeOrderedJSON(string(input))
+	if err != nil {
+		return "", err
+	}
+	return encoder.Encode(value)
+}
+
+func runDecodeTest(test ConformanceTest) ConformanceResult {
+	strict := true
+	for name, value := range test.Options {
+		switch v := value.(type) {
+		case bool:
+			if name == "strict" {
+				strict = v
+				continue
+			}
+		case float64:
+			// El decoder deduce la indentación
+			if name == "indent" {
+				continue
+			}
+		case string:
+			if name == "expandPaths" && v == "off" {
+				continue
+			}
+		}
+		return ConformanceResult{Status: "skip", Reason: fmt.Sprintf("opción no soportada: %s=%v", name, value)}
+	}
+
+	var input string
+	if err := json.Unmarshal(test.Input, &input); err != nil {
+		return ConformanceResult{Status: "fail", Reason: "input no es un string: " + err.Error()}
+	}
+	got, _, err := NewTOONDecoder().DecodeWithOptions(input, DecodeOptions{Strict: strict})
+	switch {
+	case test.ShouldError && err != nil:
+		return ConformanceResult{Status: "pass"}
+	case test.ShouldError:
+		return ConformanceResult{Status: "fail", Got: conformanceJSON(got), Reason: "se esperaba un error"}
+	case err != nil:
+		return ConformanceResult{Status: "fail", Expected: string(test.Expected), Reason: err.Error()}
+	}
+
+	var expected interface{}
+	if err := json.Unmarshal(test.Expected, &expected); err != nil {
+		return ConformanceResult{Status: "fail", Reason: "expected no es JSON: " + err.Error()}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		return ConformanceResult{Status: "fail", Expected: conformanceJSON(expected), Got: conformanceJSON(got)}
+	}
+	return ConformanceResult{Status: "pass"}
+}
+
+// conformanceJSON escribe value en JSON compacto para el informe.
+func conformanceJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,18 @@
+package toon
+
+import "testing"
+
+func TestRunConformance(t *testing.T) {
+	results, err := RunConformance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("Expected fixtures")
+	}
+	for _, result := range results {
+		if result.Status != "pass" {
+			t.Errorf("%s: %s: %s %s\nExpected:\n%s\nGot:\n%s", result.File, result.Name, result.Status, result.Reason, result.Expected, result.Got)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package toon
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DecodeCSV lee un CSV con fila de cabecera y devuelve un objeto por fila,
+// con las columnas en el orden del CSV (*OrderedMap). comma es el separador
+// de campos (',' o, para TSV, '\t'); 0 equivale a ','.
+//
+// El tipo se deduce por columna: si todas sus celdas no vacías son números
+// JSON, la columna es numérica (json.Number, sin pasar por float64) y si
+// todas son true o false (sin distinguir mayúsculas), booleana; si no, todas
+// sus celdas son strings, así que "007" o un código postal no pierden los
+// ceros. Las celdas vacías son null.
+func DecodeCSV(input string, comma rune) ([]interface{}, error) {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(input, "\uFEFF")))
+	if comma != 0 {
+		reader.Comma = comma
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV vacío: falta la fila de cabecera")
+	}
+
+	header, rows := records[0], records[1:]
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if seen[name] {
+			return nil, fmt.Errorf("columna duplicada en la cabecera: %q", name)
+		}
+		seen[name] = true
+	}
+
+	types := make([]string, len(header))
+	for col := range header {
+		types[col] = csvColumnType(rows, col)
+	}
+
+	arr := make([]interface{}, len(rows))
+	for i, row := range rows {
+		obj := &OrderedMap{Keys: header, Values: make(map[string]interface{}, len(header))}
+		for col, name := range header {
+			obj.Values[name] = csvCell(row[col], types[col])
+		}
+		arr[i] = obj
+	}
+	return arr, nil
+}
+
+// csvColumnType devuelve el tipo de la columna col: "number", "bool" o
+// "string".
+func csvColumnType(rows [][]string, col int) string {
+	columnType := ""
+	for _, row := range rows {
+		cell := row[col]
+		if cell == "" {
+			continue
+		}
+		cellType := "string"
+		switch {
+		case validJSONNumber.MatchString(cell):
+			cellType = "number"
+		case strings.EqualFold(cell, "true") || strings.EqualFold(cell, "false"):
+			cellType = "bool"
+		}
+		if columnType != "" && columnType != cellType || cellType == "string" {
+			return "string"
+		}
+		columnType = cellType
+	}
+	if columnType == "" {
+		return "string"
+	}
+	return columnType
+}
+
+// csvCell convierte una celda al tipo de su columna.
+func csvCell(cell, columnType string) interface{} {
+	switch {
+	case cell == "":
+		return nil
+	case columnType == "number":
+		return json.Number(cell)
+	case columnType == "bool":
+		return strings.EqualFold(cell, "true")
+	}
+	return cell
+}
+
+// EncodeCSV codifica un CSV con fila de cabecera (ver DecodeCSV) como un array
+// tabular "[N]{columnas}:", con las columnas en el orden del CSV. Con
+// opts.RootKey el array va bajo esa clave ("rows[N]{...}:").
+func EncodeCSV(input string, comma rune, opts TOONOptions) (string, error) {
+	opts.PreserveKeyOrder = true
+	encoder, err := NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	rows, err := DecodeCSV(input, comma)
+	if err != nil {
+		return "", err
+	}
+	return encoder.Encode(rows)
+}
+
+// CSVTable es un array tabular extraído por ExtractCSVTables. Path es su
+// ruta en el documento, con las claves y los índices separados por puntos
+// ("users", "orders.0.lines"), o "" si es la raíz.
+type CSVTable struct {
+	Path string `json:"path"`
+	Rows int    `json:"rows"`
+	CSV  string `json:"csv"`
+}
+
+// ExtractCSVTables devuelve como CSV, en el orden del documento, los arrays
+// de value que Encode escribiría como tabulares, con una fila de cabecera y
+// las columnas del header. comma es el separador (0 equivale a ','). Las
+// celdas null quedan vacías y los números se escriben como en TOON, así que
+// DecodeCSV recupera los mismos valores salvo los strings que parecen números
+// o booleanos. Antes se aplican las opciones que transforman el documento,
+// como en Encode (Include, DropKeys, Flatten...).
+func (e *TOONEncoder) ExtractCSVTables(value interface{}, comma rune) ([]CSVTable, error) {
+	value, _, err := e.prepareRoot(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables []CSVTable
+	var walk func(value interface{}, path string) error
+	walk = func(value interface{}, path string) error {
+		join := func(key string) string {
+			if path == "" {
+				return key
+			}
+			return path + "." + key
+		}
+
+		if arr, ok := value.([]interface{}); ok {
+			if tabular, fields := e.isTabularArray(arr); tabular {
+				data, err := e.tableCSV(arr, fields, comma)
+				if err != nil {
+					return err
+				}
+				tables = append(tables, CSVTable{Path: path, Rows: len(arr), CSV: data})
+				return nil
+			}
+			for i, item := range arr {
+				if err := walk(item, join(strconv.Itoa(i))); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		obj, ok := AsObject(value)
+		if !ok {
+			return nil
+		}
+		order, fixed := keyOrder(value)
+		for _, key := range e.objectKeys(obj, order, fixed || e.preserveKeyOrder || e.keySort == "none") {
+			if err := walk(obj[key], join(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(value, ""); err != nil {
+		return nil, err
+	}
+	return tables, nil
+}
+
+// tableCSV escribe las filas de un array tabular como CSV.
+func (e *TOONEncoder) tableCSV(arr []interface{}, fields []string, comma rune) (string, error) {
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	if comma != 0 {
+		writer.Comma = comma
+	}
+	writer.Write(fields)
+	for _, item := range arr {
+		obj, _ := AsObject(item)
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			switch v := obj[field].(type) {
+			case nil:
+			case string:
+				record[i] = v
+			case json.Number:
+				record[i] = e.encodeJSONNumber(v)
+			case float64:
+				record[i] = e.encodeNumber(v)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return b.String(), writer.Error()
+}
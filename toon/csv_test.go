@@ -0,0 +1,109 @@
+package toon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeCSV(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		comma    rune
+		opts     TOONOptions
+		expected string
+	}{
+		{
+			name:     "types per column",
+			input:    "id,name,active,zip,score\n1,Ana,true,08001,9.5\n2,\"Luis, Jr.\",FALSE,28001,\n",
+			expected: "[2]{id,name,active,zip,score}:\n  1,Ana,true,\"08001\",9.5\n  2,\"Luis, Jr.\",false,\"28001\",null",
+		},
+		{
+			name:     "mixed column stays string",
+			input:    "code\n42\nA7\n",
+			expected: "[2]{code}:\n  \"42\"\n  A7",
+		},
+		{
+			name:     "tsv with root key",
+			input:    "\uFEFFsku\tqty\nA1\t2\nB2\t1",
+			comma:    '\t',
+			opts:     TOONOptions{RootKey: "items", Delimiter: "|"},
+			expected: "items[2|]{sku|qty}:\n    A1|2\n    B2|1",
+		},
+		{
+			name:     "header only",
+			input:    "a,b\n",
+			expected: "[0]:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := EncodeCSV(tt.input, tt.comma, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestDecodeCSV_Invalid(t *testing.T) {
+	for _, input := range []string{"", "a,a\n1,2", "a,b\n1", "a\n\"x"} {
+		if _, err := DecodeCSV(input, 0); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+	if _, err := EncodeCSV("a\n1", 0, TOONOptions{Delimiter: ";"}); err == nil || !strings.Contains(err.Error(), "delimiter") {
+		t.Errorf("Expected invalid delimiter error, got %v", err)
+	}
+}
+
+func TestTOONEncoder_ExtractCSVTables(t *testing.T) {
+	input, err := DecodeJSON(`{
+		"users": [{"id": 1, "name": "Ana, Jr.", "score": 9.5}, {"id": 2, "name": "Luis", "score": null}],
+		"orders": [
+			{"id": "A", "lines": [{"sku": "X1", "qty": 2}]},
+			{"id": "B", "tags": ["x"]}
+		],
+		"tags": ["a", "b"]
+	}`, true)
+	if err != nil {
+		t.Fatalf("DecodeJSON error: %v", err)
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{KeySort: "none"})
+	tables, err := encoder.ExtractCSVTables(input, ';')
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []CSVTable{
+		{Path: "users", Rows: 2, CSV: "id;name;score\n1;Ana, Jr.;9.5\n2;Luis;\n"},
+		{Path: "orders.0.lines", Rows: 1, CSV: "sku;qty\nX1;2\n"},
+	}
+	if len(tables) != len(expected) {
+		t.Fatalf("Expected %d tables, got %+v", len(expected), tables)
+	}
+	for i := range expected {
+		if tables[i] != expected[i] {
+			t.Errorf("Table %d: expected %+v, got %+v", i, expected[i], tables[i])
+		}
+	}
+
+	// La tabla vuelve a los mismos valores con DecodeCSV
+	rows, err := DecodeCSV(tables[0].CSV, ';')
+	if err != nil {
+		t.Fatalf("DecodeCSV error: %v", err)
+	}
+	if got := mustEncode(t, encoder, rows); got != "[2]{id,name,score}:\n  1,\"Ana, Jr.\",9.5\n  2,Luis,null" {
+		t.Errorf("Unexpected round trip: %q", got)
+	}
+
+	// Un array tabular en la raíz tiene la ruta ""
+	tables, _ = NewTOONEncoder().ExtractCSVTables([]interface{}{map[string]interface{}{"a": true}}, 0)
+	if len(tables) != 1 || tables[0].Path != "" || tables[0].CSV != "a\ntrue\n" {
+		t.Errorf("Unexpected root table: %+v", tables)
+	}
+}
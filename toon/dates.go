@@ -0,0 +1,101 @@
+package toon
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayouts son los formatos ISO-8601 que DateMode reconoce. Sin zona
+// horaria se entienden en UTC.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// dateNotes son los comentarios que explican el formato de DateMode al
+// principio de la salida.
+var dateNotes = map[string]string{
+	"epoch":     "# dates: epoch seconds (UTC)",
+	"date-only": "# dates: YYYY-MM-DD",
+}
+
+// parseISODate interpreta s si es una fecha ISO-8601 de dateLayouts.
+func parseISODate(s string) (time.Time, bool) {
+	// Descarte rápido: toda fecha empieza por "AAAA-"
+	if len(s) < 10 || s[4] != '-' {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// compactDate convierte la fecha de s según mode: segundos desde 1970 en
+// UTC (con los decimales que hagan falta) para "epoch" o solo la fecha, en
+// la zona en que se escribió, para "date-only".
+func compactDate(t time.Time, mode string) interface{} {
+	if mode == "date-only" {
+		return t.Format("2006-01-02")
+	}
+	if nanos := t.Nanosecond(); nanos != 0 {
+		fraction := strings.TrimRight(fmt.Sprintf("%09d", nanos), "0")
+		return json.Number(fmt.Sprintf("%d.%s", t.Unix(), fraction))
+	}
+	return json.Number(fmt.Sprintf("%d", t.Unix()))
+}
+
+// convertDates cambia los strings de value que son fechas ISO-8601 según
+// DateMode, en cualquier nivel, e indica si cambió alguno. Las claves no se
+// tocan. Solo se copian los contenedores que cambian.
+func convertDates(value interface{}, mode string) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		if t, ok := parseISODate(v); ok {
+			converted := compactDate(t, mode)
+			return converted, converted != v
+		}
+	case map[string]interface{}:
+		var copied map[string]interface{}
+		for key, item := range v {
+			converted, changed := convertDates(item, mode)
+			if !changed {
+				continue
+			}
+			if copied == nil {
+				copied = make(map[string]interface{}, len(v))
+				for k, original := range v {
+					copied[k] = original
+				}
+			}
+			copied[key] = converted
+		}
+		if copied != nil {
+			return copied, true
+		}
+	case *OrderedMap:
+		if values, changed := convertDates(v.Values, mode); changed {
+			return &OrderedMap{Keys: v.Keys, Values: values.(map[string]interface{}), fixedOrder: v.fixedOrder}, true
+		}
+	case []interface{}:
+		var copied []interface{}
+		for i, item := range v {
+			converted, changed := convertDates(item, mode)
+			if changed && copied == nil {
+				copied = append([]interface{}(nil), v...)
+			}
+			if copied != nil {
+				copied[i] = converted
+			}
+		}
+		if copied != nil {
+			return copied, true
+		}
+	}
+	return value, false
+}
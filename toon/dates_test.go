@@ -0,0 +1,54 @@
+package toon
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestTOONEncoder_DateMode(t *testing.T) {
+	input := `{"events": [
+		{"at": "2024-05-01T10:30:00Z", "day": "2024-05-01"},
+		{"at": "2024-05-01T12:30:00.250+02:00", "day": "2024-05-02"}
+	], "note": "2024 fue bisiesto", "local": "2024-05-01T10:30:00"}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		mode     string
+		expected string
+	}{
+		{"keep", "events[2]{at,day}:\n    \"2024-05-01T10:30:00Z\",\"2024-05-01\"\n    \"2024-05-01T12:30:00.250+02:00\",\"2024-05-02\"\nlocal: \"2024-05-01T10:30:00\"\nnote: 2024 fue bisiesto"},
+		// Sin zona horaria se entiende UTC; con zona se pasa a UTC
+		{"epoch", "# dates: epoch seconds (UTC)\nevents[2]{at,day}:\n    1714559400,1714521600\n    1714559400.25,1714608000\nlocal: 1714559400\nnote: 2024 fue bisiesto"},
+		// La fecha es la de la zona en que se escribió
+		{"date-only", "# dates: YYYY-MM-DD\nevents[2]{at,day}:\n    \"2024-05-01\",\"2024-05-01\"\n    \"2024-05-01\",\"2024-05-02\"\nlocal: \"2024-05-01\"\nnote: 2024 fue bisiesto"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(TOONOptions{DateMode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := mustEncode(t, encoder, data)
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+			var buf bytes.Buffer
+			if err := encoder.EncodeTo(&buf, data, nil); err != nil || buf.String() != result {
+				t.Errorf("EncodeTo differs from Encode (%v):\n%s", err, buf.String())
+			}
+		})
+	}
+
+	// Sin fechas no hay nota
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{DateMode: "epoch"})
+	if result := mustEncode(t, encoder, map[string]interface{}{"a": "hola"}); result != "a: hola" {
+		t.Errorf("Expected no note without dates, got %q", result)
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{DateMode: "unix"}); err == nil {
+		t.Error("Expected error for an unknown dateMode")
+	}
+}
@@ -0,0 +1,966 @@
+package toon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// TOONDecoder convierte texto TOON de vuelta a valores genéricos
+// (map[string]interface{}, []interface{}, string, float64, bool, nil). Con
+// DecodeOptions.UseNumber los números son json.Number.
+//
+// El delimitador no se configura: se deduce de cada header de array a partir
+// del marcador de longitud ([N] coma, [N ] tab, [N|] pipe) y, si falta, del
+// separador usado entre los campos del header.
+type TOONDecoder struct {
+	trueLiteral      string
+	falseLiteral     string
+	nullLiteral      string
+	flattenSeparator string // "" sin Flatten
+	keyFolding       bool
+	abbreviateKeys   bool
+	compactBooleans  bool
+	indent           int // 0: se deduce del documento
+}
+
+func NewTOONDecoder() *TOONDecoder {
+	return &TOONDecoder{trueLiteral: "true", falseLiteral: "false", nullLiteral: "null"}
+}
+
+// NewTOONDecoderWithOptions crea un decoder que reconoce los literales
+// TrueLiteral, FalseLiteral, NullLiteral y EmptyNull de opts, y deshace
+// Flatten, KeyFolding y AbbreviateKeys, para leer lo escrito por un encoder
+// con las mismas opciones. Con CompactBooleans, 1 y 0 en una columna tabular
+// anotada como bool se leen como true y false. El resto se ignora. Con EmptyNull una clave o
+// elemento sin valor se lee como null (no como objeto vacío). Con Indent el
+// ancho de indentación es fijo en vez de deducirse del documento.
+func NewTOONDecoderWithOptions(opts TOONOptions) (*TOONDecoder, error) {
+	trueLiteral, falseLiteral, nullLiteral, err := resolveLiterals(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TOONDecoder{
+		trueLiteral:      trueLiteral,
+		falseLiteral:     falseLiteral,
+		nullLiteral:      nullLiteral,
+		flattenSeparator: flattenSeparator(opts),
+		keyFolding:       opts.KeyFolding,
+		abbreviateKeys:   opts.AbbreviateKeys,
+		compactBooleans:  opts.CompactBooleans,
+		indent:           opts.Indent,
+	}, nil
+}
+
+type toonLine struct {
+	num    int    // número de línea (desde 1) para mensajes de error
+	indent int    // espacios al inicio de la línea
+	text   string // contenido sin indentación
+}
+
+type arrayHeader struct {
+	length    int
+	columns   int // > 0 en la forma matriz "[RxC]"
+	delimiter string
+	fields    []string // nil si el array no es tabular
+	types     []string // tipo de TypedHeaders de cada campo, "" si no lo tiene
+	inline    string   // valores tras ':' en arrays primitivos
+	hasInline bool
+}
+
+type toonParser struct {
+	lines       []toonLine
+	pos         int
+	indentWidth int
+	decoder     *TOONDecoder
+	strict      bool
+	useNumber   bool
+	warnings    []string
+}
+
+// DecodeOptions controla cuánto tolera el decoder las inconsistencias del
+// texto: longitud declarada distinta de la real, filas con más o menos celdas
+// que el header, cierres de lista "[/N]" que no cuadran y secuencias de
+// escape desconocidas. Los espacios alrededor de celdas y valores se recortan
+// en ambos modos.
+type DecodeOptions struct {
+	// Strict falla en la primera inconsistencia, con su número de línea. Sin
+	// Strict se corrige lo posible (celdas que faltan como null, celdas de
+	// más descartadas, longitud real en vez de la declarada) y se avisa
+	Strict bool
+
+	// UseNumber devuelve los números como json.Number con el texto escrito,
+	// como json.Decoder.UseNumber, en vez de float64: los enteros de más de
+	// 53 bits no pierden precisión
+	UseNumber bool
+}
+
+// Decode interpreta input en modo estricto.
+func (d *TOONDecoder) Decode(input string) (interface{}, error) {
+	value, _, err := d.DecodeWithOptions(input, DecodeOptions{Strict: true})
+	return value, err
+}
+
+// DecodeWithOptions interpreta input según opts y devuelve los avisos de las
+// inconsistencias toleradas (siempre vacíos en modo estricto).
+func (d *TOONDecoder) DecodeWithOptions(input string, opts DecodeOptions) (interface{}, []string, error) {
+	p := &toonParser{lines: splitTOONLines(input), decoder: d, strict: opts.Strict, useNumber: opts.UseNumber}
+	p.indentWidth = d.indent
+	if p.indentWidth <= 0 {
+		p.indentWidth = detectIndentWidth(p.lines)
+	}
+
+	value, err := p.parseRoot()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, nil, p.errorf(p.lines[p.pos], "contenido inesperado")
+	}
+	if d.abbreviateKeys {
+		if names := parseKeyLegend(input); names != nil {
+			value = renameKeys(value, names)
+		}
+	}
+	if d.flattenSeparator != "" {
+		value = unflattenValue(value, d.flattenSeparator)
+	}
+	return value, p.warnings, nil
+}
+
+func splitTOONLines(input string) []toonLine {
+	var lines []toonLine
+	for i, raw := range strings.Split(input, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		// Solo se recortan espacios: un tab final puede ser parte de una fila
+		text = strings.TrimRight(text, " ")
+		if text == "" || isCommentLine(text) {
+			continue
+		}
+		lines = append(lines, toonLine{
+			num:    i + 1,
+			indent: len(raw) - len(strings.TrimLeft(raw, " ")),
+			text:   text,
+		})
+	}
+	return lines
+}
+
+// isCommentLine indica si text (una línea sin indentación) es un comentario:
+// "#" solo o seguido de espacio. El marcador de longitud "#" siempre va
+// dentro de corchetes, así que no se confunde, y los strings que empiezan así
+// van entre comillas.
+func isCommentLine(text string) bool {
+	return text == "#" || strings.HasPrefix(text, "# ")
+}
+
+// detectIndentWidth deduce el ancho de indentación de la disposición del
+// encoder: lo que sigue a "clave:" sin valor, al header de un array en la
+// raíz o al primer campo primitivo de un elemento de lista ("- a: 1") está un
+// nivel más adentro. Si no hay ninguna de esas líneas se usan las filas de un
+// array con clave, dos niveles por debajo (uno en la especificación: 2 y 3
+// se toman como un nivel), y si tampoco las hay, 2.
+func detectIndentWidth(lines []toonLine) int {
+	keyedStep := 0
+	for i := 0; i+1 < len(lines); i++ {
+		line, next := lines[i], lines[i+1]
+		step := next.indent - line.indent
+		if step <= 0 {
+			continue
+		}
+		if i == 0 && strings.HasPrefix(line.text, "[") {
+			if _, ok := parseArrayHeader(line.text); ok {
+				return step
+			}
+		}
+		if content, ok := listItemContent(line.text); ok {
+			if _, rest, ok := splitKey(content); ok && strings.HasPrefix(rest, ":") && strings.Trim(rest[1:], " ") != "" {
+				return step
+			}
+			continue
+		}
+		if _, rest, ok := splitKey(line.text); ok {
+			if rest == ":" {
+				return step
+			}
+			if keyedStep == 0 && strings.HasPrefix(rest, "[") {
+				keyedStep = step
+			}
+		}
+	}
+	switch {
+	case keyedStep >= 4 && keyedStep%2 == 0:
+		return keyedStep / 2
+	case keyedStep > 0:
+		return keyedStep
+	}
+	return 2
+}
+
+func (p *toonParser) errorf(line toonLine, format string, args ...interface{}) error {
+	return fmt.Errorf("línea %d: %s", line.num, fmt.Sprintf(format, args...))
+}
+
+// violation informa de una inconsistencia que el modo no estricto tolera:
+// con Strict devuelve el error y si no lo guarda como aviso y devuelve nil.
+func (p *toonParser) violation(line toonLine, format string, args ...interface{}) error {
+	err := p.errorf(line, format, args...)
+	if p.strict {
+		return err
+	}
+	p.warnings = append(p.warnings, err.Error())
+	return nil
+}
+
+func (p *toonParser) parseRoot() (interface{}, error) {
+	if len(p.lines) == 0 {
+		// Encode produce "" para un objeto vacío
+		return map[string]interface{}{}, nil
+	}
+
+	first := p.lines[0]
+
+	// Array en la raíz: "[N]: ..." sin clave
+	if strings.HasPrefix(first.text, "[") {
+		if header, ok := parseArrayHeader(first.text); ok {
+			p.pos++
+			return p.parseArrayBody(header, first)
+		}
+	}
+
+	// Primitivo en la raíz: una sola línea que no es "clave: valor"
+	if _, _, ok := splitKey(first.text); !ok {
+		if len(p.lines) > 1 {
+			return nil, p.errorf(first, "se esperaba una clave")
+		}
+		p.pos++
+		return p.parsePrimitive(first.text, first)
+	}
+
+	return p.parseObject(first.indent)
+}
+
+func (p *toonParser) parseObject(indent int) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	if err := p.parseFields(obj, indent); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// parseFields añade a obj los campos de las líneas con indentación indent.
+func (p *toonParser) parseFields(obj map[string]interface{}, indent int) error {
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return p.errorf(line, "indentación inesperada")
+		}
+
+		key, rest, ok := splitKey(line.text)
+		if !ok {
+			return p.errorf(line, "se esperaba 'clave: valor'")
+		}
+		if err := p.checkEscapes(line.text, line); err != nil {
+			return err
+		}
+		p.pos++
+
+		value, err := p.parseFieldValue(rest, line)
+		if err != nil {
+			return err
+		}
+		p.setField(obj, key, strings.HasPrefix(line.text, `"`), value)
+	}
+
+	return nil
+}
+
+// parseFieldValue interpreta lo que sigue a una clave: un header de array,
+// un objeto anidado ("clave:") o un valor primitivo ("clave: valor").
+func (p *toonParser) parseFieldValue(rest string, line toonLine) (interface{}, error) {
+	if strings.HasPrefix(rest, "[") {
+		header, ok := parseArrayHeader(rest)
+		if !ok {
+			return nil, p.errorf(line, "header de array inválido: %s", rest)
+		}
+		return p.parseArrayBody(header, line)
+	}
+
+	value := strings.TrimLeft(strings.TrimPrefix(rest, ":"), " ")
+	if value != "" {
+		return p.parsePrimitive(value, line)
+	}
+
+	// Objeto anidado en las líneas siguientes, o vacío si no hay ninguna
+	// (null si null se escribe vacío)
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > line.indent {
+		return p.parseObject(p.lines[p.pos].indent)
+	}
+	if p.decoder.nullLiteral == "" {
+		return nil, nil
+	}
+	return map[string]interface{}{}, nil
+}
+
+// parseArrayBody lee el contenido de un array cuyo header está en line.
+// Las filas o elementos son las líneas siguientes más indentadas que line.
+func (p *toonParser) parseArrayBody(header arrayHeader, line toonLine) ([]interface{}, error) {
+	arr := []interface{}{}
+	omitted := 0 // elementos que los marcadores "... (+K)" dicen omitidos
+
+	switch {
+	case header.fields != nil:
+		for p.pos < len(p.lines) && p.lines[p.pos].indent > line.indent {
+			row := p.lines[p.pos]
+			if p.skipTruncationMarker(row, &omitted) {
+				continue
+			}
+			cells := splitDelimited(row.text, header.delimiter)
+			if len(cells) != len(header.fields) {
+				if err := p.violation(row, "se esperaban %d celdas, hay %d", len(header.fields), len(cells)); err != nil {
+					return nil, err
+				}
+			}
+			obj := make(map[string]interface{}, len(header.fields))
+			for i, field := range header.fields {
+				// Celda vacía: campo ausente de SparseTabular ("" va entre
+				// comillas) o que falta en la fila
+				if i >= len(cells) || strings.Trim(cells[i], " ") == "" {
+					obj[field] = nil
+					continue
+				}
+				value, err := p.parsePrimitive(cells[i], row)
+				if err != nil {
+					return nil, err
+				}
+				if p.decoder.compactBooleans && header.types[i] == "bool" {
+					value = compactBoolValue(value)
+				}
+				obj[field] = value
+			}
+			arr = append(arr, obj)
+			p.pos++
+		}
+
+	case header.columns > 0:
+		for p.pos < len(p.lines) && p.lines[p.pos].indent > line.indent {
+			row := p.lines[p.pos]
+			if p.skipTruncationMarker(row, &omitted) {
+				continue
+			}
+			cells := splitDelimited(row.text, header.delimiter)
+			if len(cells) != header.columns {
+				if err := p.violation(row, "se esperaban %d columnas, hay %d", header.columns, len(cells)); err != nil {
+					return nil, err
+				}
+			}
+			values := make([]interface{}, len(cells))
+			for i, cell := range cells {
+				value, err := p.parsePrimitive(cell, row)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = value
+			}
+			arr = append(arr, values)
+			p.pos++
+		}
+
+	case header.hasInline:
+		for _, cell := range splitDelimited(header.inline, header.delimiter) {
+			value, err := p.parsePrimitive(cell, line)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+
+	default:
+		if p.pos < len(p.lines) && p.lines[p.pos].indent > line.indent {
+			itemIndent := p.lines[p.pos].indent
+			for p.pos < len(p.lines) && p.lines[p.pos].indent > line.indent {
+				item := p.lines[p.pos]
+				if p.skipTruncationMarker(item, &omitted) {
+					continue
+				}
+				if m := listEndPattern.FindStringSubmatch(item.text); m != nil {
+					// Cierre opcional "[/N]": debe coincidir con lo leído
+					if m[1] != strconv.Itoa(len(arr)) {
+						if err := p.violation(item, "el cierre indica %s elementos, encontrados %d", m[1], len(arr)); err != nil {
+							return nil, err
+						}
+					}
+					p.pos++
+					break
+				}
+				content, ok := listItemContent(item.text)
+				if item.indent != itemIndent || !ok {
+					return nil, p.errorf(item, "se esperaba un elemento de lista '- '")
+				}
+				value, err := p.parseListItem(item, content)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, value)
+			}
+		}
+	}
+
+	// Marcador tras el cierre "[/N]" o tras un array primitivo
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > line.indent {
+		p.skipTruncationMarker(p.lines[p.pos], &omitted)
+	}
+
+	// El header de un array recortado declara los elementos escritos o, con
+	// SampleStrategy, la longitud real
+	if len(arr) != header.length && (omitted == 0 || len(arr)+omitted != header.length) {
+		if err := p.violation(line, "longitud declarada %d, encontrados %d elementos", header.length, len(arr)); err != nil {
+			return nil, err
+		}
+	}
+	return arr, nil
+}
+
+// skipTruncationMarker salta line si es un marcador "... (+K)" de
+// MaxArrayElements y suma K a omitted. Puede ir entre las filas (con
+// SampleStrategy "head+tail") o al final.
+func (p *toonParser) skipTruncationMarker(line toonLine, omitted *int) bool {
+	m := truncationMarkerPattern.FindStringSubmatch(line.text)
+	if m == nil {
+		return false
+	}
+	count, _ := strconv.Atoi(m[1])
+	*omitted += count
+	p.pos++
+	return true
+}
+
+// listIndexPattern reconoce el prefijo numerado de ListIndex ("0- ", "1) ").
+var listIndexPattern = regexp.MustCompile(`^\d+[-)](?: |$)`)
+
+// listItemContent quita el prefijo de un elemento de lista ("- " o, si se
+// numeraron, "N- " / "N) ") y devuelve el resto.
+func listItemContent(text string) (string, bool) {
+	if strings.HasPrefix(text, "-") {
+		return strings.TrimPrefix(text[1:], " "), true
+	}
+	if m := listIndexPattern.FindString(text); m != "" {
+		return text[len(m):], true
+	}
+	return "", false
+}
+
+func (p *toonParser) parseListItem(item toonLine, content string) (interface{}, error) {
+	p.pos++
+
+	// "- " solo es un objeto vacío (o null si null se escribe vacío)
+	if content == "" {
+		if p.decoder.nullLiteral == "" {
+			return nil, nil
+		}
+		return map[string]interface{}{}, nil
+	}
+
+	if strings.HasPrefix(content, "[") {
+		if header, ok := parseArrayHeader(content); ok {
+			return p.parseArrayBody(header, item)
+		}
+	}
+
+	// Objeto en una línea: "{a: 1, b: 2}" (InlineObjects)
+	if strings.HasPrefix(content, "{") {
+		return p.parseInlineObject(content, item)
+	}
+
+	key, rest, ok := splitKey(content)
+	if !ok {
+		return p.parsePrimitive(content, item)
+	}
+	if err := p.checkEscapes(content, item); err != nil {
+		return nil, err
+	}
+
+	// Objeto: la primera clave va en la línea del guión y el resto un nivel
+	// más adentro; el primer campo se trata como si estuviera en ese nivel
+	fieldLine := toonLine{num: item.num, indent: p.firstFieldIndent(item, rest), text: content}
+	obj := make(map[string]interface{})
+	value, err := p.parseFieldValue(rest, fieldLine)
+	if err != nil {
+		return nil, err
+	}
+	p.setField(obj, key, strings.HasPrefix(content, `"`), value)
+
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > item.indent {
+		if err := p.parseFields(obj, p.lines[p.pos].indent); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+// firstFieldIndent devuelve el nivel de los campos del objeto del elemento
+// item, cuyo primer campo termina en rest. Los demás campos van un nivel por
+// debajo del guión y lo anidado en el primero, dos, así que si hay campos
+// tras lo anidado están en la menor indentación de las líneas siguientes. Si
+// no, esas líneas son los demás campos (primer campo primitivo o array sin
+// filas) o lo anidado (array con filas); tras "clave:" sin valor solo el
+// ancho de indentación distingue un objeto anidado de uno vacío seguido de
+// campos.
+func (p *toonParser) firstFieldIndent(item toonLine, rest string) int {
+	first, level := -1, -1
+	for i := p.pos; i < len(p.lines) && p.lines[i].indent > item.indent; i++ {
+		if first < 0 {
+			first = p.lines[i].indent
+		}
+		if level < 0 || p.lines[i].indent < level {
+			level = p.lines[i].indent
+		}
+	}
+	switch {
+	case first < 0:
+		return item.indent + p.indentWidth
+	case level < first:
+		return level
+	}
+
+	if strings.HasPrefix(rest, "[") {
+		if header, ok := parseArrayHeader(rest); ok && !header.hasInline && header.length > 0 {
+			return first - 1
+		}
+		return first
+	}
+	if strings.Trim(strings.TrimPrefix(rest, ":"), " ") != "" {
+		return first
+	}
+	return item.indent + p.indentWidth
+}
+
+// parseInlineObject lee un objeto de valores primitivos escrito en una línea,
+// "{clave: valor, ...}", con los campos separados por coma.
+func (p *toonParser) parseInlineObject(text string, line toonLine) (interface{}, error) {
+	if closingBrace(text) != len(text)-1 {
+		return nil, p.errorf(line, "objeto en línea sin cerrar: %s", text)
+	}
+
+	obj := make(map[string]interface{})
+	inner := strings.Trim(text[1:len(text)-1], " ")
+	if inner == "" {
+		return obj, nil
+	}
+	for _, field := range splitDelimited(inner, ",") {
+		key, rest, ok := splitKey(strings.Trim(field, " "))
+		if !ok || !strings.HasPrefix(rest, ":") {
+			return nil, p.errorf(line, "campo inválido en objeto en línea: %s", field)
+		}
+		value, err := p.parsePrimitive(rest[1:], line)
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = value
+	}
+	return obj, nil
+}
+
+// splitKey separa una línea "clave: valor" o "clave[N]..." en la clave y el
+// resto a partir de ':' o '['.
+func splitKey(text string) (string, string, bool) {
+	var key, rest string
+
+	if strings.HasPrefix(text, `"`) {
+		end := closingQuote(text)
+		if end < 0 {
+			return "", "", false
+		}
+		key = unescapeTOON(text[1:end])
+		rest = text[end+1:]
+	} else {
+		idx := strings.IndexAny(text, ":[")
+		if idx <= 0 {
+			return "", "", false
+		}
+		key = text[:idx]
+		rest = text[idx:]
+	}
+
+	if strings.HasPrefix(rest, ":") {
+		return key, rest, true
+	}
+	if strings.HasPrefix(rest, "[") {
+		if _, ok := parseArrayHeader(rest); ok {
+			return key, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// parseArrayHeader interpreta "[#N<delim>]{campos}:" y lo que le siga.
+func parseArrayHeader(s string) (arrayHeader, bool) {
+	var header arrayHeader
+
+	if !strings.HasPrefix(s, "[") {
+		return header, false
+	}
+	i := 1
+	if i < len(s) && s[i] == '#' {
+		i++
+	}
+
+	start := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == start {
+		return header, false
+	}
+	header.length, _ = strconv.Atoi(s[start:i])
+
+	// Forma matriz: "[RxC]"
+	if i < len(s) && s[i] == 'x' {
+		i++
+		colStart := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == colStart {
+			return header, false
+		}
+		header.columns, _ = strconv.Atoi(s[colStart:i])
+		if header.columns == 0 {
+			return header, false
+		}
+	}
+
+	// Marcador de delimitador dentro de los corchetes (el tabulador como
+	// espacio o, como en la especificación, tal cual)
+	marker := ""
+	if i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '|') {
+		marker = s[i : i+1]
+		i++
+	}
+	if i >= len(s) || s[i] != ']' {
+		return header, false
+	}
+	i++
+
+	fieldList := ""
+	tabular := false
+	if i < len(s) && s[i] == '{' {
+		end := closingBrace(s[i:])
+		if end < 0 {
+			return header, false
+		}
+		fieldList = s[i+1 : i+end]
+		tabular = true
+		i += end + 1
+	}
+
+	if i >= len(s) || s[i] != ':' {
+		return header, false
+	}
+	rest := strings.TrimPrefix(s[i+1:], " ")
+
+	switch marker {
+	case " ", "\t":
+		header.delimiter = "\t"
+	case "|":
+		header.delimiter = "|"
+	default:
+		header.delimiter = inferFieldDelimiter(fieldList)
+	}
+
+	if tabular && header.columns > 0 {
+		return header, false
+	}
+
+	if tabular {
+		if rest != "" {
+			return header, false
+		}
+		separator := header.delimiter
+		if separator == "\t" && !strings.Contains(fieldList, "\t") {
+			separator = " "
+		}
+		header.fields = []string{}
+		for _, field := range splitDelimited(fieldList, separator) {
+			field = strings.Trim(field, " ")
+			header.fields = append(header.fields, headerFieldName(field))
+			header.types = append(header.types, headerFieldType(field))
+		}
+		return header, true
+	}
+
+	if header.columns > 0 {
+		return header, rest == ""
+	}
+
+	header.inline = rest
+	header.hasInline = rest != ""
+	return header, true
+}
+
+// headerFieldName devuelve el nombre de un campo del header tabular, sin
+// comillas y sin la anotación de tipo de TypedHeaders ("id:int"), que se
+// ignora. Un nombre con ':' siempre va entre comillas, así que el ':' de un
+// campo sin ellas es el de la anotación.
+func headerFieldName(field string) string {
+	name, _ := splitHeaderField(field)
+	return name
+}
+
+// headerFieldType devuelve la anotación de TypedHeaders de un campo del
+// header tabular ("int" en "id:int"), o "".
+func headerFieldType(field string) string {
+	_, fieldType := splitHeaderField(field)
+	return fieldType
+}
+
+// splitHeaderField separa un campo del header tabular en su nombre y su
+// anotación de tipo.
+func splitHeaderField(field string) (string, string) {
+	if strings.HasPrefix(field, `"`) {
+		if end := closingQuote(field); end > 0 {
+			return unescapeTOON(field[1:end]), strings.TrimPrefix(field[end+1:], ":")
+		}
+		return field, ""
+	}
+	if name, fieldType, ok := strings.Cut(field, ":"); ok {
+		return name, fieldType
+	}
+	return field, ""
+}
+
+// inferFieldDelimiter deduce el delimitador de un header sin marcador mirando
+// el separador entre campos. Sin campos se asume coma.
+func inferFieldDelimiter(fieldList string) string {
+	inQuotes := false
+	for i := 0; i < len(fieldList); i++ {
+		switch c := fieldList[i]; {
+		case c == '\\' && inQuotes:
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '|':
+			return "|"
+		case c == ',':
+			return ","
+		case c == ' ' || c == '\t':
+			return "\t"
+		}
+	}
+	return ","
+}
+
+// splitDelimited divide s por el delimitador respetando las comillas.
+func splitDelimited(s, delimiter string) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && strings.HasPrefix(s[i:], delimiter):
+			parts = append(parts, s[start:i])
+			start = i + len(delimiter)
+			i += len(delimiter) - 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// closingQuote devuelve el índice de la comilla que cierra el string que
+// empieza en s[0], o -1 si no está cerrado.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func closingBrace(s string) int {
+	inQuotes := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == '}' && !inQuotes:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeTOON(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'u':
+			// \uXXXX (caracteres de control escapados por el encoder, o
+			// cualquiera con ASCIIOnly, en par suplente fuera del plano básico)
+			if i+4 < len(s) {
+				if code, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err == nil {
+					r := rune(code)
+					i += 4
+					if utf16.IsSurrogate(r) && i+6 < len(s) && s[i+1] == '\\' && s[i+2] == 'u' {
+						if low, err := strconv.ParseUint(s[i+3:i+7], 16, 32); err == nil {
+							if pair := utf16.DecodeRune(r, rune(low)); pair != utf8.RuneError {
+								r = pair
+								i += 6
+							}
+						}
+					}
+					b.WriteRune(r)
+					break
+				}
+			}
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// unknownEscape devuelve la primera secuencia de escape de s (contenido de
+// un string entre comillas) que el encoder no produce, o "".
+func unknownEscape(s string) string {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		i++
+		switch s[i] {
+		case '\\', '"', 'n', 't', 'r':
+		case 'u':
+			if i+4 >= len(s) {
+				return s[i-1:]
+			}
+			if _, err := strconv.ParseUint(s[i+1:i+5], 16, 32); err != nil {
+				return s[i-1 : i+5]
+			}
+			i += 4
+		default:
+			return s[i-1 : i+1]
+		}
+	}
+	return ""
+}
+
+// checkEscapes comprueba las secuencias de escape del string entre comillas
+// con que empieza text (una clave o un valor).
+func (p *toonParser) checkEscapes(text string, line toonLine) error {
+	if !strings.HasPrefix(text, `"`) {
+		return nil
+	}
+	end := closingQuote(text)
+	if end < 0 {
+		return nil
+	}
+	if seq := unknownEscape(text[1:end]); seq != "" {
+		return p.violation(line, "secuencia de escape desconocida: %s", seq)
+	}
+	return nil
+}
+
+// compactBoolValue convierte el 1 o el 0 de CompactBooleans en true o false;
+// cualquier otro valor se devuelve tal cual.
+func compactBoolValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		if v == 1 || v == 0 {
+			return v == 1
+		}
+	case json.Number:
+		if v == "1" || v == "0" {
+			return v == "1"
+		}
+	}
+	return value
+}
+
+// parsePrimitive convierte un token TOON en string, número, bool o null.
+// Los strings que parecen números o literales siempre van entre comillas,
+// así que un token sin comillas se interpreta por su forma.
+func (p *toonParser) parsePrimitive(token string, line toonLine) (interface{}, error) {
+	token = strings.Trim(token, " ")
+
+	if strings.HasPrefix(token, `"`) {
+		if closingQuote(token) != len(token)-1 {
+			return nil, p.errorf(line, "string sin cerrar: %s", token)
+		}
+		if err := p.checkEscapes(token, line); err != nil {
+			return nil, err
+		}
+		return unescapeTOON(token[1 : len(token)-1]), nil
+	}
+
+	switch token {
+	case p.decoder.trueLiteral:
+		return true, nil
+	case p.decoder.falseLiteral:
+		return false, nil
+	case p.decoder.nullLiteral:
+		return nil, nil
+	case "null":
+		// Con EmptyNull el encoder escribe null en las filas tabulares que
+		// quedarían vacías; el string "null" siempre va entre comillas
+		if p.decoder.nullLiteral == "" {
+			return nil, nil
+		}
+	case "[]":
+		// Array u objeto vacío escrito de forma literal (EmptyContainerStyle)
+		return []interface{}{}, nil
+	case "{}":
+		return map[string]interface{}{}, nil
+	}
+
+	if n, err := strconv.ParseFloat(token, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+		if p.useNumber {
+			// ParseFloat acepta formas que JSON no (+1, .5, 0x1p-2)
+			if validJSONNumber.MatchString(token) {
+				return json.Number(token), nil
+			}
+			return json.Number(strconv.FormatFloat(n, 'g', -1, 64)), nil
+		}
+		return n, nil
+	}
+
+	return token, nil
+}
@@ -0,0 +1,724 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOONDecoder_DelimiterRoundTrip(t *testing.T) {
+	jsonStr := `{
+		"users": [
+			{"id": 1, "name": "Alice Smith", "tags": "a,b|c", "active": true},
+			{"id": 2, "name": "Bob", "tags": "tab\there", "active": false}
+		],
+		"scores": [1.5, 2, -3],
+		"labels": ["x y", "a,b", "p|q", ""],
+		"meta": {"page": 1, "note": null}
+	}`
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, delimiter := range []string{",", "\t", "|"} {
+		t.Run(delimiter, func(t *testing.T) {
+			encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: delimiter})
+			toon := mustEncode(t, encoder, data)
+
+			decoded, err := NewTOONDecoder().Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, toon)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch for %q\nTOON:\n%s\nGot: %#v", delimiter, toon, decoded)
+			}
+		})
+	}
+}
+
+func TestTOONDecoder_InferDelimiterFromHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"comma", "items[2]{id,name}:\n    1,Widget\n    2,Gadget"},
+		{"tab", "items[2 ]{id name}:\n    1\tWidget\n    2\tGadget"},
+		{"pipe", "items[2|]{id|name}:\n    1|Widget\n    2|Gadget"},
+		{"pipe without marker", "items[2]{id|name}:\n    1|Widget\n    2|Gadget"},
+	}
+
+	expected := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": float64(1), "name": "Widget"},
+			map[string]interface{}{"id": float64(2), "name": "Gadget"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := NewTOONDecoder().Decode(tt.input)
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, expected) {
+				t.Errorf("Expected %#v, got %#v", expected, decoded)
+			}
+		})
+	}
+}
+
+func TestTOONDecoder_DelimiterInHeaderFields(t *testing.T) {
+	values := []interface{}{
+		[]interface{}{map[string]interface{}{"p|q": float64(1)}},
+		[]interface{}{
+			map[string]interface{}{"p|q": float64(1), "a,b": "x"},
+			map[string]interface{}{"p|q": float64(2), "a,b": "y"},
+		},
+	}
+
+	for _, data := range values {
+		for _, delimiter := range []string{",", "\t", "|"} {
+			encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: delimiter})
+			toon := mustEncode(t, encoder, data)
+
+			decoded, err := NewTOONDecoder().Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, toon)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch for %q\nTOON:\n%s\nGot: %#v", delimiter, toon, decoded)
+			}
+		}
+	}
+}
+
+func TestTOONDecoder_ListArrays(t *testing.T) {
+	jsonStr := `{"items": [
+		{"id": 1, "meta": {"x": 1}, "tags": ["a", "b"]},
+		[1, 2],
+		"plain"
+	]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	for _, indent := range []int{2, 4} {
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Indent: indent})
+		toon := mustEncode(t, encoder, data)
+
+		decoded, err := NewTOONDecoder().Decode(toon)
+		if err != nil {
+			t.Fatalf("Decode error: %v\n%s", err, toon)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("Round-trip mismatch (indent %d)\nTOON:\n%s\nGot: %#v", indent, toon, decoded)
+		}
+	}
+}
+
+func TestTOONDecoder_ListItemNesting(t *testing.T) {
+	inputs := []string{
+		`{"x":[{"a":{"b":1}}]}`,
+		`{"x":[{"a":{"b":{"c":1}},"d":2}]}`,
+		`{"x":[{"a":[{"b":1}],"c":2}]}`,
+		`{"x":[{"a":[[1,2],[3]],"c":1}]}`,
+		`{"x":[[{"a":{"b":1},"c":2},{"b":2}]]}`,
+		`{"x":[[[1],[2,3]]],"y":{"z":1}}`,
+	}
+
+	for _, input := range inputs {
+		var data interface{}
+		json.Unmarshal([]byte(input), &data)
+
+		for _, indent := range []int{2, 3, 4} {
+			encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Indent: indent})
+			toon := mustEncode(t, encoder, data)
+
+			decoded, err := NewTOONDecoder().Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, toon)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch for %s (indent %d)\nTOON:\n%s\nGot: %#v", input, indent, toon, decoded)
+			}
+		}
+	}
+
+	// Las filas de un array anidado en un elemento van un nivel por debajo
+	// del guión, también con otra indentación
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Indent: 4})
+	expected := "[1]:\n    - [2]:\n                - [1]: 1\n                - [2]: 2,3"
+	if got := mustEncode(t, encoder, []interface{}{[]interface{}{[]interface{}{1}, []interface{}{2, 3}}}); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Un objeto vacío seguido de campos solo se distingue de uno anidado con
+	// el ancho de indentación: con la especificación y 4 espacios hay que darlo
+	var data interface{}
+	json.Unmarshal([]byte(`{"x":[{"a":{},"c":1}]}`), &data)
+	encoder, _ = NewTOONEncoderWithOptions(TOONOptions{Indent: 4, SpecVersion: "1.0"})
+	decoder, _ := NewTOONDecoderWithOptions(TOONOptions{Indent: 4})
+	if decoded, err := decoder.Decode(mustEncode(t, encoder, data)); err != nil || !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Expected %#v, got %#v (%v)", data, decoded, err)
+	}
+}
+
+func TestTOONDecoder_ListEndMarker(t *testing.T) {
+	decoded, err := NewTOONDecoder().Decode("items[#2]:\n    - 1\n    - a: 2\n    [/#2]")
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"items": []interface{}{float64(1), map[string]interface{}{"a": float64(2)}},
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, decoded)
+	}
+
+	if _, err := NewTOONDecoder().Decode("items[2]:\n    - 1\n    - 2\n    [/3]"); err == nil {
+		t.Error("Expected error when the end marker count does not match")
+	}
+}
+
+func TestTOONDecoder_Matrix(t *testing.T) {
+	jsonStr := `{"square": [[1, 2, 3], [4, 5, 6], [7, 8, 9]], "ragged": [[1, 2], [3]], "labels": [["a", "b,c"], ["", "d"]]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	for _, delimiter := range []string{",", "\t", "|"} {
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: delimiter, LengthMarker: true})
+		toon := mustEncode(t, encoder, data)
+
+		decoded, err := NewTOONDecoder().Decode(toon)
+		if err != nil {
+			t.Fatalf("Decode error: %v\n%s", err, toon)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("Round-trip mismatch for %q\nTOON:\n%s\nGot: %#v", delimiter, toon, decoded)
+		}
+	}
+}
+
+func TestTOONDecoder_ListIndex(t *testing.T) {
+	jsonStr := `{"docs": [
+		{"id": 1, "chunks": [[1, 2], {"text": "a"}, "b"]},
+		"plain",
+		[{"x": 1}, [3]]
+	]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	tests := []struct {
+		base, style string
+		first       string
+	}{
+		{"0", "", "docs[3]:\n    0- chunks[3]:\n          0- [2]: 1,2\n          1- text: a\n          2- b\n      id: 1\n    1- plain"},
+		{"1", ")", "docs[3]:\n    1) chunks[3]:\n          1) [2]: 1,2\n          2) text: a\n          3) b\n      id: 1\n    2) plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.base+tt.style, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(TOONOptions{ListIndex: tt.base, ListIndexStyle: tt.style})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			toon := mustEncode(t, encoder, data)
+			if !strings.HasPrefix(toon, tt.first) {
+				t.Errorf("Expected output to start with:\n%s\nGot:\n%s", tt.first, toon)
+			}
+
+			decoded, err := NewTOONDecoder().Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, toon)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %#v", toon, decoded)
+			}
+		})
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{ListIndex: "2"}); err == nil {
+		t.Error("Expected error for unknown listIndex base")
+	}
+}
+
+func TestTOONDecoder_CustomLiterals(t *testing.T) {
+	jsonStr := `{"flags": [{"id": 1, "on": true, "note": null}, {"id": 2, "on": false, "note": "yes"}], "ok": true, "missing": null, "list": [true, null, "no", 1]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		contains string
+	}{
+		{"yes/no", TOONOptions{TrueLiteral: "yes", FalseLiteral: "no", NullLiteral: "none"}, "    1,none,yes\n    2,\"yes\",no"},
+		{"python", TOONOptions{TrueLiteral: "True", FalseLiteral: "False", NullLiteral: "None"}, "ok: True"},
+		{"empty null", TOONOptions{EmptyNull: true}, "missing:\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			toon := mustEncode(t, encoder, data)
+			if !strings.Contains(toon, tt.contains) {
+				t.Errorf("Expected output to contain %q, got:\n%s", tt.contains, toon)
+			}
+
+			decoder, err := NewTOONDecoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			decoded, err := decoder.Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, toon)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %#v", toon, decoded)
+			}
+		})
+	}
+}
+
+func TestTOONDecoder_EmptyNullSingleCell(t *testing.T) {
+	jsonStr := `{"rows": [{"x": null}, {"x": 1}], "list": [null], "matrix": [[null], [null]]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	// Una fila vacía sería una línea en blanco: se escribe null
+	opts := TOONOptions{EmptyNull: true}
+	encoder, _ := NewTOONEncoderWithOptions(opts)
+	toon := mustEncode(t, encoder, data)
+	expected := "list[1]: null\n" +
+		"matrix[2x1]:\n" +
+		"    null\n" +
+		"    null\n" +
+		"rows[2]{x}:\n" +
+		"    null\n" +
+		"    1"
+	if toon != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, toon)
+	}
+
+	decoder, _ := NewTOONDecoderWithOptions(opts)
+	decoded, err := decoder.Decode(toon)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Round-trip mismatch: %#v", decoded)
+	}
+}
+
+func TestTOONEncoder_EmptyNullRoot(t *testing.T) {
+	// El documento vacío se lee como {}: un null en la raíz se escribe
+	opts := TOONOptions{EmptyNull: true}
+	encoder, _ := NewTOONEncoderWithOptions(opts)
+	if toon := mustEncode(t, encoder, nil); toon != "null" {
+		t.Errorf("Expected null, got %q", toon)
+	}
+	var streamed strings.Builder
+	if err := encoder.EncodeTo(&streamed, nil, nil); err != nil || streamed.String() != "null" {
+		t.Errorf("Expected EncodeTo to write null, got %q (%v)", streamed.String(), err)
+	}
+
+	decoder, _ := NewTOONDecoderWithOptions(opts)
+	if decoded, err := decoder.Decode("null"); err != nil || decoded != nil {
+		t.Errorf("Expected nil, got %#v (%v)", decoded, err)
+	}
+
+	out, err := MarshalWithOptions(nil, opts)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	value := map[string]interface{}{"a": 1}
+	var target interface{} = value
+	if err := Unmarshal(out, &target); err != nil || target != nil {
+		t.Errorf("Expected Unmarshal to give nil, got %#v (%v)", target, err)
+	}
+}
+
+func TestTOONEncoder_InvalidLiterals(t *testing.T) {
+	for _, opts := range []TOONOptions{
+		{TrueLiteral: "1"},
+		{TrueLiteral: "yes", FalseLiteral: "yes"},
+		{NullLiteral: "n/a: x"},
+		{TrueLiteral: "false"},
+		{NullLiteral: "nil", EmptyNull: true},
+		{Delimiter: "|", FalseLiteral: "n|o"},
+	} {
+		if _, err := NewTOONEncoderWithOptions(opts); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+}
+
+func TestTOONDecoder_SparseTabular(t *testing.T) {
+	jsonStr := `{"users": [
+		{"id": 1, "name": "Alice", "email": "alice@example.com"},
+		{"id": 2, "name": "Bob"},
+		{"id": 3, "email": "", "phone": "555"}
+	]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{SparseTabular: true})
+	toon := mustEncode(t, encoder, data)
+
+	expected := "users[3]{email,id,name,phone}:\n" +
+		"    alice@example.com,1,Alice,\n" +
+		"    ,2,Bob,\n" +
+		"    \"\",3,,\"555\""
+	if toon != expected {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", expected, toon)
+	}
+
+	decoded, err := NewTOONDecoder().Decode(toon)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	want := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": float64(1), "name": "Alice", "email": "alice@example.com", "phone": nil},
+			map[string]interface{}{"id": float64(2), "name": "Bob", "email": nil, "phone": nil},
+			map[string]interface{}{"id": float64(3), "name": nil, "email": "", "phone": "555"},
+		},
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("Expected %#v, got %#v", want, decoded)
+	}
+
+	// Sin la opción se mantiene el formato lista
+	if toon := mustEncode(t, NewTOONEncoder(), data); !strings.HasPrefix(toon, "users[3]:\n") {
+		t.Errorf("Expected list format without SparseTabular, got:\n%s", toon)
+	}
+}
+
+func TestTOONDecoder_InlineObjects(t *testing.T) {
+	jsonStr := `{"items": [
+		{"a": 1, "b": "x, y"},
+		{"c": "}", "d": true},
+		{"big": 1, "more": 2, "fields": 3},
+		{"nested": {"x": 1}},
+		"plain"
+	]}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{InlineObjects: 2})
+	inline := mustEncode(t, encoder, data)
+
+	expected := "items[5]:\n" +
+		"    - {a: 1, b: \"x, y\"}\n" +
+		"    - {c: \"}\", d: true}\n" +
+		"    - big: 1\n" +
+		"      fields: 3\n" +
+		"      more: 2\n" +
+		"    - nested:\n" +
+		"        x: 1\n" +
+		"    - plain"
+	if inline != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, inline)
+	}
+
+	for _, toon := range []string{inline, mustEncode(t, NewTOONEncoder(), data)} {
+		decoded, err := NewTOONDecoder().Decode(toon)
+		if err != nil {
+			t.Fatalf("Decode error: %v\n%s", err, toon)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %#v", toon, decoded)
+		}
+	}
+}
+
+func TestTOONEncoder_InlineObjectsTokens(t *testing.T) {
+	// Objetos de dos campos no uniformes: se quedan en formato lista
+	var items []interface{}
+	for i := 0; i < 20; i++ {
+		key := "name"
+		if i%2 == 1 {
+			key = "title"
+		}
+		items = append(items, map[string]interface{}{"id": float64(i), key: "item"})
+	}
+	data := map[string]interface{}{"items": items}
+
+	expanded := mustEncode(t, NewTOONEncoder(), data)
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{InlineObjects: 2})
+	inline := mustEncode(t, encoder, data)
+
+	inlineLines, expandedLines := strings.Count(inline, "\n")+1, strings.Count(expanded, "\n")+1
+	if inlineLines != 21 || expandedLines != 41 {
+		t.Errorf("Expected one line per object inline, got %d lines (expanded %d)", inlineLines, expandedLines)
+	}
+	t.Logf("words: expanded=%d inline=%d", countWords(expanded), countWords(inline))
+}
+
+func TestTOONEncoder_Annotate(t *testing.T) {
+	input := `{"users": [{"id": 1, "name": "Alice"}, {"id": 2, "name": "# admin"}], "groups": [{"members": [{"id": 1}]}, "x"], "tags": ["#", "b"]}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Annotate: true})
+	toon := mustEncode(t, encoder, data)
+
+	expected := "groups[2]:\n" +
+		"    # 1 row: id\n" +
+		"    - members[1]{id}:\n" +
+		"          1\n" +
+		"    - x\n" +
+		"tags[2]: \"#\",b\n" +
+		"# 2 rows: id, name\n" +
+		"users[2]{id,name}:\n" +
+		"    1,Alice\n" +
+		"    2,\"# admin\""
+	if toon != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, toon)
+	}
+
+	decoded, err := NewTOONDecoder().Decode(toon)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Expected comments to be ignored, got %#v", decoded)
+	}
+}
+
+func TestTOONDecoder_Comments(t *testing.T) {
+	toon := "# Pedidos del día\n" +
+		"#\n" +
+		"orders[#2]{id,total}:\n" +
+		"  # primera fila\n" +
+		"  1,9.5\n" +
+		"  2,3\n" +
+		"#tag: x"
+
+	decoded, err := NewTOONDecoder().Decode(toon)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": 1.0, "total": 9.5},
+			map[string]interface{}{"id": 2.0, "total": 3.0},
+		},
+		// Sin espacio tras "#" no es un comentario
+		"#tag": "x",
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, decoded)
+	}
+}
+
+func TestTOONEncoder_Compact(t *testing.T) {
+	input := `{"users": [{"id": 1, "name": "Alice"}, {"id": 2, "name": "Bob"}], "ids": [{"id": 1}, {"id": 2}], "tags": ["a", "b", "c"]}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		delimiter string
+		expected  string
+	}{
+		{",", "ids[2]{id}:\n    1\n    2\ntags[3]:a,b,c\nusers[2]{id,name}:\n    1,Alice\n    2,Bob"},
+		// Con un solo campo el marcador es necesario para saber el delimitador
+		{"|", "ids[2|]{id}:\n    1\n    2\ntags[3|]:a|b|c\nusers[2]{id|name}:\n    1|Alice\n    2|Bob"},
+		{"\t", "ids[2 ]{id}:\n    1\n    2\ntags[3 ]:a\tb\tc\nusers[2]{id name}:\n    1\tAlice\n    2\tBob"},
+	}
+
+	for _, tt := range tests {
+		verbose, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: tt.delimiter})
+		compact, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: tt.delimiter, Compact: true})
+
+		toon := mustEncode(t, compact, data)
+		if toon != tt.expected {
+			t.Errorf("Delimiter %q\nExpected:\n%s\nGot:\n%s", tt.delimiter, tt.expected, toon)
+		}
+
+		full := mustEncode(t, verbose, data)
+		if len(toon) >= len(full) || countWords(toon) > countWords(full) {
+			t.Errorf("Delimiter %q: expected compact output to be smaller (%d vs %d chars, %d vs %d words)",
+				tt.delimiter, len(toon), len(full), countWords(toon), countWords(full))
+		}
+
+		// El decoder acepta las dos formas
+		for _, out := range []string{toon, full} {
+			decoded, err := NewTOONDecoder().Decode(out)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, out)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch for:\n%s", out)
+			}
+		}
+	}
+}
+
+func TestTOONEncoder_TypedHeaders(t *testing.T) {
+	input := `{"users": [{"id": 1, "score": 9.5, "name": "Alice", "admin": true, "manager": null, "note": "x"},
+		{"id": 2, "score": 7, "name": "Bob", "admin": false, "manager": null, "note": 3},
+		{"id": null, "score": 8, "name": "a:b", "admin": true, "manager": null, "note": "y"}]}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		delimiter string
+		header    string
+	}{
+		// id con un null sigue siendo int; note mezcla string y número
+		{",", "users[3]{admin:bool,id:int,manager:null,name:string,note,score:float}:"},
+		{"|", "users[3|]{admin:bool|id:int|manager:null|name:string|note|score:float}:"},
+		{"\t", "users[3 ]{admin:bool id:int manager:null name:string note score:float}:"},
+	}
+
+	for _, tt := range tests {
+		plain, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: tt.delimiter})
+		typed, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: tt.delimiter, TypedHeaders: true})
+
+		toon := mustEncode(t, typed, data)
+		lines := strings.SplitN(toon, "\n", 2)
+		if lines[0] != tt.header {
+			t.Errorf("Delimiter %q: expected header %q, got %q", tt.delimiter, tt.header, lines[0])
+		}
+		// Las filas no cambian
+		if rows := strings.SplitN(mustEncode(t, plain, data), "\n", 2)[1]; rows != lines[1] {
+			t.Errorf("Delimiter %q: rows changed:\n%s", tt.delimiter, lines[1])
+		}
+
+		decoded, err := NewTOONDecoder().Decode(toon)
+		if err != nil {
+			t.Fatalf("Decode error: %v\n%s", err, toon)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("Round-trip mismatch for:\n%s", toon)
+		}
+	}
+
+	// Los campos con ':' van entre comillas y el tipo detrás
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{TypedHeaders: true})
+	rows := []interface{}{map[string]interface{}{"a:b": 1.0}, map[string]interface{}{"a:b": 2.0}}
+	toon := mustEncode(t, encoder, rows)
+	if !strings.HasPrefix(toon, `[2]{"a:b":int}:`) {
+		t.Errorf("Unexpected header: %s", toon)
+	}
+	if decoded, _ := NewTOONDecoder().Decode(toon); !reflect.DeepEqual(decoded, rows) {
+		t.Errorf("Round-trip mismatch for:\n%s", toon)
+	}
+}
+
+func TestTOONEncoder_CompactBooleans(t *testing.T) {
+	input := `{"users": [{"id": 1, "active": true}, {"id": 2, "active": false}], "flags": [true, false], "enabled": true}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	opts := TOONOptions{CompactBooleans: true, TypedHeaders: true}
+	encoder, _ := NewTOONEncoderWithOptions(opts)
+	toon := mustEncode(t, encoder, data)
+	// Fuera de filas y arrays se usan los literales
+	expected := "enabled: true\nflags[2]: 1,0\nusers[2]{active:bool,id:int}:\n    1,1\n    0,2"
+	if toon != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, toon)
+	}
+
+	// La columna anotada vuelve a ser bool; el array de primitivos no lleva
+	// tipos y se queda en números
+	decoder, _ := NewTOONDecoderWithOptions(opts)
+	decoded, err := decoder.Decode(toon)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	users := decoded.(map[string]interface{})["users"].([]interface{})
+	if users[0].(map[string]interface{})["active"] != true || users[1].(map[string]interface{})["active"] != false {
+		t.Errorf("Expected booleans in the typed column, got %v", users)
+	}
+	if flags := decoded.(map[string]interface{})["flags"].([]interface{}); flags[0] != 1.0 {
+		t.Errorf("Expected numbers in the primitive array, got %v", flags)
+	}
+	if plain, _ := NewTOONDecoder().Decode(toon); plain.(map[string]interface{})["users"].([]interface{})[0].(map[string]interface{})["active"] != 1.0 {
+		t.Errorf("Expected numbers without CompactBooleans, got %v", plain)
+	}
+}
+
+func TestTOONEncoder_EmptyContainerStyle(t *testing.T) {
+	input := `{"a": [], "b": {}, "c": null, "d": [{}, [], null], "e": {"f": {}}}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		expected string
+	}{
+		{"header", TOONOptions{}, "a[0]:\nb:\nc: null\nd[3]:\n    - \n    - [0]:\n    - null\ne:\n  f:"},
+		{"literal", TOONOptions{EmptyContainerStyle: "literal"}, "a: []\nb: {}\nc: null\nd[3]:\n    - {}\n    - []\n    - null\ne:\n  f: {}"},
+		// Con EmptyNull "b:" sería null, así que el objeto vacío es "{}"
+		{"empty null", TOONOptions{EmptyNull: true}, "a[0]:\nb: {}\nc:\nd[3]:\n    - {}\n    - [0]:\n    - \ne:\n  f: {}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			toon := mustEncode(t, encoder, data)
+			if toon != tt.expected {
+				t.Errorf("Expected:\n%q\nGot:\n%q", tt.expected, toon)
+			}
+
+			decoder, _ := NewTOONDecoderWithOptions(tt.opts)
+			decoded, err := decoder.Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v\n%s", err, toon)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %#v", toon, decoded)
+			}
+		})
+	}
+
+	// En la raíz
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{EmptyContainerStyle: "literal"})
+	for _, root := range []interface{}{[]interface{}{}, map[string]interface{}{}} {
+		toon := mustEncode(t, encoder, root)
+		if decoded, _ := NewTOONDecoder().Decode(toon); !reflect.DeepEqual(decoded, root) {
+			t.Errorf("Round-trip mismatch for root %q: %#v", toon, decoded)
+		}
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{EmptyContainerStyle: "braces"}); err == nil {
+		t.Error("Expected error for an invalid emptyContainerStyle")
+	}
+}
+
+func TestTOONDecoder_UseNumber(t *testing.T) {
+	input := "id: 9007199254740993\nprices[3]: 1.50,+2,.5\nname: \"42\""
+
+	value, _, err := NewTOONDecoder().DecodeWithOptions(input, DecodeOptions{Strict: true, UseNumber: true})
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	// Las formas que JSON no admite se normalizan; los strings siguen siendo
+	// strings
+	expected := map[string]interface{}{
+		"id":     json.Number("9007199254740993"),
+		"prices": []interface{}{json.Number("1.50"), json.Number("2"), json.Number("0.5")},
+		"name":   "42",
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, value)
+	}
+}
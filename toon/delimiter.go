@@ -0,0 +1,30 @@
+package toon
+
+// Delimiters son los delimitadores que admite TOONOptions.Delimiter, en el
+// orden en que BestDelimiter resuelve los empates.
+var Delimiters = []string{",", "\t", "|"}
+
+// BestDelimiter codifica value con cada uno de Delimiters y el resto de
+// opts, y devuelve el que da menos tokens según countTokens (como en
+// EncodeChunks, el paquete no depende de ningún tokenizer). Con el mismo
+// número de tokens gana el primero, así que la coma se prefiere si no hay
+// diferencia. Devuelve un error si opts no es válido con algún delimitador
+// o si Encode falla.
+func BestDelimiter(value interface{}, opts TOONOptions, countTokens func(string) int) (string, error) {
+	best, bestTokens := "", 0
+	for _, delimiter := range Delimiters {
+		opts.Delimiter = delimiter
+		encoder, err := NewTOONEncoderWithOptions(opts)
+		if err != nil {
+			return "", err
+		}
+		encoded, err := encoder.Encode(value)
+		if err != nil {
+			return "", err
+		}
+		if n := countTokens(encoded); best == "" || n < bestTokens {
+			best, bestTokens = delimiter, n
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,30 @@
+package toon
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBestDelimiter(t *testing.T) {
+	data := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "a, b", "note": "x"},
+			map[string]interface{}{"name": "c, d", "note": "y"},
+		},
+	}
+	// Con coma los nombres van entre comillas: cuesta más caracteres
+	delimiter, err := BestDelimiter(data, TOONOptions{}, func(s string) int { return len(s) })
+	if err != nil || delimiter == "," {
+		t.Errorf("Expected tab or pipe, got %q (%v)", delimiter, err)
+	}
+
+	// Empate: gana la coma
+	delimiter, _ = BestDelimiter(data, TOONOptions{}, func(s string) int { return strings.Count(s, "\n") })
+	if delimiter != "," {
+		t.Errorf("Expected comma on a tie, got %q", delimiter)
+	}
+
+	if _, err := BestDelimiter(data, TOONOptions{KeySort: "desc"}, countWords); err == nil {
+		t.Error("Expected error for invalid options")
+	}
+}
@@ -0,0 +1,2329 @@
+package toon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+type TOONOptions struct {
+	Indent           int
+	Delimiter        string // ",", "\t", "|"
+	LengthMarker     bool   // true para usar '#'
+	PreserveKeyOrder bool   // columnas tabulares en orden de aparición en vez de alfabético
+	MaxArrayElements int    // 0 = sin límite
+	TruncateArrays   bool   // true: recortar arrays largos; false: CheckLimits devuelve error
+	MaxDepth         int    // niveles de anidamiento que admite CheckLimits, 0 = DefaultMaxDepth
+	RootKey          string // si no está vacío, envuelve la salida bajo esta clave
+	ListEndMarker    bool   // cerrar los arrays en formato lista con "[/N]"
+	// SampleStrategy elige qué elementos conserva un array recortado:
+	// "head", "head+tail" o "random"; vacío es "head" sin la longitud real
+	SampleStrategy string
+	// ScientificNotation permite exponentes (1e+21) en números extremos
+	ScientificNotation bool
+	// JSNumberCompat formatea los números como Number.prototype.toString de JS
+	JSNumberCompat bool
+	// DecimalPlaces fija los decimales de los números no enteros, 0 = exactos
+	DecimalPlaces int
+	// FloatPrecision limita los decimales sin ceros finales, 0 = sin límite
+	FloatPrecision int
+	// KeySort ordena claves y columnas: "asc", "asc-ci", "natural" o "none"
+	KeySort string
+	// ListIndex numera los elementos de lista desde "0" o "1";
+	// ListIndexStyle elige "-" o ")" tras el número
+	ListIndex      string
+	ListIndexStyle string
+	// TrueLiteral, FalseLiteral y NullLiteral sustituyen a true, false y
+	// null; con EmptyNull, null no se escribe
+	TrueLiteral  string
+	FalseLiteral string
+	NullLiteral  string
+	EmptyNull    bool
+	// SparseTabular permite la forma tabular con campos ausentes (celda vacía)
+	SparseTabular bool
+	// InlineObjects escribe en una línea los objetos de lista de hasta N campos
+	InlineObjects int
+	// FieldTypes fuerza "number" o "string" en columnas tabulares por campo
+	FieldTypes map[string]string
+	// CompactBooleans escribe true y false como 1 y 0 en filas y arrays
+	CompactBooleans bool
+	// BinaryPlaceholders sustituye los strings base64 de al menos
+	// MinBinaryLength caracteres por "<binary 42KB>"
+	BinaryPlaceholders bool
+	MinBinaryLength    int
+	// DateMode compacta las fechas ISO-8601: "keep", "epoch" o "date-only"
+	DateMode string
+	// MaxStringLength recorta los strings largos con "…"; MaxStringLengths
+	// fija el límite por campo
+	MaxStringLength  int
+	MaxStringLengths map[string]int
+	// AlignColumns alinea las columnas tabulares con espacios
+	AlignColumns bool
+	// Flatten escribe los valores anidados como rutas ("a.b.0: 1") separadas
+	// por FlattenSeparator (ver flattenValue)
+	Flatten          bool
+	FlattenSeparator string
+	// Annotate escribe un comentario con filas y campos sobre cada tabla
+	Annotate bool
+	// Compact acorta los headers de array sin perder información
+	Compact bool
+	// NumericStrings escribe sin comillas los strings que son números JSON;
+	// NumericFields, solo en esas claves
+	NumericStrings bool
+	NumericFields  []string
+	// Include y Exclude conservan o quitan los campos de rutas como
+	// "users.*.email", antes del resto de opciones
+	Include []string
+	Exclude []string
+	// DropKeys quita estas claves en cualquier nivel y RedactKeys cambia su
+	// valor por "***"
+	DropKeys   []string
+	RedactKeys []string
+	// OmitNull quita los campos null; OmitEmpty también "", [] y {}
+	OmitNull  bool
+	OmitEmpty bool
+	// TypedHeaders anota el tipo de cada columna tabular (ver columnType)
+	TypedHeaders bool
+	// EmptyContainerStyle escribe los vacíos como "header" o "literal"
+	EmptyContainerStyle string
+	// ASCIIOnly escribe los caracteres no ASCII como \uXXXX
+	ASCIIOnly bool
+	// SpecVersion elige la variante del formato: "legacy" o "1.0" (ver
+	// specQuoteReason)
+	SpecVersion string
+	// KeyFolding pliega las cadenas de objetos de una clave en "a.b.c" (ver
+	// foldKey)
+	KeyFolding bool
+	// AbbreviateKeys sustituye las claves largas repetidas por alias con una
+	// leyenda (ver keyAliases)
+	AbbreviateKeys bool
+}
+
+type TOONEncoder struct {
+	indent             string
+	delimiter          string
+	lengthMarker       string // "#" or ""
+	preserveKeyOrder   bool
+	maxArrayElements   int
+	maxDepth           int // 0 = DefaultMaxDepth
+	truncateArrays     bool
+	sampleStrategy     string
+	rootKey            string
+	listEndMarker      bool
+	scientificNotation bool
+	jsNumberCompat     bool
+	decimalPlaces      int
+	floatPrecision     int
+	keySort            string
+	listIndex          bool
+	listIndexBase      int
+	listIndexStyle     string
+	trueLiteral        string
+	falseLiteral       string
+	nullLiteral        string
+	customLiterals     bool
+	sparseTabular      bool
+	inlineObjects      int
+	fieldTypes         map[string]string
+	compactBooleans    bool
+	dateMode           string // "" con "keep"
+	minBinaryLength    int    // 0 sin BinaryPlaceholders
+	maxStringLength    int
+	maxStringLengths   map[string]int
+	alignColumns       bool
+	flattenSeparator   string // "" sin Flatten
+	keyFolding         bool
+	abbreviateKeys     bool
+	annotate           bool
+	compact            bool
+	numericStrings     bool
+	numericFields      map[string]bool
+	include            [][]string
+	exclude            [][]string
+	dropKeys           map[string]bool
+	redactKeys         map[string]bool
+	omitNull           bool
+	omitEmpty          bool
+	typedHeaders       bool
+	emptyLiterals      bool
+	asciiOnly          bool
+	spec               bool // SpecVersion "1.0"
+}
+
+// OrderedMap es un objeto JSON que recuerda el orden original de sus claves.
+type OrderedMap struct {
+	Keys   []string
+	Values map[string]interface{}
+	// fixedOrder: Keys se respeta aunque KeySort no sea "none" (mapas Go
+	// con claves no string, ver normalizeValue)
+	fixedOrder bool
+}
+
+// MarshalJSON escribe el objeto con las claves en el orden de Keys.
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, key := range m.Keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.Values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, k...), ':'), v...)
+	}
+	return append(buf, '}'), nil
+}
+
+// keyOrder devuelve el orden conocido de las claves de value (nil si no es
+// un *OrderedMap) y si hay que respetarlo siempre.
+func keyOrder(value interface{}) ([]string, bool) {
+	if om, ok := value.(*OrderedMap); ok {
+		return om.Keys, om.fixedOrder
+	}
+	return nil, false
+}
+
+// AsObject devuelve los valores de un objeto JSON, sea map u *OrderedMap.
+func AsObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case *OrderedMap:
+		return v.Values, true
+	}
+	return nil, false
+}
+
+// DecodeOrderedJSON decodifica JSON igual que json.Unmarshal, pero los objetos
+// se devuelven como *OrderedMap para conservar el orden de las claves.
+func DecodeOrderedJSON(input string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(input))
+	value, err := DecodeOrderedValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("contenido inesperado después del valor JSON")
+	}
+	return value, nil
+}
+
+// DecodeJSON decodifica JSON con json.Decoder.UseNumber, así que los números
+// llegan al encoder como json.Number y los enteros de más de 53 bits se
+// escriben con todas sus cifras. Con ordered los objetos se devuelven como
+// *OrderedMap, como en DecodeOrderedJSON.
+func DecodeJSON(input string, ordered bool) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(input))
+	dec.UseNumber()
+
+	var value interface{}
+	var err error
+	if ordered {
+		value, err = DecodeOrderedValue(dec)
+	} else {
+		err = dec.Decode(&value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("contenido inesperado después del valor JSON")
+	}
+	return value, nil
+}
+
+// FindDuplicateKeys recorre el JSON token a token y devuelve la ruta de cada
+// clave repetida dentro de un mismo objeto (p. ej. "users[1].id").
+func FindDuplicateKeys(input string) ([]string, error) {
+	dec := json.NewDecoder(strings.NewReader(input))
+	var duplicates []string
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		delim, ok := tok.(json.Delim)
+		if !ok {
+			return nil
+		}
+
+		switch delim {
+		case '{':
+			seen := make(map[string]int)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key := keyTok.(string)
+				keyPath := key
+				if path != "" {
+					keyPath = path + "." + key
+				}
+				seen[key]++
+				if seen[key] == 2 {
+					duplicates = append(duplicates, keyPath)
+				}
+				if err := walk(keyPath); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+		_, err = dec.Token()
+		return err
+	}
+
+	err := walk("")
+	return duplicates, err
+}
+
+// DecodeOrderedValue lee de dec el siguiente valor JSON, con los objetos como
+// *OrderedMap (ver DecodeOrderedJSON).
+func DecodeOrderedValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		// Primitivo: string, float64 (json.Number con UseNumber), bool o nil
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := &OrderedMap{Values: make(map[string]interface{})}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyTok.(string)
+			value, err := DecodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			// Claves duplicadas: gana el último valor, como en json.Unmarshal
+			if _, exists := obj.Values[key]; !exists {
+				obj.Keys = append(obj.Keys, key)
+			}
+			obj.Values[key] = value
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := DecodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+
+	return nil, fmt.Errorf("delimitador inesperado: %v", delim)
+}
+
+func NewTOONEncoder() *TOONEncoder {
+	return &TOONEncoder{
+		indent:       "  ", // 2 espacios
+		delimiter:    ",",
+		lengthMarker: "",
+		trueLiteral:  "true",
+		falseLiteral: "false",
+		nullLiteral:  "null",
+	}
+}
+
+// ErrInvalidDelimiter distingue el delimitador entre los errores de
+// NewTOONEncoderWithOptions (se comprueba con errors.Is).
+var ErrInvalidDelimiter = errors.New("invalid delimiter")
+
+// maxDecimalPlaces es el máximo de DecimalPlaces, el mismo que admitía
+// toFixed en JavaScript.
+const maxDecimalPlaces = 20
+
+func NewTOONEncoderWithOptions(opts TOONOptions) (*TOONEncoder, error) {
+	indent := "  "
+	if opts.Indent > 0 {
+		indent = strings.Repeat(" ", opts.Indent)
+	}
+
+	delimiter := ","
+	if opts.Delimiter != "" {
+		if opts.Delimiter != "," && opts.Delimiter != "\t" && opts.Delimiter != "|" {
+			return nil, fmt.Errorf("%w: %q (must be ',', '\\t', or '|')", ErrInvalidDelimiter, opts.Delimiter)
+		}
+		delimiter = opts.Delimiter
+	}
+
+	lengthMarker := ""
+	if opts.LengthMarker {
+		lengthMarker = "#"
+	}
+
+	if opts.KeyFolding && opts.Flatten {
+		return nil, fmt.Errorf("keyFolding and flatten cannot be used together")
+	}
+	if opts.Flatten && strings.Contains(opts.FlattenSeparator, `\`) {
+		return nil, fmt.Errorf("invalid flattenSeparator: %q (must not contain a backslash)", opts.FlattenSeparator)
+	}
+
+	if opts.MaxDepth < 0 {
+		return nil, fmt.Errorf("invalid maxDepth: %d (must not be negative)", opts.MaxDepth)
+	}
+
+	if opts.DecimalPlaces < 0 || opts.DecimalPlaces > maxDecimalPlaces {
+		return nil, fmt.Errorf("invalid decimalPlaces: %d (must be between 0 and %d)", opts.DecimalPlaces, maxDecimalPlaces)
+	}
+	if opts.FloatPrecision < 0 || opts.FloatPrecision > maxDecimalPlaces {
+		return nil, fmt.Errorf("invalid floatPrecision: %d (must be between 0 and %d)", opts.FloatPrecision, maxDecimalPlaces)
+	}
+
+	switch opts.KeySort {
+	case "", "asc", "asc-ci", "natural", "none":
+	default:
+		return nil, fmt.Errorf("invalid keySort: %q (must be 'asc', 'asc-ci', 'natural', or 'none')", opts.KeySort)
+	}
+
+	listIndexBase := 0
+	switch opts.ListIndex {
+	case "", "0":
+	case "1":
+		listIndexBase = 1
+	default:
+		return nil, fmt.Errorf("invalid listIndex: %q (must be '0' or '1')", opts.ListIndex)
+	}
+
+	listIndexStyle := "-"
+	if opts.ListIndexStyle != "" {
+		if opts.ListIndexStyle != "-" && opts.ListIndexStyle != ")" {
+			return nil, fmt.Errorf("invalid listIndexStyle: %q (must be '-' or ')')", opts.ListIndexStyle)
+		}
+		listIndexStyle = opts.ListIndexStyle
+	}
+
+	switch opts.SampleStrategy {
+	case "", "head", "head+tail", "random":
+	default:
+		return nil, fmt.Errorf("invalid sampleStrategy: %q (must be 'head', 'head+tail', or 'random')", opts.SampleStrategy)
+	}
+
+	dateMode := opts.DateMode
+	switch dateMode {
+	case "", "epoch", "date-only":
+	case "keep":
+		dateMode = ""
+	default:
+		return nil, fmt.Errorf("invalid dateMode: %q (must be 'keep', 'epoch', or 'date-only')", opts.DateMode)
+	}
+
+	switch opts.EmptyContainerStyle {
+	case "", "header", "literal":
+	default:
+		return nil, fmt.Errorf("invalid emptyContainerStyle: %q (must be 'header' or 'literal')", opts.EmptyContainerStyle)
+	}
+
+	switch opts.SpecVersion {
+	case "", "legacy", "1.0":
+	default:
+		return nil, fmt.Errorf("invalid specVersion: %q (must be 'legacy' or '1.0')", opts.SpecVersion)
+	}
+
+	if err := checkRedactKeys(opts); err != nil {
+		return nil, err
+	}
+	include, err := parseFieldPaths("include", opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseFieldPaths("exclude", opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.MinBinaryLength < 0 {
+		return nil, fmt.Errorf("invalid minBinaryLength: %d (must not be negative)", opts.MinBinaryLength)
+	}
+	if opts.MaxStringLength < 0 {
+		return nil, fmt.Errorf("invalid maxStringLength: %d (must not be negative)", opts.MaxStringLength)
+	}
+	for field, length := range opts.MaxStringLengths {
+		if length < 0 {
+			return nil, fmt.Errorf("invalid maxStringLengths[%q]: %d (must not be negative)", field, length)
+		}
+	}
+
+	for field, fieldType := range opts.FieldTypes {
+		if fieldType != "number" && fieldType != "string" {
+			return nil, fmt.Errorf("invalid fieldTypes[%q]: %q (must be 'number' or 'string')", field, fieldType)
+		}
+	}
+
+	trueLiteral, falseLiteral, nullLiteral, err := resolveLiterals(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &TOONEncoder{
+		indent:             indent,
+		delimiter:          delimiter,
+		lengthMarker:       lengthMarker,
+		preserveKeyOrder:   opts.PreserveKeyOrder,
+		maxArrayElements:   opts.MaxArrayElements,
+		maxDepth:           opts.MaxDepth,
+		truncateArrays:     opts.TruncateArrays,
+		sampleStrategy:     opts.SampleStrategy,
+		rootKey:            opts.RootKey,
+		listEndMarker:      opts.ListEndMarker,
+		scientificNotation: opts.ScientificNotation,
+		jsNumberCompat:     opts.JSNumberCompat,
+		decimalPlaces:      opts.DecimalPlaces,
+		floatPrecision:     opts.FloatPrecision,
+		keySort:            opts.KeySort,
+		listIndex:          opts.ListIndex != "",
+		listIndexBase:      listIndexBase,
+		listIndexStyle:     listIndexStyle,
+		trueLiteral:        trueLiteral,
+		falseLiteral:       falseLiteral,
+		nullLiteral:        nullLiteral,
+		sparseTabular:      opts.SparseTabular,
+		inlineObjects:      opts.InlineObjects,
+		fieldTypes:         opts.FieldTypes,
+		compactBooleans:    opts.CompactBooleans,
+		dateMode:           dateMode,
+		minBinaryLength:    minBinaryLength(opts),
+		maxStringLength:    opts.MaxStringLength,
+		maxStringLengths:   opts.MaxStringLengths,
+		alignColumns:       opts.AlignColumns && delimiter != "\t",
+		flattenSeparator:   flattenSeparator(opts),
+		keyFolding:         opts.KeyFolding,
+		abbreviateKeys:     opts.AbbreviateKeys,
+		annotate:           opts.Annotate,
+		compact:            opts.Compact,
+		typedHeaders:       opts.TypedHeaders,
+		emptyLiterals:      opts.EmptyContainerStyle == "literal",
+		numericStrings:     opts.NumericStrings,
+		numericFields:      keySet(opts.NumericFields),
+		include:            include,
+		exclude:            exclude,
+		dropKeys:           keySet(opts.DropKeys),
+		redactKeys:         keySet(opts.RedactKeys),
+		omitNull:           opts.OmitNull,
+		omitEmpty:          opts.OmitEmpty,
+		asciiOnly:          opts.ASCIIOnly,
+		spec:               opts.SpecVersion == "1.0",
+	}
+
+	// Un literal propio debe poder escribirse sin comillas y no confundirse
+	// con un número ni con otro valor al decodificar
+	for _, literal := range []string{trueLiteral, falseLiteral, nullLiteral} {
+		if literal == "" {
+			continue
+		}
+		switch e.stringQuoteReason(literal) {
+		case QuoteNone:
+		case quoteReservedWord:
+			if literal == trueLiteral && !strings.EqualFold(literal, "true") ||
+				literal == falseLiteral && !strings.EqualFold(literal, "false") ||
+				literal == nullLiteral && !strings.EqualFold(literal, "null") {
+				return nil, fmt.Errorf("invalid literal: %q is reserved for another value", literal)
+			}
+		case quoteNumeric:
+			return nil, fmt.Errorf("invalid literal: %q would be read as a number", literal)
+		default:
+			return nil, fmt.Errorf("invalid literal: %q would need quotes", literal)
+		}
+	}
+	e.customLiterals = trueLiteral != "true" || falseLiteral != "false" || nullLiteral != "null"
+
+	return e, nil
+}
+
+// resolveLiterals devuelve las palabras para true, false y null según las
+// opciones (las de JSON por defecto), comprobando que sean distintas.
+func resolveLiterals(opts TOONOptions) (string, string, string, error) {
+	trueLiteral, falseLiteral, nullLiteral := "true", "false", "null"
+	if opts.TrueLiteral != "" {
+		trueLiteral = opts.TrueLiteral
+	}
+	if opts.FalseLiteral != "" {
+		falseLiteral = opts.FalseLiteral
+	}
+	if opts.NullLiteral != "" {
+		nullLiteral = opts.NullLiteral
+	}
+	if opts.EmptyNull {
+		if opts.NullLiteral != "" {
+			return "", "", "", fmt.Errorf("nullLiteral and emptyNull cannot be used together")
+		}
+		nullLiteral = ""
+	}
+
+	if trueLiteral == falseLiteral || trueLiteral == nullLiteral || falseLiteral == nullLiteral {
+		return "", "", "", fmt.Errorf("true, false and null literals must be different")
+	}
+	return trueLiteral, falseLiteral, nullLiteral, nil
+}
+
+// Encode convierte un valor genérico a TOON. En la raíz:
+//   - Un objeto se escribe como sus campos, sin clave ni indentación; vacío
+//     es "".
+//   - Un array se escribe sin clave, empezando por su header: "[3]: 1,2,3",
+//     "[2]{id,name}:" con las filas indentadas un nivel, o "[N]:" con los
+//     elementos "- " indentados un nivel.
+//   - Un primitivo es una sola línea con el mismo formato que un valor:
+//     hello, "a: b", "", 42, true, null.
+//
+// El decoder sigue el mismo contrato, así que cualquier salida de Encode
+// vuelve a dar el valor original.
+//
+// Devuelve un error si value se contiene a sí mismo o, con ErrMaxDepth, si
+// tiene más niveles de anidamiento que MaxDepth. Los arrays que superan MaxArrayElements no son un
+// error: se recortan (ver CheckLimits).
+func (e *TOONEncoder) Encode(value interface{}) (string, error) {
+	value, notes, err := e.prepareRoot(value)
+	if err != nil {
+		return "", err
+	}
+	encoded := e.encodeRoot(value)
+	if arr, ok := value.([]interface{}); ok {
+		if comment := e.arrayComment(arr); comment != "" {
+			encoded = comment + "\n" + encoded
+		}
+	}
+	if notes != "" {
+		return notes + "\n" + encoded, nil
+	}
+	return encoded, nil
+}
+
+// prepareRoot pasa el valor raíz al modelo JSON (normalizeValue) y le aplica
+// Include/Exclude, DropKeys/RedactKeys, OmitNull/OmitEmpty, DateMode,
+// Flatten, RootKey y AbbreviateKeys, en ese orden: se seleccionan los campos,
+// se quitan las claves y los campos vacíos, se compactan las fechas, se
+// aplana, se envuelve bajo la clave raíz, que se codifica como un objeto de
+// una clave, y se abrevian las claves. Devuelve también los comentarios que
+// van al principio de la salida (la nota de DateMode y la leyenda de
+// AbbreviateKeys), o "". Falla si el valor se contiene a sí mismo o supera
+// MaxDepth.
+func (e *TOONEncoder) prepareRoot(value interface{}) (interface{}, string, error) {
+	var notes []string
+	value, err := normalizeValue(value)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := e.walkLimits(value, false); err != nil {
+		return nil, "", err
+	}
+	if e.include != nil || e.exclude != nil {
+		value = projectFields(value, e.include, e.exclude)
+	}
+	if e.dropKeys != nil || e.redactKeys != nil {
+		value = redactValue(value, e.dropKeys, e.redactKeys)
+	}
+	if e.omitNull || e.omitEmpty {
+		value = omitValue(value, e.omitNull, e.omitEmpty)
+	}
+	if e.dateMode != "" {
+		if converted, changed := convertDates(value, e.dateMode); changed {
+			value = converted
+			notes = append(notes, dateNotes[e.dateMode])
+		}
+	}
+	if e.flattenSeparator != "" {
+		value = flattenValue(value, e.flattenSeparator)
+	}
+	if e.rootKey != "" {
+		value = map[string]interface{}{e.rootKey: value}
+	}
+	if e.abbreviateKeys {
+		var legend string
+		if value, legend = e.applyKeyAliases(value); legend != "" {
+			notes = append(notes, legend)
+		}
+	}
+	return value, strings.Join(notes, "\n"), nil
+}
+
+// EncodeTo escribe en w la misma salida que Encode, pero por partes, sin
+// construir antes el documento entero: cada clave con valor primitivo, cada
+// fila de un array tabular y cada elemento de un array en formato lista se
+// escriben en cuanto se codifican, a cualquier profundidad. Así la memoria
+// depende del tamaño de la parte más grande y no del de la salida.
+//
+// Si progress no es nil se llama con las partes del nivel raíz escritas y el
+// total: las claves de un objeto raíz o los elementos de un array raíz.
+func (e *TOONEncoder) EncodeTo(w io.Writer, value interface{}, progress func(done, total int)) error {
+	value, notes, err := e.prepareRoot(value)
+	if err != nil {
+		return err
+	}
+
+	// Las partes van separadas por saltos de línea, como en Encode
+	started := false
+	write := func(chunk string) error {
+		if started {
+			chunk = "\n" + chunk
+		}
+		started = true
+		_, err := io.WriteString(w, chunk)
+		return err
+	}
+	report := func(done, total int) {
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+
+	if notes != "" {
+		if err := write(notes); err != nil {
+			return err
+		}
+	}
+
+	if obj, ok := AsObject(value); ok && len(obj) > 0 {
+		order, fixed := keyOrder(value)
+		keys := e.objectKeys(obj, order, fixed || e.keySort == "none")
+		for i := range keys {
+			if err := e.streamObjectKeys(write, obj, keys[i:i+1], 0); err != nil {
+				return err
+			}
+			report(i+1, len(keys))
+		}
+		return nil
+	}
+
+	arr, ok := value.([]interface{})
+	if !ok || len(arr) == 0 {
+		if err := write(e.encodeRoot(value)); err != nil {
+			return err
+		}
+		report(1, 1)
+		return nil
+	}
+
+	if comment := e.arrayComment(arr); comment != "" {
+		if err := write(comment); err != nil {
+			return err
+		}
+	}
+	return e.streamArray(write, "", arr, 0, report)
+}
+
+// streamObjectKeys escribe con write las mismas líneas que encodeObjectKeys,
+// pero entrando en los objetos y arrays anidados en vez de codificarlos de
+// una vez.
+func (e *TOONEncoder) streamObjectKeys(write func(string) error, obj map[string]interface{}, keys []string, depth int) error {
+	indentation := strings.Repeat(e.indent, depth)
+
+	for i, key := range keys {
+		encodedKey, _, value := e.foldKey(key, obj[key])
+		if _, ok := e.emptyContainer(value); ok {
+			if err := write(e.encodeObjectKeys(obj, keys[i:i+1], depth)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}, *OrderedMap:
+			if err := write(indentation + encodedKey + ":"); err != nil {
+				return err
+			}
+			nested, _ := AsObject(v)
+			order, fixed := keyOrder(v)
+			nestedKeys := e.objectKeys(nested, order, fixed || e.keySort == "none")
+			if err := e.streamObjectKeys(write, nested, nestedKeys, depth+1); err != nil {
+				return err
+			}
+
+		case []interface{}:
+			if comment := e.arrayComment(v); comment != "" {
+				if err := write(indentation + comment); err != nil {
+					return err
+				}
+			}
+			if err := e.streamArray(write, indentation+encodedKey, v, e.fieldArrayDepth(depth), nil); err != nil {
+				return err
+			}
+
+		default:
+			if err := write(e.encodeObjectKeys(obj, keys[i:i+1], depth)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// streamArray escribe con write lo mismo que prefix+encodeArray(arr, depth):
+// el header y luego cada fila o elemento por separado. Las matrices y los
+// arrays de primitivos se escriben de una vez. report, si no es nil, se
+// llama tras cada fila o elemento.
+func (e *TOONEncoder) streamArray(write func(string) error, prefix string, arr []interface{}, depth int, report func(done, total int)) error {
+	if report == nil {
+		report = func(done, total int) {}
+	}
+
+	sample := e.sampleArray(arr)
+	arr = sample.items
+	// El marcador de los omitidos va antes del elemento sample.at; en las
+	// matrices y los arrays primitivos, siempre al final
+	marker := func(i int) error {
+		if sample.omitted == 0 || i != sample.at {
+			return nil
+		}
+		return write(strings.Repeat(e.indent, depth+1) + fmt.Sprintf(truncationMarker, sample.omitted))
+	}
+
+	isTabular, fields := e.isTabularArray(arr)
+	_, isMatrix := e.matrixColumns(arr)
+	switch {
+	case isTabular:
+		if err := write(prefix + e.tabularHeader(arr, fields, depth, sample.length)); err != nil {
+			return err
+		}
+		widths := e.columnWidths(arr, fields, depth)
+		for i, item := range arr {
+			if err := marker(i); err != nil {
+				return err
+			}
+			if err := write(e.tabularRow(item, fields, depth, widths)); err != nil {
+				return err
+			}
+			report(i+1, len(arr))
+		}
+
+	case len(arr) > 0 && !isMatrix && !e.allPrimitive(arr):
+		if err := write(prefix + fmt.Sprintf("[%s%d]:", e.lengthMarker, sample.length)); err != nil {
+			return err
+		}
+		for i, item := range arr {
+			if err := marker(i); err != nil {
+				return err
+			}
+			if err := write(strings.Join(e.listItemLines(item, i, depth), "\n")); err != nil {
+				return err
+			}
+			report(i+1, len(arr))
+		}
+		if e.listEndMarker {
+			if err := write(e.listEndLine(depth, len(arr))); err != nil {
+				return err
+			}
+		}
+
+	default:
+		// Matrices y arrays primitivos se escriben de una vez
+		if err := write(prefix + e.encodeArrayLength(arr, depth, sample.length)); err != nil {
+			return err
+		}
+		report(1, 1)
+		sample.at = len(arr)
+	}
+
+	return marker(len(arr))
+}
+
+// arraySample son los elementos de un array que se escriben tras recortarlo
+// a MaxArrayElements según SampleStrategy.
+type arraySample struct {
+	items   []interface{}
+	omitted int // elementos que no se escriben
+	at      int // posición en items del marcador "... (+omitted)"
+	length  int // longitud que declara el header
+}
+
+// sampleArray elige los elementos de arr que se escriben (ver
+// SampleStrategy). Un array dentro del límite se escribe entero.
+func (e *TOONEncoder) sampleArray(arr []interface{}) arraySample {
+	max := e.maxArrayElements
+	if max <= 0 || len(arr) <= max {
+		return arraySample{items: arr, length: len(arr)}
+	}
+
+	sample := arraySample{omitted: len(arr) - max, at: max, length: max}
+	if e.sampleStrategy != "" {
+		sample.length = len(arr)
+	}
+	switch e.sampleStrategy {
+	case "head+tail":
+		head := (max + 1) / 2
+		sample.items = append(append(make([]interface{}, 0, max), arr[:head]...), arr[len(arr)-(max-head):]...)
+		sample.at = head
+	case "random":
+		// Semilla fija: la misma entrada da siempre la misma muestra
+		indexes := rand.New(rand.NewSource(int64(len(arr)))).Perm(len(arr))[:max]
+		sort.Ints(indexes)
+		sample.items = make([]interface{}, max)
+		for i, index := range indexes {
+			sample.items[i] = arr[index]
+		}
+	default:
+		sample.items = arr[:max]
+	}
+	return sample
+}
+
+// DefaultMaxDepth es el anidamiento máximo de objetos y arrays si
+// TOONOptions.MaxDepth es 0.
+const DefaultMaxDepth = 100
+
+// ErrMaxDepth es el error de CheckLimits y Encode cuando el valor tiene más
+// niveles de anidamiento que MaxDepth (se comprueba con errors.Is).
+var ErrMaxDepth = errors.New("max depth exceeded")
+
+// depthLimit devuelve el anidamiento máximo de objetos y arrays.
+func (e *TOONEncoder) depthLimit() int {
+	if e.maxDepth > 0 {
+		return e.maxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// truncationMarker marca los elementos omitidos de un array recortado por
+// MaxArrayElements. Va en su propia línea, al nivel de las filas.
+const truncationMarker = "... (+%d)"
+
+var truncationMarkerPattern = regexp.MustCompile(`^\.\.\. \(\+(\d+)\)$`)
+
+// listEndPattern reconoce la línea de cierre "[/N]" de ListEndMarker.
+var listEndPattern = regexp.MustCompile(`^\[/#?(\d+)\]$`)
+
+// CheckLimits recorre el valor buscando arrays que excedan MaxArrayElements
+// y anidamientos de más de MaxDepth niveles (un error con ErrMaxDepth). Con
+// TruncateArrays indica si la salida de Encode quedará recortada; sin él
+// devuelve un error, ya que Encode siempre respeta el límite. Encode también
+// comprueba MaxDepth, pero recorta los arrays sin avisar.
+func (e *TOONEncoder) CheckLimits(value interface{}) (bool, error) {
+	return e.walkLimits(value, true)
+}
+
+// walkLimits hace el recorrido de CheckLimits; sin arrays solo comprueba
+// MaxDepth.
+func (e *TOONEncoder) walkLimits(value interface{}, arrays bool) (bool, error) {
+	maxDepth := e.depthLimit()
+	truncated := false
+	var walk func(v interface{}, depth int) error
+	walk = func(v interface{}, depth int) error {
+		obj, isObject := AsObject(v)
+		arr, isArray := v.([]interface{})
+		if !isObject && !isArray {
+			return nil
+		}
+		if depth > maxDepth {
+			return fmt.Errorf("%w: más de %d niveles de objetos y arrays anidados", ErrMaxDepth, maxDepth)
+		}
+		if isObject {
+			for _, child := range obj {
+				if err := walk(child, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if arrays && e.maxArrayElements > 0 && len(arr) > e.maxArrayElements {
+			if !e.truncateArrays {
+				return fmt.Errorf("array con %d elementos excede el máximo de %d", len(arr), e.maxArrayElements)
+			}
+			truncated = true
+			arr = e.sampleArray(arr).items
+		}
+		for _, child := range arr {
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(value, 1); err != nil {
+		return false, err
+	}
+	return truncated, nil
+}
+
+// encodeRoot es encodeValue para el valor raíz. Con EmptyNull un null en la
+// raíz sería el documento vacío, que se lee como {}, así que se escribe null.
+func (e *TOONEncoder) encodeRoot(value interface{}) string {
+	if value == nil && e.nullLiteral == "" {
+		return "null"
+	}
+	return e.encodeValue(value, 0)
+}
+
+func (e *TOONEncoder) encodeValue(value interface{}, depth int) string {
+	if literal, ok := e.emptyContainer(value); ok {
+		return literal
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return e.encodeObject(v, depth)
+	case *OrderedMap:
+		return e.encodeObjectKeys(v.Values, e.objectKeys(v.Values, v.Keys, v.fixedOrder || e.keySort == "none"), depth)
+	case []interface{}:
+		return e.encodeArray(v, depth)
+	default:
+		return e.encodeCell(v, "")
+	}
+}
+
+// encodeCell codifica un valor primitivo allí donde aparezca: celda tabular,
+// elemento de un array de primitivos o de una matriz, o valor de la clave
+// field ("" si no hay clave, que solo cuenta para NumericFields). Todos los
+// sitios pasan por aquí para que un mismo valor se escriba siempre igual.
+func (e *TOONEncoder) encodeCell(value interface{}, field string) string {
+	switch v := value.(type) {
+	case nil:
+		return e.nullLiteral
+	case bool:
+		if v {
+			return e.trueLiteral
+		}
+		return e.falseLiteral
+	case float64:
+		return e.encodeNumber(v)
+	case json.Number:
+		return e.encodeJSONNumber(v)
+	case string:
+		return e.encodeStringValue(v, field)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// encodeCompactCell es encodeCell con CompactBooleans: true y false se
+// escriben 1 y 0. Solo se usa en filas tabulares, arrays de primitivos y
+// matrices.
+func (e *TOONEncoder) encodeCompactCell(value interface{}, field string) string {
+	if v, ok := value.(bool); ok && e.compactBooleans {
+		if v {
+			return "1"
+		}
+		return "0"
+	}
+	return e.encodeCell(value, field)
+}
+
+// encodeNumber formatea un número con un único algoritmo, independiente de
+// la plataforma y sin separadores de miles:
+//   - NaN e ±Inf no existen en JSON y se emiten como null.
+//   - -0 se emite como 0.
+//   - El resto usa la representación decimal más corta que vuelve a dar el
+//     mismo float64 (strconv.FormatFloat con precisión -1), así que los
+//     enteros salen exactos y los decimales no pierden precisión.
+//   - Sin notación científica salvo que se active ScientificNotation, en cuyo
+//     caso se usa el formato más corto entre decimal y exponente ('g'), o de
+//     JSNumberCompat, que sigue las reglas de JavaScript (formatJSNumber).
+//   - Con DecimalPlaces los números no enteros se redondean a esos decimales;
+//     si el redondeo da cero se emite 0, sin signo. FloatPrecision hace lo
+//     mismo pero quita los ceros finales.
+func (e *TOONEncoder) encodeNumber(n float64) string {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return e.nullLiteral
+	}
+
+	if n == 0 {
+		return "0"
+	}
+
+	if e.decimalPlaces > 0 && n != math.Trunc(n) {
+		s := strconv.FormatFloat(n, 'f', e.decimalPlaces, 64)
+		if strings.Trim(s, "-0.") == "" {
+			return "0"
+		}
+		return s
+	}
+
+	if e.floatPrecision > 0 && n != math.Trunc(n) {
+		s := strconv.FormatFloat(n, 'f', e.floatPrecision, 64)
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+		if s == "-0" || s == "0" {
+			return "0"
+		}
+		return s
+	}
+
+	if e.jsNumberCompat {
+		return formatJSNumber(n)
+	}
+
+	if e.scientificNotation {
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// formatJSNumber escribe un número finito distinto de cero con el algoritmo
+// de Number::toString de ECMAScript: los dígitos más cortos que identifican
+// el float64 (como strconv) y la posición del punto decide el formato.
+func formatJSNumber(n float64) string {
+	// "d.ddde±x": mantisa con los dígitos mínimos y exponente decimal
+	sci := strconv.FormatFloat(math.Abs(n), 'e', -1, 64)
+	mantissa, exp, _ := strings.Cut(sci, "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	point, _ := strconv.Atoi(exp)
+	point++ // dígitos antes del punto decimal
+
+	var out string
+	switch k := len(digits); {
+	case k <= point && point <= 21:
+		out = digits + strings.Repeat("0", point-k)
+	case 0 < point && point <= 21:
+		out = digits[:point] + "." + digits[point:]
+	case -6 < point && point <= 0:
+		out = "0." + strings.Repeat("0", -point) + digits
+	default:
+		if point-1 < 0 {
+			out = mantissa + "e-" + strconv.Itoa(1-point)
+		} else {
+			out = mantissa + "e+" + strconv.Itoa(point-1)
+		}
+	}
+
+	if n < 0 {
+		return "-" + out
+	}
+	return out
+}
+
+// encodeJSONNumber codifica un número leído con json.Decoder.UseNumber. Los
+// enteros se emiten tal cual, sin pasar por float64, para no perder precisión
+// en los de más de 53 bits; el resto se formatea como en encodeNumber.
+func (e *TOONEncoder) encodeJSONNumber(n json.Number) string {
+	s := string(n)
+	if !strings.ContainsAny(s, ".eE") && !e.jsNumberCompat {
+		if s == "-0" {
+			return "0"
+		}
+		return s
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return e.encodeString(s)
+	}
+	return e.encodeNumber(f)
+}
+
+// encodeStringValue codifica el valor s de la clave field ("" fuera de un
+// objeto) teniendo en cuenta NumericStrings, NumericFields,
+// BinaryPlaceholders y MaxStringLength.
+func (e *TOONEncoder) encodeStringValue(s, field string) string {
+	if (e.numericStrings || field != "" && e.numericFields[field]) && validJSONNumber.MatchString(s) {
+		return s
+	}
+	if e.minBinaryLength > 0 {
+		if placeholder, ok := binaryPlaceholder(s, e.minBinaryLength); ok {
+			return e.encodeString(placeholder)
+		}
+	}
+	return e.encodeString(e.truncateString(s, field))
+}
+
+// stringEllipsis sustituye al final recortado por MaxStringLength.
+const stringEllipsis = "…"
+
+// truncateString recorta s al límite de MaxStringLength o, si field tiene
+// entrada en MaxStringLengths, al suyo. Se cuentan caracteres, no bytes.
+func (e *TOONEncoder) truncateString(s, field string) string {
+	limit := e.maxStringLength
+	if fieldLimit, ok := e.maxStringLengths[field]; ok && field != "" {
+		limit = fieldLimit
+	}
+	if limit <= 0 || utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+
+	count := 0
+	for i := range s {
+		if count == limit {
+			return s[:i] + stringEllipsis
+		}
+		count++
+	}
+	return s
+}
+
+func (e *TOONEncoder) encodeString(s string) string {
+	if s == "" {
+		return `""`
+	}
+
+	// Bytes UTF-8 inválidos se reemplazan por U+FFFD, como hace encoding/json
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "\uFFFD")
+	}
+
+	if e.needsQuotes(s) {
+		return e.quote(s)
+	}
+
+	return s
+}
+
+// QuoteReason identifica la regla que obliga a poner un string (valor o clave)
+// entre comillas. QuoteNone indica que puede ir tal cual.
+type QuoteReason string
+
+const (
+	QuoteNone             QuoteReason = ""
+	quoteEmpty            QuoteReason = "empty"
+	quoteLeadingSpace     QuoteReason = "leading-space"
+	quoteTrailingSpace    QuoteReason = "trailing-space"
+	quoteDelimiter        QuoteReason = "contains-delimiter"
+	quoteSpecialChar      QuoteReason = "contains-special-char"
+	quoteControlChar      QuoteReason = "contains-control-char"
+	quoteNonASCII         QuoteReason = "non-ascii"
+	quoteInvalidUTF8      QuoteReason = "invalid-utf8"
+	quoteStructuralPrefix QuoteReason = "structural-prefix"
+	quoteListItemPrefix   QuoteReason = "list-item-prefix"
+	quoteLeadingHyphen    QuoteReason = "leading-hyphen"
+	quoteCommentPrefix    QuoteReason = "comment-prefix"
+	quoteDateTime         QuoteReason = "looks-like-date"
+	quoteTruncationMarker QuoteReason = "looks-like-truncation-marker"
+	quoteReservedWord     QuoteReason = "reserved-word"
+	quoteNumeric          QuoteReason = "looks-like-number"
+	quoteFoldedPath       QuoteReason = "looks-like-folded-path"
+)
+
+// quoteReasonDescriptions explica cada regla para /api/explain-quoting.
+var quoteReasonDescriptions = map[QuoteReason]string{
+	QuoteNone:             "No necesita comillas",
+	quoteEmpty:            "Está vacío",
+	quoteLeadingSpace:     "Empieza con un espacio en blanco",
+	quoteTrailingSpace:    "Termina con un espacio en blanco",
+	quoteDelimiter:        "Contiene el delimitador activo",
+	quoteSpecialChar:      "Contiene un carácter con significado en TOON (:, comillas, backslash, espacio o corchetes)",
+	quoteControlChar:      "Contiene caracteres de control (saltos de línea, tabuladores, U+2028...)",
+	quoteNonASCII:         "Contiene caracteres no ASCII, que con asciiOnly se escapan",
+	quoteInvalidUTF8:      "Contiene bytes UTF-8 inválidos",
+	quoteStructuralPrefix: "Empieza con '[' o '{' y se confundiría con un array u objeto",
+	quoteListItemPrefix:   "Empieza con \"- \" y se confundiría con un elemento de lista",
+	quoteLeadingHyphen:    "Empieza con guión",
+	quoteCommentPrefix:    "Empieza con \"#\" y se confundiría con un comentario",
+	quoteDateTime:         "Es una fecha u hora ISO 8601; van siempre entre comillas, tengan ':' o no",
+	quoteTruncationMarker: "Se confundiría con el marcador de array recortado",
+	quoteReservedWord:     "Es una palabra reservada (true, false o null)",
+	quoteNumeric:          "Se leería como un número",
+	quoteFoldedPath:       "Contiene un punto y, con keyFolding, se leería como una ruta de claves plegadas",
+}
+
+// Description explica la regla en una frase, para mostrarla al usuario.
+func (r QuoteReason) Description() string {
+	return quoteReasonDescriptions[r]
+}
+
+// ExplainString devuelve s escrito como valor y la regla que obliga a ponerlo
+// entre comillas (QuoteNone si va tal cual).
+func (e *TOONEncoder) ExplainString(s string) (string, QuoteReason) {
+	return e.encodeString(s), e.stringQuoteReason(s)
+}
+
+// ExplainKey hace lo mismo que ExplainString con una clave de objeto o, si
+// inArray es true, con un campo de header tabular.
+func (e *TOONEncoder) ExplainKey(key string, inArray bool) (string, QuoteReason) {
+	return e.encodeKeyWithDelimiter(key, inArray), e.keyQuoteReason(key, inArray)
+}
+
+// needsQuotes indica si el valor s debe ir entre comillas.
+func (e *TOONEncoder) needsQuotes(s string) bool {
+	return e.stringQuoteReason(s) != QuoteNone
+}
+
+// stringQuoteReason decide en una sola pasada si un valor string debe ir
+// entre comillas y por qué. Es la ruta más caliente del encoder (cada celda
+// de un array tabular), así que evita ToLower, ParseFloat y regex salvo
+// cuando pueden cambiar el resultado.
+func (e *TOONEncoder) stringQuoteReason(s string) QuoteReason {
+	if e.spec {
+		return e.specQuoteReason(s)
+	}
+	if s == "" {
+		return quoteEmpty
+	}
+
+	// Espacios al inicio o al final
+	first, _ := utf8.DecodeRuneInString(s)
+	if unicode.IsSpace(first) {
+		return quoteLeadingSpace
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	if unicode.IsSpace(last) {
+		return quoteTrailingSpace
+	}
+
+	// Fechas y horas siempre entre comillas: las que llevan hora tienen ':' y
+	// las necesitan, así que las que no también, para que todas se escriban
+	// igual
+	if looksLikeDateTime(s) {
+		return quoteDateTime
+	}
+
+	// CRÍTICO: Quote si contiene el delimitador ACTIVO, además de :,
+	// comillas, backslash, caracteres de control (C0, U+2028 y U+2029) o,
+	// con ASCIIOnly, cualquier carácter no ASCII
+	delimiter := e.delimiter[0]
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ':', '"', '\'', '\\':
+			return quoteSpecialChar
+		default:
+			if c == delimiter {
+				return quoteDelimiter
+			}
+			if c < 0x20 || isLineSeparatorAt(s, i) {
+				return quoteControlChar
+			}
+			if c >= utf8.RuneSelf && e.asciiOnly {
+				return quoteNonASCII
+			}
+		}
+	}
+
+	switch s[0] {
+	case '[', '{':
+		return quoteStructuralPrefix
+	case '-':
+		if strings.HasPrefix(s, "- ") {
+			return quoteListItemPrefix
+		}
+	case '.':
+		// No confundir con el marcador de array recortado
+		if truncationMarkerPattern.MatchString(s) {
+			return quoteTruncationMarker
+		}
+	case '#':
+		// Al inicio de una fila se leería como comentario
+		return quoteCommentPrefix
+	}
+
+	if len(s) <= 5 && (strings.EqualFold(s, "true") || strings.EqualFold(s, "false") || strings.EqualFold(s, "null")) {
+		return quoteReservedWord
+	}
+	if e.customLiterals && (s == e.trueLiteral || s == e.falseLiteral || s == e.nullLiteral) {
+		return quoteReservedWord
+	}
+
+	// Solo puede parecer número si empieza como uno (incluye inf/nan)
+	if strings.IndexByte("0123456789+-.iInN", s[0]) >= 0 {
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return quoteNumeric
+		}
+	}
+
+	return QuoteNone
+}
+
+// dateTimePattern reconoce fechas y horas ISO 8601 / RFC 3339: "2024-01-15",
+// "2024-01-15T10:00:00Z", "2024-01-15 10:00:00.5+02:00", "10:00"...
+var dateTimePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([T ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?)?|\d{2}:\d{2}(:\d{2}(\.\d+)?)?)([Zz]|[+-]\d{2}(:?\d{2})?)?$`)
+
+// looksLikeDateTime indica si s es una fecha u hora. Solo usa la regex si s
+// empieza como una ("AAAA-" o "HH:").
+func looksLikeDateTime(s string) bool {
+	if len(s) < 5 || s[0] < '0' || s[0] > '9' || (s[4] != '-' && s[2] != ':') {
+		return false
+	}
+	return dateTimePattern.MatchString(s)
+}
+
+// isLineSeparatorAt indica si en s[i] empieza U+2028 o U+2029, que algunos
+// lectores (JavaScript, editores) toman como salto de línea.
+func isLineSeparatorAt(s string, i int) bool {
+	return s[i] == 0xE2 && i+2 < len(s) && s[i+1] == 0x80 && (s[i+2] == 0xA8 || s[i+2] == 0xA9)
+}
+
+// quote pone s entre comillas con quoteString o, con ASCIIOnly, con
+// quoteASCII.
+func (e *TOONEncoder) quote(s string) string {
+	if e.asciiOnly {
+		return quoteASCII(s)
+	}
+	return quoteString(s)
+}
+
+// quoteString escapa backslash, comillas y caracteres de control en una sola
+// pasada (\n, \t, \r y el resto de C0, U+2028 y U+2029 como \uXXXX) y
+// envuelve el resultado entre comillas.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case writeEscape(&b, c):
+		case isLineSeparatorAt(s, i):
+			writeUnicodeEscape(&b, 0x2028+rune(s[i+2]-0xA8))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// quoteASCII hace lo mismo que quoteString y además escapa todos los
+// caracteres no ASCII, los de fuera del plano básico como par suplente
+// ("😀" → "\ud83d\ude00").
+func quoteASCII(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			if !writeEscape(&b, byte(r)) {
+				b.WriteByte(byte(r))
+			}
+		case r > 0xFFFF:
+			high, low := utf16.EncodeRune(r)
+			writeUnicodeEscape(&b, high)
+			writeUnicodeEscape(&b, low)
+		default:
+			writeUnicodeEscape(&b, r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeEscape escribe en b el escape del byte ASCII c si lo necesita dentro
+// de comillas e indica si lo hizo.
+func writeEscape(b *strings.Builder, c byte) bool {
+	switch c {
+	case '\\':
+		b.WriteString(`\\`)
+	case '"':
+		b.WriteString(`\"`)
+	case '\n':
+		b.WriteString(`\n`)
+	case '\t':
+		b.WriteString(`\t`)
+	case '\r':
+		b.WriteString(`\r`)
+	default:
+		if c >= 0x20 {
+			return false
+		}
+		writeUnicodeEscape(b, rune(c))
+	}
+	return true
+}
+
+// writeUnicodeEscape escribe r (como mucho U+FFFF) como \uXXXX.
+func writeUnicodeEscape(b *strings.Builder, r rune) {
+	const hex = "0123456789abcdef"
+	b.WriteString(`\u`)
+	for shift := 12; shift >= 0; shift -= 4 {
+		b.WriteByte(hex[r>>shift&0xf])
+	}
+}
+
+// objectKeys devuelve las claves de obj en el orden de salida. Si keepOrder
+// es true y se conoce el orden de aparición (order), se usa tal cual; si no,
+// se ordenan según keySort. Con "none" y un map sin orden conocido se cae al
+// orden ascendente para que la salida siga siendo determinística.
+func (e *TOONEncoder) objectKeys(obj map[string]interface{}, order []string, keepOrder bool) []string {
+	if keepOrder && order != nil {
+		return append([]string(nil), order...)
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+
+	switch e.keySort {
+	case "asc-ci":
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := strings.ToLower(keys[i]), strings.ToLower(keys[j])
+			if a != b {
+				return a < b
+			}
+			return keys[i] < keys[j]
+		})
+	case "natural":
+		sort.Slice(keys, func(i, j int) bool {
+			return naturalLess(keys[i], keys[j])
+		})
+	default:
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// ObjectKeys devuelve las claves de obj en el orden en que las escribiría e.
+func (e *TOONEncoder) ObjectKeys(obj map[string]interface{}) []string {
+	return e.objectKeys(obj, nil, false)
+}
+
+// naturalLess compara a y b tratando cada tramo de dígitos como un número,
+// de modo que "item2" < "item10". Los ceros a la izquierda sólo desempatan.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na := strings.TrimLeft(a[si:i], "0")
+			nb := strings.TrimLeft(b[sj:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			return a[i] < b[j]
+		}
+		i++
+		j++
+	}
+	if len(a)-i != len(b)-j {
+		return len(a)-i < len(b)-j
+	}
+	return a < b
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (e *TOONEncoder) encodeObject(obj map[string]interface{}, depth int) string {
+	return e.encodeObjectKeys(obj, e.objectKeys(obj, nil, false), depth)
+}
+
+// encodeObjectKeys codifica obj emitiendo sus claves en el orden de keys.
+func (e *TOONEncoder) encodeObjectKeys(obj map[string]interface{}, keys []string, depth int) string {
+	if len(obj) == 0 {
+		return ""
+	}
+
+	var lines []string
+	indentation := strings.Repeat(e.indent, depth)
+
+	for _, key := range keys {
+		encodedKey, field, value := e.foldKey(key, obj[key])
+
+		if literal, ok := e.emptyContainer(value); ok {
+			lines = append(lines, indentation+encodedKey+": "+literal)
+			continue
+		}
+
+		// Determinar formato según tipo de valor
+		switch v := value.(type) {
+		case map[string]interface{}, *OrderedMap:
+			lines = append(lines, indentation+encodedKey+":")
+			if nested := e.encodeValue(v, depth+1); nested != "" {
+				lines = append(lines, nested)
+			}
+
+		case []interface{}:
+			if comment := e.arrayComment(v); comment != "" {
+				lines = append(lines, indentation+comment)
+			}
+			arrayStr := e.encodeArray(v, e.fieldArrayDepth(depth))
+			if strings.Contains(arrayStr, "\n") {
+				// Array multilínea
+				lines = append(lines, indentation+encodedKey+arrayStr)
+			} else {
+				// Array inline
+				lines = append(lines, indentation+encodedKey+arrayStr)
+			}
+
+		default:
+			// Valor primitivo (vacío solo con EmptyNull)
+			encoded := e.encodeCell(value, field)
+			if encoded == "" {
+				lines = append(lines, indentation+encodedKey+":")
+			} else {
+				lines = append(lines, indentation+encodedKey+": "+encoded)
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// fieldArrayDepth devuelve la profundidad con la que se codifica el array
+// de un campo a profundidad depth: sus filas o elementos quedan dos niveles
+// por debajo de la clave, o uno con SpecVersion "1.0".
+func (e *TOONEncoder) fieldArrayDepth(depth int) int {
+	if e.spec {
+		return depth
+	}
+	return depth + 1
+}
+
+// tabDelimiterMarker devuelve lo que indica el delimitador tabulador en los
+// headers: un espacio ("[2 ]", "{id name}"), o el propio tabulador con
+// SpecVersion "1.0".
+func (e *TOONEncoder) tabDelimiterMarker() string {
+	if e.spec {
+		return "\t"
+	}
+	return " "
+}
+
+// emptyContainer devuelve "[]" o "{}" si value es un array u objeto vacío
+// que se escribe de forma literal (ver EmptyContainerStyle).
+func (e *TOONEncoder) emptyContainer(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 && e.emptyLiterals {
+			return "[]", true
+		}
+	case map[string]interface{}, *OrderedMap:
+		obj, _ := AsObject(v)
+		if len(obj) == 0 && (e.emptyLiterals || e.nullLiteral == "") {
+			return "{}", true
+		}
+	}
+	return "", false
+}
+
+func (e *TOONEncoder) encodeKeyWithDelimiter(key string, inArray bool) string {
+	if key == "" {
+		return `""`
+	}
+
+	if e.keyQuoteReason(key, inArray) != QuoteNone {
+		return e.quote(key)
+	}
+
+	return key
+}
+
+// keyQuoteReason devuelve la regla por la que una clave necesita comillas:
+// - Está vacía
+// - Contiene espacios, comas, colons, comillas
+// - Contiene brackets/braces
+// - Comienza con guión
+// - Es solo un número
+// - Tiene caracteres de control o bytes UTF-8 inválidos
+// En cabeceras tabulares (inArray) cuentan la coma y '|' aunque no sean el
+// delimitador: sin marcador en los corchetes el decoder deduce el
+// delimitador del primero que aparezca entre los campos.
+func (e *TOONEncoder) keyQuoteReason(key string, inArray bool) QuoteReason {
+	if e.spec {
+		return e.specKeyQuoteReason(key, inArray)
+	}
+	if key == "" {
+		return quoteEmpty
+	}
+
+	// Caracteres de control o bytes UTF-8 inválidos
+	if hasControlChars(key) {
+		return quoteControlChar
+	}
+	if !utf8.ValidString(key) {
+		return quoteInvalidUTF8
+	}
+	if e.asciiOnly && !isASCII(key) {
+		return quoteNonASCII
+	}
+
+	if inArray {
+		// En arrays, quote si contiene un delimitador
+		if strings.Contains(key, e.delimiter) || strings.ContainsAny(key, ",|") {
+			return quoteDelimiter
+		}
+		if strings.ContainsAny(key, ` :"'[]{}`) {
+			return quoteSpecialChar
+		}
+	} else {
+		if strings.ContainsAny(key, ` ,:"'[]{}`) {
+			return quoteSpecialChar
+		}
+		if e.keyFolding && strings.Contains(key, ".") {
+			return quoteFoldedPath
+		}
+	}
+
+	if strings.HasPrefix(key, "-") {
+		return quoteLeadingHyphen
+	}
+
+	if _, err := strconv.ParseFloat(key, 64); err == nil {
+		return quoteNumeric
+	}
+
+	return QuoteNone
+}
+
+func hasControlChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || isLineSeparatorAt(s, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *TOONEncoder) encodeKey(key string) string {
+	return e.encodeKeyWithDelimiter(key, false)
+}
+
+// Nueva función para encodear claves en arrays tabulares
+func (e *TOONEncoder) encodeKeyForArray(key string) string {
+	return e.encodeKeyWithDelimiter(key, true)
+}
+
+func (e *TOONEncoder) encodeArray(arr []interface{}, depth int) string {
+	// Un array por encima de MaxArrayElements se recorta (ver sampleArray) y
+	// una línea indica cuántos elementos se omitieron; streamArray ya lo hace
+	// fila a fila
+	if e.maxArrayElements > 0 && len(arr) > e.maxArrayElements {
+		var lines []string
+		e.streamArray(func(chunk string) error {
+			lines = append(lines, chunk)
+			return nil
+		}, "", arr, depth, nil)
+		return strings.Join(lines, "\n")
+	}
+	return e.encodeArrayLength(arr, depth, len(arr))
+}
+
+// encodeArrayLength es encodeArray sin recortar, con length como la longitud
+// que declara el header.
+func (e *TOONEncoder) encodeArrayLength(arr []interface{}, depth int, length int) string {
+	if len(arr) == 0 {
+		return "[0]:"
+	}
+
+	// Verificar si es array tabular (todos objetos con mismas claves primitivas)
+	if isTabular, fields := e.isTabularArray(arr); isTabular {
+		return e.encodeTabularArray(arr, fields, depth, length)
+	}
+
+	// Verificar si es matriz (arrays primitivos de igual longitud)
+	if columns, isMatrix := e.matrixColumns(arr); isMatrix {
+		return e.encodeMatrix(arr, columns, depth, length)
+	}
+
+	// Verificar si todos son primitivos
+	if e.allPrimitive(arr) {
+		return e.encodePrimitiveArray(arr, length)
+	}
+
+	// Formato lista (fallback)
+	return e.encodeListArray(arr, depth, length)
+}
+
+// ArrayFormat indica el formato que elegiría e para arr: "empty",
+// "tabular" (con sus campos), "matrix", "primitive" o "list".
+func (e *TOONEncoder) ArrayFormat(arr []interface{}) (string, []string) {
+	if len(arr) == 0 {
+		return "empty", nil
+	}
+	if isTabular, fields := e.isTabularArray(arr); isTabular {
+		return "tabular", fields
+	}
+	if _, isMatrix := e.matrixColumns(arr); isMatrix {
+		return "matrix", nil
+	}
+	if e.allPrimitive(arr) {
+		return "primitive", nil
+	}
+	return "list", nil
+}
+
+func (e *TOONEncoder) isTabularArray(arr []interface{}) (bool, []string) {
+	if len(arr) == 0 {
+		return false, nil
+	}
+
+	if e.sparseTabular {
+		return e.sparseTabularFields(arr)
+	}
+
+	// Primer elemento debe ser objeto, con algún campo: filas vacías no se
+	// distinguirían de líneas en blanco
+	firstObj, ok := AsObject(arr[0])
+	if !ok || len(firstObj) == 0 {
+		return false, nil
+	}
+
+	// Obtener claves del primer objeto: en su orden original si se pidió
+	// conservarlo y se conoce, si no según keySort
+	order, fixed := keyOrder(arr[0])
+	fields := e.objectKeys(firstObj, order, fixed || e.preserveKeyOrder || e.keySort == "none")
+
+	// Verificar todos los elementos
+	for _, item := range arr {
+		obj, ok := AsObject(item)
+		if !ok {
+			return false, nil
+		}
+
+		// Misma cantidad de campos
+		if len(obj) != len(fields) {
+			return false, nil
+		}
+
+		// Mismos campos y todos primitivos
+		for _, field := range fields {
+			val, exists := obj[field]
+			if !exists {
+				return false, nil
+			}
+
+			// Verificar que sea primitivo
+			switch val.(type) {
+			case map[string]interface{}, *OrderedMap, []interface{}:
+				return false, nil
+			}
+		}
+	}
+
+	return true, fields
+}
+
+// sparseTabularFields es isTabularArray con SparseTabular: todos los
+// elementos deben ser objetos de valores primitivos, pero no necesitan las
+// mismas claves. Devuelve la unión de claves, en orden de aparición si se
+// pidió conservarlo y se conoce, si no según keySort.
+func (e *TOONEncoder) sparseTabularFields(arr []interface{}) (bool, []string) {
+	union := make(map[string]interface{})
+	var order []string
+	ordered := true
+
+	for _, item := range arr {
+		obj, ok := AsObject(item)
+		if !ok {
+			return false, nil
+		}
+
+		om, isOrdered := item.(*OrderedMap)
+		ordered = ordered && isOrdered
+
+		for _, val := range obj {
+			switch val.(type) {
+			case map[string]interface{}, *OrderedMap, []interface{}:
+				return false, nil
+			}
+		}
+
+		// Orden de aparición: solo se conoce si todos son *OrderedMap
+		if ordered {
+			for _, k := range om.Keys {
+				if _, seen := union[k]; !seen {
+					order = append(order, k)
+				}
+				union[k] = nil
+			}
+		} else {
+			for k := range obj {
+				union[k] = nil
+			}
+		}
+	}
+
+	if len(union) == 0 {
+		return false, nil
+	}
+	if !ordered {
+		order = nil
+	}
+	return true, e.objectKeys(union, order, e.preserveKeyOrder || e.keySort == "none")
+}
+
+func (e *TOONEncoder) encodeTabularArray(arr []interface{}, fields []string, depth int, length int) string {
+	// Filas - usar fields originales
+	rows := []string{e.tabularHeader(arr, fields, depth, length)}
+	widths := e.columnWidths(arr, fields, depth)
+	for _, item := range arr {
+		rows = append(rows, e.tabularRow(item, fields, depth, widths))
+	}
+
+	return strings.Join(rows, "\n")
+}
+
+// coerceCell aplica la pista de FieldTypes a una celda ya codificada
+// (encoded). Los valores que no se pueden convertir se quedan como estaban.
+func (e *TOONEncoder) coerceCell(val interface{}, fieldType string, encoded string) string {
+	switch fieldType {
+	case "number":
+		// Tal cual, sin pasar por float64 (int64 de más de 53 bits)
+		if s, ok := val.(string); ok && validJSONNumber.MatchString(s) {
+			return s
+		}
+	case "string":
+		switch v := val.(type) {
+		case float64:
+			return e.encodeString(e.encodeNumber(v))
+		case json.Number:
+			return e.encodeString(e.encodeJSONNumber(v))
+		case bool:
+			return e.encodeString(strconv.FormatBool(v))
+		}
+	}
+	return encoded
+}
+
+// arrayComment devuelve el comentario de Annotate para arr ("# 2 rows: id,
+// name"), o "" si no se pidió o arr no se escribe en forma tabular.
+func (e *TOONEncoder) arrayComment(arr []interface{}) string {
+	if !e.annotate {
+		return ""
+	}
+	arr = e.sampleArray(arr).items
+	isTabular, fields := e.isTabularArray(arr)
+	if !isTabular {
+		return ""
+	}
+
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = e.encodeKey(field)
+	}
+	rows := "rows"
+	if len(arr) == 1 {
+		rows = "row"
+	}
+	return fmt.Sprintf("# %d %s: %s", len(arr), rows, strings.Join(names, ", "))
+}
+
+// tabularHeader devuelve la cabecera "[N]{campos}:" de un array tabular, con
+// length como N; con TypedHeaders, "[N]{campo:tipo,...}:".
+func (e *TOONEncoder) tabularHeader(arr []interface{}, fields []string, depth int, length int) string {
+	// Determinar delimitador para header
+	var headerDelimiter string
+	var lengthDelimiter string
+
+	switch e.delimiter {
+	case "\t":
+		headerDelimiter = e.tabDelimiterMarker()
+		lengthDelimiter = e.tabDelimiterMarker()
+	case "|":
+		headerDelimiter = "|"
+		lengthDelimiter = "|"
+	default: // comma
+		headerDelimiter = ","
+		lengthDelimiter = ""
+	}
+
+	// Encodear claves para el header
+	encodedFields := make([]string, len(fields))
+	for i, field := range fields {
+		encodedFields[i] = e.encodeKeyForArray(field)
+	}
+	if e.typedHeaders {
+		for i, columnType := range e.columnTypes(arr, fields, depth) {
+			if columnType != "" {
+				encodedFields[i] += ":" + columnType
+			}
+		}
+	}
+	fieldList := strings.Join(encodedFields, headerDelimiter)
+
+	// El decoder deduce el delimitador del separador entre campos
+	if e.compact && len(fields) > 1 && inferFieldDelimiter(fieldList) == e.delimiter {
+		lengthDelimiter = ""
+	}
+
+	return fmt.Sprintf("[%s%d%s]{%s}:",
+		e.lengthMarker,
+		length,
+		lengthDelimiter,
+		fieldList)
+}
+
+// tabularRow codifica una fila de un array tabular con los valores de fields.
+// Con widths (ver columnWidths) cada celda salvo la última se rellena con
+// espacios hasta el ancho de su columna; el decoder los recorta.
+func (e *TOONEncoder) tabularRow(item interface{}, fields []string, depth int, widths []int) string {
+	cells := e.tabularCells(item, fields, depth)
+	if widths != nil {
+		for i := 0; i < len(cells)-1; i++ {
+			if pad := widths[i] - utf8.RuneCountInString(cells[i]); pad > 0 {
+				cells[i] += strings.Repeat(" ", pad)
+			}
+		}
+	}
+	return strings.Repeat(e.indent, depth+1) + e.joinCells(cells)
+}
+
+// joinCells une las celdas de una fila o un array de primitivos con el
+// delimitador. Si el resultado queda vacío (una sola celda con null vacío
+// por EmptyNull, o ausente por SparseTabular) se escribe null: una fila en
+// blanco se la salta el decoder, y "[1]: " no tendría elementos.
+func (e *TOONEncoder) joinCells(cells []string) string {
+	joined := strings.Join(cells, e.delimiter)
+	if joined == "" && len(cells) > 0 {
+		if e.nullLiteral != "" {
+			return e.nullLiteral
+		}
+		return "null"
+	}
+	return joined
+}
+
+// columnTypes deduce el tipo de cada columna de TypedHeaders a partir de las
+// celdas tal como se escriben (ver cellType), así que respeta FieldTypes y
+// NumericStrings. Los null solo cuentan si la columna no tiene otra cosa
+// (una columna int con nulls es int); int y float juntos dan float. Una
+// columna con tipos incompatibles, o solo con celdas vacías, queda sin tipo
+// ("").
+func (e *TOONEncoder) columnTypes(arr []interface{}, fields []string, depth int) []string {
+	types := make([]string, len(fields))
+	hasNull := make([]bool, len(fields))
+	mixed := make([]bool, len(fields))
+	for _, item := range arr {
+		obj, _ := AsObject(item)
+		for i, cell := range e.tabularCells(item, fields, depth) {
+			cellType := e.cellType(cell)
+			if _, isBool := obj[fields[i]].(bool); isBool && e.compactBooleans && (cell == "1" || cell == "0") {
+				cellType = "bool"
+			}
+			switch {
+			case cellType == "":
+			case cellType == "null":
+				hasNull[i] = true
+			case types[i] == "" || types[i] == cellType:
+				types[i] = cellType
+			case (types[i] == "int" || types[i] == "float") && (cellType == "int" || cellType == "float"):
+				types[i] = "float"
+			default:
+				mixed[i] = true
+			}
+		}
+	}
+
+	for i := range types {
+		if mixed[i] {
+			types[i] = ""
+		} else if types[i] == "" && hasNull[i] {
+			types[i] = "null"
+		}
+	}
+	return types
+}
+
+// cellType devuelve el tipo que leerá el decoder en una celda ya codificada:
+// "int", "float", "bool", "null" o "string", o "" si está vacía (campo
+// ausente o EmptyNull).
+func (e *TOONEncoder) cellType(cell string) string {
+	switch {
+	case cell == "":
+		return ""
+	case strings.HasPrefix(cell, `"`):
+		return "string"
+	case cell == e.trueLiteral || cell == e.falseLiteral:
+		return "bool"
+	case cell == e.nullLiteral:
+		return "null"
+	case validJSONNumber.MatchString(cell):
+		if strings.ContainsAny(cell, ".eE") {
+			return "float"
+		}
+		return "int"
+	}
+	return "string"
+}
+
+// columnWidths devuelve el ancho en caracteres de la celda más larga de cada
+// columna, o nil si AlignColumns está desactivado.
+func (e *TOONEncoder) columnWidths(arr []interface{}, fields []string, depth int) []int {
+	if !e.alignColumns {
+		return nil
+	}
+	widths := make([]int, len(fields))
+	for _, item := range arr {
+		for i, cell := range e.tabularCells(item, fields, depth) {
+			if width := utf8.RuneCountInString(cell); width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	return widths
+}
+
+// tabularCells codifica las celdas de una fila de un array tabular.
+func (e *TOONEncoder) tabularCells(item interface{}, fields []string, depth int) []string {
+	obj, _ := AsObject(item)
+	var values []string
+
+	for _, field := range fields { // Usar fields, no encodedFields
+		val, exists := obj[field]
+		if !exists {
+			// Campo ausente (SparseTabular): celda vacía
+			values = append(values, "")
+			continue
+		}
+		encoded := e.encodeCompactCell(val, field)
+		if len(e.fieldTypes) > 0 {
+			encoded = e.coerceCell(val, e.fieldTypes[field], encoded)
+		}
+		values = append(values, encoded)
+	}
+
+	return values
+}
+
+// matrixColumns indica si todos los elementos son arrays no vacíos de
+// primitivos con la misma longitud, y cuál es esa longitud. La
+// especificación no tiene matrices, así que con SpecVersion "1.0" nunca.
+func (e *TOONEncoder) matrixColumns(arr []interface{}) (int, bool) {
+	if e.spec {
+		return 0, false
+	}
+	columns := -1
+	for _, item := range arr {
+		row, ok := item.([]interface{})
+		if !ok || len(row) == 0 || !e.allPrimitive(row) {
+			return 0, false
+		}
+		if columns >= 0 && len(row) != columns {
+			return 0, false
+		}
+		columns = len(row)
+	}
+	return columns, true
+}
+
+// encodeMatrix emite "[RxC]:" seguido de una fila por línea, con las celdas
+// separadas por el delimitador activo.
+func (e *TOONEncoder) encodeMatrix(arr []interface{}, columns int, depth int, rows int) string {
+	indentation := strings.Repeat(e.indent, depth)
+
+	var delimiterMarker string
+	switch e.delimiter {
+	case "\t":
+		delimiterMarker = e.tabDelimiterMarker()
+	case "|":
+		delimiterMarker = "|"
+	}
+
+	lines := []string{fmt.Sprintf("[%s%dx%d%s]:", e.lengthMarker, rows, columns, delimiterMarker)}
+	for _, item := range arr {
+		var values []string
+		for _, cell := range item.([]interface{}) {
+			values = append(values, e.encodeCompactCell(cell, ""))
+		}
+		lines = append(lines, indentation+e.indent+e.joinCells(values))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (e *TOONEncoder) allPrimitive(arr []interface{}) bool {
+	for _, item := range arr {
+		switch item.(type) {
+		case map[string]interface{}, *OrderedMap, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func (e *TOONEncoder) encodePrimitiveArray(arr []interface{}, length int) string {
+	var values []string
+	for _, item := range arr {
+		values = append(values, e.encodeCompactCell(item, ""))
+	}
+
+	// Delimiter marker para header
+	var delimiterMarker string
+	switch e.delimiter {
+	case "\t":
+		delimiterMarker = e.tabDelimiterMarker()
+	case "|":
+		delimiterMarker = "|"
+	}
+
+	separator := " "
+	if e.compact {
+		separator = ""
+	}
+
+	return fmt.Sprintf("[%s%d%s]:%s%s",
+		e.lengthMarker,
+		length,
+		delimiterMarker,
+		separator,
+		e.joinCells(values))
+}
+
+// listItemMarker devuelve el prefijo del elemento i de una lista: "- " o,
+// con ListIndex, su número ("0- ", "1) ").
+func (e *TOONEncoder) listItemMarker(i int) string {
+	if !e.listIndex {
+		return "- "
+	}
+	return strconv.Itoa(i+e.listIndexBase) + e.listIndexStyle + " "
+}
+
+func (e *TOONEncoder) encodeListArray(arr []interface{}, depth int, length int) string {
+	lines := []string{fmt.Sprintf("[%s%d]:", e.lengthMarker, length)}
+	for i, item := range arr {
+		lines = append(lines, e.listItemLines(item, i, depth)...)
+	}
+
+	// Línea de cierre con los elementos emitidos, para contrastar con [N]
+	if e.listEndMarker {
+		lines = append(lines, e.listEndLine(depth, length))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// encodeInlineObject escribe un objeto como "{a: 1, b: 2}" si InlineObjects
+// lo permite: no vacío, con hasta InlineObjects campos y todos primitivos.
+// Además de las reglas normales, los strings con ',' o '}' van entre
+// comillas para que el decoder encuentre los límites.
+func (e *TOONEncoder) encodeInlineObject(value interface{}) (string, bool) {
+	obj, _ := AsObject(value)
+	if e.inlineObjects <= 0 || len(obj) == 0 || len(obj) > e.inlineObjects {
+		return "", false
+	}
+
+	order, fixed := keyOrder(value)
+	fields := make([]string, 0, len(obj))
+	for _, key := range e.objectKeys(obj, order, fixed || e.keySort == "none") {
+		var encoded string
+		switch val := obj[key].(type) {
+		case map[string]interface{}, *OrderedMap, []interface{}:
+			return "", false
+		case string:
+			encoded = e.encodeCell(val, key)
+			if !strings.HasPrefix(encoded, `"`) && strings.ContainsAny(encoded, ",}") {
+				encoded = quoteString(encoded)
+			}
+		default:
+			encoded = e.encodeCell(val, key)
+		}
+		fields = append(fields, e.encodeKey(key)+": "+encoded)
+	}
+
+	return "{" + strings.Join(fields, ", ") + "}", true
+}
+
+// listEndLine devuelve la línea de cierre "[/N]" de ListEndMarker.
+func (e *TOONEncoder) listEndLine(depth int, length int) string {
+	return fmt.Sprintf("%s%s[/%s%d]", strings.Repeat(e.indent, depth), e.indent, e.lengthMarker, length)
+}
+
+// listItemLines codifica el elemento i de un array en formato lista.
+func (e *TOONEncoder) listItemLines(item interface{}, i int, depth int) []string {
+	indentation := strings.Repeat(e.indent, depth)
+	marker := e.listItemMarker(i)
+
+	if literal, ok := e.emptyContainer(item); ok {
+		return []string{indentation + e.indent + marker + literal}
+	}
+
+	var lines []string
+	switch v := item.(type) {
+	case map[string]interface{}, *OrderedMap:
+		// Objeto en lista: en una línea si es pequeño y se pidió
+		if inline, ok := e.encodeInlineObject(v); ok {
+			lines = append(lines, indentation+e.indent+marker+inline)
+			break
+		}
+		encoded := e.encodeValue(v, depth+2)
+		if encoded == "" {
+			// La especificación no deja espacio tras el guión
+			if e.spec {
+				marker = strings.TrimSuffix(marker, " ")
+			}
+			lines = append(lines, indentation+e.indent+marker)
+		} else {
+			// Propiedades un nivel por debajo del guión; la primera va
+			// en la línea del guión. Así los valores anidados (objetos,
+			// arrays) conservan su indentación relativa.
+			objLines := strings.Split(encoded, "\n")
+			fieldIndentation := indentation + e.indent + e.indent
+			// El comentario de Annotate del primer campo va antes del guión
+			if first := strings.TrimPrefix(objLines[0], fieldIndentation); isCommentLine(first) {
+				lines = append(lines, indentation+e.indent+first)
+				objLines = objLines[1:]
+			}
+			lines = append(lines, indentation+e.indent+marker+strings.TrimPrefix(objLines[0], fieldIndentation))
+			lines = append(lines, objLines[1:]...)
+		}
+
+	case []interface{}:
+		// Array en lista
+		if comment := e.arrayComment(v); comment != "" {
+			lines = append(lines, indentation+e.indent+comment)
+		}
+		arrayStr := e.encodeArray(v, depth+1)
+		if strings.Contains(arrayStr, "\n") {
+			// Array multilínea - indentar cada línea
+			arrayLines := strings.Split(arrayStr, "\n")
+			for j, line := range arrayLines {
+				switch {
+				case j == 0:
+					lines = append(lines, indentation+e.indent+marker+line)
+				case e.spec:
+					// Ya van un nivel por debajo del guión
+					lines = append(lines, line)
+				default:
+					lines = append(lines, indentation+e.indent+e.indent+line)
+				}
+			}
+		} else {
+			// Array inline
+			lines = append(lines, indentation+e.indent+marker+arrayStr)
+		}
+
+	default:
+		// Primitivo en lista
+		lines = append(lines, indentation+e.indent+marker+e.encodeCell(item, ""))
+	}
+
+	return lines
+}
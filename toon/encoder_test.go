@@ -0,0 +1,1063 @@
+package toon
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mustEncode codifica value con e y falla el test si Encode devuelve un error.
+func mustEncode(t *testing.T, e *TOONEncoder, value interface{}) string {
+	t.Helper()
+	encoded, err := e.Encode(value)
+	if err != nil {
+		t.Fatalf("Encode error: %v", err)
+	}
+	return encoded
+}
+
+func TestTOONEncoder_SimpleObject(t *testing.T) {
+	input := map[string]interface{}{
+		"id":   float64(123),
+		"name": "Alice",
+	}
+
+	encoder := NewTOONEncoder()
+	result := mustEncode(t, encoder, input)
+
+	expected := "id: 123\nname: Alice"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_TabularArray(t *testing.T) {
+	input := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": float64(1), "name": "Alice"},
+			map[string]interface{}{"id": float64(2), "name": "Bob"},
+		},
+	}
+
+	encoder := NewTOONEncoder()
+	result := mustEncode(t, encoder, input)
+
+	expected := "users[2]{id,name}:\n    1,Alice\n    2,Bob"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_TabularCellTypes(t *testing.T) {
+	input := []interface{}{
+		map[string]interface{}{"b": true, "n": nil, "x": 1.5, "s": "true", "q": "a,b", "i": json.Number("9007199254740993")},
+		map[string]interface{}{"b": false, "n": nil, "x": -0.0, "s": "", "q": "null", "i": json.Number("-0")},
+	}
+
+	result := mustEncode(t, NewTOONEncoder(), input)
+	expected := "[2]{b,i,n,q,s,x}:\n  true,9007199254740993,null,\"a,b\",\"true\",1.5\n  false,0,null,\"null\",\"\",0"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	// Cada primitivo se escribe igual como celda, elemento de un array, valor
+	// de una clave o elemento de una lista
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{TrueLiteral: "yes", FalseLiteral: "no", NullLiteral: "none"})
+	for _, value := range []interface{}{true, false, nil, 42.0, "yes", "plain", "a:b"} {
+		cell := encoder.encodeCell(value, "")
+		forms := map[string]string{
+			"tabular":   mustEncode(t, encoder, []interface{}{map[string]interface{}{"v": value}}),
+			"primitive": mustEncode(t, encoder, []interface{}{value}),
+			"object":    mustEncode(t, encoder, map[string]interface{}{"v": value}),
+			"list":      mustEncode(t, encoder, []interface{}{value, []interface{}{}}),
+		}
+		expected := map[string]string{
+			"tabular":   "[1]{v}:\n  " + cell,
+			"primitive": "[1]: " + cell,
+			"object":    "v: " + cell,
+			"list":      "[2]:\n  - " + cell + "\n  - [0]:",
+		}
+		for form, result := range forms {
+			if result != expected[form] {
+				t.Errorf("%v as %s: expected %q, got %q", value, form, expected[form], result)
+			}
+		}
+	}
+}
+
+func TestTOONEncoder_TabDelimiter(t *testing.T) {
+	input := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": float64(1), "name": "Widget"},
+			map[string]interface{}{"id": float64(2), "name": "Gadget"},
+		},
+	}
+
+	opts := TOONOptions{
+		Delimiter: "\t",
+	}
+	encoder, _ := NewTOONEncoderWithOptions(opts)
+	result := mustEncode(t, encoder, input)
+
+	expected := "items[2 ]{id name}:\n    1\tWidget\n    2\tGadget"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_LengthMarker(t *testing.T) {
+	input := map[string]interface{}{
+		"tags": []interface{}{"foo", "bar", "baz"},
+	}
+
+	opts := TOONOptions{
+		LengthMarker: true,
+	}
+	encoder, _ := NewTOONEncoderWithOptions(opts)
+	result := mustEncode(t, encoder, input)
+
+	expected := "tags[#3]: foo,bar,baz"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_StringQuoting(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty", "", `""`},
+		{"normal", "hello", "hello"},
+		{"with comma", "hello,world", `"hello,world"`},
+		{"with colon", "key:value", `"key:value"`},
+		{"looks like bool", "true", `"true"`},
+		{"looks like number", "123", `"123"`},
+		{"with leading space", " padded", `" padded"`},
+		{"with dash prefix", "- item", `"- item"`},
+	}
+
+	encoder := NewTOONEncoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := encoder.encodeString(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTOONEncoder_NestedArrays(t *testing.T) {
+	// Arrays de arrays primitivos de igual longitud usan la forma matriz
+	input := map[string]interface{}{
+		"matrix": []interface{}{
+			[]interface{}{float64(1), float64(2)},
+			[]interface{}{float64(3), float64(4)},
+		},
+	}
+
+	encoder := NewTOONEncoder()
+	result := mustEncode(t, encoder, input)
+
+	expected := "matrix[2x2]:\n    1,2\n    3,4"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_ComplexNested(t *testing.T) {
+	jsonStr := `{
+		"users": [
+			{"id": 1, "name": "Alice", "active": true},
+			{"id": 2, "name": "Bob", "active": false}
+		],
+		"metadata": {
+			"total": 2,
+			"page": 1
+		}
+	}`
+
+	var data interface{}
+	json.Unmarshal([]byte(jsonStr), &data)
+
+	encoder := NewTOONEncoder()
+	result := mustEncode(t, encoder, data)
+
+	expected := "metadata:\n  page: 1\n  total: 2\nusers[2]{active,id,name}:\n    true,1,Alice\n    false,2,Bob"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_PreserveKeyOrderTabular(t *testing.T) {
+	jsonStr := `{"users": [
+		{"id": 1, "name": "Alice", "email": "alice@example.com"},
+		{"id": 2, "name": "Bob", "email": "bob@example.com"}
+	]}`
+
+	data, err := DecodeOrderedJSON(jsonStr)
+	if err != nil {
+		t.Fatalf("DecodeOrderedJSON: %v", err)
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{PreserveKeyOrder: true})
+	result := mustEncode(t, encoder, data)
+
+	expected := "users[2]{id,name,email}:\n    1,Alice,alice@example.com\n    2,Bob,bob@example.com"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	// Sin la opción se mantiene el orden alfabético
+	result = mustEncode(t, NewTOONEncoder(), data)
+	expected = "users[2]{email,id,name}:\n    alice@example.com,1,Alice\n    bob@example.com,2,Bob"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_KeySort(t *testing.T) {
+	jsonStr := `{"item10": 1, "Beta": 2, "item2": 3, "alpha": 4, "rows": [{"b": 1, "A": 2, "a10": 3, "a9": 4}]}`
+
+	data, err := DecodeOrderedJSON(jsonStr)
+	if err != nil {
+		t.Fatalf("DecodeOrderedJSON: %v", err)
+	}
+
+	tests := []struct {
+		keySort  string
+		expected string
+	}{
+		{"", "Beta: 2\nalpha: 4\nitem10: 1\nitem2: 3\nrows[1]{A,a10,a9,b}:\n    2,3,4,1"},
+		{"asc", "Beta: 2\nalpha: 4\nitem10: 1\nitem2: 3\nrows[1]{A,a10,a9,b}:\n    2,3,4,1"},
+		{"asc-ci", "alpha: 4\nBeta: 2\nitem10: 1\nitem2: 3\nrows[1]{A,a10,a9,b}:\n    2,3,4,1"},
+		{"natural", "Beta: 2\nalpha: 4\nitem2: 3\nitem10: 1\nrows[1]{A,a9,a10,b}:\n    2,4,3,1"},
+		{"none", "item10: 1\nBeta: 2\nitem2: 3\nalpha: 4\nrows[1]{b,A,a10,a9}:\n    1,2,3,4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keySort, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(TOONOptions{KeySort: tt.keySort})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			result := mustEncode(t, encoder, data)
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{KeySort: "desc"}); err == nil {
+		t.Error("Expected error for unknown keySort")
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	ordered := []string{"", "a", "a01", "a1", "a2", "a10", "a10b", "b"}
+	for i := 0; i < len(ordered)-1; i++ {
+		if !naturalLess(ordered[i], ordered[i+1]) {
+			t.Errorf("Expected %q < %q", ordered[i], ordered[i+1])
+		}
+		if naturalLess(ordered[i+1], ordered[i]) {
+			t.Errorf("Expected !(%q < %q)", ordered[i+1], ordered[i])
+		}
+	}
+}
+
+func TestTOONEncoder_MaxArrayElements(t *testing.T) {
+	input := map[string]interface{}{
+		"ids": []interface{}{float64(1), float64(2), float64(3), float64(4)},
+		"users": []interface{}{
+			map[string]interface{}{"id": float64(1)},
+			map[string]interface{}{"id": float64(2)},
+			map[string]interface{}{"id": float64(3)},
+		},
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{MaxArrayElements: 2, TruncateArrays: true})
+	truncated, err := encoder.CheckLimits(input)
+	if err != nil || !truncated {
+		t.Fatalf("Expected truncation without error, got truncated=%v err=%v", truncated, err)
+	}
+
+	result := mustEncode(t, encoder, input)
+	expected := "ids[2]: 1,2\n    ... (+2)\nusers[2]{id}:\n    1\n    2\n    ... (+1)"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	if _, err := NewTOONDecoder().Decode(result); err != nil {
+		t.Errorf("Truncated output should decode: %v", err)
+	}
+
+	strict, _ := NewTOONEncoderWithOptions(TOONOptions{MaxArrayElements: 2})
+	if _, err := strict.CheckLimits(input); err == nil {
+		t.Error("Expected error when TruncateArrays is disabled")
+	}
+}
+
+func TestTOONEncoder_SampleStrategy(t *testing.T) {
+	var rows []interface{}
+	for i := 1; i <= 10; i++ {
+		rows = append(rows, map[string]interface{}{"id": float64(i)})
+	}
+	input := map[string]interface{}{"rows": rows}
+
+	tests := []struct {
+		strategy string
+		expected string
+	}{
+		{"head", "rows[10]{id}:\n    1\n    2\n    3\n    4\n    ... (+6)"},
+		{"head+tail", "rows[10]{id}:\n    1\n    2\n    ... (+6)\n    9\n    10"},
+	}
+	for _, tt := range tests {
+		encoder, err := NewTOONEncoderWithOptions(TOONOptions{MaxArrayElements: 4, TruncateArrays: true, SampleStrategy: tt.strategy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := mustEncode(t, encoder, input)
+		if result != tt.expected {
+			t.Errorf("%s: expected:\n%s\nGot:\n%s", tt.strategy, tt.expected, result)
+		}
+		// El header con la longitud real se lee en modo estricto
+		if _, err := NewTOONDecoder().Decode(result); err != nil {
+			t.Errorf("%s: sampled output should decode: %v", tt.strategy, err)
+		}
+	}
+
+	// random: muestra en orden original y siempre la misma
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{MaxArrayElements: 4, TruncateArrays: true, SampleStrategy: "random"})
+	result := mustEncode(t, encoder, input)
+	if result != mustEncode(t, encoder, input) || !strings.HasPrefix(result, "rows[10]{id}:\n") || !strings.HasSuffix(result, "\n    ... (+6)") {
+		t.Errorf("Unexpected random sample:\n%s", result)
+	}
+	decoded, _ := NewTOONDecoder().Decode(result)
+	sample := decoded.(map[string]interface{})["rows"].([]interface{})
+	for i := 1; i < len(sample); i++ {
+		if sample[i].(map[string]interface{})["id"].(float64) <= sample[i-1].(map[string]interface{})["id"].(float64) {
+			t.Errorf("Expected rows in their original order, got %v", sample)
+		}
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{SampleStrategy: "tail"}); err == nil {
+		t.Error("Expected error for an unknown sampleStrategy")
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	input := `{"id": 9007199254740993, "price": 1.50, "b": 1, "a": 2}`
+
+	for _, ordered := range []bool{false, true} {
+		data, err := DecodeJSON(input, ordered)
+		if err != nil {
+			t.Fatalf("DecodeJSON(%v) error: %v", ordered, err)
+		}
+		expected := "a: 2\nb: 1\nid: 9007199254740993\nprice: 1.5"
+		if ordered {
+			expected = "id: 9007199254740993\nprice: 1.5\nb: 1\na: 2"
+		}
+		keySort := "asc"
+		if ordered {
+			keySort = "none"
+		}
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{KeySort: keySort})
+		if result := mustEncode(t, encoder, data); result != expected {
+			t.Errorf("DecodeJSON(%v): expected:\n%s\nGot:\n%s", ordered, expected, result)
+		}
+	}
+
+	if _, err := DecodeJSON(`{"a": 1} {"b": 2}`, false); err == nil {
+		t.Error("Expected error for content after the JSON value")
+	}
+}
+
+func TestTOONEncoder_MaxDepth(t *testing.T) {
+	// nested(n) tiene n niveles de objetos y arrays: {"a": [{"a": [...]}]}
+	var nested func(n int) interface{}
+	nested = func(n int) interface{} {
+		if n == 0 {
+			return "x"
+		}
+		if n%2 == 0 {
+			return []interface{}{nested(n - 1), "y"}
+		}
+		return map[string]interface{}{"a": nested(n - 1)}
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{MaxDepth: 5})
+	if _, err := encoder.CheckLimits(nested(5)); err != nil {
+		t.Errorf("Unexpected error at MaxDepth: %v", err)
+	}
+	if _, err := encoder.Encode(nested(5)); err != nil {
+		t.Errorf("Unexpected Encode error at MaxDepth: %v", err)
+	}
+	if _, err := encoder.CheckLimits(nested(6)); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expected ErrMaxDepth, got %v", err)
+	}
+
+	// Por defecto el límite es DefaultMaxDepth, también en Marshal
+	if _, err := Marshal(nested(DefaultMaxDepth + 1)); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("Expected ErrMaxDepth from Marshal, got %v", err)
+	}
+	// Encode y EncodeTo también fallan, sin escribir nada
+	if result, err := NewTOONEncoder().Encode(nested(4 * DefaultMaxDepth)); !errors.Is(err, ErrMaxDepth) || result != "" {
+		t.Errorf("Expected ErrMaxDepth from Encode, got %q, %v", result, err)
+	}
+	var out strings.Builder
+	if err := encoder.EncodeTo(&out, nested(6), nil); !errors.Is(err, ErrMaxDepth) || out.Len() != 0 {
+		t.Errorf("Expected ErrMaxDepth from EncodeTo, got %q, %v", out.String(), err)
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{MaxDepth: -1}); err == nil {
+		t.Error("Expected error for a negative MaxDepth")
+	}
+}
+
+func TestFindDuplicateKeys(t *testing.T) {
+	input := `{"a": 1, "a": 2, "a": 3, "users": [{"id": 1}, {"id": 2, "id": 3}], "meta": {"x": {"y": 1, "y": 2}}}`
+
+	duplicates, err := FindDuplicateKeys(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"a", "users[1].id", "meta.x.y"}
+	if strings.Join(duplicates, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, duplicates)
+	}
+}
+
+func TestTOONEncoder_RootKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"primitive array", `[1,2,3]`, "items[3]: 1,2,3"},
+		{"object", `{"id": 1, "meta": {"page": 2}}`, "items:\n  id: 1\n  meta:\n    page: 2"},
+		{"tabular array", `[{"id": 1}, {"id": 2}]`, "items[2]{id}:\n    1\n    2"},
+		{"list array", `[1, {"a": 1, "b": [1, 2]}]`, "items[2]:\n    - 1\n    - a: 1\n      b[2]: 1,2"},
+		{"primitive", `"hello"`, "items: hello"},
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{RootKey: "items"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data interface{}
+			json.Unmarshal([]byte(tt.input), &data)
+
+			result := mustEncode(t, encoder, data)
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTOONEncoder_ListEndMarker(t *testing.T) {
+	input := map[string]interface{}{
+		"items": []interface{}{float64(1), map[string]interface{}{"a": float64(2)}, "x"},
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{ListEndMarker: true, LengthMarker: true})
+	result := mustEncode(t, encoder, input)
+
+	expected := "items[#3]:\n    - 1\n    - a: 2\n    - x\n    [/#3]"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	// La salida por defecto no cambia
+	if strings.Contains(mustEncode(t, NewTOONEncoder(), input), "[/") {
+		t.Error("End marker should be opt-in")
+	}
+}
+
+func TestTOONEncoder_ControlCharsAndInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		decoded  string
+	}{
+		{"nul", "a\x00b", `"a\u0000b"`, "a\x00b"},
+		{"esc", "\x1b[31mred", `"\u001b[31mred"`, "\x1b[31mred"},
+		{"newline", "a\nb", `"a\nb"`, "a\nb"},
+		{"line separator", "a\u2028b\u2029", `"a\u2028b\u2029"`, "a\u2028b\u2029"},
+		{"invalid utf8", "ok\xff\xfeend", "ok�end", "ok�end"},
+	}
+
+	encoder := NewTOONEncoder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := encoder.encodeString(tt.input)
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+
+			toon := mustEncode(t, encoder, map[string]interface{}{"v": tt.input})
+			decoded, err := NewTOONDecoder().Decode(toon)
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if got := decoded.(map[string]interface{})["v"]; got != tt.decoded {
+				t.Errorf("Expected decoded %q, got %q", tt.decoded, got)
+			}
+		})
+	}
+}
+
+func TestTOONEncoder_ASCIIOnly(t *testing.T) {
+	encoder, err := NewTOONEncoderWithOptions(TOONOptions{ASCIIOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"año":   "Málaga 😀",
+		"plain": "ok",
+		"rows":  []interface{}{map[string]interface{}{"ciudad": "Zürich"}},
+	}
+
+	result := mustEncode(t, encoder, data)
+	expected := "\"a\\u00f1o\": \"M\\u00e1laga \\ud83d\\ude00\"\nplain: ok\nrows[1]{ciudad}:\n    \"Z\\u00fcrich\""
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	decoded, err := NewTOONDecoder().Decode(result)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Round trip mismatch: %v", decoded)
+	}
+}
+
+func TestTOONEncoder_RaggedMatrix(t *testing.T) {
+	input := map[string]interface{}{
+		"ragged": []interface{}{
+			[]interface{}{float64(1), float64(2)},
+			[]interface{}{float64(3)},
+		},
+	}
+
+	result := mustEncode(t, NewTOONEncoder(), input)
+
+	expected := "ragged[2]:\n    - [2]: 1,2\n    - [1]: 3"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestTOONEncoder_NumberFormatting(t *testing.T) {
+	tests := []struct {
+		input      float64
+		expected   string
+		scientific string
+	}{
+		{0, "0", "0"},
+		{math.Copysign(0, -1), "0", "0"},
+		{1, "1", "1"},
+		{-42, "-42", "-42"},
+		{1.5, "1.5", "1.5"},
+		{0.1, "0.1", "0.1"},
+		{0.30000000000000004, "0.30000000000000004", "0.30000000000000004"},
+		{-3.25, "-3.25", "-3.25"},
+		{2500000, "2500000", "2.5e+06"},
+		{2500000.75, "2500000.75", "2.50000075e+06"},
+		{1234567.89, "1234567.89", "1.23456789e+06"},
+		{1e15, "1000000000000000", "1e+15"},
+		{9007199254740993, "9007199254740992", "9.007199254740992e+15"},
+		{1e21, "1000000000000000000000", "1e+21"},
+		{1.5e-7, "0.00000015", "1.5e-07"},
+		{1e-10, "0.0000000001", "1e-10"},
+		{math.NaN(), "null", "null"},
+		{math.Inf(1), "null", "null"},
+		{math.Inf(-1), "null", "null"},
+	}
+
+	plain := NewTOONEncoder()
+	scientific, _ := NewTOONEncoderWithOptions(TOONOptions{ScientificNotation: true})
+	for _, tt := range tests {
+		if result := plain.encodeNumber(tt.input); result != tt.expected {
+			t.Errorf("encodeNumber(%v): expected %s, got %s", tt.input, tt.expected, result)
+		}
+		if result := scientific.encodeNumber(tt.input); result != tt.scientific {
+			t.Errorf("encodeNumber(%v) with ScientificNotation: expected %s, got %s", tt.input, tt.scientific, result)
+		}
+	}
+}
+
+func TestTOONEncoder_DecimalPlaces(t *testing.T) {
+	encoder, err := NewTOONEncoderWithOptions(TOONOptions{DecimalPlaces: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"prices": []interface{}{1.5, 1234567.891, 2.005, -0.001, 3.0, 1.5e-7},
+		"id":     json.Number("9007199254740993"),
+		"rate":   json.Number("0.126"),
+	}
+	// Los enteros (también los de json.Number) no ganan decimales
+	expected := "id: 9007199254740993\n" +
+		"prices[6]: 1.50,1234567.89,2.00,0,3,0\n" +
+		"rate: 0.13"
+	if result := mustEncode(t, encoder, data); result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	// Tiene prioridad sobre JSNumberCompat, que escribiría 1.5e-7
+	js, _ := NewTOONEncoderWithOptions(TOONOptions{DecimalPlaces: 8, JSNumberCompat: true})
+	if result := js.encodeNumber(1.5e-7); result != "0.00000015" {
+		t.Errorf("Expected 0.00000015, got %s", result)
+	}
+
+	for _, places := range []int{-1, 21} {
+		if _, err := NewTOONEncoderWithOptions(TOONOptions{DecimalPlaces: places}); err == nil {
+			t.Errorf("Expected error for DecimalPlaces %d", places)
+		}
+	}
+}
+
+func TestTOONEncoder_FloatPrecision(t *testing.T) {
+	encoder, err := NewTOONEncoderWithOptions(TOONOptions{FloatPrecision: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"readings": []interface{}{3.14159265358979, 2.5, 1.0005, -0.0001, 42.0, 1.2e-9},
+		"rate":     json.Number("0.123456789"),
+	}
+	// Sin ceros finales y sin tocar los enteros
+	expected := "rate: 0.123\nreadings[6]: 3.142,2.5,1,0,42,0"
+	if result := mustEncode(t, encoder, data); result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	// DecimalPlaces tiene prioridad
+	both, _ := NewTOONEncoderWithOptions(TOONOptions{FloatPrecision: 3, DecimalPlaces: 1})
+	if result := both.encodeNumber(2.25); result != "2.2" {
+		t.Errorf("Expected 2.2, got %s", result)
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{FloatPrecision: -1}); err == nil {
+		t.Error("Expected error for a negative FloatPrecision")
+	}
+}
+
+func TestTOONEncoder_JSNumberCompat(t *testing.T) {
+	// Salida de Number.prototype.toString en JavaScript
+	tests := []struct {
+		input    float64
+		expected string
+	}{
+		{0.30000000000000004, "0.30000000000000004"}, // 0.1 + 0.2
+		{math.Copysign(0, -1), "0"},
+		{123, "123"},
+		{-1.5, "-1.5"},
+		{2500000, "2500000"},
+		{1e20, "100000000000000000000"},
+		{123456789012345680000, "123456789012345680000"},
+		{1e21, "1e+21"},
+		{1.5e21, "1.5e+21"},
+		{-2e300, "-2e+300"},
+		{math.MaxFloat64, "1.7976931348623157e+308"},
+		{0.000001, "0.000001"},
+		{1.5e-6, "0.0000015"},
+		{1e-7, "1e-7"},
+		{1.25e-10, "1.25e-10"},
+		{5e-324, "5e-324"},
+		{math.NaN(), "null"},
+	}
+
+	// ScientificNotation no cambia nada con JSNumberCompat
+	for _, scientific := range []bool{false, true} {
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{JSNumberCompat: true, ScientificNotation: scientific})
+		for _, tt := range tests {
+			if result := encoder.encodeNumber(tt.input); result != tt.expected {
+				t.Errorf("encodeNumber(%v), scientific=%v: expected %s, got %s", tt.input, scientific, tt.expected, result)
+			}
+		}
+	}
+
+	// Los enteros de json.Number también pasan por float64, como en JS
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{JSNumberCompat: true})
+	if result := mustEncode(t, encoder, json.Number("9007199254740993")); result != "9007199254740992" {
+		t.Errorf("Expected the float64 value, got %s", result)
+	}
+}
+
+func TestTOONEncoder_DateTimeStrings(t *testing.T) {
+	data := map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"day": "2024-01-15", "at": "2024-01-15T10:00:00Z"},
+			map[string]interface{}{"day": "2024-02-01", "at": "2024-02-01T08:30:00-05:00"},
+		},
+		"tags": []interface{}{"2024-01-15", "v2024"},
+	}
+
+	encoder := NewTOONEncoder()
+	expected := "events[2]{at,day}:\n    \"2024-01-15T10:00:00Z\",\"2024-01-15\"\n    \"2024-02-01T08:30:00-05:00\",\"2024-02-01\"\ntags[2]: \"2024-01-15\",v2024"
+	result := mustEncode(t, encoder, data)
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	decoded, err := NewTOONDecoder().Decode(result)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Round trip mismatch: %v", decoded)
+	}
+}
+
+func TestTOONEncoder_QuoteReason(t *testing.T) {
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Delimiter: "|"})
+
+	values := []struct {
+		input    string
+		expected QuoteReason
+	}{
+		{"hello world", QuoteNone},
+		{"a,b", QuoteNone},
+		{"", quoteEmpty},
+		{" x", quoteLeadingSpace},
+		{"x ", quoteTrailingSpace},
+		{"a|b", quoteDelimiter},
+		{"key: value", quoteSpecialChar},
+		{"line\nbreak", quoteControlChar},
+		{"[1]", quoteStructuralPrefix},
+		{"- item", quoteListItemPrefix},
+		{"# note", quoteCommentPrefix},
+		{"#hashtag", quoteCommentPrefix},
+		{"2024-01-15", quoteDateTime},
+		{"2024-01-15T10:00:00Z", quoteDateTime},
+		{"2024-01-15T10:00:00.123+02:00", quoteDateTime},
+		{"10:30", quoteDateTime},
+		{"2024-1-15", QuoteNone},
+		{"... (+3)", quoteTruncationMarker},
+		{"True", quoteReservedWord},
+		{"1e5", quoteNumeric},
+	}
+	for _, tt := range values {
+		if got := encoder.stringQuoteReason(tt.input); got != tt.expected {
+			t.Errorf("stringQuoteReason(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+		if quoted := encoder.encodeString(tt.input) != tt.input; quoted != (tt.expected != QuoteNone) {
+			t.Errorf("encodeString(%q) quoting disagrees with reason %q", tt.input, tt.expected)
+		}
+	}
+
+	keys := []struct {
+		input    string
+		inArray  bool
+		expected QuoteReason
+	}{
+		{"name", false, QuoteNone},
+		{"a,b", false, quoteSpecialChar},
+		{"a,b", true, quoteDelimiter},
+		{"a|b", true, quoteDelimiter},
+		{"a.b", true, QuoteNone},
+		{"-x", false, quoteLeadingHyphen},
+		{"42", false, quoteNumeric},
+		{"a\tb", false, quoteControlChar},
+		{"\xff", false, quoteInvalidUTF8},
+	}
+	for _, tt := range keys {
+		if got := encoder.keyQuoteReason(tt.input, tt.inArray); got != tt.expected {
+			t.Errorf("keyQuoteReason(%q, %v) = %q, expected %q", tt.input, tt.inArray, got, tt.expected)
+		}
+	}
+}
+
+func TestEncodeTopLevelArray(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"primitive", `[1, "a b", true]`, "[3]: 1,a b,true"},
+		{"tabular", `[{"id": 1, "name": "Alice"}, {"id": 2, "name": "Bob"}]`, "[2]{id,name}:\n  1,Alice\n  2,Bob"},
+		{"list", `[{"id": 1}, "x", [1, 2]]`, "[3]:\n  - id: 1\n  - x\n  - [2]: 1,2"},
+		{"matrix", `[[1, 2], [3, 4]]`, "[2x2]:\n  1,2\n  3,4"},
+		{"empty", `[]`, "[0]:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertTopLevel(t, tt.input, tt.expected)
+		})
+	}
+}
+
+func TestEncodeTopLevelScalar(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"string", `"hello"`, "hello"},
+		{"string needing quotes", `"a: b"`, `"a: b"`},
+		{"string like header", `"[3]: x"`, `"[3]: x"`},
+		{"empty string", `""`, `""`},
+		{"number", `42`, "42"},
+		{"bool", `true`, "true"},
+		{"null", `null`, "null"},
+		{"empty object", `{}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertTopLevel(t, tt.input, tt.expected)
+		})
+	}
+}
+
+// assertTopLevel comprueba la salida exacta de input y que el decoder
+// devuelva el mismo valor.
+func assertTopLevel(t *testing.T, input, expected string) {
+	t.Helper()
+
+	var data interface{}
+	if err := json.Unmarshal([]byte(input), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	result := mustEncode(t, NewTOONEncoder(), data)
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	decoded, err := NewTOONDecoder().Decode(result)
+	if err != nil {
+		t.Fatalf("Decode error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Expected %#v after decoding, got %#v", data, decoded)
+	}
+}
+
+func TestTOONEncoder_FieldTypes(t *testing.T) {
+	input := `[{"id": "007", "age": "42", "zip": 12345, "code": "99"}, {"id": "010", "age": "n/a", "zip": 8080, "code": "7"}]`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	encoder, err := NewTOONEncoderWithOptions(TOONOptions{
+		FieldTypes: map[string]string{"id": "number", "age": "number", "zip": "string"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// "007" no es un número JSON válido y se queda como string; "code" no
+	// tiene pista y mantiene el comportamiento automático
+	expected := "[2]{age,code,id,zip}:\n  42,\"99\",\"007\",\"12345\"\n  n/a,\"7\",\"010\",\"8080\""
+	if result := mustEncode(t, encoder, data); result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{FieldTypes: map[string]string{"age": "int"}}); err == nil {
+		t.Error("Expected error for an unknown field type")
+	}
+}
+
+func TestTOONEncoder_AlignColumns(t *testing.T) {
+	input := `[{"id": 1, "name": "Alice", "role": "admin"}, {"id": 1000000, "name": "Bob", "role": "x"}, {"id": 22, "name": "Émilie Zola", "role": "dev"}]`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		delimiter string
+		expected  string
+	}{
+		{",", "[3]{id,name,role}:\n  1      ,Alice      ,admin\n  1000000,Bob        ,x\n  22     ,Émilie Zola,dev"},
+		{"|", "[3|]{id|name|role}:\n  1      |Alice      |admin\n  1000000|Bob        |x\n  22     |Émilie Zola|dev"},
+		// Con tab no se alinea
+		{"\t", "[3 ]{id name role}:\n  1\tAlice\tadmin\n  1000000\tBob\tx\n  22\tÉmilie Zola\tdev"},
+	}
+
+	for _, tt := range tests {
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{AlignColumns: true, Delimiter: tt.delimiter})
+		result := mustEncode(t, encoder, data)
+		if result != tt.expected {
+			t.Errorf("Delimiter %q\nExpected:\n%s\nGot:\n%s", tt.delimiter, tt.expected, result)
+		}
+
+		decoded, err := NewTOONDecoder().Decode(result)
+		if err != nil {
+			t.Fatalf("Decode error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("Expected padding to be ignored when decoding, got %#v", decoded)
+		}
+	}
+}
+
+func TestTOONEncoder_NumericStrings(t *testing.T) {
+	input := `{"id": "9007199254740993", "zip": "02134", "sku": "12", "rows": [{"id": "1", "code": "44"}], "ids": ["-5", "1.5e3", "x"]}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		expected string
+	}{
+		{
+			name:     "off by default",
+			opts:     TOONOptions{},
+			expected: "id: \"9007199254740993\"\nids[3]: \"-5\",\"1.5e3\",x\nrows[1]{code,id}:\n    \"44\",\"1\"\nsku: \"12\"\nzip: \"02134\"",
+		},
+		{
+			// Los ceros a la izquierda indican un string de verdad
+			name:     "all numeric strings",
+			opts:     TOONOptions{NumericStrings: true},
+			expected: "id: 9007199254740993\nids[3]: -5,1.5e3,x\nrows[1]{code,id}:\n    44,1\nsku: 12\nzip: \"02134\"",
+		},
+		{
+			name:     "configured fields",
+			opts:     TOONOptions{NumericFields: []string{"id"}},
+			expected: "id: 9007199254740993\nids[3]: \"-5\",\"1.5e3\",x\nrows[1]{code,id}:\n    \"44\",1\nsku: \"12\"\nzip: \"02134\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, _ := NewTOONEncoderWithOptions(tt.opts)
+			if result := mustEncode(t, encoder, data); result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTOONEncoder_MaxStringLength(t *testing.T) {
+	input := `{"log": "línea uno, línea dos", "html": "<p>hola</p>", "short": "abc", "id": "123456789", "rows": [{"msg": "mensaje largo"}], "tags": ["abcdefgh"]}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		expected string
+	}{
+		{
+			// Se cuentan caracteres: "línea" son 5 aunque ocupe 6 bytes
+			name:     "global limit",
+			opts:     TOONOptions{MaxStringLength: 5},
+			expected: "html: <p>ho…\nid: 12345…\nlog: línea…\nrows[1]{msg}:\n    mensa…\nshort: abc\ntags[1]: abcde…",
+		},
+		{
+			name:     "per field",
+			opts:     TOONOptions{MaxStringLength: 5, MaxStringLengths: map[string]int{"log": 8, "html": 0}, NumericFields: []string{"id"}},
+			expected: "html: <p>hola</p>\nid: 123456789\nlog: línea un…\nrows[1]{msg}:\n    mensa…\nshort: abc\ntags[1]: abcde…",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := mustEncode(t, encoder, data); result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{MaxStringLength: -1}); err == nil {
+		t.Error("Expected error for a negative maxStringLength")
+	}
+}
+
+func TestTOONEncoder_EncodeToMatchesEncode(t *testing.T) {
+	inputs := []string{
+		`{"users": [{"id": 1, "name": "Alice"}, {"id": 2, "name": "Bob"}], "meta": {"page": 1}, "tags": ["a", "b"]}`,
+		`[{"id": 1}, {"id": 2}, {"id": 3}]`,
+		`[{"id": 1, "meta": {"x": 1}}, [1, 2], "plain"]`,
+		`[[1, 2], [3, 4]]`,
+		`[1, 2, 3, 4, 5, 6]`,
+		`{}`,
+		`"plain"`,
+		`{"a": {"b": {"rows": [{"id": 1}, {"id": 2}], "list": [{"x": [1, 2]}, 3], "empty": []}, "c": {}}, "d": null}`,
+		`{"groups": [{"members": [{"id": 1}, {"id": 2}, {"id": 3}]}], "m": [[1, 2], [3, 4]]}`,
+	}
+
+	for _, opts := range []TOONOptions{
+		{},
+		{ListEndMarker: true, LengthMarker: true, Delimiter: "|"},
+		{MaxArrayElements: 2, TruncateArrays: true},
+		{RootKey: "data"},
+		{AlignColumns: true, Delimiter: "|"},
+		{Annotate: true},
+		{KeySort: "none"},
+		{EmptyContainerStyle: "literal", InlineObjects: 2},
+		{Flatten: true},
+	} {
+		encoder, _ := NewTOONEncoderWithOptions(opts)
+		for _, input := range inputs {
+			var data interface{}
+			if opts.KeySort == "none" {
+				data, _ = DecodeOrderedJSON(input)
+			} else {
+				json.Unmarshal([]byte(input), &data)
+			}
+
+			var out strings.Builder
+			calls, lastDone, lastTotal := 0, 0, 0
+			err := encoder.EncodeTo(&out, data, func(done, total int) {
+				calls++
+				lastDone, lastTotal = done, total
+			})
+			if err != nil {
+				t.Fatalf("EncodeTo error: %v", err)
+			}
+
+			if expected := mustEncode(t, encoder, data); out.String() != expected {
+				t.Errorf("EncodeTo mismatch for %s (%+v)\nExpected:\n%s\nGot:\n%s", input, opts, expected, out.String())
+			}
+			if calls == 0 || lastDone != lastTotal {
+				t.Errorf("Expected progress to finish for %s, got %d/%d after %d calls", input, lastDone, lastTotal, calls)
+			}
+		}
+	}
+}
+
+// countingWriter cuenta las escrituras que recibe.
+type countingWriter struct {
+	buf    strings.Builder
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func TestTOONEncoder_EncodeToStreamsNestedArrays(t *testing.T) {
+	rows := make([]interface{}, 100)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": float64(i)}
+	}
+	data := map[string]interface{}{"data": map[string]interface{}{"rows": rows}}
+
+	var out countingWriter
+	if err := NewTOONEncoder().EncodeTo(&out, data, nil); err != nil {
+		t.Fatalf("EncodeTo error: %v", err)
+	}
+	// "data:", el header y una escritura por fila
+	if out.writes != 102 {
+		t.Errorf("Expected 102 writes, got %d", out.writes)
+	}
+	if out.buf.String() != mustEncode(t, NewTOONEncoder(), data) {
+		t.Error("EncodeTo does not match Encode")
+	}
+}
@@ -0,0 +1,317 @@
+package toon
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FixJSON corrige los errores habituales del JSON escrito a mano o pegado
+// (comentarios, comas finales, comillas simples o tipográficas, números mal
+// escritos...) y devuelve el texto corregido con la lista de cambios hechos.
+func FixJSON(input string) (string, []string) {
+	s := strings.TrimSpace(input)
+	var changes []string
+
+	// 0. Quitar el BOM UTF-8 y normalizar comillas tipográficas (texto pegado
+	// desde Word o Google Docs)
+	if strings.HasPrefix(s, "\uFEFF") {
+		s = strings.TrimSpace(strings.TrimPrefix(s, "\uFEFF"))
+		changes = append(changes, "Eliminado BOM UTF-8 al inicio")
+	}
+	s, quoteChanges := normalizeSmartQuotes(s)
+	changes = append(changes, quoteChanges...)
+
+	// 1. Eliminar comentarios (// y /* */) fuera de strings
+	s, commentChanges := stripComments(s)
+	if len(commentChanges) > 0 {
+		changes = append(changes, commentChanges...)
+		s = strings.TrimSpace(s)
+	}
+
+	// 2. Eliminar comas duplicadas
+	re := regexp.MustCompile(`,\s*,+`)
+	s = re.ReplaceAllStringFunc(s, func(match string) string {
+		changes = append(changes, fmt.Sprintf("Eliminada coma duplicada: %s", match))
+		return ","
+	})
+
+	// 3. Eliminar comas antes de llaves/corchetes de cierre
+	s = regexp.MustCompile(`,\s*}`).ReplaceAllStringFunc(s, func(match string) string {
+		changes = append(changes, "Eliminada coma antes de }")
+		return "}"
+	})
+	s = regexp.MustCompile(`,\s*]`).ReplaceAllStringFunc(s, func(match string) string {
+		changes = append(changes, "Eliminada coma antes de ]")
+		return "]"
+	})
+
+	// 4. Agregar comas faltantes entre propiedades (caso: "a":1"b":2)
+	re = regexp.MustCompile(`("|[0-9]|true|false|null|[}\]])(\s*)("[^"]*"\s*:)`)
+	s = replaceAndRecord(s, re, "$1,$2$3", "Agregada coma faltante entre propiedades", &changes)
+
+	// 5. Balancear llaves y corchetes
+	openBraces := strings.Count(s, "{")
+	closeBraces := strings.Count(s, "}")
+	if openBraces > closeBraces {
+		s += strings.Repeat("}", openBraces-closeBraces)
+		changes = append(changes, fmt.Sprintf("Agregadas %d llaves de cierre", openBraces-closeBraces))
+	} else if closeBraces > openBraces {
+		s = strings.Repeat("{", closeBraces-openBraces) + s
+		changes = append(changes, fmt.Sprintf("Agregadas %d llaves de apertura", closeBraces-openBraces))
+	}
+
+	openBrackets := strings.Count(s, "[")
+	closeBrackets := strings.Count(s, "]")
+	if openBrackets > closeBrackets {
+		s += strings.Repeat("]", openBrackets-closeBrackets)
+		changes = append(changes, fmt.Sprintf("Agregados %d corchetes de cierre", openBrackets-closeBrackets))
+	} else if closeBrackets > openBrackets {
+		s = strings.Repeat("[", closeBrackets-openBrackets) + s
+		changes = append(changes, fmt.Sprintf("Agregados %d corchetes de apertura", closeBrackets-openBrackets))
+	}
+
+	// 6. Agregar comillas a claves sin comillas
+	re = regexp.MustCompile(`([{,]\s*)([a-zA-Z_][a-zA-Z0-9_]*)\s*:`)
+	s = replaceAndRecord(s, re, `$1"$2":`, "Agregadas comillas a clave sin comillas", &changes)
+
+	// 7. Corregir comillas simples a dobles en claves
+	re = regexp.MustCompile(`'([^']*)'(\s*:)`)
+	s = replaceAndRecord(s, re, `"$1"$2`, "Convertidas comillas simples a dobles en clave", &changes)
+
+	// 8. Corregir literales al estilo Python (True, False, None)
+	re = regexp.MustCompile(`([:\[,]\s*)(True|False|None)(\s*[,}\]])`)
+	literals := map[string]string{"True": "true", "False": "false", "None": "null"}
+	s = re.ReplaceAllStringFunc(s, func(match string) string {
+		m := re.FindStringSubmatch(match)
+		changes = append(changes, fmt.Sprintf("Corregido valor primitivo: %s → %s", m[2], literals[m[2]]))
+		return m[1] + literals[m[2]] + m[3]
+	})
+
+	// 9. Normalizar números mal formados (.5, 5., 1.2.3)
+	s, numberChanges := fixNumbers(s)
+	changes = append(changes, numberChanges...)
+
+	return s, changes
+}
+
+// replaceAndRecord aplica re expandiendo $1, $2... en repl y registra el
+// cambio una vez por cada coincidencia.
+func replaceAndRecord(s string, re *regexp.Regexp, repl, change string, changes *[]string) string {
+	for range re.FindAllStringIndex(s, -1) {
+		*changes = append(*changes, change)
+	}
+	return re.ReplaceAllString(s, repl)
+}
+
+var validJSONNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// stripComments elimina los comentarios // (hasta fin de línea) y /* */
+// recorriendo el texto, de modo que las mismas secuencias dentro de strings
+// (URLs como "https://...") se conservan. Un /* sin cerrar llega hasta el
+// final.
+func stripComments(s string) (string, []string) {
+	var b strings.Builder
+	var changes []string
+	quote := byte(0) // comilla del string abierto, 0 fuera de strings
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if quote != 0 {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		if c == '"' || c == '\'' {
+			quote = c
+			b.WriteByte(c)
+			continue
+		}
+
+		if c != '/' || i+1 >= len(s) || (s[i+1] != '/' && s[i+1] != '*') {
+			b.WriteByte(c)
+			continue
+		}
+
+		var end int
+		if s[i+1] == '/' {
+			end = strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += i // el salto de línea se conserva
+			}
+		} else {
+			end = strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += i + 4
+			}
+		}
+		changes = append(changes, fmt.Sprintf("Eliminado comentario: %s", strings.TrimSpace(s[i:end])))
+		i = end - 1
+	}
+
+	return b.String(), changes
+}
+
+// normalizeSmartQuotes convierte las comillas tipográficas (“ ” ‘ ’) que
+// delimitan claves y strings en comillas rectas dobles. Las que aparecen
+// dentro de un string, como el apóstrofo de "it’s", se conservan; dentro de
+// un string entre ‘ ’, una ’ seguida de letra también se toma como apóstrofo.
+func normalizeSmartQuotes(s string) (string, []string) {
+	if !strings.ContainsAny(s, "“”‘’") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	var changes []string
+	runes := []rune(s)
+	quote := rune(0) // '"' en strings rectos, '“' o '‘' en tipográficos
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch quote {
+		case '"':
+			b.WriteRune(c)
+			if c == '\\' && i+1 < len(runes) {
+				i++
+				b.WriteRune(runes[i])
+			} else if c == '"' {
+				quote = 0
+			}
+			continue
+		case '“', '‘':
+			closes := c == '”' || c == '“'
+			if quote == '‘' {
+				closes = (c == '’' || c == '‘') && (i+1 >= len(runes) || !unicode.IsLetter(runes[i+1]))
+			}
+			switch {
+			case closes:
+				b.WriteByte('"')
+				quote = 0
+			case c == '"':
+				b.WriteString(`\"`)
+			case c == '\\' && i+1 < len(runes):
+				i++
+				b.WriteRune(c)
+				b.WriteRune(runes[i])
+			default:
+				b.WriteRune(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			quote = c
+			b.WriteRune(c)
+		case '“', '”':
+			quote = '“'
+			b.WriteByte('"')
+			changes = append(changes, "Convertidas comillas tipográficas “ ” a comillas rectas")
+		case '‘', '’':
+			quote = '‘'
+			b.WriteByte('"')
+			changes = append(changes, "Convertidas comillas tipográficas ‘ ’ a comillas rectas")
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	return b.String(), changes
+}
+
+// fixNumbers corrige números inválidos en posición de valor, sin tocar el
+// contenido de los strings ni los números que ya son válidos.
+func fixNumbers(s string) (string, []string) {
+	var b strings.Builder
+	var changes []string
+	inString := false
+	prev := byte(0) // último carácter significativo fuera de strings
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if inString {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			} else if c == '"' {
+				inString = false
+				prev = c
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+			b.WriteByte(c)
+			continue
+		}
+
+		isNumberStart := (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '+'
+		if !isNumberStart || (prev != 0 && prev != ':' && prev != '[' && prev != ',') {
+			b.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				prev = c
+			}
+			continue
+		}
+
+		end := i
+		for end < len(s) && strings.IndexByte("0123456789.+-eE", s[end]) >= 0 {
+			end++
+		}
+		token := s[i:end]
+
+		// Un número seguido de ':' es una clave, no un valor
+		rest := strings.TrimLeft(s[end:], " \t\r\n")
+		if validJSONNumber.MatchString(token) || strings.HasPrefix(rest, ":") {
+			b.WriteString(token)
+		} else {
+			fixed := normalizeNumber(token)
+			changes = append(changes, fmt.Sprintf("Corregido número inválido: %s → %s", token, fixed))
+			b.WriteString(fixed)
+		}
+		prev = token[len(token)-1]
+		i = end - 1
+	}
+
+	return b.String(), changes
+}
+
+// normalizeNumber repara un número inválido si es evidente cómo hacerlo
+// (.5 → 0.5, 5. → 5, +5 → 5); si no, lo conserva como string.
+func normalizeNumber(token string) string {
+	candidate := strings.TrimPrefix(token, "+")
+
+	sign := ""
+	if strings.HasPrefix(candidate, "-") {
+		sign = "-"
+		candidate = candidate[1:]
+	}
+	if strings.HasPrefix(candidate, ".") {
+		candidate = "0" + candidate
+	}
+	candidate = strings.TrimSuffix(candidate, ".")
+	candidate = strings.Replace(candidate, ".e", "e", 1)
+	candidate = strings.Replace(candidate, ".E", "E", 1)
+
+	if validJSONNumber.MatchString(sign + candidate) {
+		return sign + candidate
+	}
+	return strconv.Quote(token)
+}
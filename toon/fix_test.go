@@ -0,0 +1,99 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFixJSON_Numbers(t *testing.T) {
+	input := `{"a": .5, "b": 5., "c": -.25, "d": 1.2.3, "e": +7, "f": [1.5, .1, 2.], "g": "v 1.2.3 .5", "h": 1e5}`
+
+	fixed, changes := FixJSON(input)
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(fixed), &data); err != nil {
+		t.Fatalf("Fixed JSON does not parse: %v\n%s", err, fixed)
+	}
+
+	expected := map[string]interface{}{
+		"a": 0.5,
+		"b": float64(5),
+		"c": -0.25,
+		"d": "1.2.3",
+		"e": float64(7),
+		"f": []interface{}{1.5, 0.1, float64(2)},
+		"g": "v 1.2.3 .5",
+		"h": float64(100000),
+	}
+	for key, want := range expected {
+		got, _ := json.Marshal(data[key])
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("%s: expected %s, got %s", key, wantJSON, got)
+		}
+	}
+
+	if len(changes) != 7 {
+		t.Errorf("Expected 7 recorded changes, got %d: %v", len(changes), changes)
+	}
+}
+
+func TestFixJSON_CommentsKeepURLs(t *testing.T) {
+	input := `{
+		// enlaces
+		"url": "https://example.com/a//b", /* principal */
+		"cdn": "//cdn.example.com/app.js",
+		"note": "no /* comment */ here" // fin
+	}`
+
+	fixed, changes := FixJSON(input)
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(fixed), &data); err != nil {
+		t.Fatalf("Fixed JSON does not parse: %v\n%s", err, fixed)
+	}
+
+	expected := map[string]interface{}{
+		"url":  "https://example.com/a//b",
+		"cdn":  "//cdn.example.com/app.js",
+		"note": "no /* comment */ here",
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+
+	if len(changes) != 3 {
+		t.Errorf("Expected 3 removed comments, got %d: %v", len(changes), changes)
+	}
+
+	// Sin comentarios no hay nada que corregir
+	if fixed, changes := FixJSON(`{"url": "http://x.io"}`); fixed != `{"url": "http://x.io"}` || len(changes) != 0 {
+		t.Errorf("Expected URL to be left untouched, got %s %v", fixed, changes)
+	}
+}
+
+func TestFixJSON_BOMAndSmartQuotes(t *testing.T) {
+	input := "\uFEFF{“name”: “Ana”, ‘city’: ‘L’Hospitalet’, “note”: “it’s a \"test\"”, \"plain\": \"“as is”\"}"
+
+	fixed, changes := FixJSON(input)
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(fixed), &data); err != nil {
+		t.Fatalf("Fixed JSON does not parse: %v\n%s", err, fixed)
+	}
+
+	expected := map[string]interface{}{
+		"name":  "Ana",
+		"city":  "L’Hospitalet",
+		"note":  `it’s a "test"`,
+		"plain": "“as is”",
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+
+	if len(changes) != 7 || changes[0] != "Eliminado BOM UTF-8 al inicio" {
+		t.Errorf("Expected the BOM and 6 quoted strings to be reported, got %v", changes)
+	}
+}
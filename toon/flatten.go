@@ -0,0 +1,227 @@
+package toon
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flattenSeparator devuelve el separador de rutas de opts, o "" si Flatten
+// está desactivado.
+func flattenSeparator(opts TOONOptions) string {
+	if !opts.Flatten {
+		return ""
+	}
+	if opts.FlattenSeparator == "" {
+		return "."
+	}
+	return opts.FlattenSeparator
+}
+
+// flattenValue convierte los objetos y arrays anidados de value en un único
+// objeto cuyas claves son la ruta completa de cada valor, con los índices de
+// los arrays como segmentos: {"a": {"b": 1}, "c": [{"d": 2}]} pasa a
+// {"a.b": 1, "c.0.d": 2}. Las claves vacías son segmentos vacíos ({"": {"a":
+// 1}} pasa a {".a": 1}). Los objetos y arrays vacíos se quedan como valor de
+// su ruta, y también los objetos cuyas claves son exactamente "0".."N-1", que
+// al deshacerlo se leerían como un array; en la raíz, los vacíos y los
+// primitivos no cambian. Se devuelve un *OrderedMap con las claves en orden
+// de recorrido: el de un *OrderedMap de entrada y, en los map, el
+// alfabético, así que con KeySort "none" la salida es siempre la misma.
+// Las claves que contienen sep o una barra invertida se escapan con una
+// barra invertida (ver escapeFlattenSegment): la clave "a.b" es el segmento
+// `a\.b`, que no se confunde con la ruta de {"a": {"b": 1}}.
+//
+// Solo es reversible (ver unflattenValue) si la raíz no es un objeto con
+// claves "0".."N-1".
+func flattenValue(value interface{}, sep string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return value
+		}
+	case *OrderedMap:
+		if len(v.Keys) == 0 {
+			return value
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return value
+		}
+	default:
+		return value
+	}
+
+	flat := &OrderedMap{Values: make(map[string]interface{})}
+	add := func(path string, value interface{}) {
+		if _, exists := flat.Values[path]; !exists {
+			flat.Keys = append(flat.Keys, path)
+		}
+		flat.Values[path] = value
+	}
+
+	var walk func(value interface{}, path string, root bool)
+	walk = func(value interface{}, path string, root bool) {
+		child := func(segment string) string {
+			segment = escapeFlattenSegment(segment, sep)
+			if root {
+				return segment
+			}
+			return path + sep + segment
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			if !root && (len(v) == 0 || looksLikeArray(keys)) {
+				add(path, v)
+				return
+			}
+			for _, key := range keys {
+				walk(v[key], child(key), false)
+			}
+		case *OrderedMap:
+			if !root && (len(v.Keys) == 0 || looksLikeArray(v.Keys)) {
+				add(path, v)
+				return
+			}
+			for _, key := range v.Keys {
+				walk(v.Values[key], child(key), false)
+			}
+		case []interface{}:
+			if !root && len(v) == 0 {
+				add(path, v)
+				return
+			}
+			for i, item := range v {
+				walk(item, child(strconv.Itoa(i)), false)
+			}
+		default:
+			add(path, v)
+		}
+	}
+
+	walk(value, "", true)
+	return flat
+}
+
+// escapeFlattenSegment antepone una barra invertida a cada aparición de sep y de la barra
+// invertida en segment, para que splitFlattenPath no parta la clave.
+func escapeFlattenSegment(segment, sep string) string {
+	if !strings.Contains(segment, sep) && !strings.Contains(segment, `\`) {
+		return segment
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); {
+		switch {
+		case strings.HasPrefix(segment[i:], sep):
+			b.WriteString(`\` + sep)
+			i += len(sep)
+		case segment[i] == '\\':
+			b.WriteString(`\\`)
+			i++
+		default:
+			b.WriteByte(segment[i])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// splitFlattenPath parte path por las apariciones de sep que no van
+// escapadas y deshace escapeFlattenSegment en cada segmento.
+func splitFlattenPath(path, sep string) []string {
+	var segments []string
+	var b strings.Builder
+	for i := 0; i < len(path); {
+		switch {
+		case path[i] == '\\' && strings.HasPrefix(path[i+1:], sep):
+			b.WriteString(sep)
+			i += 1 + len(sep)
+		case path[i] == '\\' && i+1 < len(path):
+			b.WriteByte(path[i+1])
+			i += 2
+		case strings.HasPrefix(path[i:], sep):
+			segments = append(segments, b.String())
+			b.Reset()
+			i += len(sep)
+		default:
+			b.WriteByte(path[i])
+			i++
+		}
+	}
+	return append(segments, b.String())
+}
+
+// looksLikeArray indica si keys son exactamente "0".."N-1", en cualquier
+// orden.
+func looksLikeArray(keys []string) bool {
+	seen := make([]bool, len(keys))
+	for _, key := range keys {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(keys) || seen[i] || key != strconv.Itoa(i) {
+			return false
+		}
+		seen[i] = true
+	}
+	return len(keys) > 0
+}
+
+// flatNode es un objeto reconstruido por unflattenValue a partir de las
+// rutas. Se distingue de los objetos que eran el valor de una ruta, que se
+// devuelven tal cual.
+type flatNode map[string]interface{}
+
+// unflattenValue deshace flattenValue sobre un valor decodificado: parte
+// cada clave del objeto raíz por sep (ver splitFlattenPath) y reconstruye los objetos anidados; los
+// reconstruidos cuyas claves son exactamente "0".."N-1" pasan a ser arrays.
+func unflattenValue(value interface{}, sep string) interface{} {
+	obj, ok := value.(map[string]interface{})
+	if !ok || len(obj) == 0 {
+		return value
+	}
+
+	root := make(flatNode)
+	for path, item := range obj {
+		segments := splitFlattenPath(path, sep)
+		node := root
+		for _, segment := range segments[:len(segments)-1] {
+			next, ok := node[segment].(flatNode)
+			if !ok {
+				next = make(flatNode)
+				node[segment] = next
+			}
+			node = next
+		}
+		node[segments[len(segments)-1]] = item
+	}
+	return restoreArrays(root)
+}
+
+// restoreArrays convierte los flatNode en objetos, o en arrays si sus claves
+// son "0".."N-1". Los demás valores no cambian.
+func restoreArrays(value interface{}) interface{} {
+	node, ok := value.(flatNode)
+	if !ok {
+		return value
+	}
+
+	obj := make(map[string]interface{}, len(node))
+	for key, item := range node {
+		obj[key] = restoreArrays(item)
+	}
+
+	arr := make([]interface{}, len(obj))
+	for i := range arr {
+		item, ok := obj[strconv.Itoa(i)]
+		if !ok {
+			return obj
+		}
+		arr[i] = item
+	}
+	return arr
+}
@@ -0,0 +1,122 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTOONEncoder_Flatten(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		input    string
+		expected string
+	}{
+		{
+			name:     "nested objects",
+			opts:     TOONOptions{Flatten: true},
+			input:    `{"a": {"b": 1, "c": {"d": "x"}}, "e": true}`,
+			expected: "a.b: 1\na.c.d: x\ne: true",
+		},
+		{
+			name:     "arrays use indexed paths",
+			opts:     TOONOptions{Flatten: true},
+			input:    `{"a": [{"b": 1}, {"b": 2}], "tags": ["x", "y"], "empty": [], "none": {}}`,
+			expected: "a.0.b: 1\na.1.b: 2\nempty[0]:\nnone:\ntags.0: x\ntags.1: y",
+		},
+		{
+			name:     "root array and custom separator",
+			opts:     TOONOptions{Flatten: true, FlattenSeparator: "/"},
+			input:    `[{"id": 1}, {"id": 2}]`,
+			expected: "0/id: 1\n1/id: 2",
+		},
+		{
+			name:     "empty keys are empty segments",
+			opts:     TOONOptions{Flatten: true},
+			input:    `{"": {"a": 1}, "b": {"": 2}}`,
+			expected: ".a: 1\nb.: 2",
+		},
+		{
+			name:     "objects with index keys stay nested",
+			opts:     TOONOptions{Flatten: true},
+			input:    `{"m": {"0": "a", "1": "b"}, "n": [{"1": 2, "0": 1}]}`,
+			expected: "m:\n  \"0\": a\n  \"1\": b\nn.0:\n  \"0\": 1\n  \"1\": 2",
+		},
+		{
+			name:     "keys containing the separator are escaped",
+			opts:     TOONOptions{Flatten: true},
+			input:    `{"a.b": 1, "a": {"b": 2, "c\\d": 3}}`,
+			expected: "a.b: 2\na.c\\\\d: 3\na\\.b: 1",
+		},
+		{
+			name:     "multi-character separator",
+			opts:     TOONOptions{Flatten: true, FlattenSeparator: "::"},
+			input:    `{"x:::y": {"z": 1}}`,
+			expected: "\"x\\\\:::y::z\": 1",
+		},
+		{
+			name:     "empty root array",
+			opts:     TOONOptions{Flatten: true},
+			input:    `[]`,
+			expected: "[0]:",
+		},
+		{
+			name:     "root primitive",
+			opts:     TOONOptions{Flatten: true},
+			input:    `"plain"`,
+			expected: "plain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data interface{}
+			json.Unmarshal([]byte(tt.input), &data)
+
+			encoder, _ := NewTOONEncoderWithOptions(tt.opts)
+			result := mustEncode(t, encoder, data)
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+
+			// Un decoder con las mismas opciones devuelve el valor original
+			decoder, _ := NewTOONDecoderWithOptions(tt.opts)
+			decoded, err := decoder.Decode(result)
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Expected %#v after decoding, got %#v", data, decoded)
+			}
+		})
+	}
+}
+
+func TestTOONEncoder_FlattenKeepsOrder(t *testing.T) {
+	data, err := DecodeOrderedJSON(`{"z": {"y": 1, "x": 2}, "a": [3]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{Flatten: true, KeySort: "none"})
+	if result := mustEncode(t, encoder, data); result != "z.y: 1\nz.x: 2\na.0: 3" {
+		t.Errorf("Expected the original key order, got:\n%s", result)
+	}
+
+	// Sin orden conocido (un map) las claves van en orden alfabético, en
+	// cada llamada el mismo
+	var unordered interface{}
+	json.Unmarshal([]byte(`{"z": {"y": 1, "x": 2}, "a": [3], "m": 4}`), &unordered)
+	for i := 0; i < 20; i++ {
+		if result := mustEncode(t, encoder, unordered); result != "a.0: 3\nm: 4\nz.x: 2\nz.y: 1" {
+			t.Fatalf("Expected sorted keys, got:\n%s", result)
+		}
+	}
+}
+
+func TestTOONEncoder_FlattenSeparatorWithBackslash(t *testing.T) {
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{Flatten: true, FlattenSeparator: `\`}); err == nil {
+		t.Error("Expected an error for a separator with a backslash")
+	}
+}
@@ -0,0 +1,82 @@
+package toon
+
+import (
+	"regexp"
+	"strings"
+)
+
+// foldSegmentPattern reconoce las claves que KeyFolding puede unir en una
+// ruta: identificadores sin puntos ni caracteres que necesiten comillas.
+var foldSegmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// foldKey devuelve la clave con la que se escribe key y el valor que va tras
+// ella. Con KeyFolding, las cadenas de objetos de una sola clave se pliegan
+// en una ruta con puntos: {"a": {"b": {"c": 1}}} se escribe "a.b.c: 1".
+// La cadena se corta en la primera clave que no sea un identificador (ver
+// foldSegmentPattern), de modo que la ruta nunca necesita comillas. field es
+// el último segmento, la clave de la que cuelga el valor (para
+// NumericFields).
+func (e *TOONEncoder) foldKey(key string, value interface{}) (encoded, field string, folded interface{}) {
+	if !e.keyFolding || !foldSegmentPattern.MatchString(key) {
+		return e.encodeKey(key), key, value
+	}
+
+	path := []string{key}
+	for {
+		obj, ok := AsObject(value)
+		if !ok || len(obj) != 1 {
+			break
+		}
+		var next string
+		for k := range obj {
+			next = k
+		}
+		if !foldSegmentPattern.MatchString(next) {
+			break
+		}
+		path = append(path, next)
+		value = obj[next]
+	}
+	return strings.Join(path, "."), path[len(path)-1], value
+}
+
+// setField guarda value en obj bajo key. Con KeyFolding, una clave sin
+// comillas con puntos es una ruta plegada por el encoder y se despliega en
+// objetos anidados, fusionándose con los que ya estén: "a.b: 1" y "a.c: 2"
+// dan {"a": {"b": 1, "c": 2}}.
+func (p *toonParser) setField(obj map[string]interface{}, key string, quoted bool, value interface{}) {
+	if !p.decoder.keyFolding {
+		obj[key] = value
+		return
+	}
+	if quoted || !strings.Contains(key, ".") {
+		mergeField(obj, key, value)
+		return
+	}
+
+	segments := strings.Split(key, ".")
+	node := obj
+	for _, segment := range segments[:len(segments)-1] {
+		next, ok := node[segment].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			node[segment] = next
+		}
+		node = next
+	}
+	mergeField(node, segments[len(segments)-1], value)
+}
+
+// mergeField guarda value en obj[key]; si los dos son objetos se fusionan,
+// para que una ruta plegada no borre lo que otra ya creó.
+func mergeField(obj map[string]interface{}, key string, value interface{}) {
+	existing, ok := obj[key].(map[string]interface{})
+	incoming, isObject := value.(map[string]interface{})
+	if !ok || !isObject {
+		obj[key] = value
+		return
+	}
+	for k, v := range incoming {
+		mergeField(existing, k, v)
+	}
+}
@@ -0,0 +1,88 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOONEncoder_KeyFolding(t *testing.T) {
+	input := `{
+		"config": {"server": {"http": {"port": 8080}}},
+		"meta": {"owner": {"name": "Ana", "team": "core"}},
+		"a.b": 1,
+		"x": {"my-key": {"y": 1}},
+		"tags": {"list": ["a", "b"]},
+		"empty": {"inner": {}},
+		"items": [{"spec": {"size": {"w": 1}}, "id": 1}, {"id": 2}]
+	}`
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+
+	opts := TOONOptions{KeyFolding: true}
+	encoder, err := NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := mustEncode(t, encoder, data)
+
+	// "my-key" no es un identificador: la cadena se corta antes. La clave
+	// con punto va entre comillas para no leerse como ruta
+	expected := "\"a.b\": 1\n" +
+		"config.server.http.port: 8080\n" +
+		"empty.inner:\n" +
+		"items[2]:\n" +
+		"    - id: 1\n" +
+		"      spec.size.w: 1\n" +
+		"    - id: 2\n" +
+		"meta.owner:\n" +
+		"  name: Ana\n" +
+		"  team: core\n" +
+		"tags.list[2]: a,b\n" +
+		"x:\n" +
+		"  my-key:\n" +
+		"    y: 1"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	var streamed strings.Builder
+	if err := encoder.EncodeTo(&streamed, data, nil); err != nil || streamed.String() != result {
+		t.Errorf("EncodeTo differs from Encode:\n%s", streamed.String())
+	}
+
+	decoder, _ := NewTOONDecoderWithOptions(opts)
+	decoded, err := decoder.Decode(result)
+	if err != nil {
+		t.Fatalf("Decode error: %v\n%s", err, result)
+	}
+	if !reflect.DeepEqual(decoded, data) {
+		t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %#v", result, decoded)
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{KeyFolding: true, Flatten: true}); err == nil {
+		t.Error("Expected error for keyFolding with flatten")
+	}
+}
+
+func TestTOONDecoder_KeyFoldingMerge(t *testing.T) {
+	decoder, _ := NewTOONDecoderWithOptions(TOONOptions{KeyFolding: true})
+	decoded, err := decoder.Decode("a.b: 1\na.c.d: 2\na:\n  e: 3\n\"x.y\": 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"a":   map[string]interface{}{"b": 1.0, "c": map[string]interface{}{"d": 2.0}, "e": 3.0},
+		"x.y": 4.0,
+	}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, decoded)
+	}
+
+	// Sin KeyFolding las claves con puntos no se tocan
+	decoded, _ = NewTOONDecoder().Decode("a.b: 1")
+	if !reflect.DeepEqual(decoded, map[string]interface{}{"a.b": 1.0}) {
+		t.Errorf("Unexpected expansion without KeyFolding: %#v", decoded)
+	}
+}
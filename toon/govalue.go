@@ -0,0 +1,394 @@
+package toon
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// normalizeValue convierte al modelo de encoding/json los valores Go que
+// Encode recibe de código que no decodificó JSON: mapas con claves no string
+// (map[int]..., map[float64]...), slices y mapas tipados ([]int,
+// map[string]int...), números que no son float64 y structs (ver
+// structFields). Los enteros pasan a json.Number para no perder precisión,
+// los float32 se escriben con sus cifras de float32 (0.1, no
+// 0.10000000149011612) y los []byte en base64, como en encoding/json.
+//
+// Las claves no string se convierten en texto (10, 2.5, true) y el mapa en
+// un *OrderedMap con las claves ordenadas por su valor: numéricamente si son
+// números, de modo que 10 va después de 2, sea cual sea KeySort. Como
+// cualquier clave que parezca un número, se escriben entre comillas.
+//
+// Los valores que ya son JSON se devuelven sin copiar. Devuelve un error si
+// value se contiene a sí mismo (un puntero, mapa o slice que lleva de vuelta
+// a un valor por el que ya se ha pasado).
+func normalizeValue(value interface{}) (interface{}, error) {
+	var n normalizer
+	normalized, _, err := n.normalize(value)
+	return normalized, err
+}
+
+// startDetectingCyclesAfter es la profundidad a partir de la cual normalizer
+// anota los contenedores por los que pasa, como en encoding/json: hasta ahí
+// no cuesta nada y un ciclo la alcanza siempre.
+const startDetectingCyclesAfter = 1000
+
+// normalizer lleva el estado de normalizeValue: la profundidad y, a partir
+// de startDetectingCyclesAfter, los contenedores de la ruta actual.
+type normalizer struct {
+	depth int
+	seen  map[visit]struct{}
+}
+
+// visit identifica un contenedor: su puntero y, en los slices, su longitud.
+type visit struct {
+	ptr uintptr
+	len int
+}
+
+// enter baja a rv, un puntero, mapa o slice; falla si ya estaba en la ruta.
+// Cada enter sin error va seguido de un leave.
+func (n *normalizer) enter(rv reflect.Value) error {
+	n.depth++
+	if n.depth <= startDetectingCyclesAfter {
+		return nil
+	}
+	key := containerVisit(rv)
+	if _, ok := n.seen[key]; ok {
+		n.depth--
+		return fmt.Errorf("ciclo en un valor de tipo %s", rv.Type())
+	}
+	if n.seen == nil {
+		n.seen = make(map[visit]struct{})
+	}
+	n.seen[key] = struct{}{}
+	return nil
+}
+
+func (n *normalizer) leave(rv reflect.Value) {
+	if n.depth > startDetectingCyclesAfter {
+		delete(n.seen, containerVisit(rv))
+	}
+	n.depth--
+}
+
+func containerVisit(rv reflect.Value) visit {
+	if rv.Kind() == reflect.Slice {
+		return visit{rv.Pointer(), rv.Len()}
+	}
+	return visit{ptr: rv.Pointer()}
+}
+
+// normalize hace el trabajo de normalizeValue e indica si cambió algo, para
+// copiar solo los contenedores que lo necesitan.
+func (n *normalizer) normalize(value interface{}) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case nil, bool, float64, string, json.Number:
+		return value, false, nil
+	case map[string]interface{}:
+		rv := reflect.ValueOf(v)
+		if err := n.enter(rv); err != nil {
+			return nil, false, err
+		}
+		defer n.leave(rv)
+		var copied map[string]interface{}
+		for key, item := range v {
+			normalized, changed, err := n.normalize(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed && copied == nil {
+				copied = make(map[string]interface{}, len(v))
+				for k, i := range v {
+					copied[k] = i
+				}
+			}
+			if copied != nil {
+				copied[key] = normalized
+			}
+		}
+		if copied == nil {
+			return v, false, nil
+		}
+		return copied, true, nil
+	case *OrderedMap:
+		values, changed, err := n.normalize(v.Values)
+		if err != nil || !changed {
+			return v, false, err
+		}
+		return &OrderedMap{Keys: v.Keys, Values: values.(map[string]interface{}), fixedOrder: v.fixedOrder}, true, nil
+	case []interface{}:
+		rv := reflect.ValueOf(v)
+		if err := n.enter(rv); err != nil {
+			return nil, false, err
+		}
+		defer n.leave(rv)
+		var copied []interface{}
+		for i, item := range v {
+			normalized, changed, err := n.normalize(item)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed && copied == nil {
+				copied = append([]interface{}(nil), v...)
+			}
+			if copied != nil {
+				copied[i] = normalized
+			}
+		}
+		if copied == nil {
+			return v, false, nil
+		}
+		return copied, true, nil
+	}
+	switch v := value.(type) {
+	case Marshaler:
+		normalized, err := normalizeTOON(v)
+		return normalized, true, err
+	case json.Marshaler, encoding.TextMarshaler:
+		return normalizeJSON(value), true, nil
+	}
+	normalized, err := n.normalizeReflect(reflect.ValueOf(value))
+	return normalized, true, err
+}
+
+// normalizeTOON decodifica lo que devuelve MarshalTOON para insertarlo como
+// cualquier otro valor, así que se le aplican las opciones del encoder
+// (delimitador, indentación...) allí donde aparezca. Un puntero nil es null,
+// como en encoding/json. Si MarshalTOON falla o su salida no es TOON válido
+// devuelve un error, que envuelve el de MarshalTOON.
+func normalizeTOON(m Marshaler) (interface{}, error) {
+	if rv := reflect.ValueOf(m); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil, nil
+	}
+	data, err := m.MarshalTOON()
+	if err != nil {
+		return nil, fmt.Errorf("MarshalTOON de %T: %w", m, err)
+	}
+	value, err := NewTOONDecoder().Decode(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("MarshalTOON de %T devolvió TOON inválido: %v", m, err)
+	}
+	return value, nil
+}
+
+// normalizeJSON pasa por encoding/json los tipos con MarshalJSON o
+// MarshalText, para respetar su formato (time.Time como string RFC 3339...).
+// Si json.Marshal falla, el valor se escribe con fmt, como los demás valores
+// que JSON no admite.
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	normalized, err := DecodeOrderedValue(dec)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return normalized
+}
+
+func (n *normalizer) normalizeReflect(rv reflect.Value) (interface{}, error) {
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if rv.Kind() == reflect.Ptr {
+			if err := n.enter(rv); err != nil {
+				return nil, err
+			}
+			defer n.leave(rv)
+		}
+		return n.normalizeElem(rv.Elem())
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return json.Number(strconv.FormatInt(rv.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return json.Number(strconv.FormatUint(rv.Uint(), 10)), nil
+	case reflect.Float32:
+		return float32Value(rv.Float()), nil
+	case reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice {
+			if rv.IsNil() {
+				return nil, nil
+			}
+			if rv.Type().Elem().Kind() == reflect.Uint8 {
+				return base64.StdEncoding.EncodeToString(rv.Bytes()), nil
+			}
+			if err := n.enter(rv); err != nil {
+				return nil, err
+			}
+			defer n.leave(rv)
+		}
+		arr := make([]interface{}, rv.Len())
+		for i := range arr {
+			item, err := n.normalizeElem(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = item
+		}
+		return arr, nil
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		if err := n.enter(rv); err != nil {
+			return nil, err
+		}
+		defer n.leave(rv)
+		return n.normalizeMap(rv)
+	case reflect.Struct:
+		return n.normalizeStruct(rv)
+	}
+	if !rv.CanInterface() {
+		return nil, nil
+	}
+	return fmt.Sprintf("%v", rv.Interface()), nil
+}
+
+// float32Value devuelve el float64 con las cifras con las que se escribe el
+// float32 f: 0.1 y no 0.10000000149011612.
+func float32Value(f float64) float64 {
+	f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+	return f
+}
+
+// normalizeElem normaliza un valor alcanzado por reflexión (elemento, campo).
+// Los que no admiten Interface() se convierten sin pasar por normalize.
+func (n *normalizer) normalizeElem(rv reflect.Value) (interface{}, error) {
+	if rv.CanInterface() {
+		normalized, _, err := n.normalize(rv.Interface())
+		return normalized, err
+	}
+	return n.normalizeReflect(rv)
+}
+
+// normalizeMap convierte un mapa de cualquier tipo en un *OrderedMap con las
+// claves ordenadas por su valor (ver mapKeyLess).
+func (n *normalizer) normalizeMap(rv reflect.Value) (*OrderedMap, error) {
+	mapKeys := rv.MapKeys()
+	sort.Slice(mapKeys, func(i, j int) bool {
+		return mapKeyLess(mapKeys[i], mapKeys[j])
+	})
+
+	obj := &OrderedMap{Values: make(map[string]interface{}, len(mapKeys)), fixedOrder: true}
+	for _, key := range mapKeys {
+		name := mapKeyString(key)
+		// Claves distintas con el mismo texto (1.0 y 1 en un
+		// map[interface{}]): gana la última, como con claves duplicadas
+		if _, exists := obj.Values[name]; !exists {
+			obj.Keys = append(obj.Keys, name)
+		}
+		value, err := n.normalizeElem(rv.MapIndex(key))
+		if err != nil {
+			return nil, err
+		}
+		obj.Values[name] = value
+	}
+	return obj, nil
+}
+
+// mapKeyString convierte una clave de mapa en la clave del objeto TOON.
+func mapKeyString(key reflect.Value) string {
+	switch key.Kind() {
+	case reflect.Interface:
+		if key.IsNil() {
+			return "null"
+		}
+		return mapKeyString(key.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := key.Float()
+		if f == 0 {
+			return "0"
+		}
+		return strconv.FormatFloat(f, 'f', -1, key.Type().Bits())
+	case reflect.Bool:
+		return strconv.FormatBool(key.Bool())
+	case reflect.String:
+		return key.String()
+	}
+	return fmt.Sprintf("%v", key.Interface())
+}
+
+// mapKeyLess ordena las claves numéricas por su valor y antes que el resto,
+// que se ordena por su texto.
+func mapKeyLess(a, b reflect.Value) bool {
+	a, b = mapKeyElem(a), mapKeyElem(b)
+	// Enteros del mismo signo sin pasar por float64 (más de 53 bits)
+	if isIntKind(a.Kind()) && isIntKind(b.Kind()) && a.Int() != b.Int() {
+		return a.Int() < b.Int()
+	}
+	if isUintKind(a.Kind()) && isUintKind(b.Kind()) && a.Uint() != b.Uint() {
+		return a.Uint() < b.Uint()
+	}
+
+	an, aNumeric := mapKeyNumber(a)
+	bn, bNumeric := mapKeyNumber(b)
+	switch {
+	case aNumeric && bNumeric:
+		if an != bn {
+			return an < bn
+		}
+	case aNumeric != bNumeric:
+		return aNumeric
+	}
+	return mapKeyString(a) < mapKeyString(b)
+}
+
+// mapKeyElem devuelve el valor concreto de una clave de un
+// map[interface{}]...
+func mapKeyElem(key reflect.Value) reflect.Value {
+	if key.Kind() == reflect.Interface && !key.IsNil() {
+		return key.Elem()
+	}
+	return key
+}
+
+func mapKeyNumber(key reflect.Value) (float64, bool) {
+	switch key.Kind() {
+	case reflect.Interface:
+		if key.IsNil() {
+			return 0, false
+		}
+		return mapKeyNumber(key.Elem())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(key.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(key.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		if math.IsNaN(key.Float()) {
+			return 0, false
+		}
+		return key.Float(), true
+	}
+	return 0, false
+}
+
+func isIntKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUintKind(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
@@ -0,0 +1,133 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTOONEncoder_NonStringMapKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+	}{
+		{
+			name:     "int keys sort numerically",
+			input:    map[int]string{10: "ten", 2: "two", -1: "minus one"},
+			expected: "\"-1\": minus one\n\"2\": two\n\"10\": ten",
+		},
+		{
+			name:     "float keys",
+			input:    map[float64]bool{2.5: true, 10: false, 0.25: true},
+			expected: "\"0.25\": true\n\"2.5\": true\n\"10\": false",
+		},
+		{
+			name:     "nested under string keys",
+			input:    map[string]interface{}{"scores": map[int64]int{100: 1, 20: 2}},
+			expected: "scores:\n  \"20\": 2\n  \"100\": 1",
+		},
+		{
+			name:     "int64 beyond float precision",
+			input:    map[int64]int{9007199254740993: 1, 9007199254740992: 2},
+			expected: "\"9007199254740992\": 2\n\"9007199254740993\": 1",
+		},
+		{
+			name:     "mixed keys: numbers first",
+			input:    map[interface{}]int{"b": 1, 3: 2, "a": 3, 1.5: 4},
+			expected: "\"1.5\": 4\n\"3\": 2\na: 3\nb: 1",
+		},
+		{
+			name:     "typed slices and maps",
+			input:    map[string][]int{"ids": {3, 1, 2}},
+			expected: "ids[3]: 3,1,2",
+		},
+	}
+
+	// El orden numérico se mantiene con cualquier KeySort
+	for _, keySort := range []string{"", "asc-ci", "none"} {
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{KeySort: keySort})
+		for _, tt := range tests {
+			if result := mustEncode(t, encoder, tt.input); result != tt.expected {
+				t.Errorf("%s (keySort %q): expected:\n%s\ngot:\n%s", tt.name, keySort, tt.expected, result)
+			}
+		}
+	}
+}
+
+func TestTOONEncoder_NonStringMapKeysTabular(t *testing.T) {
+	rows := []map[int]string{
+		{1: "a", 10: "b", 2: "c"},
+		{1: "d", 10: "e", 2: "f"},
+	}
+
+	result := mustEncode(t, NewTOONEncoder(), rows)
+	expected := "[2]{\"1\",\"2\",\"10\"}:\n  a,c,b\n  d,f,e"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestNormalizeValue_KeepsJSONValues(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{"a": [1, "x", {"b": null}]}`), &data)
+
+	if normalized, _ := normalizeValue(data); reflect.ValueOf(normalized).Pointer() != reflect.ValueOf(data).Pointer() {
+		t.Error("Expected a JSON value to be returned without copying")
+	}
+
+	// Solo se copia lo que cambia; el original no se modifica
+	mixed := map[string]interface{}{"ids": []int{1, 2}, "name": "x"}
+	value, _ := normalizeValue(mixed)
+	normalized := value.(map[string]interface{})
+	if _, ok := mixed["ids"].([]int); !ok {
+		t.Error("Expected the input map to stay untouched")
+	}
+	if !reflect.DeepEqual(normalized["ids"], []interface{}{json.Number("1"), json.Number("2")}) {
+		t.Errorf("Unexpected normalized slice: %#v", normalized["ids"])
+	}
+}
+
+func TestMarshal_ReflectValues(t *testing.T) {
+	type payload struct {
+		Data  []byte             `json:"data"`
+		Ratio float32            `json:"ratio"`
+		Keys  map[float32]string `json:"keys"`
+	}
+	data, err := Marshal(payload{Data: []byte("hi"), Ratio: 0.1, Keys: map[float32]string{0.1: "x"}})
+	expected := "data: aGk=\nkeys:\n  \"0.1\": x\nratio: 0.1"
+	if err != nil || string(data) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s (%v)", expected, data, err)
+	}
+}
+
+func TestMarshal_Cycles(t *testing.T) {
+	type node struct {
+		Name string `json:"name"`
+		Next *node  `json:"next"`
+	}
+	list := &node{Name: "a", Next: &node{Name: "b"}}
+	list.Next.Next = list
+
+	self := map[string]interface{}{"a": 1}
+	self["self"] = self
+
+	nested := []interface{}{nil}
+	nested[0] = nested
+
+	for name, value := range map[string]interface{}{"pointer": list, "map": self, "slice": nested} {
+		if _, err := Marshal(value); err == nil || !strings.Contains(err.Error(), "ciclo") {
+			t.Errorf("%s: expected a cycle error from Marshal, got %v", name, err)
+		}
+		if _, err := NewTOONEncoder().Encode(value); err == nil {
+			t.Errorf("%s: expected a cycle error from Encode", name)
+		}
+	}
+
+	// Un valor compartido sin ciclo no es un error
+	shared := &node{Name: "x"}
+	if _, err := Marshal([]*node{shared, shared}); err != nil {
+		t.Errorf("Unexpected error for a shared pointer: %v", err)
+	}
+}
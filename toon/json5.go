@@ -0,0 +1,538 @@
+package toon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxJSON5Depth limita el anidamiento que acepta DecodeJSON5, como el límite
+// interno de encoding/json.
+const maxJSON5Depth = 10000
+
+// DecodeJSON5 decodifica JSON5, que incluye JSONC (JSON con comentarios):
+// comentarios // y /* */, comas finales, claves sin comillas, strings con
+// comillas simples o con saltos de línea escapados, números hexadecimales,
+// con signo + o con punto inicial o final (.5, 5.), e Infinity y NaN. A
+// diferencia de FixJSON no reescribe el texto: lo lee con la gramática de
+// JSON5, así que no toca el contenido de los strings ni adivina lo que no es
+// JSON5.
+//
+// Los valores tienen los tipos de DecodeJSON: números como json.Number (los
+// hexadecimales en decimal, con todas sus cifras), Infinity y NaN como null,
+// y con ordered los objetos como *OrderedMap. Si una clave se repite gana el
+// último valor (FindDuplicateKeysJSON5 las encuentra). Devuelve también las extensiones de JSON5 que ha encontrado,
+// en el orden en que aparecen ("comentarios", "comas finales"...), vacío si
+// input era JSON estándar.
+func DecodeJSON5(input string, ordered bool) (interface{}, []string, error) {
+	p := &json5Parser{s: input, ordered: ordered}
+	value, err := p.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, p.features, nil
+}
+
+// FindDuplicateKeysJSON5 es FindDuplicateKeys para JSON5: devuelve la ruta
+// de cada clave repetida dentro de un mismo objeto (p. ej. "users[1].id").
+func FindDuplicateKeysJSON5(input string) ([]string, error) {
+	p := &json5Parser{s: input, findDuplicates: true}
+	if _, err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.duplicates, nil
+}
+
+// json5Parser lee un valor JSON5 de s a partir de pos.
+type json5Parser struct {
+	s        string
+	pos      int
+	ordered  bool
+	features []string
+
+	// Con findDuplicates se anotan en duplicates las rutas de las claves
+	// repetidas
+	findDuplicates bool
+	duplicates     []string
+}
+
+// parse lee s entero, un único valor.
+func (p *json5Parser) parse() (interface{}, error) {
+	value, err := p.value(0, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.s) {
+		return nil, p.errorf("contenido inesperado después del valor")
+	}
+	return value, nil
+}
+
+// use anota una extensión de JSON5 la primera vez que aparece.
+func (p *json5Parser) use(feature string) {
+	for _, f := range p.features {
+		if f == feature {
+			return
+		}
+	}
+	p.features = append(p.features, feature)
+}
+
+// errorf devuelve un error con la línea y la columna de pos.
+func (p *json5Parser) errorf(format string, args ...interface{}) error {
+	before := p.s[:p.pos]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return fmt.Errorf("línea %d, columna %d: %s", line, column, fmt.Sprintf(format, args...))
+}
+
+func (p *json5Parser) peek() (rune, int) {
+	if p.pos >= len(p.s) {
+		return -1, 0
+	}
+	return utf8.DecodeRuneInString(p.s[p.pos:])
+}
+
+// skip salta los espacios (los de JSON5 incluyen el BOM, U+00A0 y los
+// separadores Unicode) y los comentarios.
+func (p *json5Parser) skip() error {
+	for p.pos < len(p.s) {
+		r, size := p.peek()
+		switch {
+		case r == '\t' || r == '\n' || r == '\v' || r == '\f' || r == '\r' || r == '\uFEFF' || r == '\u2028' || r == '\u2029' || unicode.Is(unicode.Zs, r):
+			p.pos += size
+		case strings.HasPrefix(p.s[p.pos:], "//"):
+			p.use("comentarios")
+			if end := strings.IndexAny(p.s[p.pos:], "\n\r"); end >= 0 {
+				p.pos += end
+			} else {
+				p.pos = len(p.s)
+			}
+		case strings.HasPrefix(p.s[p.pos:], "/*"):
+			p.use("comentarios")
+			end := strings.Index(p.s[p.pos+2:], "*/")
+			if end < 0 {
+				return p.errorf("comentario sin cerrar")
+			}
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// value lee un valor; path es su ruta ("users[1].id", "" en la raíz), que
+// solo se construye con findDuplicates.
+func (p *json5Parser) value(depth int, path string) (interface{}, error) {
+	if depth > maxJSON5Depth {
+		return nil, p.errorf("anidamiento de más de %d niveles", maxJSON5Depth)
+	}
+	if err := p.skip(); err != nil {
+		return nil, err
+	}
+
+	r, _ := p.peek()
+	switch {
+	case r == -1:
+		return nil, p.errorf("fin inesperado del texto")
+	case r == '{':
+		return p.object(depth, path)
+	case r == '[':
+		return p.array(depth, path)
+	case r == '"' || r == '\'':
+		return p.str()
+	case r == '-' || r == '+' || r == '.' || r >= '0' && r <= '9':
+		return p.number()
+	case isJSON5IdentifierStart(r):
+		start := p.pos
+		switch word := p.identifier(); word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "Infinity", "NaN":
+			p.use("Infinity y NaN")
+			return nil, nil
+		default:
+			p.pos = start
+			return nil, p.errorf("valor desconocido: %s", word)
+		}
+	}
+	return nil, p.errorf("carácter inesperado %q", r)
+}
+
+func (p *json5Parser) object(depth int, path string) (interface{}, error) {
+	p.pos++ // {
+	values := make(map[string]interface{})
+	var keys []string
+	seenTwice := make(map[string]bool)
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		r, _ := p.peek()
+		if r == '}' {
+			p.pos++
+			break
+		}
+
+		var key string
+		switch {
+		case r == '"' || r == '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s.(string)
+		case isJSON5IdentifierStart(r):
+			p.use("claves sin comillas")
+			key = p.identifier()
+		default:
+			return nil, p.errorf("se esperaba una clave o '}'")
+		}
+
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if r, _ := p.peek(); r != ':' {
+			return nil, p.errorf("se esperaba ':' después de la clave %q", key)
+		}
+		p.pos++
+		keyPath := key
+		if p.findDuplicates && path != "" {
+			keyPath = path + "." + key
+		}
+		value, err := p.value(depth+1, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, seen := values[key]; !seen {
+			keys = append(keys, key)
+		} else if p.findDuplicates && !seenTwice[key] {
+			seenTwice[key] = true
+			p.duplicates = append(p.duplicates, keyPath)
+		}
+		values[key] = value
+
+		done, err := p.separator('}')
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+
+	if p.ordered {
+		return &OrderedMap{Keys: keys, Values: values}, nil
+	}
+	return values, nil
+}
+
+func (p *json5Parser) array(depth int, path string) (interface{}, error) {
+	p.pos++ // [
+	arr := []interface{}{}
+	for {
+		if err := p.skip(); err != nil {
+			return nil, err
+		}
+		if r, _ := p.peek(); r == ']' {
+			p.pos++
+			return arr, nil
+		}
+		var itemPath string
+		if p.findDuplicates {
+			itemPath = fmt.Sprintf("%s[%d]", path, len(arr))
+		}
+		value, err := p.value(depth+1, itemPath)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, value)
+
+		if done, err := p.separator(']'); err != nil || done {
+			return arr, err
+		}
+	}
+}
+
+// separator lee lo que sigue a un elemento: una coma, que puede ser la
+// última antes de closing, o closing. Devuelve true si ha leído el cierre.
+func (p *json5Parser) separator(closing rune) (bool, error) {
+	if err := p.skip(); err != nil {
+		return false, err
+	}
+	switch r, _ := p.peek(); r {
+	case closing:
+		p.pos++
+		return true, nil
+	case ',':
+		p.pos++
+		if err := p.skip(); err != nil {
+			return false, err
+		}
+		if r, _ := p.peek(); r == closing {
+			p.use("comas finales")
+			p.pos++
+			return true, nil
+		}
+		return false, nil
+	}
+	return false, p.errorf("se esperaba ',' o '%c'", closing)
+}
+
+// identifier lee un nombre de identificador de ECMAScript.
+func (p *json5Parser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		r, size := p.peek()
+		if !isJSON5IdentifierStart(r) && !unicode.In(r, unicode.Nd, unicode.Mn, unicode.Mc, unicode.Pc) && r != '\u200C' && r != '\u200D' {
+			break
+		}
+		p.pos += size
+	}
+	return p.s[start:p.pos]
+}
+
+func isJSON5IdentifierStart(r rune) bool {
+	return r == '$' || r == '_' || unicode.IsLetter(r) || unicode.Is(unicode.Nl, r)
+}
+
+// str lee un string entre comillas dobles o simples.
+func (p *json5Parser) str() (interface{}, error) {
+	quote := p.s[p.pos]
+	if quote == '\'' {
+		p.use("strings con comillas simples")
+	}
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("string sin cerrar")
+		}
+		r, size := p.peek()
+		switch {
+		case r == rune(quote):
+			p.pos++
+			return b.String(), nil
+		case r == '\n' || r == '\r':
+			return nil, p.errorf("salto de línea sin escapar en un string")
+		case r == '\\':
+			p.pos++
+			if err := p.escape(&b); err != nil {
+				return nil, err
+			}
+		default:
+			b.WriteString(p.s[p.pos : p.pos+size])
+			p.pos += size
+		}
+	}
+}
+
+// escape lee la secuencia que sigue a una barra invertida. JSON5 admite
+// además de las de JSON \v, \0, \xHH, los saltos de línea escapados (el
+// string continúa en la línea siguiente) y cualquier otro carácter escapado,
+// que se representa a sí mismo.
+func (p *json5Parser) escape(b *strings.Builder) error {
+	r, size := p.peek()
+	if r == -1 {
+		return p.errorf("string sin cerrar")
+	}
+	p.pos += size
+
+	switch r {
+	case '"', '\\', '/':
+		b.WriteRune(r)
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'u':
+		code, err := p.hex(4)
+		if err != nil {
+			return err
+		}
+		c := rune(code)
+		if utf16.IsSurrogate(c) && strings.HasPrefix(p.s[p.pos:], "\\u") {
+			start := p.pos
+			p.pos += 2
+			low, err := p.hex(4)
+			if err != nil {
+				return err
+			}
+			if pair := utf16.DecodeRune(c, rune(low)); pair != utf8.RuneError {
+				c = pair
+			} else {
+				p.pos = start
+			}
+		}
+		b.WriteRune(c)
+	case '\n', '\r', '\u2028', '\u2029':
+		p.use("strings multilínea")
+		if r == '\r' && strings.HasPrefix(p.s[p.pos:], "\n") {
+			p.pos++
+		}
+	default:
+		p.use("escapes de JSON5")
+		switch r {
+		case 'v':
+			b.WriteByte('\v')
+		case '0':
+			if next, _ := p.peek(); next >= '0' && next <= '9' {
+				return p.errorf("escape octal no admitido")
+			}
+			b.WriteByte(0)
+		case 'x':
+			code, err := p.hex(2)
+			if err != nil {
+				return err
+			}
+			b.WriteRune(rune(code))
+		default:
+			if r >= '1' && r <= '9' {
+				return p.errorf("escape octal no admitido")
+			}
+			b.WriteRune(r)
+		}
+	}
+	return nil
+}
+
+// hex lee n dígitos hexadecimales.
+func (p *json5Parser) hex(n int) (int, error) {
+	if p.pos+n > len(p.s) {
+		return 0, p.errorf("escape incompleto")
+	}
+	code := 0
+	for _, c := range []byte(p.s[p.pos : p.pos+n]) {
+		var digit byte
+		switch {
+		case c >= '0' && c <= '9':
+			digit = c - '0'
+		case c >= 'a' && c <= 'f':
+			digit = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			digit = c - 'A' + 10
+		default:
+			return 0, p.errorf("dígito hexadecimal no válido %q", c)
+		}
+		code = code<<4 | int(digit)
+	}
+	p.pos += n
+	return code, nil
+}
+
+// number lee un número y lo devuelve como json.Number en la sintaxis de JSON
+// (".5" pasa a "0.5", "0x1F" a "31", "+1" a "1").
+func (p *json5Parser) number() (interface{}, error) {
+	start := p.pos
+	sign := ""
+	switch p.s[p.pos] {
+	case '+':
+		p.use("números con signo +")
+		p.pos++
+	case '-':
+		sign = "-"
+		p.pos++
+	}
+
+	rest := p.s[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "Infinity"), strings.HasPrefix(rest, "NaN"):
+		p.use("Infinity y NaN")
+		p.identifier()
+		return nil, nil
+	case strings.HasPrefix(rest, "0x"), strings.HasPrefix(rest, "0X"):
+		p.use("números hexadecimales")
+		p.pos += 2
+		digits := p.scan(func(c byte) bool {
+			return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+		})
+		n, ok := new(big.Int).SetString(digits, 16)
+		if !ok {
+			p.pos = start
+			return nil, p.errorf("número hexadecimal no válido")
+		}
+		if n.Sign() == 0 {
+			sign = ""
+		}
+		return p.endNumber(json.Number(sign + n.String()))
+	}
+
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	integer := p.scan(isDigit)
+	if len(integer) > 1 && integer[0] == '0' {
+		p.pos = start
+		return nil, p.errorf("número con ceros a la izquierda")
+	}
+	var fraction string
+	hasPoint := p.pos < len(p.s) && p.s[p.pos] == '.'
+	if hasPoint {
+		p.pos++
+		fraction = p.scan(isDigit)
+	}
+	if integer == "" && fraction == "" {
+		p.pos = start
+		return nil, p.errorf("número no válido")
+	}
+	if hasPoint && (integer == "" || fraction == "") {
+		p.use("números con punto inicial o final")
+	}
+
+	number := sign
+	if integer == "" {
+		integer = "0"
+	}
+	number += integer
+	if fraction != "" {
+		number += "." + fraction
+	}
+	if p.pos < len(p.s) && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E') {
+		expStart := p.pos
+		p.pos++
+		if p.pos < len(p.s) && (p.s[p.pos] == '+' || p.s[p.pos] == '-') {
+			p.pos++
+		}
+		if p.scan(isDigit) == "" {
+			p.pos = expStart
+			return nil, p.errorf("exponente no válido")
+		}
+		number += p.s[expStart:p.pos]
+	}
+	return p.endNumber(json.Number(number))
+}
+
+// endNumber comprueba que el número no siga pegado a un identificador
+// ("12abc").
+func (p *json5Parser) endNumber(n json.Number) (interface{}, error) {
+	if r, _ := p.peek(); isJSON5IdentifierStart(r) || r >= '0' && r <= '9' {
+		return nil, p.errorf("carácter inesperado %q después de un número", r)
+	}
+	return n, nil
+}
+
+// scan avanza mientras los bytes cumplan ok y devuelve lo leído.
+func (p *json5Parser) scan(ok func(byte) bool) string {
+	start := p.pos
+	for p.pos < len(p.s) && ok(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
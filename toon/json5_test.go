@@ -0,0 +1,104 @@
+package toon
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON5(t *testing.T) {
+	input := `// configuración
+{
+  name: 'Ana "la jefa"',   /* comillas simples */
+  $id: 0x1F,
+  big: 0xFFFFFFFFFFFFFFFFFF,
+  ratio: .5,
+  total: +5.,
+  limit: Infinity,
+  note: "línea 1 \
+línea 2",
+  escapes: '\x41\v\'',
+  "url": "http://example.com/*no es un comentario*/",
+  tags: ['a', 'b',],
+}
+`
+	value, features, err := DecodeJSON5(input, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{KeySort: "none"})
+	expected := "name: \"Ana \\\"la jefa\\\"\"\n" +
+		"$id: 31\n" +
+		"big: 4722366482869645213695\n" +
+		"ratio: 0.5\n" +
+		"total: 5\n" +
+		"limit: null\n" +
+		"note: línea 1 línea 2\n" +
+		"escapes: \"A\\u000b'\"\n" +
+		"url: \"http://example.com/*no es un comentario*/\"\n" +
+		"tags[2]: a,b"
+	if got := mustEncode(t, encoder, value); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	expectedFeatures := []string{
+		"comentarios", "claves sin comillas", "strings con comillas simples", "números hexadecimales",
+		"números con punto inicial o final", "números con signo +", "Infinity y NaN", "strings multilínea",
+		"escapes de JSON5", "comas finales",
+	}
+	if !reflect.DeepEqual(features, expectedFeatures) {
+		t.Errorf("Expected features %v, got %v", expectedFeatures, features)
+	}
+
+	// El JSON estándar da lo mismo que DecodeJSON y ninguna extensión
+	standard := `{"a": [1, 2.50, -0.1e3, true, null, "é😀"], "b": {}}`
+	value, features, err = DecodeJSON5(standard, false)
+	want, _ := DecodeJSON(standard, false)
+	if err != nil || len(features) != 0 || !reflect.DeepEqual(value, want) {
+		t.Errorf("Expected %v with no features, got %v %v (%v)", want, value, features, err)
+	}
+}
+
+func TestDecodeJSON5_Invalid(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"{a: 1", "línea 1, columna 6: se esperaba ',' o '}'"},
+		{"{\n  a: 1,\n  b 2\n}", "línea 3, columna 5: se esperaba ':'"},
+		{"[1, 2] x", "contenido inesperado"},
+		{"/* sin cerrar", "comentario sin cerrar"},
+		{"'abc", "string sin cerrar"},
+		{"\"a\nb\"", "salto de línea sin escapar"},
+		{"[undefined]", "valor desconocido: undefined"},
+		{"[012]", "ceros a la izquierda"},
+		{"[12abc]", "después de un número"},
+		{"[1,,2]", "carácter inesperado ','"},
+		{"'\\1'", "escape octal"},
+		{"", "fin inesperado"},
+		{strings.Repeat("[", maxJSON5Depth+2), "anidamiento"},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := DecodeJSON5(tt.input, false); err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%.20q: expected an error with %q, got %v", tt.input, tt.message, err)
+		}
+	}
+}
+
+func TestFindDuplicateKeysJSON5(t *testing.T) {
+	input := `{
+  users: [{id: 1, 'id': 2, "id": 3}, {tags: {a: 1, a: 2}}],
+  users: [], // repetida en la raíz
+}`
+	duplicates, err := FindDuplicateKeysJSON5(input)
+	expected := []string{"users[0].id", "users[1].tags.a", "users"}
+	if err != nil || !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, duplicates, err)
+	}
+
+	if _, err := FindDuplicateKeysJSON5("{a: 1"); err == nil {
+		t.Error("Expected an error for invalid JSON5")
+	}
+}
@@ -0,0 +1,315 @@
+package toon
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// maxMessagePackDepth limita el anidamiento que acepta DecodeMessagePack, como
+// el límite interno de encoding/json.
+const maxMessagePackDepth = 10000
+
+// DecodeMessagePack convierte un payload MessagePack en la misma estructura
+// genérica que produce DecodeJSON, para pasarla al encoder TOON:
+//
+//   - Los mapas son *OrderedMap, con las claves en el orden del payload. Las
+//     claves que no son strings (1, true, nil) se escriben como texto ("1",
+//     "true", "null").
+//   - Los enteros pasan a json.Number, así que los int64 y uint64 grandes no
+//     pierden precisión. Los float32 se escriben con sus cifras significativas
+//     (0.1, no 0.10000000149011612), y NaN e Inf quedan como null.
+//   - Los binarios (bin 8/16/32) pasan a string en base64, así que
+//     BinaryPlaceholders los resume.
+//   - Las marcas de tiempo (extensión -1) pasan a string RFC 3339 en UTC. Las
+//     demás extensiones son un error.
+//   - Con varios valores seguidos (un stream) el resultado es un array con uno
+//     por elemento.
+func DecodeMessagePack(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("MessagePack vacío")
+	}
+
+	r := &msgpackReader{data: data}
+	var values []interface{}
+	for r.pos < len(data) {
+		value, err := r.value(0)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if len(values) == 1 {
+		return values[0], nil
+	}
+	return values, nil
+}
+
+// EncodeMessagePack codifica un payload MessagePack (ver DecodeMessagePack)
+// con opts. Las claves conservan el orden del payload con KeySort "none" o
+// PreserveKeyOrder.
+func EncodeMessagePack(data []byte, opts TOONOptions) (string, error) {
+	encoder, err := NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	value, err := DecodeMessagePack(data)
+	if err != nil {
+		return "", err
+	}
+	return encoder.Encode(value)
+}
+
+// msgpackReader lee valores MessagePack de data a partir de pos.
+type msgpackReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *msgpackReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("byte %d: %s", r.pos, fmt.Sprintf(format, args...))
+}
+
+// next devuelve los n bytes siguientes.
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, r.errorf("fin inesperado del payload")
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// uint lee un entero sin signo big-endian de size bytes.
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+// length lee una longitud de size bytes y comprueba que quepan al menos
+// minSize bytes por elemento en lo que queda del payload, para no reservar
+// memoria por una longitud falsa.
+func (r *msgpackReader) length(size, minSize int) (int, error) {
+	n, err := r.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(r.data)-r.pos)/uint64(minSize) {
+		return 0, r.errorf("longitud %d mayor que el payload", n)
+	}
+	return int(n), nil
+}
+
+func (r *msgpackReader) value(depth int) (interface{}, error) {
+	if depth > maxMessagePackDepth {
+		return nil, r.errorf("anidamiento de más de %d niveles", maxMessagePackDepth)
+	}
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return json.Number(strconv.Itoa(int(c))), nil
+	case c <= 0x8f:
+		return r.mapValue(int(c&0x0f), depth)
+	case c <= 0x9f:
+		return r.array(int(c&0x0f), depth)
+	case c <= 0xbf:
+		return r.str(int(c & 0x1f))
+	case c >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(c)))), nil
+	}
+
+	switch c := b[0]; c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.length(1<<(c-0xc4), 1)
+		if err != nil {
+			return nil, err
+		}
+		bin, _ := r.next(n)
+		return base64.StdEncoding.EncodeToString(bin), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.length(1<<(c-0xc7), 1)
+		if err != nil {
+			return nil, err
+		}
+		return r.ext(n)
+	case 0xca:
+		bits, err := r.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		f := math.Float32frombits(uint32(bits))
+		if math.IsInf(float64(f), 0) || math.IsNaN(float64(f)) {
+			return nil, nil
+		}
+		f64, _ := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+		return f64, nil
+	case 0xcb:
+		bits, err := r.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		f := math.Float64frombits(bits)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, nil
+		}
+		return f, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := r.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := r.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Extensión de signo desde size bytes
+		shift := 64 - 8*size
+		return json.Number(strconv.FormatInt(int64(n<<shift)>>shift, 10)), nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.length(1<<(c-0xd9), 1)
+		if err != nil {
+			return nil, err
+		}
+		return r.str(n)
+	case 0xdc, 0xdd:
+		n, err := r.length(2<<(c-0xdc), 1)
+		if err != nil {
+			return nil, err
+		}
+		return r.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := r.length(2<<(c-0xde), 2)
+		if err != nil {
+			return nil, err
+		}
+		return r.mapValue(n, depth)
+	}
+	r.pos--
+	return nil, r.errorf("tipo 0x%02x no válido", b[0])
+}
+
+func (r *msgpackReader) str(n int) (interface{}, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (r *msgpackReader) array(n, depth int) (interface{}, error) {
+	arr := make([]interface{}, n)
+	for i := range arr {
+		item, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = item
+	}
+	return arr, nil
+}
+
+// mapValue lee n pares clave-valor. Si una clave se repite, gana el último
+// valor y la clave queda en la posición de la primera.
+func (r *msgpackReader) mapValue(n, depth int) (interface{}, error) {
+	obj := &OrderedMap{Keys: make([]string, 0, n), Values: make(map[string]interface{}, n)}
+	for i := 0; i < n; i++ {
+		keyPos := r.pos
+		rawKey, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := msgpackKey(rawKey)
+		if !ok {
+			r.pos = keyPos
+			return nil, r.errorf("clave de mapa no válida: solo se admiten valores primitivos")
+		}
+		value, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, seen := obj.Values[key]; !seen {
+			obj.Keys = append(obj.Keys, key)
+		}
+		obj.Values[key] = value
+	}
+	return obj, nil
+}
+
+// msgpackKey escribe como texto una clave de mapa que no es un string.
+func msgpackKey(key interface{}) (string, bool) {
+	switch k := key.(type) {
+	case string:
+		return k, true
+	case nil:
+		return "null", true
+	case bool:
+		return strconv.FormatBool(k), true
+	case json.Number:
+		return string(k), true
+	case float64:
+		return strconv.FormatFloat(k, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// ext lee el tipo y los n bytes de una extensión. Solo se admite la marca de
+// tiempo (-1) en sus tres formatos: 32 bits de segundos, 64 bits con los
+// nanosegundos en los 30 bits altos, o 32 bits de nanosegundos más 64 de
+// segundos.
+func (r *msgpackReader) ext(n int) (interface{}, error) {
+	typ, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) != -1 {
+		return nil, r.errorf("extensión de tipo %d no soportada", int8(typ[0]))
+	}
+
+	var sec int64
+	var nsec uint32
+	switch n {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(payload))
+	case 8:
+		v := binary.BigEndian.Uint64(payload)
+		nsec, sec = uint32(v>>34), int64(v&(1<<34-1))
+	case 12:
+		nsec, sec = binary.BigEndian.Uint32(payload), int64(binary.BigEndian.Uint64(payload[4:]))
+	default:
+		return nil, r.errorf("marca de tiempo de %d bytes no válida", n)
+	}
+	if nsec > 999999999 {
+		return nil, r.errorf("marca de tiempo con %d nanosegundos", nsec)
+	}
+	return time.Unix(sec, int64(nsec)).UTC().Format(time.RFC3339Nano), nil
+}
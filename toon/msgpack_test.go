@@ -0,0 +1,95 @@
+package toon
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEncodeMessagePack(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		opts     TOONOptions
+		expected string
+	}{
+		{
+			name: "map keeps payload order",
+			// {"name": "sensor-1", "temp": 21.5, "ok": true}
+			input: append(append([]byte{0x83, 0xa4, 'n', 'a', 'm', 'e', 0xa8}, "sensor-1"...),
+				0xa4, 't', 'e', 'm', 'p', 0xcb, 0x40, 0x35, 0x80, 0, 0, 0, 0, 0,
+				0xa2, 'o', 'k', 0xc3),
+			opts:     TOONOptions{KeySort: "none"},
+			expected: "name: sensor-1\ntemp: 21.5\nok: true",
+		},
+		{
+			name: "integers and floats",
+			// [-1, -128, 255, 18446744073709551615, -9223372036854775808, float32 0.1, nil]
+			input: []byte{0x97, 0xff, 0xd0, 0x80, 0xcc, 0xff,
+				0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+				0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0,
+				0xca, 0x3d, 0xcc, 0xcc, 0xcd, 0xc0},
+			expected: "[7]: -1,-128,255,18446744073709551615,-9223372036854775808,0.1,null",
+		},
+		{
+			name: "non-string keys, binary and timestamp",
+			// {1: bin "hi", nil: timestamp32 1700000000}
+			input:    []byte{0x82, 0x01, 0xc4, 0x02, 'h', 'i', 0xc0, 0xd6, 0xff, 0x65, 0x53, 0xf1, 0x00},
+			opts:     TOONOptions{KeySort: "none"},
+			expected: "\"1\": aGk=\nnull: \"2023-11-14T22:13:20Z\"",
+		},
+		{
+			name: "stream of values",
+			// {"id": 1} {"id": 2}
+			input:    []byte{0x81, 0xa2, 'i', 'd', 0x01, 0x81, 0xa2, 'i', 'd', 0x02},
+			expected: "[2]{id}:\n  1\n  2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EncodeMessagePack(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecodeMessagePack_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		message string
+	}{
+		{"empty", nil, "vacío"},
+		{"truncated string", []byte{0xa5, 'a', 'b'}, "fin inesperado"},
+		{"never used type", []byte{0x91, 0xc1}, "byte 1: tipo 0xc1 no válido"},
+		{"length beyond payload", []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, "mayor que el payload"},
+		{"array key", []byte{0x81, 0x90, 0x01}, "clave de mapa no válida"},
+		{"unknown extension", []byte{0xd4, 0x05, 0x00}, "extensión de tipo 5 no soportada"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeMessagePack(tt.input)
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Expected an error with %q, got %v", tt.message, err)
+			}
+		})
+	}
+}
+
+func TestOrderedMap_MarshalJSON(t *testing.T) {
+	value, err := DecodeMessagePack([]byte{0x82, 0xa1, 'b', 0x91, 0x81, 0xa1, 'z', 0x01, 0xa1, 'a', 0xc0})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, err := json.Marshal(value)
+	if err != nil || string(data) != `{"b":[{"z":1}],"a":null}` {
+		t.Errorf("Expected keys in payload order, got %s (%v)", data, err)
+	}
+}
@@ -0,0 +1,151 @@
+package toon
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// RecordError es el error de EncodeNDJSON en un registro. Schema distingue
+// los registros que son JSON válido pero no encajan en la tabla (no son un
+// objeto, tienen valores anidados o campos distintos de los del primero) de
+// las líneas que no son JSON.
+type RecordError struct {
+	Line    int
+	Schema  bool
+	Message string
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("línea %d: %s", e.Line, e.Message)
+}
+
+// EncodeNDJSON lee de r un documento NDJSON (JSON Lines: un objeto por línea)
+// y escribe en w un único array tabular con todos los registros, con RootKey
+// como clave si la hay. Devuelve cuántos registros leyó. Las líneas en blanco
+// se ignoran.
+//
+// La entrada se procesa línea a línea, sin cargarla entera: cada registro se
+// convierte en su fila al leerlo y solo se guardan las filas hasta el final,
+// porque el header declara la longitud. Las columnas son las del primer
+// registro, en el orden de KeySort o, con "none" o PreserveKeyOrder, en el
+// suyo. Las opciones que transforman el documento antes de codificarlo
+// (Include, DropKeys, Flatten...) y las que necesitan ver todas las filas
+// (TypedHeaders, AlignColumns) no se aplican.
+//
+// Un registro que no es JSON, no es un objeto con solo valores primitivos o
+// no tiene los mismos campos que el primero devuelve un *RecordError con su
+// número de línea.
+func (e *TOONEncoder) EncodeNDJSON(r io.Reader, w io.Writer) (int, error) {
+	ordered := e.preserveKeyOrder || e.keySort == "none"
+	reader := bufio.NewReader(r)
+
+	var fields, schema []string
+	schemaLine := 0
+	depth := 0
+	if e.rootKey != "" {
+		depth = e.fieldArrayDepth(0)
+	}
+	var rows []string
+
+	for num := 1; ; num++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if text := strings.TrimSpace(line); text != "" {
+			record, err := DecodeJSON(text, ordered)
+			if err != nil {
+				return 0, &RecordError{Line: num, Message: fmt.Sprintf("JSON inválido: %v", err)}
+			}
+			keys, err := recordKeys(record, num)
+			if err != nil {
+				return 0, err
+			}
+
+			if schema == nil {
+				schema, schemaLine = keys, num
+				obj, _ := AsObject(record)
+				order, fixed := keyOrder(record)
+				fields = e.objectKeys(obj, order, fixed || ordered)
+			} else if missing, extra := diffKeys(schema, keys); len(missing) > 0 || len(extra) > 0 {
+				return 0, &RecordError{Line: num, Schema: true, Message: fmt.Sprintf("los campos no coinciden con los de la línea %d (faltan: %s; sobran: %s)",
+					schemaLine, formatKeyList(missing), formatKeyList(extra))}
+			}
+			rows = append(rows, e.tabularRow(record, fields, depth, nil))
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	var header string
+	if len(rows) == 0 {
+		header = "[0]:"
+	} else {
+		header = e.tabularHeader(nil, fields, depth, len(rows))
+	}
+	if e.rootKey != "" {
+		header = e.encodeKey(e.rootKey) + header
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(header)
+	for _, row := range rows {
+		bw.WriteString("\n")
+		bw.WriteString(row)
+	}
+	return len(rows), bw.Flush()
+}
+
+// recordKeys comprueba que record sea un objeto no vacío de valores
+// primitivos y devuelve sus claves ordenadas.
+func recordKeys(record interface{}, num int) ([]string, error) {
+	obj, ok := AsObject(record)
+	if !ok {
+		return nil, &RecordError{Line: num, Schema: true, Message: "se esperaba un objeto JSON"}
+	}
+	if len(obj) == 0 {
+		return nil, &RecordError{Line: num, Schema: true, Message: "el registro no tiene campos"}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key, value := range obj {
+		switch value.(type) {
+		case map[string]interface{}, *OrderedMap, []interface{}:
+			return nil, &RecordError{Line: num, Schema: true, Message: fmt.Sprintf("el campo %q no es un valor primitivo", key)}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// diffKeys compara dos listas de claves ordenadas y devuelve las de want que
+// faltan en got y las de got que no están en want.
+func diffKeys(want, got []string) (missing, extra []string) {
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case j == len(got) || i < len(want) && want[i] < got[j]:
+			missing = append(missing, want[i])
+			i++
+		case i == len(want) || got[j] < want[i]:
+			extra = append(extra, got[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return missing, extra
+}
+
+func formatKeyList(keys []string) string {
+	if len(keys) == 0 {
+		return "ninguno"
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,106 @@
+package toon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTOONEncoder_EncodeNDJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		opts     TOONOptions
+		expected string
+		records  int
+	}{
+		{
+			name:     "sorted columns",
+			input:    "{\"id\": 1, \"name\": \"Alice\", \"active\": true}\r\n\n{\"name\": \"Bob\", \"id\": 2, \"active\": null}",
+			expected: "[2]{active,id,name}:\n  true,1,Alice\n  null,2,Bob",
+			records:  2,
+		},
+		{
+			name:     "first record order with root key",
+			input:    "{\"sku\": \"A1\", \"qty\": 2}\n{\"qty\": 1, \"sku\": \"B2\"}\n",
+			opts:     TOONOptions{RootKey: "items", KeySort: "none", Delimiter: "|"},
+			expected: "items[2|]{sku|qty}:\n    A1|2\n    B2|1",
+			records:  2,
+		},
+		{
+			name:     "empty input",
+			input:    "\n\n",
+			expected: "[0]:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var out strings.Builder
+			records, err := encoder.EncodeNDJSON(strings.NewReader(tt.input), &out)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if out.String() != tt.expected || records != tt.records {
+				t.Errorf("Expected %d records:\n%s\ngot %d:\n%s", tt.records, tt.expected, records, out.String())
+			}
+		})
+	}
+}
+
+func TestTOONEncoder_EncodeNDJSONErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		line    int
+		schema  bool
+		message string
+	}{
+		{"{\"id\": 1}\n{\"id\": ", 2, false, "línea 2: JSON inválido"},
+		{"{\"id\": 1, \"a\": 1}\n\n{\"id\": 2, \"b\": 1}", 3, true, "línea 3: los campos no coinciden con los de la línea 1 (faltan: a; sobran: b)"},
+		{"{\"id\": 1, \"tags\": [1]}", 1, true, `el campo "tags" no es un valor primitivo`},
+		{"[1, 2]", 1, true, "se esperaba un objeto JSON"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewTOONEncoder().EncodeNDJSON(strings.NewReader(tt.input), io.Discard)
+		var recordErr *RecordError
+		if !errors.As(err, &recordErr) {
+			t.Fatalf("%q: expected a *RecordError, got %v", tt.input, err)
+		}
+		if recordErr.Line != tt.line || recordErr.Schema != tt.schema || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%q: expected line %d (schema %v) with %q, got %+v", tt.input, tt.line, tt.schema, tt.message, recordErr)
+		}
+	}
+}
+
+// La salida de un stream largo coincide con Encode sobre los mismos registros
+func TestTOONEncoder_EncodeNDJSONMatchesEncode(t *testing.T) {
+	const n = 5000
+	pr, pw := io.Pipe()
+	records := make([]interface{}, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(pw, "{\"id\": %d, \"msg\": \"evento %d\", \"ok\": %v}\n", i, i, i%2 == 0)
+		}
+		pw.Close()
+	}()
+	for i := range records {
+		records[i] = map[string]interface{}{"id": float64(i), "msg": fmt.Sprintf("evento %d", i), "ok": i%2 == 0}
+	}
+
+	encoder := NewTOONEncoder()
+	var out strings.Builder
+	count, err := encoder.EncodeNDJSON(pr, &out)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := mustEncode(t, encoder, records); count != n || out.String() != expected {
+		t.Errorf("Expected %d records matching Encode, got %d:\n%.200s", n, count, out.String())
+	}
+}
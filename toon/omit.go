@@ -0,0 +1,94 @@
+package toon
+
+// omitValue quita de los objetos de value los campos que OmitNull y
+// OmitEmpty descartan (ver omittable), en cualquier nivel de anidamiento. Se
+// aplica de dentro hacia fuera, así que con OmitEmpty un objeto que se queda
+// sin campos también se quita. Los elementos de los arrays nunca se quitan,
+// para no cambiar su posición. Solo se copian los contenedores que cambian.
+func omitValue(value interface{}, omitNull, omitEmpty bool) interface{} {
+	omitted, _ := omitCopy(value, omitNull, omitEmpty)
+	return omitted
+}
+
+// omittable indica si un campo con valor value se quita: null con OmitNull u
+// OmitEmpty, y "", [] o {} con OmitEmpty.
+func omittable(value interface{}, omitNull, omitEmpty bool) bool {
+	switch v := value.(type) {
+	case nil:
+		return omitNull || omitEmpty
+	case string:
+		return omitEmpty && v == ""
+	case []interface{}:
+		return omitEmpty && len(v) == 0
+	case map[string]interface{}:
+		return omitEmpty && len(v) == 0
+	case *OrderedMap:
+		return omitEmpty && len(v.Keys) == 0
+	}
+	return false
+}
+
+// omitCopy hace el trabajo de omitValue e indica si cambió algo.
+func omitCopy(value interface{}, omitNull, omitEmpty bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return omitObject(v, omitNull, omitEmpty)
+	case *OrderedMap:
+		values, changed := omitObject(v.Values, omitNull, omitEmpty)
+		if !changed {
+			return v, false
+		}
+		keys := make([]string, 0, len(values))
+		for _, key := range v.Keys {
+			if _, ok := values[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+		return &OrderedMap{Keys: keys, Values: values, fixedOrder: v.fixedOrder}, true
+	case []interface{}:
+		var copied []interface{}
+		for i, item := range v {
+			omitted, changed := omitCopy(item, omitNull, omitEmpty)
+			if changed && copied == nil {
+				copied = append([]interface{}(nil), v...)
+			}
+			if copied != nil {
+				copied[i] = omitted
+			}
+		}
+		if copied == nil {
+			return v, false
+		}
+		return copied, true
+	}
+	return value, false
+}
+
+func omitObject(obj map[string]interface{}, omitNull, omitEmpty bool) (map[string]interface{}, bool) {
+	var copied map[string]interface{}
+	ensureCopy := func() {
+		if copied == nil {
+			copied = make(map[string]interface{}, len(obj))
+			for k, item := range obj {
+				copied[k] = item
+			}
+		}
+	}
+
+	for key, item := range obj {
+		omitted, changed := omitCopy(item, omitNull, omitEmpty)
+		switch {
+		case omittable(omitted, omitNull, omitEmpty):
+			ensureCopy()
+			delete(copied, key)
+		case changed:
+			ensureCopy()
+			copied[key] = omitted
+		}
+	}
+
+	if copied == nil {
+		return obj, false
+	}
+	return copied, true
+}
@@ -0,0 +1,83 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTOONEncoder_OmitNullAndEmpty(t *testing.T) {
+	input := `{"id": 1, "name": "", "email": null, "tags": [], "meta": {}, "flags": [null, ""], "profile": {"bio": null, "links": {}}, "active": false}`
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		input    string
+		expected string
+	}{
+		{
+			name:     "omitNull",
+			opts:     TOONOptions{OmitNull: true},
+			input:    input,
+			expected: "active: false\nflags[2]: null,\"\"\nid: 1\nmeta:\nname: \"\"\nprofile:\n  links:\ntags[0]:",
+		},
+		{
+			// profile se queda vacío al quitar sus campos y también se quita
+			name:     "omitEmpty",
+			opts:     TOONOptions{OmitEmpty: true},
+			input:    input,
+			expected: "active: false\nflags[2]: null,\"\"\nid: 1",
+		},
+		{
+			// Las filas pasan a tener campos distintos
+			name:     "rows lose the tabular form",
+			opts:     TOONOptions{OmitNull: true},
+			input:    `[{"id": 1, "note": null}, {"id": 2, "note": "x"}]`,
+			expected: "[2]:\n  - id: 1\n  - id: 2\n    note: x",
+		},
+		{
+			name:     "sparseTabular keeps the table",
+			opts:     TOONOptions{OmitNull: true, SparseTabular: true},
+			input:    `[{"id": 1, "note": null}, {"id": 2, "note": "x"}]`,
+			expected: "[2]{id,note}:\n  1,\n  2,x",
+		},
+		{
+			name:     "order kept",
+			opts:     TOONOptions{OmitEmpty: true, KeySort: "none"},
+			input:    `{"z": 1, "y": "", "a": {"c": null, "b": 2}}`,
+			expected: "z: 1\na:\n  b: 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var data interface{}
+			if tt.opts.KeySort == "none" {
+				data, _ = DecodeOrderedJSON(tt.input)
+			} else {
+				json.Unmarshal([]byte(tt.input), &data)
+			}
+			if result := mustEncode(t, encoder, data); result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestOmitValue_DoesNotModifyInput(t *testing.T) {
+	const input = `{"a": [{"x": null, "id": 2}], "b": {"c": 3}}`
+	var data, original interface{}
+	json.Unmarshal([]byte(input), &data)
+	json.Unmarshal([]byte(input), &original)
+
+	omitted := omitValue(data, true, false)
+	if !reflect.DeepEqual(data, original) {
+		t.Errorf("Input was modified: %v", data)
+	}
+	if reflect.ValueOf(omitted.(map[string]interface{})["b"]).Pointer() != reflect.ValueOf(data.(map[string]interface{})["b"]).Pointer() {
+		t.Error("Expected unchanged objects to be shared")
+	}
+}
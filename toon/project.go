@@ -0,0 +1,171 @@
+package toon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseFieldPaths divide las rutas de Include o Exclude en segmentos
+// ("users.*.email" → ["users", "*", "email"]).
+func parseFieldPaths(option string, paths []string) ([][]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	parsed := make([][]string, len(paths))
+	for i, path := range paths {
+		segments := strings.Split(path, ".")
+		for _, segment := range segments {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid %s: %q (empty path segment)", option, path)
+			}
+		}
+		parsed[i] = segments
+	}
+	return parsed, nil
+}
+
+// segmentMatches indica si el segmento de una ruta selecciona la clave o el
+// índice name: "*" selecciona cualquiera.
+func segmentMatches(segment, name string) bool {
+	return segment == "*" || segment == name
+}
+
+// arrayPaths reparte paths entre los elementos de un array: un segmento "*" o
+// un índice se consume en el elemento que selecciona, y cualquier otro pasa
+// tal cual a todos, así que "users.email" equivale a "users.*.email".
+func arrayPaths(paths [][]string, index int) [][]string {
+	name := strconv.Itoa(index)
+	var selected [][]string
+	for _, path := range paths {
+		if _, err := strconv.Atoi(path[0]); err == nil || path[0] == "*" {
+			if segmentMatches(path[0], name) {
+				selected = append(selected, path[1:])
+			}
+			continue
+		}
+		selected = append(selected, path)
+	}
+	return selected
+}
+
+// keyPaths devuelve el resto de las rutas de paths que empiezan por key.
+func keyPaths(paths [][]string, key string) [][]string {
+	var selected [][]string
+	for _, path := range paths {
+		if segmentMatches(path[0], key) {
+			selected = append(selected, path[1:])
+		}
+	}
+	return selected
+}
+
+// hasEmptyPath indica si alguna ruta ya se ha consumido entera, es decir,
+// selecciona el valor actual.
+func hasEmptyPath(paths [][]string) bool {
+	for _, path := range paths {
+		if len(path) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// includeFields deja en value solo lo que seleccionan las rutas de Include,
+// con los objetos que lo contienen, e indica si seleccionaron algo. Un valor
+// seleccionado se conserva entero; las claves y los elementos de array sin
+// nada seleccionado se quitan.
+func includeFields(value interface{}, paths [][]string) (interface{}, bool) {
+	if hasEmptyPath(paths) {
+		return value, true
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{})
+		for key, item := range v {
+			if sub := keyPaths(paths, key); len(sub) > 0 {
+				if included, ok := includeFields(item, sub); ok {
+					obj[key] = included
+				}
+			}
+		}
+		return obj, len(obj) > 0
+	case *OrderedMap:
+		obj := &OrderedMap{Values: make(map[string]interface{}), fixedOrder: v.fixedOrder}
+		for _, key := range v.Keys {
+			if sub := keyPaths(paths, key); len(sub) > 0 {
+				if included, ok := includeFields(v.Values[key], sub); ok {
+					obj.Keys = append(obj.Keys, key)
+					obj.Values[key] = included
+				}
+			}
+		}
+		return obj, len(obj.Keys) > 0
+	case []interface{}:
+		arr := []interface{}{}
+		for i, item := range v {
+			if sub := arrayPaths(paths, i); len(sub) > 0 {
+				if included, ok := includeFields(item, sub); ok {
+					arr = append(arr, included)
+				}
+			}
+		}
+		return arr, len(arr) > 0
+	}
+	return value, false
+}
+
+// excludeFields quita de value lo que seleccionan las rutas de Exclude: la
+// clave o el elemento de array donde termina cada ruta.
+func excludeFields(value interface{}, paths [][]string) interface{} {
+	if len(paths) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			sub := keyPaths(paths, key)
+			if hasEmptyPath(sub) {
+				continue
+			}
+			obj[key] = excludeFields(item, sub)
+		}
+		return obj
+	case *OrderedMap:
+		obj := &OrderedMap{Values: make(map[string]interface{}, len(v.Keys)), fixedOrder: v.fixedOrder}
+		for _, key := range v.Keys {
+			sub := keyPaths(paths, key)
+			if hasEmptyPath(sub) {
+				continue
+			}
+			obj.Keys = append(obj.Keys, key)
+			obj.Values[key] = excludeFields(v.Values[key], sub)
+		}
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for i, item := range v {
+			sub := arrayPaths(paths, i)
+			if hasEmptyPath(sub) {
+				continue
+			}
+			arr = append(arr, excludeFields(item, sub))
+		}
+		return arr
+	}
+	return value
+}
+
+// projectFields aplica a value Include y después Exclude.
+func projectFields(value interface{}, include, exclude [][]string) interface{} {
+	if include != nil {
+		value, _ = includeFields(value, include)
+	}
+	if exclude != nil {
+		value = excludeFields(value, exclude)
+	}
+	return value
+}
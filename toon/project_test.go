@@ -0,0 +1,72 @@
+package toon
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTOONEncoder_IncludeExclude(t *testing.T) {
+	input := `{
+		"users": [
+			{"id": 1, "email": "a@x.com", "profile": {"bio": "hola", "age": 30}},
+			{"id": 2, "email": "b@x.com", "profile": {"bio": "adiós", "age": 40}}
+		],
+		"meta": {"page": 1, "total": 2},
+		"debug": {"trace": "..."}
+	}`
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		expected string
+	}{
+		{
+			name:     "include with wildcard",
+			opts:     TOONOptions{Include: []string{"users.*.email", "meta.page"}},
+			expected: "meta:\n  page: 1\nusers[2]{email}:\n    a@x.com\n    b@x.com",
+		},
+		{
+			// Sin "*" los arrays se atraviesan igual
+			name:     "include through arrays",
+			opts:     TOONOptions{Include: []string{"users.id", "users.profile.age"}},
+			expected: "users[2]:\n    - id: 1\n      profile:\n        age: 30\n    - id: 2\n      profile:\n        age: 40",
+		},
+		{
+			name:     "include by index",
+			opts:     TOONOptions{Include: []string{"users.1.id"}},
+			expected: "users[1]{id}:\n    2",
+		},
+		{
+			name:     "exclude",
+			opts:     TOONOptions{Exclude: []string{"debug", "users.*.profile", "meta.*"}},
+			expected: "meta:\nusers[2]{email,id}:\n    a@x.com,1\n    b@x.com,2",
+		},
+		{
+			name:     "include then exclude",
+			opts:     TOONOptions{Include: []string{"users"}, Exclude: []string{"users.profile.bio", "users.email"}},
+			expected: "users[2]:\n    - id: 1\n      profile:\n        age: 30\n    - id: 2\n      profile:\n        age: 40",
+		},
+		{
+			name:     "nothing selected",
+			opts:     TOONOptions{Include: []string{"missing.path"}},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var data interface{}
+			json.Unmarshal([]byte(input), &data)
+			if result := mustEncode(t, encoder, data); result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{Include: []string{"users..email"}}); err == nil {
+		t.Error("Expected error for an empty path segment")
+	}
+}
@@ -0,0 +1,109 @@
+package toon
+
+import "fmt"
+
+// redactedValue sustituye a los valores de RedactKeys.
+const redactedValue = "***"
+
+// keySet convierte una lista de claves en un conjunto, o nil si está vacía.
+func keySet(keys []string) map[string]bool {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+// checkRedactKeys comprueba que ninguna clave esté a la vez en DropKeys y en
+// RedactKeys.
+func checkRedactKeys(opts TOONOptions) error {
+	drop := keySet(opts.DropKeys)
+	for _, key := range opts.RedactKeys {
+		if drop[key] {
+			return fmt.Errorf("invalid redactKeys: %q is also in dropKeys", key)
+		}
+	}
+	return nil
+}
+
+// redactValue quita de value las claves de drop y sustituye por "***" el
+// valor de las de redact, en cualquier nivel de anidamiento. Se aplica antes
+// de codificar, así que un array cuyos objetos solo difieren en un campo
+// quitado pasa a ser tabular, y uno cuyas filas pierden todos sus campos deja
+// de serlo. Solo se copian los contenedores que cambian.
+func redactValue(value interface{}, drop, redact map[string]bool) interface{} {
+	redacted, _ := redactCopy(value, drop, redact)
+	return redacted
+}
+
+// redactCopy hace el trabajo de redactValue e indica si cambió algo.
+func redactCopy(value interface{}, drop, redact map[string]bool) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactObject(v, drop, redact)
+	case *OrderedMap:
+		values, changed := redactObject(v.Values, drop, redact)
+		if !changed {
+			return v, false
+		}
+		keys := make([]string, 0, len(v.Keys))
+		for _, key := range v.Keys {
+			if !drop[key] {
+				keys = append(keys, key)
+			}
+		}
+		return &OrderedMap{Keys: keys, Values: values, fixedOrder: v.fixedOrder}, true
+	case []interface{}:
+		var copied []interface{}
+		for i, item := range v {
+			redacted, changed := redactCopy(item, drop, redact)
+			if changed && copied == nil {
+				copied = append([]interface{}(nil), v...)
+			}
+			if copied != nil {
+				copied[i] = redacted
+			}
+		}
+		if copied == nil {
+			return v, false
+		}
+		return copied, true
+	}
+	return value, false
+}
+
+func redactObject(obj map[string]interface{}, drop, redact map[string]bool) (map[string]interface{}, bool) {
+	var copied map[string]interface{}
+	ensureCopy := func() {
+		if copied == nil {
+			copied = make(map[string]interface{}, len(obj))
+			for k, item := range obj {
+				copied[k] = item
+			}
+		}
+	}
+
+	for key, item := range obj {
+		switch {
+		case drop[key]:
+			ensureCopy()
+			delete(copied, key)
+		case redact[key]:
+			ensureCopy()
+			copied[key] = redactedValue
+		default:
+			if redacted, changed := redactCopy(item, drop, redact); changed {
+				ensureCopy()
+				copied[key] = redacted
+			}
+		}
+	}
+
+	if copied == nil {
+		return obj, false
+	}
+	return copied, true
+}
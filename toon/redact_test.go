@@ -0,0 +1,99 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTOONEncoder_DropAndRedactKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		input    string
+		expected string
+	}{
+		{
+			name:     "nested objects",
+			opts:     TOONOptions{DropKeys: []string{"password"}, RedactKeys: []string{"ssn"}},
+			input:    `{"user": {"name": "Alice", "password": "x", "ssn": "123", "profile": {"ssn": 456, "password": null}}}`,
+			expected: "user:\n  name: Alice\n  profile:\n    ssn: ***\n  ssn: ***",
+		},
+		{
+			name:     "tabular columns",
+			opts:     TOONOptions{DropKeys: []string{"password"}, RedactKeys: []string{"ssn"}},
+			input:    `{"users": [{"id": 1, "password": "a", "ssn": "1"}, {"id": 2, "password": "b", "ssn": "2"}]}`,
+			expected: "users[2]{id,ssn}:\n    1,***\n    2,***",
+		},
+		{
+			// Las filas solo diferían en el campo quitado: pasan a ser tabulares
+			name:     "dropping a sparse field makes rows uniform",
+			opts:     TOONOptions{DropKeys: []string{"token"}},
+			input:    `[{"id": 1, "token": "t"}, {"id": 2}]`,
+			expected: "[2]{id}:\n  1\n  2",
+		},
+		{
+			// Sin campos las filas ya no son tabulares
+			name:     "dropping every field",
+			opts:     TOONOptions{DropKeys: []string{"token"}},
+			input:    `{"rows": [{"token": "a"}, {"token": "b"}]}`,
+			expected: "rows[2]:\n    - \n    - ",
+		},
+		{
+			name:     "dropping every field with sparseTabular",
+			opts:     TOONOptions{DropKeys: []string{"token"}, SparseTabular: true},
+			input:    `[{"token": "a"}, {}]`,
+			expected: "[2]:\n  - \n  - ",
+		},
+		{
+			name:     "redacted containers",
+			opts:     TOONOptions{RedactKeys: []string{"secrets"}},
+			input:    `{"secrets": {"a": 1}, "list": [{"secrets": [1, 2]}]}`,
+			expected: "list[1]{secrets}:\n    ***\nsecrets: ***",
+		},
+		{
+			name:     "order kept with flatten",
+			opts:     TOONOptions{DropKeys: []string{"b"}, Flatten: true, KeySort: "none"},
+			input:    `{"z": {"b": 1, "c": 2}, "a": [{"b": 3}]}`,
+			expected: "z.c: 2\na.0:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var data interface{}
+			if tt.opts.KeySort == "none" {
+				data, _ = DecodeOrderedJSON(tt.input)
+			} else {
+				json.Unmarshal([]byte(tt.input), &data)
+			}
+			if result := mustEncode(t, encoder, data); result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRedactValue_DoesNotModifyInput(t *testing.T) {
+	var data interface{}
+	json.Unmarshal([]byte(`{"a": [{"ssn": 1, "id": 2}], "b": {"c": 3}}`), &data)
+	var original interface{}
+	json.Unmarshal([]byte(`{"a": [{"ssn": 1, "id": 2}], "b": {"c": 3}}`), &original)
+
+	redacted := redactValue(data, map[string]bool{"ssn": true}, nil)
+	if !reflect.DeepEqual(data, original) {
+		t.Errorf("Input was modified: %v", data)
+	}
+	// Lo que no cambia se comparte sin copiar
+	if reflect.ValueOf(redacted.(map[string]interface{})["b"]).Pointer() != reflect.ValueOf(data.(map[string]interface{})["b"]).Pointer() {
+		t.Error("Expected unchanged objects to be shared")
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{DropKeys: []string{"ssn"}, RedactKeys: []string{"ssn"}}); err == nil {
+		t.Error("Expected error for a key in both lists")
+	}
+}
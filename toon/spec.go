@@ -0,0 +1,105 @@
+package toon
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// specNumberPattern reconoce los strings que la especificación de referencia
+// pone entre comillas por parecer números: "42", "-1.5", "1e6" y los que
+// tienen ceros a la izquierda ("05").
+var specNumberPattern = regexp.MustCompile(`^(-?\d+(\.\d+)?([eE][+-]?\d+)?|0\d+)$`)
+
+// specKeyPattern reconoce las claves que la especificación escribe sin
+// comillas.
+var specKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// specQuoteReason es stringQuoteReason con las reglas de la especificación
+// de referencia (SpecVersion "1.0"): no se entrecomillan fechas ni
+// apóstrofos, pero sí los corchetes y llaves en cualquier posición y
+// cualquier string que empiece por guión. Los que empiezan por "#" o parecen
+// el marcador de array recortado van entre comillas como en legacy, porque
+// el decoder los leería como comentarios o como el marcador.
+func (e *TOONEncoder) specQuoteReason(s string) QuoteReason {
+	if s == "" {
+		return quoteEmpty
+	}
+
+	first, _ := utf8.DecodeRuneInString(s)
+	if unicode.IsSpace(first) {
+		return quoteLeadingSpace
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	if unicode.IsSpace(last) {
+		return quoteTrailingSpace
+	}
+
+	if s == "true" || s == "false" || s == "null" {
+		return quoteReservedWord
+	}
+	if e.customLiterals && (s == e.trueLiteral || s == e.falseLiteral || s == e.nullLiteral) {
+		return quoteReservedWord
+	}
+	if specNumberPattern.MatchString(s) {
+		return quoteNumeric
+	}
+
+	delimiter := e.delimiter[0]
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ':', '"', '\\', '[', ']', '{', '}':
+			return quoteSpecialChar
+		default:
+			if c == delimiter {
+				return quoteDelimiter
+			}
+			if c < 0x20 || isLineSeparatorAt(s, i) {
+				return quoteControlChar
+			}
+			if c >= utf8.RuneSelf && e.asciiOnly {
+				return quoteNonASCII
+			}
+		}
+	}
+
+	switch s[0] {
+	case '-':
+		return quoteLeadingHyphen
+	case '#':
+		return quoteCommentPrefix
+	case '.':
+		if truncationMarkerPattern.MatchString(s) {
+			return quoteTruncationMarker
+		}
+	}
+	return QuoteNone
+}
+
+// specKeyQuoteReason es keyQuoteReason con las reglas de la especificación:
+// solo van sin comillas los identificadores (con puntos).
+func (e *TOONEncoder) specKeyQuoteReason(key string, inArray bool) QuoteReason {
+	switch {
+	case key == "":
+		return quoteEmpty
+	case specKeyPattern.MatchString(key):
+		if e.keyFolding && !inArray && strings.Contains(key, ".") {
+			return quoteFoldedPath
+		}
+		return QuoteNone
+	case hasControlChars(key):
+		return quoteControlChar
+	case !utf8.ValidString(key):
+		return quoteInvalidUTF8
+	case strings.Contains(key, e.delimiter):
+		return quoteDelimiter
+	case strings.HasPrefix(key, "-"):
+		return quoteLeadingHyphen
+	}
+	if _, err := strconv.ParseFloat(key, 64); err == nil {
+		return quoteNumeric
+	}
+	return quoteSpecialChar
+}
@@ -0,0 +1,108 @@
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTOONEncoder_SpecVersion(t *testing.T) {
+	input := `{"users": [{"id": 1, "name": "Ana"}, {"id": 2, "name": "Luis"}], "tags": ["a", "b"], "list": [{}, [{"x": 1}], [1, 2]], "matrix": [[1, 2], [3, 4]], "date": "2024-01-01", "note": "it's", "range": "a[1]", "code": "05", "flag": "-x", "my key": 1}`
+	tests := []struct {
+		name     string
+		opts     TOONOptions
+		expected string
+	}{
+		{
+			name: "1.0",
+			opts: TOONOptions{SpecVersion: "1.0"},
+			expected: "code: \"05\"\ndate: 2024-01-01\nflag: \"-x\"\nlist[3]:\n  -\n  - [1]{x}:\n    1\n  - [2]: 1,2\n" +
+				"matrix[2]:\n  - [2]: 1,2\n  - [2]: 3,4\n\"my key\": 1\nnote: it's\nrange: \"a[1]\"\ntags[2]: a,b\n" +
+				"users[2]{id,name}:\n  1,Ana\n  2,Luis",
+		},
+		{
+			name: "1.0 with tabs",
+			opts: TOONOptions{SpecVersion: "1.0", Delimiter: "\t"},
+			expected: "code: \"05\"\ndate: 2024-01-01\nflag: \"-x\"\nlist[3]:\n  -\n  - [1\t]{x}:\n    1\n  - [2\t]: 1\t2\n" +
+				"matrix[2]:\n  - [2\t]: 1\t2\n  - [2\t]: 3\t4\n\"my key\": 1\nnote: it's\nrange: \"a[1]\"\ntags[2\t]: a\tb\n" +
+				"users[2\t]{id\tname}:\n  1\tAna\n  2\tLuis",
+		},
+		{
+			name: "legacy",
+			opts: TOONOptions{SpecVersion: "legacy"},
+			expected: "code: \"05\"\ndate: \"2024-01-01\"\nflag: -x\nlist[3]:\n    - \n    - [1]{x}:\n            1\n    - [2]: 1,2\n" +
+				"matrix[2x2]:\n    1,2\n    3,4\n\"my key\": 1\nnote: \"it's\"\nrange: a[1]\ntags[2]: a,b\n" +
+				"users[2]{id,name}:\n    1,Ana\n    2,Luis",
+		},
+	}
+
+	var data interface{}
+	json.Unmarshal([]byte(input), &data)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewTOONEncoderWithOptions(tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			result := mustEncode(t, encoder, data)
+			if result != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, result)
+			}
+
+			decoded, err := NewTOONDecoder().Decode(result)
+			if err != nil {
+				t.Fatalf("Decode error: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, data) {
+				t.Errorf("Round trip mismatch: %v", decoded)
+			}
+		})
+	}
+
+	if _, err := NewTOONEncoderWithOptions(TOONOptions{SpecVersion: "2.0"}); err == nil {
+		t.Error("Expected error for unknown specVersion")
+	}
+}
+
+func TestTOONEncoder_CommentPrefixRoundTrip(t *testing.T) {
+	data := map[string]interface{}{
+		"note": "# todo",
+		"hash": "#",
+		"tags": []interface{}{"#go", "# x", "a"},
+		"rows": []interface{}{
+			map[string]interface{}{"tag": "# admin"},
+			map[string]interface{}{"tag": "#1"},
+		},
+	}
+	for _, version := range []string{"1.0", "legacy"} {
+		encoder, _ := NewTOONEncoderWithOptions(TOONOptions{SpecVersion: version})
+		result := mustEncode(t, encoder, data)
+		decoded, err := NewTOONDecoder().Decode(result)
+		if err != nil {
+			t.Fatalf("%s: decode error: %v", version, err)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("%s: round trip mismatch for\n%s\ngot %v", version, result, decoded)
+		}
+	}
+}
+
+func TestMarshal_TruncationMarkerRoundTrip(t *testing.T) {
+	type row struct {
+		Note string `toon:"note"`
+	}
+	data := []row{{"... (+3)"}, {"... (+1)"}}
+	for _, version := range []string{"1.0", "legacy"} {
+		out, err := MarshalWithOptions(data, TOONOptions{SpecVersion: version})
+		if err != nil {
+			t.Fatalf("%s: Marshal error: %v", version, err)
+		}
+		var decoded []row
+		if err := Unmarshal(out, &decoded); err != nil {
+			t.Fatalf("%s: Unmarshal error: %v\n%s", version, err, out)
+		}
+		if !reflect.DeepEqual(decoded, data) {
+			t.Errorf("%s: round trip mismatch for\n%s\ngot %v", version, out, decoded)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package toon
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structField es un campo exportado de un struct tal como se codifica: su
+// clave y la ruta de índices hasta él (más de uno si viene de un struct
+// embebido).
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool // el nombre viene de una etiqueta
+}
+
+// structFieldsCache guarda los campos de cada tipo de struct ya visto.
+var structFieldsCache sync.Map // reflect.Type → []structField
+
+// cachedStructFields devuelve structFields(t), calculándolo una sola vez
+// por tipo.
+func cachedStructFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields, _ := structFieldsCache.LoadOrStore(t, structFields(t))
+	return fields.([]structField)
+}
+
+// structFields lista los campos de t en orden de declaración con las mismas
+// reglas que encoding/json, leyendo la etiqueta `toon` o, si no la hay, la
+// `json`:
+//
+//   - `toon:"name"` cambia la clave y `toon:"name,omitempty"` (o
+//     `toon:",omitempty"`) omite el campo si está vacío: false, 0, "", nil o
+//     un array, slice o mapa sin elementos.
+//   - `toon:"-"` excluye el campo; los campos no exportados nunca se
+//     incluyen.
+//   - Los campos de un struct embebido sin nombre en la etiqueta se
+//     promocionan al struct exterior. Si dos campos tienen la misma clave
+//     gana el menos anidado; a igual profundidad, el único con etiqueta, y
+//     si no hay uno así se descartan todos.
+func structFields(t reflect.Type) []structField {
+	var all []structField
+
+	var walk func(t reflect.Type, index []int, visited map[reflect.Type]bool)
+	walk = func(t reflect.Type, index []int, visited map[reflect.Type]bool) {
+		visited[t] = true
+		defer delete(visited, t)
+
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("toon")
+			if tag == "" {
+				tag = sf.Tag.Get("json")
+			}
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			fieldIndex := append(append([]int(nil), index...), i)
+
+			if sf.Anonymous && name == "" {
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					if !visited[ft] {
+						walk(ft, fieldIndex, visited)
+					}
+					continue
+				}
+			}
+			if !sf.IsExported() {
+				continue
+			}
+
+			field := structField{name: name, index: fieldIndex, tagged: name != ""}
+			if name == "" {
+				field.name = sf.Name
+			}
+			for _, option := range strings.Split(options, ",") {
+				if option == "omitempty" {
+					field.omitEmpty = true
+				}
+			}
+			all = append(all, field)
+		}
+	}
+	walk(t, nil, make(map[reflect.Type]bool))
+
+	// Resolver las claves repetidas conservando el orden de declaración
+	byName := make(map[string][]structField)
+	for _, field := range all {
+		byName[field.name] = append(byName[field.name], field)
+	}
+	fields := make([]structField, 0, len(all))
+	for _, field := range all {
+		if dominant, ok := dominantField(byName[field.name]); ok && sameIndex(dominant.index, field.index) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// dominantField elige entre los campos con la misma clave (ver structFields).
+func dominantField(candidates []structField) (structField, bool) {
+	depth := len(candidates[0].index)
+	for _, field := range candidates[1:] {
+		if len(field.index) < depth {
+			depth = len(field.index)
+		}
+	}
+
+	var shallowest []structField
+	for _, field := range candidates {
+		if len(field.index) == depth {
+			shallowest = append(shallowest, field)
+		}
+	}
+	if len(shallowest) == 1 {
+		return shallowest[0], true
+	}
+
+	var tagged []structField
+	for _, field := range shallowest {
+		if field.tagged {
+			tagged = append(tagged, field)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return structField{}, false
+}
+
+func sameIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByIndex devuelve el campo de rv en la ruta index, o false si pasa
+// por un puntero embebido nil.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, step := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(step)
+	}
+	return rv, true
+}
+
+// isEmptyValue indica si omitempty omite el valor, como en encoding/json.
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// normalizeStruct convierte un struct en un *OrderedMap con sus campos en
+// orden de declaración (ver structFields). KeySort los ordena como a
+// cualquier otro objeto; con "none" se quedan en ese orden.
+func (n *normalizer) normalizeStruct(rv reflect.Value) (*OrderedMap, error) {
+	fields := cachedStructFields(rv.Type())
+	obj := &OrderedMap{Values: make(map[string]interface{}, len(fields))}
+	for _, field := range fields {
+		fv, ok := fieldByIndex(rv, field.index)
+		if !ok || field.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		value, err := n.normalizeElem(fv)
+		if err != nil {
+			return nil, err
+		}
+		obj.Keys = append(obj.Keys, field.name)
+		obj.Values[field.name] = value
+	}
+	return obj, nil
+}
+
+// unmarshalValue guarda en rv (direccionable) un valor decodificado por
+// TOONDecoder. Los structs usan las claves de structFields, con o sin
+// mayúsculas como encoding/json; los slices, arrays y mapas con claves string
+// se recorren para llegar a los structs que contengan. Lo demás, y los tipos
+// con UnmarshalJSON o UnmarshalText, se asigna con json.Unmarshal.
+func unmarshalValue(rv reflect.Value, value interface{}) error {
+	switch rv.Addr().Interface().(type) {
+	case json.Unmarshaler, encoding.TextUnmarshaler:
+		return unmarshalJSON(rv, value)
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if value == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+			return nil
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return unmarshalValue(rv.Elem(), value)
+
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, field := range cachedStructFields(rv.Type()) {
+			item, ok := lookupKey(obj, field.name)
+			if !ok {
+				continue
+			}
+			fv, ok := settableField(rv, field.index)
+			if !ok {
+				continue
+			}
+			if err := unmarshalValue(fv, item); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		arr, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(arr), len(arr))
+		for i, item := range arr {
+			if err := unmarshalValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+		return nil
+
+	case reflect.Array:
+		arr, ok := value.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if i >= len(arr) {
+				rv.Index(i).Set(reflect.Zero(rv.Type().Elem()))
+				continue
+			}
+			if err := unmarshalValue(rv.Index(i), arr[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), len(obj))
+		for key, item := range obj {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := unmarshalValue(elem, item); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), elem)
+		}
+		rv.Set(m)
+		return nil
+	}
+	return unmarshalJSON(rv, value)
+}
+
+// unmarshalJSON asigna value a rv con las reglas (y los errores) de
+// json.Unmarshal.
+func unmarshalJSON(rv reflect.Value, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, rv.Addr().Interface())
+}
+
+// lookupKey busca key en obj; si no está, cualquier clave igual salvo
+// mayúsculas.
+func lookupKey(obj map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := obj[key]; ok {
+		return value, true
+	}
+	for k, value := range obj {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// settableField es fieldByIndex creando los punteros embebidos nil. Devuelve
+// false si uno de ellos es de un tipo no exportado y no se puede crear.
+func settableField(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, step := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Value{}, false
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(step)
+	}
+	return rv, true
+}
@@ -0,0 +1,133 @@
+package toon
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Audit struct {
+	CreatedBy string `toon:"created_by"`
+	Version   int    `toon:"version,omitempty"`
+}
+
+type item struct {
+	SKU      string            `toon:"sku"`
+	Qty      int               `toon:"qty"`
+	Price    float64           `json:"price"` // sin etiqueta toon se usa la json
+	Note     string            `toon:"note,omitempty"`
+	Internal string            `toon:"-"`
+	Extra    map[string]string `toon:",omitempty"`
+	secret   string
+}
+
+type order struct {
+	ID int64 `toon:"id"`
+	*Audit
+	Items    []item          `toon:"items"`
+	Customer *string         `toon:"customer"`
+	Totals   map[string]item `toon:"totals,omitempty"`
+}
+
+func TestEncode_Structs(t *testing.T) {
+	o := order{
+		ID:    9007199254740993,
+		Audit: &Audit{CreatedBy: "ana"},
+		Items: []item{
+			{SKU: "A1", Qty: 2, Price: 9.5, Internal: "x", secret: "y"},
+			{SKU: "B2", Qty: 1, Price: 20},
+		},
+	}
+
+	encoder, _ := NewTOONEncoderWithOptions(TOONOptions{KeySort: "none"})
+	result := mustEncode(t, encoder, &o)
+
+	// Los campos de Audit se promocionan y version se omite por estar vacía
+	expected := "id: 9007199254740993\n" +
+		"created_by: ana\n" +
+		"items[2]{sku,qty,price}:\n" +
+		"    A1,2,9.5\n" +
+		"    B2,1,20\n" +
+		"customer: null"
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+
+	// Sin Audit sus campos desaparecen, y con Note el campo vuelve
+	o.Audit = nil
+	o.Items = o.Items[:1]
+	o.Items[0].Note = "frágil"
+	expected = "customer: null\n" +
+		"id: 9007199254740993\n" +
+		"items[1]{note,price,qty,sku}:\n" +
+		"    frágil,9.5,2,A1"
+	if result := mustEncode(t, NewTOONEncoder(), o); result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestStructFields_Conflicts(t *testing.T) {
+	type A struct{ Name, Only string }
+	type B struct{ Name string }
+	type C struct {
+		Only string `toon:"Only"`
+	}
+	type outer struct {
+		A
+		B
+		C
+		ID int
+	}
+	var names []string
+	fields := structFields(reflect.TypeOf(outer{}))
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+	if len(fields) > 0 && !reflect.DeepEqual(fields[0].index, []int{2, 0}) {
+		t.Errorf("Expected Only from C, got index %v", fields[0].index)
+	}
+	// Name aparece dos veces a la misma profundidad sin etiqueta y se
+	// descarta; de los dos Only gana el etiquetado
+	if expected := []string{"Only", "ID"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected fields %v, got %v", expected, names)
+	}
+
+	type node struct {
+		*node
+		Value int
+	}
+	if fields := structFields(reflect.TypeOf(node{})); len(fields) != 1 || fields[0].name != "Value" {
+		t.Errorf("Expected only Value for a recursive embedded type, got %+v", fields)
+	}
+}
+
+func TestUnmarshal_StructTags(t *testing.T) {
+	customer := "Bob"
+	original := order{
+		ID:       42,
+		Audit:    &Audit{CreatedBy: "ana", Version: 3},
+		Items:    []item{{SKU: "A1", Qty: 2, Price: 9.5, Extra: map[string]string{"color": "red"}}},
+		Customer: &customer,
+		Totals:   map[string]item{"all": {SKU: "*", Qty: 2, Price: 19}},
+	}
+
+	data, err := Marshal(original)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var decoded order
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v\n%s", err, data)
+	}
+	if !reflect.DeepEqual(decoded, original) {
+		t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %+v", data, decoded)
+	}
+
+	// Como encoding/json, las claves se encuentran sin distinguir mayúsculas
+	var it item
+	if err := Unmarshal([]byte("SKU: A1\nQTY: 3"), &it); err != nil || it.SKU != "A1" || it.Qty != 3 {
+		t.Errorf("Expected case-insensitive keys, got %+v, %v", it, err)
+	}
+	if err := Unmarshal([]byte("qty: many"), &it); err == nil {
+		t.Error("Expected error for a string in an int field")
+	}
+}
@@ -0,0 +1,76 @@
+// Package toon codifica y decodifica TOON (Token-Oriented Object Notation),
+// una representación de JSON pensada para gastar menos tokens en los prompts
+// de un LLM.
+//
+// Marshal y Unmarshal funcionan como sus equivalentes de encoding/json; para
+// elegir el formato de salida se usan TOONOptions con MarshalWithOptions o
+// directamente TOONEncoder y TOONDecoder.
+package toon
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Marshaler es la interfaz de los tipos que eligen su propia representación
+// TOON. MarshalTOON devuelve un documento TOON (un valor como 42 o "a b", un
+// objeto o un array), que se decodifica y se inserta en el lugar del valor;
+// los strings que podrían leerse como otra cosa deben ir entre comillas.
+//
+// Encode la comprueba antes que json.Marshaler y encoding.TextMarshaler, que
+// se siguen usando para los tipos que no la implementan.
+type Marshaler interface {
+	MarshalTOON() ([]byte, error)
+}
+
+// Marshal devuelve la codificación TOON de v con las opciones por defecto.
+//
+// v puede ser lo que devuelve json.Unmarshal o cualquier valor Go, como en
+// Encode: los structs usan sus etiquetas `toon` (o `json`, si no tienen) con
+// las reglas de encoding/json, los tipos con MarshalTOON (ver Marshaler) se
+// escriben a su manera y los que tienen MarshalJSON o MarshalText como los
+// escribiría encoding/json.
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalWithOptions(v, TOONOptions{})
+}
+
+// MarshalWithOptions es Marshal con las opciones de opts. Devuelve un error
+// si las opciones no son válidas o si v tiene un array que supera
+// MaxArrayElements sin TruncateArrays, o si v se contiene a sí mismo.
+func MarshalWithOptions(v interface{}, opts TOONOptions) ([]byte, error) {
+	encoder, err := NewTOONEncoderWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	value, err := normalizeValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encoder.CheckLimits(value); err != nil {
+		return nil, err
+	}
+	encoded, err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(encoded), nil
+}
+
+// Unmarshal decodifica el documento TOON data y guarda el resultado en v, que
+// debe ser un puntero no nil. Con *interface{} se obtiene el mismo modelo que
+// con json.Unmarshal (map[string]interface{}, []interface{}, float64...); con
+// cualquier otro tipo el valor se asigna con las reglas de json.Unmarshal, y
+// los structs leen las mismas claves que escribe Marshal. Los números no
+// pasan por float64, así que un int64 de más de 53 bits se lee exacto.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	value, _, err := NewTOONDecoder().DecodeWithOptions(string(data), DecodeOptions{Strict: true, UseNumber: true})
+	if err != nil {
+		return err
+	}
+	return unmarshalValue(rv.Elem(), value)
+}
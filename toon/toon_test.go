@@ -0,0 +1,192 @@
+package toon
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Email   string    `json:"email,omitempty"`
+	Created time.Time `json:"created"`
+	secret  string
+}
+
+func TestMarshal(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"users": []testUser{
+			{ID: 1, Name: "Alice", Created: created, secret: "x"},
+			{ID: 2, Name: "Bob", Created: created},
+		},
+		"owner": &testUser{ID: 3, Name: "Carol", Email: "c@example.com", Created: created},
+	}
+
+	out, err := Marshal(data)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "owner:\n" +
+		"  created: \"2024-05-01T12:00:00Z\"\n" +
+		"  email: c@example.com\n" +
+		"  id: 3\n" +
+		"  name: Carol\n" +
+		"users[2]{created,id,name}:\n" +
+		"    \"2024-05-01T12:00:00Z\",1,Alice\n" +
+		"    \"2024-05-01T12:00:00Z\",2,Bob"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	// Con KeySort "none" los campos salen en el orden del struct
+	out, _ = MarshalWithOptions(testUser{ID: 1, Name: "Alice", Created: created}, TOONOptions{KeySort: "none"})
+	if expected := "id: 1\nname: Alice\ncreated: \"2024-05-01T12:00:00Z\""; string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	if _, err := MarshalWithOptions(data, TOONOptions{Delimiter: ";"}); !errors.Is(err, ErrInvalidDelimiter) {
+		t.Errorf("Expected ErrInvalidDelimiter, got %v", err)
+	}
+	if _, err := MarshalWithOptions([]int{1, 2, 3}, TOONOptions{MaxArrayElements: 2}); err == nil {
+		t.Error("Expected error for an array over MaxArrayElements")
+	}
+}
+
+// money se escribe como "12.50 EUR"; un Amount negativo hace fallar a
+// MarshalTOON.
+type money struct {
+	Amount   int // céntimos
+	Currency string
+}
+
+func (m money) MarshalTOON() ([]byte, error) {
+	if m.Amount < 0 {
+		return nil, errors.New("importe negativo")
+	}
+	return []byte(fmt.Sprintf("\"%d.%02d %s\"", m.Amount/100, m.Amount%100, m.Currency)), nil
+}
+
+// point tiene MarshalTOON (un objeto) y MarshalText: gana MarshalTOON.
+type point struct{ X, Y int }
+
+func (p *point) MarshalTOON() ([]byte, error) {
+	return []byte(fmt.Sprintf("x: %d\ny: %d", p.X, p.Y)), nil
+}
+
+func (p *point) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", p.X, p.Y)), nil
+}
+
+func TestMarshal_Marshaler(t *testing.T) {
+	var missing *point
+	data := map[string]interface{}{
+		"prices":  []money{{1250, "EUR"}, {99, "USD"}},
+		"total":   money{1349, "EUR"},
+		"origin":  &point{1, 2},
+		"missing": missing,
+	}
+
+	out, err := MarshalWithOptions(data, TOONOptions{Delimiter: "|"})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	expected := "missing: null\n" +
+		"origin:\n" +
+		"  x: 1\n" +
+		"  y: 2\n" +
+		"prices[2|]: 12.50 EUR|0.99 USD\n" +
+		"total: 13.49 EUR"
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out)
+	}
+
+	// Si MarshalTOON falla, o su salida no es TOON, Marshal devuelve el error
+	if out, err := Marshal(map[string]interface{}{"debt": []money{{-5, "EUR"}}}); err == nil || !strings.Contains(err.Error(), "importe negativo") || out != nil {
+		t.Errorf("Expected the MarshalTOON error, got %q, %v", out, err)
+	}
+	if _, err := Marshal(badTOON{}); err == nil || !strings.Contains(err.Error(), "TOON inválido") {
+		t.Errorf("Expected an invalid TOON error, got %v", err)
+	}
+}
+
+// badTOON devuelve un array con menos elementos de los que declara.
+type badTOON struct{}
+
+func (badTOON) MarshalTOON() ([]byte, error) {
+	return []byte("[2]: 1"), nil
+}
+
+func TestUnmarshal(t *testing.T) {
+	input := []byte("users[2]{id,name}:\n  1,Alice\n  2,Bob\ntotal: 2")
+
+	var result struct {
+		Users []testUser `json:"users"`
+		Total int        `json:"total"`
+	}
+	if err := Unmarshal(input, &result); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if result.Total != 2 || len(result.Users) != 2 || result.Users[1].ID != 2 || result.Users[1].Name != "Bob" {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	// Los enteros de más de 53 bits llegan exactos
+	var ids struct {
+		IDs []int64 `toon:"ids"`
+		Max uint64  `toon:"max"`
+	}
+	if err := Unmarshal([]byte("ids[2]: 9007199254740993,-9007199254740993\nmax: 18446744073709551615"), &ids); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if ids.IDs[0] != 9007199254740993 || ids.IDs[1] != -9007199254740993 || ids.Max != 18446744073709551615 {
+		t.Errorf("Expected exact integers, got %+v", ids)
+	}
+
+	var generic interface{}
+	if err := Unmarshal(input, &generic); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	expected := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"id": 1.0, "name": "Alice"},
+			map[string]interface{}{"id": 2.0, "name": "Bob"},
+		},
+		"total": 2.0,
+	}
+	if !reflect.DeepEqual(generic, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, generic)
+	}
+
+	if err := Unmarshal(input, result); err == nil {
+		t.Error("Expected error for a non-pointer")
+	}
+	if err := Unmarshal([]byte("users[3]{id}:\n  1"), &generic); err == nil {
+		t.Error("Expected error for invalid TOON")
+	}
+}
+
+func TestMarshalUnmarshal_RoundTrip(t *testing.T) {
+	type order struct {
+		ID    int64    `json:"id"`
+		Tags  []string `json:"tags"`
+		Total float64  `json:"total"`
+	}
+	orders := []order{{ID: 1, Tags: []string{"a", "b"}, Total: 9.5}, {ID: 2, Tags: []string{}, Total: 0}}
+
+	out, err := Marshal(orders)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var decoded []order
+	if err := Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("Unmarshal error: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(decoded, orders) {
+		t.Errorf("Round-trip mismatch\nTOON:\n%s\nGot: %+v", out, decoded)
+	}
+}
@@ -0,0 +1,182 @@
+package toon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeYAML convierte un documento YAML en la misma estructura genérica que
+// produce json.Unmarshal, para pasarla al encoder TOON:
+//
+//   - Los mappings son objetos. Las claves que no son strings (1, true,
+//     null) se escriben como texto ("1", "true", "null"), así que un
+//     map[interface{}]interface{} acaba como map[string]interface{}.
+//   - Los enteros pasan a json.Number, así que los int64 y uint64 grandes no
+//     pierden precisión; .inf y .nan no existen en JSON y quedan como null.
+//   - Las fechas pasan a string: "2024-05-01" si no tienen hora y RFC 3339
+//     ("2024-05-01T10:30:00Z") si la tienen.
+//   - Los anchors, alias y claves de merge ("<<") se resuelven.
+//   - Con varios documentos ("---") el resultado es un array con uno por
+//     elemento.
+//
+// El orden de las claves no se conserva.
+func DecodeYAML(input string) (interface{}, error) {
+	decoder := yaml.NewDecoder(strings.NewReader(input))
+	var docs []interface{}
+	for {
+		var doc interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		docs = append(docs, yamlValue(doc))
+	}
+
+	switch len(docs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return docs[0], nil
+	}
+	return docs, nil
+}
+
+// yamlValue pasa un valor decodificado por yaml a los tipos de JSON.
+func yamlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[key] = yamlValue(item)
+		}
+		return obj
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[yamlKey(key)] = yamlValue(item)
+		}
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = yamlValue(item)
+		}
+		return arr
+	case int:
+		return json.Number(strconv.Itoa(v))
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10))
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10))
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil
+		}
+	case time.Time:
+		return formatYAMLTime(v)
+	}
+	return value
+}
+
+// yamlKey escribe como texto una clave de mapping que no es un string.
+func yamlKey(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case nil:
+		return "null"
+	case float64:
+		return strconv.FormatFloat(k, 'g', -1, 64)
+	case time.Time:
+		return formatYAMLTime(k)
+	}
+	return fmt.Sprint(key)
+}
+
+// formatYAMLTime escribe una fecha YAML como solo fecha si no tiene hora (así
+// se decodifica "2024-05-01") o en RFC 3339.
+func formatYAMLTime(t time.Time) string {
+	if t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour)) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// EncodeYAML escribe value, con los tipos de DecodeJSON, como documento YAML
+// con indent espacios por nivel. Los json.Number se copian tal cual, así que
+// los enteros grandes no pierden cifras, y los *OrderedMap conservan el
+// orden de sus claves; las de los map se ordenan.
+func EncodeYAML(value interface{}, indent int) (string, error) {
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(indent)
+	if err := enc.Encode(yamlNode(value)); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// yamlNode construye el nodo YAML de un valor JSON.
+func yamlNode(value interface{}) *yaml.Node {
+	scalar := func(tag, text string) *yaml.Node {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: text}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return scalar("!!null", "null")
+	case bool:
+		return scalar("!!bool", strconv.FormatBool(v))
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return scalar("!!float", string(v))
+		}
+		return scalar("!!int", string(v))
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e21 {
+			return scalar("!!int", strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		return scalar("!!float", strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		return scalar("!!str", v)
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+	}
+
+	obj, ok := AsObject(value)
+	if !ok {
+		return scalar("!!str", fmt.Sprint(value))
+	}
+	var order []string
+	if om, ok := value.(*OrderedMap); ok {
+		order = om.Keys
+	} else {
+		for key := range obj {
+			order = append(order, key)
+		}
+		sort.Strings(order)
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range order {
+		node.Content = append(node.Content, scalar("!!str", key), yamlNode(obj[key]))
+	}
+	return node
+}
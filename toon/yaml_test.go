@@ -0,0 +1,68 @@
+package toon
+
+import "testing"
+
+const serversYAML = `title: Inventario
+max_id: 9007199254740993
+ratio: 0.5
+updated: 1979-05-27T07:32:00Z
+since: 1979-05-27
+missing: .nan
+defaults: &defaults
+  enabled: true
+  port: 8000
+codes:
+  200: ok
+  404: not found
+servers:
+  - name: alpha
+    <<: *defaults
+    port: 8001
+  - name: beta
+    <<: *defaults
+    enabled: false
+`
+
+func TestDecodeYAML_Mappings(t *testing.T) {
+	data, err := DecodeYAML(serversYAML)
+	if err != nil {
+		t.Fatalf("DecodeYAML error: %v", err)
+	}
+
+	result := mustEncode(t, NewTOONEncoder(), data)
+
+	expected := "codes:\n" +
+		"  \"200\": ok\n" +
+		"  \"404\": not found\n" +
+		"defaults:\n" +
+		"  enabled: true\n" +
+		"  port: 8000\n" +
+		"max_id: 9007199254740993\n" +
+		"missing: null\n" +
+		"ratio: 0.5\n" +
+		"servers[2]{enabled,name,port}:\n" +
+		"    true,alpha,8001\n" +
+		"    false,beta,8000\n" +
+		"since: \"1979-05-27\"\n" +
+		"title: Inventario\n" +
+		"updated: \"1979-05-27T07:32:00Z\""
+	if result != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, result)
+	}
+}
+
+func TestDecodeYAML_Documents(t *testing.T) {
+	data, err := DecodeYAML("a: 1\n---\na: 2\n")
+	if err != nil {
+		t.Fatalf("DecodeYAML error: %v", err)
+	}
+	if result := mustEncode(t, NewTOONEncoder(), data); result != "[2]{a}:\n  1\n  2" {
+		t.Errorf("Expected one element per document, got:\n%s", result)
+	}
+
+	for _, input := range []string{"a: [1, 2", "a: 1\na: 2", "a:\n\tb: 1"} {
+		if _, err := DecodeYAML(input); err == nil {
+			t.Errorf("Expected error for %q", input)
+		}
+	}
+}